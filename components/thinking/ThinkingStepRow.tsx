@@ -1,8 +1,17 @@
 import React, { memo, useState } from 'react';
 import { Loader2, CheckCircle2, ChevronUp, Info, ExternalLink, Braces, FileText } from 'lucide-react';
-import { ThinkingStep } from '../../types';
+import { ThinkingStep, ToolErrorClass } from '../../types';
 import { PlanLoadingSkeleton } from '../chat/PlanLoadingSkeleton';
 
+const ERROR_CLASS_LABELS: Record<ToolErrorClass, string> = {
+  invalid_args: '参数错误',
+  timeout: '超时',
+  upstream_error: '上游错误',
+  permission_denied: '无权限',
+  not_found: '不存在',
+  internal_error: '内部错误',
+};
+
 interface ThinkingStepRowProps {
   step: ThinkingStep;
   index?: number;
@@ -50,6 +59,11 @@ export const ThinkingStepRow = memo<ThinkingStepRowProps>(({ step, index = 0, to
         <div className="flex items-center justify-between gap-2 mb-2">
           <div className="flex items-center gap-2 flex-wrap">
             <span className="text-sm font-bold text-slate-800">{step.agentName}</span>
+            {isFailed && step.errorClass && (
+              <span className="text-[10px] font-medium text-rose-600 bg-rose-50 border border-rose-100 px-1.5 py-0.5 rounded" title={step.errorClass}>
+                {ERROR_CLASS_LABELS[step.errorClass] ?? step.errorClass}
+              </span>
+            )}
             {step.details && (
               <span className="text-[10px] font-medium text-slate-400 bg-slate-100 px-1.5 py-0.5 rounded flex items-center gap-1">
                 <Braces size={9} />
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"agentic-demo/server/internal/config"
 	"agentic-demo/server/internal/handler"
+	"agentic-demo/server/internal/httptool"
+	"agentic-demo/server/internal/mcp"
+	"agentic-demo/server/internal/openapi"
+	"agentic-demo/server/internal/plugin"
 	"agentic-demo/server/internal/registry"
 	"agentic-demo/server/internal/setup"
 	"agentic-demo/server/internal/store"
@@ -22,13 +31,19 @@ func main() {
 	if err != nil {
 		log.Fatalf("init session store: %v", err)
 	}
+	s.SetVFSLimits(store.VFSLimits{MaxFileBytes: config.VFSMaxFileBytes, MaxTotalBytes: config.VFSMaxTotalBytes})
+	s.SetVFSHistoryLimits(store.VFSHistoryLimits{MaxRevisions: config.VFSHistoryMaxRevisions, MaxBytes: config.VFSHistoryMaxBytes})
 
 	todoStore := store.NewTodoStore(config.DataDir)
 	toolEnableStore, err := store.NewToolEnableStore(config.DataDir)
 	if err != nil {
 		log.Fatalf("init tool enable store: %v", err)
 	}
-	mcpStore, err := store.NewMcpStore(config.DataDir)
+	secrets, err := store.NewSecretBox(config.DataDir, config.SecretKey)
+	if err != nil {
+		log.Fatalf("init secret box: %v", err)
+	}
+	mcpStore, err := store.NewMcpStoreWithSecret(config.DataDir, secrets)
 	if err != nil {
 		log.Fatalf("init mcp store: %v", err)
 	}
@@ -41,10 +56,79 @@ func main() {
 		mcpStatusStore.EnsureEntry(svr.ID)
 	}
 
+	denyCIDRs := config.McpDenyCIDRs
+	if denyCIDRs == nil {
+		denyCIDRs = mcp.DefaultDenyCIDRs
+	}
+	urlPolicy, err := mcp.NewURLPolicy(config.McpURLSchemes, config.McpAllowHosts, config.McpDenyHosts,
+		config.McpAllowCIDRs, denyCIDRs, config.McpAllowCrossOriginEndpoint)
+	if err != nil {
+		log.Fatalf("init mcp url policy: %v", err)
+	}
+	mcp.SetURLPolicy(urlPolicy)
+
 	reg := registry.Global()
 	setup.RegisterBuiltinTools(reg)
+	httpToolStore, err := store.NewHttpToolStore(config.DataDir, secrets)
+	if err != nil {
+		log.Fatalf("init http tool store: %v", err)
+	}
+	for _, name := range httptool.RegisterAll(reg, httpToolStore) {
+		log.Printf("http tool %q skipped: name conflicts with an existing tool", name)
+	}
+	openAPIStore, err := store.NewOpenAPIStore(config.DataDir, secrets)
+	if err != nil {
+		log.Fatalf("init openapi store: %v", err)
+	}
+	for _, spec := range openAPIStore.List() {
+		_, conflicts, err := openapi.Register(reg, spec)
+		if err != nil {
+			log.Printf("openapi spec %q not registered: %v", spec.Title, err)
+		}
+		for _, name := range conflicts {
+			log.Printf("openapi tool %q skipped: name conflicts with an existing tool", name)
+		}
+	}
+
+	plugins := plugin.NewManager(config.PluginDir, reg)
+	for _, st := range plugins.Reload() {
+		if st.Error != "" {
+			log.Printf("plugin %s skipped: %s", st.File, st.Error)
+		}
+	}
 
 	h := handler.NewHandlerWithTools(s, todoStore, reg, toolEnableStore, mcpStore, mcpStatusStore)
+	mcpProcs := mcp.NewProcessManager()
+	h.SetMcpProcessManager(mcpProcs)
+	h.SetHttpToolStore(httpToolStore)
+	h.SetOpenAPIStore(openAPIStore)
+	h.SetPluginManager(plugins)
+	toolLimitStore, err := store.NewToolLimitStore(config.DataDir)
+	if err != nil {
+		log.Fatalf("init tool limit store: %v", err)
+	}
+	h.SetToolLimitStore(toolLimitStore)
+	toolUsageStore, err := store.NewToolUsageStore(config.DataDir)
+	if err != nil {
+		log.Fatalf("init tool usage store: %v", err)
+	}
+	h.SetToolUsageStore(toolUsageStore)
+	toolProfileStore, err := store.NewToolProfileStore(config.DataDir)
+	if err != nil {
+		log.Fatalf("init tool profile store: %v", err)
+	}
+	h.SetToolProfileStore(toolProfileStore)
+	h.SetVFSExportRoot(config.VFSExportRoot)
+	h.StartMcpProcesses()
+	mcpMonitor := mcp.NewMonitor(mcpStore, mcpStatusStore, mcpProcs, config.McpCheckInterval)
+	h.SetMcpMonitor(mcpMonitor)
+	mcpCatalog := mcp.NewCatalog(mcpStore, mcpProcs)
+	mcpMonitor.SetCatalog(mcpCatalog)
+	h.SetMcpCatalog(mcpCatalog)
+	mcp.RegisterResourceTool(reg, mcpCatalog)
+	mcpToolSync := mcp.NewToolSync(mcpStore, mcpStatusStore, mcpProcs, reg)
+	mcpMonitor.SetToolSync(mcpToolSync)
+	h.SetMcpToolSync(mcpToolSync)
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/api/sessions", func(w http.ResponseWriter, r *http.Request) {
@@ -79,6 +163,36 @@ func main() {
 		}
 		h.ListTools(w, r)
 	})
+	mux.HandleFunc("/api/tools/events", h.ToolEvents)
+	mux.HandleFunc("/api/tools/effective", h.GetEffectiveTools)
+	mux.HandleFunc("/api/tool-profiles", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.ListToolProfiles(w, r)
+		case http.MethodPost:
+			h.CreateToolProfile(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/tool-profiles/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/tool-profiles/")
+		if id == "" || strings.Contains(id, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			h.GetToolProfile(w, r, id)
+		case http.MethodPut:
+			h.UpdateToolProfile(w, r, id)
+		case http.MethodDelete:
+			h.DeleteToolProfile(w, r, id)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/mcp", h.McpServe)
 	mux.HandleFunc("/api/tools/", func(w http.ResponseWriter, r *http.Request) {
 		path := strings.TrimPrefix(r.URL.Path, "/api/tools/")
 		parts := strings.Split(path, "/")
@@ -87,6 +201,14 @@ func main() {
 			return
 		}
 		id := parts[0]
+		if len(parts) == 2 && parts[1] == "invoke" {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.InvokeTool(w, r, id)
+			return
+		}
 		switch r.Method {
 		case http.MethodGet:
 			h.GetTool(w, r, id)
@@ -96,6 +218,74 @@ func main() {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/api/http-tools", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.ListHttpTools(w, r)
+		case http.MethodPost:
+			h.CreateHttpTool(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/http-tools/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/http-tools/")
+		if id == "" || strings.Contains(id, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			h.GetHttpTool(w, r, id)
+		case http.MethodPut:
+			h.UpdateHttpTool(w, r, id)
+		case http.MethodDelete:
+			h.DeleteHttpTool(w, r, id)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/openapi/specs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.ListOpenAPISpecs(w, r)
+		case http.MethodPost:
+			h.ImportOpenAPISpec(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/openapi/specs/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/openapi/specs/")
+		if id == "" || strings.Contains(id, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			h.GetOpenAPISpec(w, r, id)
+		case http.MethodPut:
+			h.UpdateOpenAPISpec(w, r, id)
+		case http.MethodDelete:
+			h.DeleteOpenAPISpec(w, r, id)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/plugins", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ListPlugins(w, r)
+	})
+	mux.HandleFunc("/api/plugins/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ReloadPlugins(w, r)
+	})
 	mux.HandleFunc("/api/mcp/servers", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -106,6 +296,20 @@ func main() {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/api/mcp/config/export", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ExportMcpConfig(w, r)
+	})
+	mux.HandleFunc("/api/mcp/config/import", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ImportMcpConfig(w, r)
+	})
 	mux.HandleFunc("/api/mcp/servers/", func(w http.ResponseWriter, r *http.Request) {
 		path := strings.TrimPrefix(r.URL.Path, "/api/mcp/servers/")
 		parts := strings.Split(path, "/")
@@ -119,6 +323,18 @@ func main() {
 			h.CheckMcpServer(w, r, id)
 		case len(parts) == 2 && parts[1] == "status" && r.Method == http.MethodGet:
 			h.GetMcpServerStatus(w, r, id)
+		case len(parts) == 2 && parts[1] == "logs" && r.Method == http.MethodGet:
+			h.GetMcpServerLogs(w, r, id)
+		case len(parts) == 2 && parts[1] == "resources" && r.Method == http.MethodGet:
+			h.ListMcpResources(w, r, id)
+		case len(parts) == 3 && parts[1] == "resources" && parts[2] == "read" && r.Method == http.MethodGet:
+			h.ReadMcpResource(w, r, id)
+		case len(parts) == 3 && parts[1] == "resources" && parts[2] == "import" && r.Method == http.MethodPost:
+			h.ImportMcpResource(w, r, id)
+		case len(parts) == 2 && parts[1] == "prompts" && r.Method == http.MethodGet:
+			h.ListMcpPrompts(w, r, id)
+		case len(parts) >= 3 && parts[1] == "prompts" && r.Method == http.MethodPost:
+			h.GetMcpPrompt(w, r, id, strings.Join(parts[2:], "/"))
 		case len(parts) == 1 && r.Method == http.MethodPut:
 			h.UpdateMcpServer(w, r, id)
 		case len(parts) == 1 && r.Method == http.MethodDelete:
@@ -148,23 +364,49 @@ func main() {
 			h.ClearSessionContent(w, r, id)
 		case len(parts) == 2 && parts[1] == "chunks" && r.Method == http.MethodPost:
 			h.AppendSessionChunks(w, r, id)
+		case len(parts) == 3 && parts[1] == "knowledge" && parts[2] == "ingest" && r.Method == http.MethodPost:
+			h.IngestKnowledge(w, r, id)
+		case len(parts) >= 3 && parts[1] == "knowledge" && parts[2] == "documents":
+			h.KnowledgeDocuments(w, r, id, parts[3:])
+		case len(parts) >= 2 && parts[1] == "vfs":
+			h.SessionVFS(w, r, id, parts[2:])
+		case len(parts) == 2 && parts[1] == "tools" && r.Method == http.MethodGet:
+			h.GetSessionTools(w, r, id)
+		case len(parts) == 2 && parts[1] == "tools" && r.Method == http.MethodPut:
+			h.UpdateSessionTools(w, r, id)
 		default:
 			http.NotFound(w, r)
 		}
 	})
 
 	addr := ":" + config.Port
+	srv := &http.Server{Addr: addr, Handler: corsMiddleware(mux)}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go mcpMonitor.Run(ctx)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
 	log.Printf("Server listening on %s", addr)
-	if err := http.ListenAndServe(addr, corsMiddleware(mux)); err != nil {
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		mcpToolSync.Close()
+		mcpProcs.StopAll()
 		log.Fatalf("server: %v", err)
 	}
+	// 关闭时断开 MCP 长连接并停止所有 stdio 子进程
+	mcpToolSync.Close()
+	mcpProcs.StopAll()
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Mcp-Session-Id, Mcp-Protocol-Version, X-Session-Id")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
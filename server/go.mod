@@ -2,7 +2,10 @@ module agentic-demo/server
 
 go 1.24
 
-require google.golang.org/genai v1.47.0
+require (
+	golang.org/x/net v0.38.0
+	google.golang.org/genai v1.47.0
+)
 
 require (
 	cloud.google.com/go v0.116.0 // indirect
@@ -15,7 +18,6 @@ require (
 	github.com/gorilla/websocket v1.5.3 // indirect
 	go.opencensus.io v0.24.0 // indirect
 	golang.org/x/crypto v0.36.0 // indirect
-	golang.org/x/net v0.38.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240903143218-8af14fe29dc1 // indirect
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"slices"
 	"strings"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"agentic-demo/server/internal/registry"
 	"agentic-demo/server/internal/registry/builtin"
 	"agentic-demo/server/internal/store"
+	"agentic-demo/server/internal/toolset"
 
 	"google.golang.org/genai"
 )
@@ -30,6 +32,9 @@ type Callbacks struct {
 	OnFilesWritten   func(paths []string)
 	OnPlanStepUpdate func(msgID, stepID, status string)
 	OnToast          func(msg string)
+	// OnToolProgress 转发执行器经 OnProgress 报告的进度；OnFileProgress 转发 write_file 的写入进度
+	OnToolProgress func(callID, tool, message string)
+	OnFileProgress func(callID string, p registry.FileProgress)
 }
 
 type SupervisorDeps struct {
@@ -37,6 +42,8 @@ type SupervisorDeps struct {
 	TodoStore    *store.TodoStore
 	Registry     *registry.Registry
 	ToolEnable   *store.ToolEnableStore // optional: filter tools by enabled state
+	ToolProfiles *store.ToolProfileStore // optional: named tool profiles bound to mode/industry
+	McpResources []prompts.McpResourceRef // optional: MCP resources advertised in the system prompt
 }
 
 func RunSupervisor(
@@ -92,15 +99,24 @@ func RunSupervisor(
 		Industry:        opts.Industry,
 		Mode:            opts.Mode,
 		HasMcpConnected: false,
+		McpResources:    deps.McpResources,
 	})
 
-	var toolDefs []*genai.FunctionDeclaration
+	// 全局启用状态 → 工具配置 → 会话覆盖
+	in := toolset.Input{
+		IDs:      deps.Registry.GetIDs(),
+		Profiles: deps.ToolProfiles,
+		Session:  session.Tools,
+		Mode:     opts.Mode,
+		Industry: opts.Industry,
+	}
 	if deps.ToolEnable != nil {
-		toolDefs = deps.Registry.GetDefinitionsEnabled(deps.ToolEnable.GetEnabled)
-	} else {
-		toolDefs = deps.Registry.GetDefinitions()
+		in.Global = deps.ToolEnable.GetEnabled
 	}
+	tools := toolset.Resolve(in)
+	toolDefs := deps.Registry.GetDefinitionsEnabled(tools.Available)
 	blockingIDs := deps.Registry.GetBlockingIDs()
+	planApproved := params != nil && params.IsApprovalConfirmed
 
 	userMsgID := fmt.Sprintf("u-%d", time.Now().UnixMilli())
 	assistantMsgID := fmt.Sprintf("agent-%d", time.Now().UnixMilli())
@@ -242,6 +258,8 @@ func RunSupervisor(
 			TodoStore:    deps.TodoStore,
 			GeminiClient: client,
 			OnProgress:   nil,
+			Caller:       "agent",
+			TurnID:       assistantMsgID,
 		}
 
 		blockingCalls := []struct {
@@ -276,7 +294,8 @@ func RunSupervisor(
 				continue
 			}
 
-			if fc.Name == "generate_chart" {
+			denied := toolDenied(tools, fc.Name, planApproved)
+			if fc.Name == "generate_chart" && denied == nil {
 				var chartArgs map[string]any
 				_ = json.Unmarshal(fc.Args, &chartArgs)
 				if cb.OnChartData != nil {
@@ -289,17 +308,35 @@ func RunSupervisor(
 				continue
 			}
 
-			result, execErr := deps.Registry.Execute(execReq, fc.Name, fc.Args)
+			var toolLog strings.Builder
+			callReq := execReq
+			callReq.CallID = fc.Id
+			callReq.OnLog = func(s string) { toolLog.WriteString(s) }
+			if cb.OnToolProgress != nil {
+				callReq.OnProgress = func(msg string) { cb.OnToolProgress(fc.Id, fc.Name, msg) }
+			}
+			if cb.OnFileProgress != nil {
+				callReq.OnFileProgress = func(p registry.FileProgress) { cb.OnFileProgress(fc.Id, p) }
+			}
+			var result interface{}
+			execErr := denied
+			if execErr == nil {
+				result, execErr = deps.Registry.Execute(callReq, fc.Name, fc.Args)
+			}
 			stepID := "call-" + fc.Id
 			label := toolLabel(fc.Name)
 
 			if execErr != nil {
+				errClass := registry.ErrorClassOf(execErr, deps.Registry.GetSource(fc.Name))
+				details := withToolLog(execErr.Error(), toolLog.String())
+				step := thinkingStep(stepID, fc.Name, label, "Failed: "+execErr.Error(), "failed", details)
+				step["errorClass"] = errClass
 				if cb.OnThinking != nil {
-					cb.OnThinking(thinkingStep(stepID, fc.Name, label, "Failed: "+execErr.Error(), "failed", execErr.Error()))
+					cb.OnThinking(step)
 				}
-				thinkingSteps = appendOrUpdate(thinkingSteps, stepID, thinkingStep(stepID, fc.Name, label, "Failed: "+execErr.Error(), "failed", execErr.Error()))
+				thinkingSteps = appendOrUpdate(thinkingSteps, stepID, step)
 				responseParts = append(responseParts, &genai.Part{
-					FunctionResponse: &genai.FunctionResponse{Name: fc.Name, Id: fc.Id, Response: map[string]any{"error": execErr.Error()}},
+					FunctionResponse: &genai.FunctionResponse{Name: fc.Name, Id: fc.Id, Response: map[string]any{"error": execErr.Error(), "errorClass": errClass}},
 				})
 				continue
 			}
@@ -327,10 +364,12 @@ func RunSupervisor(
 				}
 			}
 
-			if fc.Name == "write_file" {
+			if fc.Name == "write_file" || fc.Name == "edit_file" {
 				if m, ok := result.(map[string]interface{}); ok {
 					if path, ok := m["path"].(string); ok {
-						writtenFilePaths = append(writtenFilePaths, path)
+						if !slices.Contains(writtenFilePaths, path) {
+							writtenFilePaths = append(writtenFilePaths, path)
+						}
 						if cb.OnFilesWritten != nil {
 							cb.OnFilesWritten(writtenFilePaths)
 						}
@@ -355,10 +394,11 @@ func RunSupervisor(
 						}
 					}
 				}
+				details := withToolLog(fmt.Sprintf("%v", result), toolLog.String())
 				if cb.OnThinking != nil {
-					cb.OnThinking(thinkingStep(stepID, fc.Name, label, doneContent, "completed", fmt.Sprintf("%v", result)))
+					cb.OnThinking(thinkingStep(stepID, fc.Name, label, doneContent, "completed", details))
 				}
-				thinkingSteps = appendOrUpdate(thinkingSteps, stepID, thinkingStep(stepID, fc.Name, label, doneContent, "completed", fmt.Sprintf("%v", result)))
+				thinkingSteps = appendOrUpdate(thinkingSteps, stepID, thinkingStep(stepID, fc.Name, label, doneContent, "completed", details))
 			}
 
 			responseParts = append(responseParts, &genai.Part{
@@ -547,6 +587,15 @@ func thinkingStep(id, agentID, agentName, content, status, details string) map[s
 	return m
 }
 
+// withToolLog 把工具的诊断输出（如插件 stderr）附加到思考步骤详情之后
+func withToolLog(details, log string) string {
+	log = strings.TrimRight(log, "\n")
+	if log == "" {
+		return details
+	}
+	return details + "\n\n[stderr]\n" + log
+}
+
 func appendOrUpdate(steps []map[string]any, id string, step map[string]any) []map[string]any {
 	for i := range steps {
 		if sid, _ := steps[i]["id"].(string); sid == id {
@@ -583,3 +632,18 @@ func sliceAny(in []any) []any {
 	copy(out, in)
 	return out
 }
+
+// toolDenied 模型调用了当前会话不可用的工具，或需要计划审批而尚未批准时返回 permission_denied
+func toolDenied(tools *toolset.Result, name string, planApproved bool) error {
+	t, ok := tools.Lookup(name)
+	if !ok {
+		return nil // 未注册的工具由 registry 返回 not_found
+	}
+	if !t.Available {
+		return registry.NewToolError(registry.ErrPermissionDenied, fmt.Errorf("工具 %s 在当前会话不可用：%s", name, t.Reason))
+	}
+	if t.Approval == store.ApprovalPlan && !planApproved {
+		return registry.NewToolError(registry.ErrPermissionDenied, fmt.Errorf("工具 %s 需要在已批准的计划中执行，请先调用 propose_plan", name))
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package bm25
+
+import (
+	"math"
+	"sort"
+)
+
+// BM25 参数
+const (
+	K1 = 1.2
+	B  = 0.75
+)
+
+type posting struct {
+	doc int
+	tf  int
+}
+
+// Index 文档按加入顺序编号（从 0 开始），只支持追加；非并发安全，由调用方加锁
+type Index struct {
+	postings map[string][]posting
+	lengths  []int
+	total    int
+}
+
+// Hit 检索结果：文档编号、BM25 分数与命中的查询词项
+type Hit struct {
+	Doc   int
+	Score float64
+	Terms []string
+}
+
+func New() *Index {
+	return &Index{postings: map[string][]posting{}}
+}
+
+// Len 已索引的文档数
+func (ix *Index) Len() int {
+	return len(ix.lengths)
+}
+
+// Add 索引一篇文档，返回其编号
+func (ix *Index) Add(text string) int {
+	doc := len(ix.lengths)
+	terms := Terms(text)
+	tf := map[string]int{}
+	for _, t := range terms {
+		tf[t]++
+	}
+	for t, n := range tf {
+		ix.postings[t] = append(ix.postings[t], posting{doc: doc, tf: n})
+	}
+	ix.lengths = append(ix.lengths, len(terms))
+	ix.total += len(terms)
+	return doc
+}
+
+// Search 按 BM25 返回得分最高的 limit 篇文档；limit <= 0 时返回全部命中
+func (ix *Index) Search(query string, limit int) []Hit {
+	n := len(ix.lengths)
+	if n == 0 {
+		return nil
+	}
+	avg := float64(ix.total) / float64(n)
+	if avg == 0 {
+		avg = 1
+	}
+	seen := map[string]bool{}
+	hits := map[int]*Hit{}
+	for _, t := range QueryTerms(query) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		list := ix.postings[t]
+		if len(list) == 0 {
+			continue
+		}
+		df := float64(len(list))
+		idf := math.Log(1 + (float64(n)-df+0.5)/(df+0.5))
+		for _, p := range list {
+			tf := float64(p.tf)
+			norm := tf * (K1 + 1) / (tf + K1*(1-B+B*float64(ix.lengths[p.doc])/avg))
+			h := hits[p.doc]
+			if h == nil {
+				h = &Hit{Doc: p.doc}
+				hits[p.doc] = h
+			}
+			h.Score += idf * norm
+			h.Terms = append(h.Terms, t)
+		}
+	}
+	out := make([]Hit, 0, len(hits))
+	for _, h := range hits {
+		out = append(out, *h)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Doc < out[j].Doc
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
@@ -0,0 +1,74 @@
+package bm25
+
+import "strings"
+
+// 片段中命中词项的标记
+const (
+	MarkOpen  = "**"
+	MarkClose = "**"
+)
+
+// Snippet 截取 text 中命中词项最密集、不超过 maxRunes 个字符的片段，命中处用 MarkOpen/MarkClose 包围（相邻或重叠的命中合并）；
+// 截断处加省略号，没有命中时返回开头部分
+func Snippet(text string, terms []string, maxRunes int) string {
+	rs := []rune(text)
+	want := map[string]bool{}
+	for _, t := range terms {
+		want[t] = true
+	}
+	var spans [][2]int
+	for _, tok := range Tokenize(text) {
+		if !want[tok.Term] {
+			continue
+		}
+		if k := len(spans) - 1; k >= 0 && tok.Start <= spans[k][1] {
+			spans[k][1] = max(spans[k][1], tok.End)
+			continue
+		}
+		spans = append(spans, [2]int{tok.Start, tok.End})
+	}
+	start, end := 0, len(rs)
+	if len(rs) > maxRunes {
+		end = maxRunes
+		if len(spans) > 0 {
+			// 以每个命中为窗口起点（前留少量上下文），取覆盖命中最多的窗口
+			best := -1
+			for i, sp := range spans {
+				s := max(sp[0]-maxRunes/8, 0)
+				count := 0
+				for _, o := range spans[i:] {
+					if o[1] > s+maxRunes {
+						break
+					}
+					count++
+				}
+				if count > best {
+					best, start = count, s
+				}
+			}
+			if start+maxRunes > len(rs) {
+				start = max(len(rs)-maxRunes, 0)
+			}
+			end = start + maxRunes
+		}
+	}
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, sp := range spans {
+		s, e := max(sp[0], start), min(sp[1], end)
+		if s >= e {
+			continue
+		}
+		b.WriteString(string(rs[pos:s]))
+		b.WriteString(MarkOpen + string(rs[s:e]) + MarkClose)
+		pos = e
+	}
+	b.WriteString(string(rs[pos:end]))
+	if end < len(rs) {
+		b.WriteString("…")
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,81 @@
+// Package bm25 内存倒排索引与 BM25 打分。分词不依赖词典：拉丁字母与数字按词切分，中日韩文字按单字与相邻二元组（bigram）切分。
+// 查询时连续多个字只取二元组，单独的一个字（如「税」「A股」中的「股」）匹配文档中的单字
+package bm25
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Token 词项及其在原文中的字符（rune）区间 [Start, End)
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// Tokenize 把文本切分为小写词项：连续的字母数字为一个词；中日韩文字输出每个字及相邻二元组，按起始位置排列
+func Tokenize(s string) []Token {
+	return tokenize(s, true)
+}
+
+// tokenize unigrams 为 false 时连续多个中日韩文字只输出二元组
+func tokenize(s string, unigrams bool) []Token {
+	var out []Token
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case isCJK(r):
+			j := i
+			for j < len(rs) && isCJK(rs[j]) {
+				j++
+			}
+			for k := i; k < j; k++ {
+				if unigrams || j-i == 1 {
+					out = append(out, Token{Term: string(rs[k]), Start: k, End: k + 1})
+				}
+				if k+1 < j {
+					out = append(out, Token{Term: string(rs[k : k+2]), Start: k, End: k + 2})
+				}
+			}
+			i = j
+		case isWord(r):
+			j := i
+			for j < len(rs) && isWord(rs[j]) && !isCJK(rs[j]) {
+				j++
+			}
+			out = append(out, Token{Term: strings.ToLower(string(rs[i:j])), Start: i, End: j})
+			i = j
+		default:
+			i++
+		}
+	}
+	return out
+}
+
+// Terms 文本的词项（可重复）
+func Terms(s string) []string {
+	return terms(Tokenize(s))
+}
+
+// QueryTerms 查询的词项：连续多个中日韩文字只取二元组，避免常见单字稀释相关性
+func QueryTerms(s string) []string {
+	return terms(tokenize(s, false))
+}
+
+func terms(toks []Token) []string {
+	out := make([]string, len(toks))
+	for i, t := range toks {
+		out[i] = t.Term
+	}
+	return out
+}
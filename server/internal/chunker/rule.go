@@ -0,0 +1,261 @@
+// Package chunker 把长文本切分为知识块：按窗口调用模型做语义切分，失败或离线时退回基于规则的切分
+package chunker
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"agentic-demo/server/internal/store"
+)
+
+// 块长度（按字符计）与 SemanticChunkerPrompt 中的建议一致
+const (
+	MinChunkRunes = 100
+	MaxChunkRunes = 500
+	// WindowRunes 单次送入模型的文本上限，超出的输入先在段落边界切成多个窗口
+	WindowRunes = 6000
+	// maxSummaryRunes 规则切分生成的摘要长度上限
+	maxSummaryRunes = 60
+)
+
+// 规则切分记录的切分理由（块结束处的边界）
+const (
+	ReasonHeading   = "下一节标题"
+	ReasonParagraph = "段落边界"
+	ReasonSentence  = "句子边界"
+	ReasonLength    = "长度上限"
+	ReasonEnd       = "文本结束"
+)
+
+// headingLine Markdown 标题、「第X章/节」与「一、」式的中文标题
+var headingLine = regexp.MustCompile(`^(#{1,6}\s+\S|第[一二三四五六七八九十百零〇\d]+[章节部分篇条](\s|$)|[一二三四五六七八九十]+、)`)
+
+type block struct {
+	text    string
+	heading bool
+}
+
+func runeLen(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+func isHeading(line string) bool {
+	if strings.HasPrefix(line, "#") {
+		return headingLine.MatchString(line)
+	}
+	return runeLen(line) <= 40 && headingLine.MatchString(line)
+}
+
+// blocks 按空行与标题行把文本切分为段落
+func blocks(text string) []block {
+	var out []block
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			out = append(out, block{text: strings.TrimSpace(strings.Join(para, "\n"))})
+			para = nil
+		}
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		t := strings.TrimSpace(line)
+		switch {
+		case t == "":
+			flush()
+		case isHeading(t):
+			flush()
+			out = append(out, block{text: t, heading: true})
+		default:
+			para = append(para, strings.TrimRightFunc(line, unicode.IsSpace))
+		}
+	}
+	flush()
+	return out
+}
+
+func isTerminator(r rune) bool {
+	switch r {
+	case '。', '！', '？', '；', '…', '!', '?', ';':
+		return true
+	}
+	return false
+}
+
+func isCloser(r rune) bool {
+	switch r {
+	case '”', '’', '」', '』', '）', ')', '"', '\'', ']', '】':
+		return true
+	}
+	return false
+}
+
+// sentences 在中英文句末标点处切分，句号后须跟空白（避免切开小数与缩写中的点），保留原有字符
+func sentences(s string) []string {
+	rs := []rune(s)
+	var out []string
+	start := 0
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		end := isTerminator(r) || r == '\n' ||
+			(r == '.' && (i+1 == len(rs) || unicode.IsSpace(rs[i+1]) || isCloser(rs[i+1])))
+		if !end {
+			continue
+		}
+		for i+1 < len(rs) && (isCloser(rs[i+1]) || isTerminator(rs[i+1])) {
+			i++
+		}
+		for i+1 < len(rs) && rs[i+1] == ' ' {
+			i++
+		}
+		out = append(out, string(rs[start:i+1]))
+		start = i + 1
+	}
+	if start < len(rs) {
+		out = append(out, string(rs[start:]))
+	}
+	return out
+}
+
+// splitLong 把超长段落按句子打包为片段，第一个片段尽量不超过 first（首句放不下时除外）、其余不超过 max，
+// 单句超过 max 时硬切；返回片段及其结束处的边界类型
+func splitLong(s string, first, max int) ([]string, []string) {
+	var pieces, reasons []string
+	var cur strings.Builder
+	n, limit := 0, first
+	flush := func(reason string) {
+		if t := strings.TrimSpace(cur.String()); t != "" {
+			pieces = append(pieces, t)
+			reasons = append(reasons, reason)
+			limit = max
+		}
+		cur.Reset()
+		n = 0
+	}
+	for _, sent := range sentences(s) {
+		// 每句只转换一次，硬切时在 rune 切片上前移，整体为线性
+		rs := []rune(sent)
+		if n == 0 && len(rs) > limit {
+			limit = max
+		}
+		if len(rs) > limit {
+			flush(ReasonSentence)
+			for len(rs) > limit {
+				cur.WriteString(string(rs[:limit]))
+				rs = rs[limit:]
+				flush(ReasonLength)
+			}
+		}
+		if n > 0 && n+len(rs) > limit {
+			flush(ReasonSentence)
+		}
+		cur.WriteString(string(rs))
+		n += len(rs)
+	}
+	flush(ReasonParagraph)
+	return pieces, reasons
+}
+
+// Rule 基于规则切分：标题开启新块，段落合并到接近 MaxChunkRunes，超长段落在句子边界切开
+func Rule(text string) []store.KnowledgeChunk {
+	var chunks []store.KnowledgeChunk
+	var cur []string
+	curLen, onlyHeadings := 0, false
+	emit := func(reason string) {
+		if curLen == 0 {
+			return
+		}
+		content := strings.Join(cur, "\n\n")
+		chunks = append(chunks, store.KnowledgeChunk{Content: content, Summary: summarize(content), BoundaryReason: reason})
+		cur, curLen, onlyHeadings = nil, 0, false
+	}
+	// 块内段落以空行连接，curLen 计入分隔符
+	add := func(s string) {
+		if curLen > 0 {
+			curLen += 2
+		}
+		cur = append(cur, s)
+		curLen += runeLen(s)
+	}
+	for _, b := range blocks(text) {
+		n := runeLen(b.text)
+		switch {
+		case b.heading:
+			// 连续的标题（如章与节）合并到同一块
+			if !onlyHeadings {
+				emit(ReasonHeading)
+			}
+			add(b.text)
+			onlyHeadings = true
+		case n > MaxChunkRunes:
+			if curLen > 0 && !onlyHeadings {
+				emit(ReasonParagraph)
+			}
+			// 第一个片段与前面的标题同块，扣除标题所占长度
+			first := MaxChunkRunes
+			if curLen > 0 {
+				first = max(MaxChunkRunes-curLen-2, MinChunkRunes)
+			}
+			pieces, reasons := splitLong(b.text, first, MaxChunkRunes)
+			if curLen > 0 && curLen+2+runeLen(pieces[0]) > MaxChunkRunes {
+				emit(ReasonParagraph)
+			}
+			for i, p := range pieces {
+				add(p)
+				onlyHeadings = false
+				if i < len(pieces)-1 {
+					emit(reasons[i])
+				}
+			}
+		default:
+			if curLen > 0 && !onlyHeadings && curLen+2+n > MaxChunkRunes {
+				emit(ReasonParagraph)
+			}
+			add(b.text)
+			onlyHeadings = false
+		}
+	}
+	emit(ReasonEnd)
+	return chunks
+}
+
+// summarize 取块的标题或第一句作为摘要
+func summarize(content string) string {
+	first := strings.TrimSpace(strings.SplitN(content, "\n", 2)[0])
+	if isHeading(first) {
+		return strings.TrimSpace(strings.TrimLeft(first, "#"))
+	}
+	if s := sentences(first); len(s) > 0 {
+		first = strings.TrimSpace(s[0])
+	}
+	if rs := []rune(first); len(rs) > maxSummaryRunes {
+		return string(rs[:maxSummaryRunes]) + "…"
+	}
+	return first
+}
+
+// Windows 把输入在段落边界打包为不超过 max 字符的窗口，单个段落超长时按句子切开
+func Windows(text string, max int) []string {
+	var out []string
+	var cur []string
+	n := 0
+	for _, b := range blocks(text) {
+		parts := []string{b.text}
+		if runeLen(b.text) > max {
+			parts, _ = splitLong(b.text, max, max)
+		}
+		for _, p := range parts {
+			l := runeLen(p)
+			if n > 0 && n+l+2 > max {
+				out = append(out, strings.Join(cur, "\n\n"))
+				cur, n = nil, 0
+			}
+			cur = append(cur, p)
+			n += l + 2
+		}
+	}
+	if len(cur) > 0 {
+		out = append(out, strings.Join(cur, "\n\n"))
+	}
+	return out
+}
@@ -0,0 +1,164 @@
+package chunker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"agentic-demo/server/internal/prompts"
+	"agentic-demo/server/internal/store"
+
+	"google.golang.org/genai"
+)
+
+// Model 语义切分使用的模型
+const Model = "gemini-2.0-flash"
+
+// minCoverage 模型返回的块须覆盖窗口内容的比例（按去空白后的字符数），不足时视为改写或遗漏
+const minCoverage = 0.8
+
+// 切分方式
+const (
+	// ModeAuto 配置了模型时按语义切分，否则按规则切分
+	ModeAuto     = "auto"
+	ModeSemantic = "semantic"
+	ModeRule     = "rule"
+)
+
+var ErrInvalidChunks = errors.New("invalid semantic chunks")
+
+var chunkSchema = &genai.Schema{
+	Type: genai.TypeArray,
+	Items: &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"content":        {Type: genai.TypeString},
+			"summary":        {Type: genai.TypeString},
+			"boundaryReason": {Type: genai.TypeString},
+		},
+		Required: []string{"content", "summary", "boundaryReason"},
+	},
+}
+
+// Semantic 用模型切分单个窗口，并校验结果是原文的切分
+func Semantic(ctx context.Context, client *genai.Client, window string) ([]store.KnowledgeChunk, error) {
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: prompts.SemanticChunkerPrompt(window)}}},
+	}
+	cfg := &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   chunkSchema,
+	}
+	resp, err := client.Models.GenerateContent(ctx, Model, contents, cfg)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []store.KnowledgeChunk
+	if err := json.Unmarshal([]byte(resp.Text()), &chunks); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChunks, err)
+	}
+	return validate(window, chunks)
+}
+
+func compact(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+// validate 每块须为窗口原文的片段（忽略空白差异）、不能过长、互不重叠，且合起来覆盖窗口的大部分内容；
+// 覆盖率按各块在原文中实际占据的位置计算，重复或重叠的块视为无效
+func validate(window string, chunks []store.KnowledgeChunk) ([]store.KnowledgeChunk, error) {
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%w: no chunks", ErrInvalidChunks)
+	}
+	src := compact(window)
+	used := make([]bool, len(src)) // 已被前面的块占据的字节位置
+	covered := 0
+	out := make([]store.KnowledgeChunk, 0, len(chunks))
+	for i, c := range chunks {
+		c.Content = strings.TrimSpace(c.Content)
+		body := compact(c.Content)
+		switch {
+		case body == "":
+			return nil, fmt.Errorf("%w: chunk %d is empty", ErrInvalidChunks, i+1)
+		case runeLen(c.Content) > 3*MaxChunkRunes:
+			return nil, fmt.Errorf("%w: chunk %d exceeds %d characters", ErrInvalidChunks, i+1, 3*MaxChunkRunes)
+		case !strings.Contains(src, body):
+			return nil, fmt.Errorf("%w: chunk %d is not part of the source text", ErrInvalidChunks, i+1)
+		}
+		pos := freeOccurrence(src, body, used)
+		if pos < 0 {
+			return nil, fmt.Errorf("%w: chunk %d duplicates or overlaps an earlier chunk", ErrInvalidChunks, i+1)
+		}
+		for j := pos; j < pos+len(body); j++ {
+			used[j] = true
+		}
+		covered += runeLen(body)
+		if strings.TrimSpace(c.Summary) == "" {
+			c.Summary = summarize(c.Content)
+		}
+		if strings.TrimSpace(c.BoundaryReason) == "" {
+			c.BoundaryReason = "语义边界"
+		}
+		out = append(out, c)
+	}
+	if total := runeLen(src); total > 0 && float64(covered) < minCoverage*float64(total) {
+		return nil, fmt.Errorf("%w: chunks cover %d of %d characters", ErrInvalidChunks, covered, total)
+	}
+	return out, nil
+}
+
+// freeOccurrence 返回 body 在 src 中第一个未与已占据位置重叠的出现位置，没有时返回 -1
+func freeOccurrence(src, body string, used []bool) int {
+	for from := 0; from+len(body) <= len(src); {
+		i := strings.Index(src[from:], body)
+		if i < 0 {
+			return -1
+		}
+		pos := from + i
+		overlap := false
+		for j := pos; j < pos+len(body); j++ {
+			if used[j] {
+				overlap = true
+				break
+			}
+		}
+		if !overlap {
+			return pos
+		}
+		_, size := utf8.DecodeRuneInString(src[pos:])
+		from = pos + size
+	}
+	return -1
+}
+
+// Stats 一次导入的切分情况
+type Stats struct {
+	Windows         int      `json:"windows"`
+	SemanticWindows int      `json:"semanticWindows"`
+	RuleWindows     int      `json:"ruleWindows"`
+	Errors          []string `json:"errors,omitempty"`
+}
+
+// Split 把文本切成窗口后逐个切分：client 非 nil 且 mode 不是 rule 时先用模型，失败的窗口退回规则切分并记录原因
+func Split(ctx context.Context, client *genai.Client, text, mode string) ([]store.KnowledgeChunk, Stats) {
+	var all []store.KnowledgeChunk
+	var st Stats
+	for i, w := range Windows(text, WindowRunes) {
+		st.Windows++
+		if client != nil && mode != ModeRule {
+			chunks, err := Semantic(ctx, client, w)
+			if err == nil {
+				all = append(all, chunks...)
+				st.SemanticWindows++
+				continue
+			}
+			st.Errors = append(st.Errors, fmt.Sprintf("window %d: %v", i+1, err))
+		}
+		all = append(all, Rule(w)...)
+		st.RuleWindows++
+	}
+	return all, st
+}
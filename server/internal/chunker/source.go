@@ -0,0 +1,124 @@
+package chunker
+
+import (
+	"strings"
+	"unicode"
+
+	"agentic-demo/server/internal/store"
+)
+
+type heading struct {
+	offset int
+	level  int
+	title  string
+}
+
+// headingLevel Markdown 标题按 # 数；「第X章/部分/篇」为 1 级、「第X节」为 2 级、「第X条」与「一、」为 3 级
+func headingLevel(line string) int {
+	if strings.HasPrefix(line, "#") {
+		return len(line) - len(strings.TrimLeft(line, "#"))
+	}
+	if strings.HasPrefix(line, "第") {
+		switch {
+		case strings.Contains(line, "节"):
+			return 2
+		case strings.Contains(line, "条"):
+			return 3
+		}
+		return 1
+	}
+	return 3
+}
+
+// headings 文本中的标题及其字符偏移
+func headings(text string) []heading {
+	var out []heading
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if t := strings.TrimSpace(line); t != "" && isHeading(t) {
+			lead := runeLen(line) - runeLen(strings.TrimLeftFunc(line, unicode.IsSpace))
+			out = append(out, heading{
+				offset: offset + lead,
+				level:  headingLevel(t),
+				title:  strings.TrimSpace(strings.TrimLeft(t, "#")),
+			})
+		}
+		offset += runeLen(line)
+	}
+	return out
+}
+
+// locator 忽略空白在原文中定位块：块内容（去空白后）须依次出现在原文（去空白后）中
+type locator struct {
+	compact string
+	// runeAt compact 中每个字节所属字符在原文中的字符偏移
+	runeAt []int
+	cursor int
+}
+
+func newLocator(text string) *locator {
+	var b strings.Builder
+	var runeAt []int
+	i := 0
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			n := b.Len()
+			b.WriteRune(r)
+			for ; n < b.Len(); n++ {
+				runeAt = append(runeAt, i)
+			}
+		}
+		i++
+	}
+	return &locator{compact: b.String(), runeAt: runeAt}
+}
+
+// find 返回块的起止字符偏移，先从上一块之后查找，找不到再从头查找
+func (l *locator) find(content string) (int, int, bool) {
+	c := compact(content)
+	if c == "" {
+		return -1, -1, false
+	}
+	idx := strings.Index(l.compact[l.cursor:], c)
+	if idx >= 0 {
+		idx += l.cursor
+	} else if idx = strings.Index(l.compact, c); idx < 0 {
+		return -1, -1, false
+	}
+	end := idx + len(c)
+	l.cursor = end
+	return l.runeAt[idx], l.runeAt[end-1] + 1, true
+}
+
+// Annotate 为块标注来源文档、所在章节路径与在 text 中的字符偏移
+func Annotate(text string, chunks []store.KnowledgeChunk, docID, name string) {
+	hs := headings(text)
+	loc := newLocator(text)
+	for i := range chunks {
+		start, end, ok := loc.find(chunks[i].Content)
+		src := &store.ChunkSource{DocumentID: docID, Document: name, Start: start, End: end}
+		if ok {
+			src.Section = sectionAt(hs, start)
+		}
+		chunks[i].Source = src
+	}
+}
+
+// sectionAt 位于 offset 处（含从该处开始的标题）的章节路径
+func sectionAt(hs []heading, offset int) []string {
+	var stack []heading
+	for _, h := range hs {
+		if h.offset > offset {
+			break
+		}
+		for len(stack) > 0 && stack[len(stack)-1].level >= h.level {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, h)
+	}
+	var path []string
+	for _, h := range stack {
+		path = append(path, h.title)
+	}
+	return path
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
@@ -10,6 +13,36 @@ var (
 	GeminiAPIKey string
 	DataDir      string
 	SessionsDir  string
+	// McpCheckInterval MCP 后台健康检查间隔，0 表示关闭后台检查
+	McpCheckInterval time.Duration
+	// SecretKey 加密落盘敏感字段的口令，为空时使用 DataDir/secret.key
+	SecretKey string
+
+	// 出站 MCP 请求的 URL 策略，见 mcp.URLPolicy
+	McpURLSchemes []string
+	McpAllowHosts []string
+	McpDenyHosts  []string
+	McpAllowCIDRs []string
+	// McpDenyCIDRs 为 nil 时使用内置默认禁止网段；设置 MCP_DENY_CIDRS=none 可清空
+	McpDenyCIDRs                []string
+	McpAllowCrossOriginEndpoint bool
+	// OpenAPIDir 允许按本地路径导入 OpenAPI 文档的目录
+	OpenAPIDir string
+	// ToolTimeout、ToolMaxResultBytes 工具执行的默认超时与结果大小上限，可按工具单独覆盖；0 表示不限制
+	ToolTimeout        time.Duration
+	ToolMaxResultBytes int
+	// PluginDir 外部命令插件的清单目录
+	PluginDir string
+	// VFSMaxFileBytes、VFSMaxTotalBytes 经 VFS 接口写入时单文件与单会话的大小上限；0 表示不限制
+	VFSMaxFileBytes  int
+	VFSMaxTotalBytes int
+	// VFSHistoryMaxRevisions、VFSHistoryMaxBytes 文件版本历史的保留上限：每个文件的版本数与单会话历史总字节数
+	VFSHistoryMaxRevisions int
+	VFSHistoryMaxBytes     int
+	// VFSExportRoot 会话 VFS 导出到磁盘的根目录，每次导出写入其下的一个子目录
+	VFSExportRoot string
+	// McpServerToken 对外 MCP 服务（/mcp）的 Bearer 令牌，为空时仅允许本机来源
+	McpServerToken string
 )
 
 func Load() {
@@ -24,6 +57,36 @@ func Load() {
 	}
 	DataDir = getEnv("DATA_DIR", filepath.Join(base, ".agent"))
 	SessionsDir = filepath.Join(DataDir, "sessions")
+	McpCheckInterval = getDuration("MCP_CHECK_INTERVAL", time.Minute)
+	SecretKey = os.Getenv("AGENT_SECRET_KEY")
+
+	McpURLSchemes = getList("MCP_URL_SCHEMES")
+	if len(McpURLSchemes) == 0 {
+		McpURLSchemes = []string{"http", "https"}
+	}
+	McpAllowHosts = getList("MCP_ALLOW_HOSTS")
+	McpDenyHosts = getList("MCP_DENY_HOSTS")
+	McpAllowCIDRs = getList("MCP_ALLOW_CIDRS")
+	if v := os.Getenv("MCP_DENY_CIDRS"); v != "" {
+		McpDenyCIDRs = []string{}
+		if v != "none" {
+			McpDenyCIDRs = getList("MCP_DENY_CIDRS")
+		}
+	}
+	McpAllowCrossOriginEndpoint, _ = strconv.ParseBool(os.Getenv("MCP_ALLOW_CROSS_ORIGIN_ENDPOINT"))
+	McpServerToken = os.Getenv("MCP_SERVER_TOKEN")
+	ToolTimeout = getDuration("TOOL_TIMEOUT", 2*time.Minute)
+	ToolMaxResultBytes = 64 << 10
+	if n, err := strconv.Atoi(os.Getenv("TOOL_MAX_RESULT_BYTES")); err == nil && n >= 0 {
+		ToolMaxResultBytes = n
+	}
+	VFSMaxFileBytes = getInt("VFS_MAX_FILE_BYTES", 1<<20)
+	VFSMaxTotalBytes = getInt("VFS_MAX_TOTAL_BYTES", 20<<20)
+	VFSHistoryMaxRevisions = getInt("VFS_HISTORY_MAX_REVISIONS", 50)
+	VFSHistoryMaxBytes = getInt("VFS_HISTORY_MAX_BYTES", 20<<20)
+	PluginDir = getEnv("PLUGIN_DIR", filepath.Join(DataDir, "plugins"))
+	OpenAPIDir = getEnv("OPENAPI_DIR", filepath.Join(DataDir, "openapi"))
+	VFSExportRoot = getEnv("VFS_EXPORT_ROOT", filepath.Join(DataDir, "exports"))
 }
 
 func getEnv(key, def string) string {
@@ -32,3 +95,37 @@ func getEnv(key, def string) string {
 	}
 	return def
 }
+
+// getList 解析逗号分隔的环境变量，忽略空项
+func getList(key string) []string {
+	var out []string
+	for _, s := range strings.Split(os.Getenv(key), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// getInt 解析非负整数环境变量，无效时使用默认值
+func getInt(key string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n >= 0 {
+		return n
+	}
+	return def
+}
+
+// getDuration 解析时长环境变量，支持 Go duration（如 30s、5m）或纯秒数
+func getDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	return def
+}
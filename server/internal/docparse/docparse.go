@@ -0,0 +1,226 @@
+// Package docparse 识别上传文档的格式并提取纯文本：标题转为 Markdown 标题，表格转为 Markdown 表格，列表保留为列表项
+package docparse
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// 支持的文档格式
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatText     = "text"
+	FormatCSV      = "csv"
+	FormatDOCX     = "docx"
+)
+
+var ErrUnsupported = errors.New("unsupported document format")
+
+var extFormats = map[string]string{
+	".md":       FormatMarkdown,
+	".markdown": FormatMarkdown,
+	".html":     FormatHTML,
+	".htm":      FormatHTML,
+	".xhtml":    FormatHTML,
+	".txt":      FormatText,
+	".text":     FormatText,
+	".csv":      FormatCSV,
+	".tsv":      FormatCSV,
+	".docx":     FormatDOCX,
+}
+
+// Valid 是否为支持的格式名
+func Valid(format string) bool {
+	switch format {
+	case FormatMarkdown, FormatHTML, FormatText, FormatCSV, FormatDOCX:
+		return true
+	}
+	return false
+}
+
+// Detect 按扩展名识别格式，扩展名未知时按内容判断；无法识别时返回空串
+func Detect(name string, data []byte) string {
+	if f, ok := extFormats[strings.ToLower(filepath.Ext(name))]; ok {
+		return f
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		if isDOCX(data) {
+			return FormatDOCX
+		}
+		return ""
+	}
+	if !utf8.Valid(data) {
+		return ""
+	}
+	if strings.HasPrefix(http.DetectContentType(data), "text/html") {
+		return FormatHTML
+	}
+	for _, line := range strings.SplitN(string(data), "\n", 50) {
+		if t := strings.TrimSpace(line); strings.HasPrefix(t, "# ") || strings.HasPrefix(t, "## ") || strings.HasPrefix(t, "```") {
+			return FormatMarkdown
+		}
+	}
+	return FormatText
+}
+
+// Extract 提取文档文本，结果中的段落之间以空行分隔
+func Extract(format, name string, data []byte) (string, error) {
+	var text string
+	var err error
+	switch format {
+	case FormatMarkdown, FormatText:
+		text, err = decodeText(data)
+	case FormatHTML:
+		text, err = extractHTML(data)
+	case FormatCSV:
+		text, err = extractCSV(name, data)
+	case FormatDOCX:
+		text, err = extractDOCX(data)
+	default:
+		return "", ErrUnsupported
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// decodeText 去掉 BOM 并统一换行；非 UTF-8 内容视为不支持
+func decodeText(data []byte) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return "", errors.New("document is not valid UTF-8 text")
+	}
+	s := strings.ReplaceAll(string(data), "\r\n", "\n")
+	return strings.ReplaceAll(s, "\r", "\n"), nil
+}
+
+// extractCSV 把整个表格转为 Markdown 表格，第一行作为表头；.tsv 或只含制表符分隔的内容按制表符解析
+func extractCSV(name string, data []byte) (string, error) {
+	s, err := decodeText(data)
+	if err != nil {
+		return "", err
+	}
+	r := csv.NewReader(strings.NewReader(s))
+	first, _, _ := strings.Cut(s, "\n")
+	if strings.EqualFold(filepath.Ext(name), ".tsv") || (strings.Contains(first, "\t") && !strings.Contains(first, ",")) {
+		r.Comma = '\t'
+	}
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	var rows [][]string
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		rows = append(rows, rec)
+	}
+	return markdownTable(rows), nil
+}
+
+// markdownTable 第一行为表头，列数按最宽的行补齐；空行忽略
+func markdownTable(rows [][]string) string {
+	cols := 0
+	var kept [][]string
+	for _, row := range rows {
+		empty := true
+		for _, c := range row {
+			if strings.TrimSpace(c) != "" {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			continue
+		}
+		kept = append(kept, row)
+		cols = max(cols, len(row))
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	line := func(cells []string) {
+		b.WriteString("|")
+		for i := 0; i < cols; i++ {
+			c := ""
+			if i < len(cells) {
+				c = tableCell(cells[i])
+			}
+			b.WriteString(" " + c + " |")
+		}
+		b.WriteString("\n")
+	}
+	line(kept[0])
+	b.WriteString("|" + strings.Repeat(" --- |", cols) + "\n")
+	for _, row := range kept[1:] {
+		line(row)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func tableCell(s string) string {
+	var lines []string
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return strings.ReplaceAll(strings.Join(lines, "<br>"), "|", `\|`)
+}
+
+// mdWriter 收集提取出的块：连续的列表项合并为一个块，其余块之间以空行分隔
+type mdWriter struct {
+	blocks []string
+	items  []string
+}
+
+func (w *mdWriter) block(s string) {
+	w.endList()
+	if s = strings.TrimRight(s, " \t\n"); strings.TrimSpace(s) != "" {
+		w.blocks = append(w.blocks, s)
+	}
+}
+
+func (w *mdWriter) heading(level int, s string) {
+	if s = strings.Join(strings.Fields(s), " "); s != "" {
+		w.block(strings.Repeat("#", min(max(level, 1), 6)) + " " + s)
+	}
+}
+
+// item 追加列表项；marker 为空时是上一项的续行
+func (w *mdWriter) item(depth int, marker, s string) {
+	if s = strings.TrimSpace(s); s == "" {
+		return
+	}
+	prefix := strings.Repeat("  ", depth)
+	if marker != "" {
+		prefix += marker + " "
+	} else {
+		prefix += "  "
+	}
+	w.items = append(w.items, prefix+s)
+}
+
+func (w *mdWriter) endList() {
+	if len(w.items) > 0 {
+		w.blocks = append(w.blocks, strings.Join(w.items, "\n"))
+		w.items = nil
+	}
+}
+
+func (w *mdWriter) String() string {
+	w.endList()
+	return strings.Join(w.blocks, "\n\n")
+}
@@ -0,0 +1,236 @@
+package docparse
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxDOCXPartBytes 解压单个 XML 部件的上限，防止压缩炸弹
+const maxDOCXPartBytes = 64 << 20
+
+func isDOCX(data []byte) bool {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			return true
+		}
+	}
+	return false
+}
+
+func readPart(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, maxDOCXPartBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxDOCXPartBytes {
+			return nil, errors.New(name + " is too large")
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+// headingStyles 样式 ID 到标题级别：样式名为 heading N / 标题 N / Title，或设置了大纲级别
+func headingStyles(data []byte) map[string]int {
+	levels := map[string]int{}
+	var doc struct {
+		Styles []struct {
+			ID   string `xml:"styleId,attr"`
+			Name struct {
+				Val string `xml:"val,attr"`
+			} `xml:"name"`
+			Outline *struct {
+				Val string `xml:"val,attr"`
+			} `xml:"pPr>outlineLvl"`
+		} `xml:"style"`
+	}
+	if xml.Unmarshal(data, &doc) != nil {
+		return levels
+	}
+	for _, s := range doc.Styles {
+		if l := styleLevel(s.Name.Val); l > 0 {
+			levels[s.ID] = l
+		} else if s.Outline != nil {
+			if n, err := strconv.Atoi(s.Outline.Val); err == nil && n < 9 {
+				levels[s.ID] = n + 1
+			}
+		}
+	}
+	return levels
+}
+
+func styleLevel(name string) int {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "title" || name == "标题" {
+		return 1
+	}
+	for _, prefix := range []string{"heading", "标题"} {
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			if n, err := strconv.Atoi(strings.TrimSpace(rest)); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// docxPara 正在读取的段落
+type docxPara struct {
+	text  strings.Builder
+	level int
+	// list 列表层级，-1 表示不是列表项
+	list int
+}
+
+// extractDOCX 读取 word/document.xml 的正文：标题样式转为 Markdown 标题，编号段落转为列表项，表格转为 Markdown 表格
+func extractDOCX(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	body, err := readPart(zr, "word/document.xml")
+	if err != nil {
+		return "", err
+	}
+	if body == nil {
+		return "", errors.New("word/document.xml not found")
+	}
+	styles, err := readPart(zr, "word/styles.xml")
+	if err != nil {
+		return "", err
+	}
+	levels := headingStyles(styles)
+
+	var w mdWriter
+	// 文本框中的段落嵌套在外层段落内，按栈处理
+	var paras []*docxPara
+	var inText bool
+	// 只收集最外层表格的行，嵌套表格的内容并入外层单元格
+	var rows [][]string
+	depth := 0
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		var para *docxPara
+		if len(paras) > 0 {
+			para = paras[len(paras)-1]
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				paras = append(paras, &docxPara{list: -1})
+			case "pStyle":
+				if para != nil {
+					para.level = levels[attr(t, "val")]
+				}
+			case "outlineLvl":
+				if n, err := strconv.Atoi(attr(t, "val")); err == nil && para != nil && n < 9 {
+					para.level = n + 1
+				}
+			case "numPr":
+				if para != nil && para.list < 0 {
+					para.list = 0
+				}
+			case "ilvl":
+				if n, err := strconv.Atoi(attr(t, "val")); err == nil && para != nil {
+					para.list = n
+				}
+			case "t":
+				inText = true
+			case "tab":
+				if para != nil {
+					para.text.WriteString(" ")
+				}
+			case "br", "cr":
+				if para != nil {
+					para.text.WriteString("\n")
+				}
+			case "tbl":
+				if depth++; depth == 1 {
+					rows = nil
+				}
+			case "tr":
+				if depth == 1 {
+					rows = append(rows, nil)
+				}
+			case "tc":
+				if depth == 1 && len(rows) > 0 {
+					rows[len(rows)-1] = append(rows[len(rows)-1], "")
+				}
+			}
+		case xml.CharData:
+			if inText && para != nil {
+				para.text.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if para == nil {
+					continue
+				}
+				text := strings.TrimSpace(para.text.String())
+				switch {
+				case depth > 0:
+					if len(rows) > 0 && len(rows[len(rows)-1]) > 0 && text != "" {
+						row := rows[len(rows)-1]
+						if row[len(row)-1] != "" {
+							row[len(row)-1] += "\n"
+						}
+						row[len(row)-1] += text
+					}
+				case para.level > 0:
+					w.heading(para.level, text)
+				case para.list >= 0:
+					w.item(para.list, "-", text)
+				default:
+					w.block(text)
+				}
+				paras = paras[:len(paras)-1]
+			case "tbl":
+				if depth == 0 {
+					continue
+				}
+				if depth--; depth == 0 {
+					w.block(markdownTable(rows))
+				}
+			}
+		}
+	}
+	return w.String(), nil
+}
+
+func attr(e xml.StartElement, local string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,256 @@
+package docparse
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// skipTags 不含正文的元素
+var skipTags = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Canvas: true, atom.Iframe: true, atom.Object: true, atom.Select: true, atom.Button: true,
+}
+
+// blockTags 前后断开段落的元素
+var blockTags = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true, atom.Header: true,
+	atom.Footer: true, atom.Aside: true, atom.Nav: true, atom.Blockquote: true, atom.Figure: true,
+	atom.Figcaption: true, atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Address: true, atom.Form: true,
+	atom.Fieldset: true, atom.Details: true, atom.Summary: true, atom.Caption: true, atom.Body: true,
+}
+
+var headingTags = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+type htmlList struct {
+	ordered bool
+	n       int
+	// marker 当前列表项尚未输出的标记，输出第一段文字后清空
+	marker string
+}
+
+type htmlConv struct {
+	mdWriter
+	inline strings.Builder
+	lists  []htmlList
+	inItem int
+}
+
+func extractHTML(data []byte) (string, error) {
+	s, err := decodeText(data)
+	if err != nil {
+		return "", err
+	}
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return "", err
+	}
+	var c htmlConv
+	c.walk(doc)
+	c.flush()
+	return c.String(), nil
+}
+
+// flush 输出累积的行内文字：位于列表项中时作为列表项，否则作为段落
+func (c *htmlConv) flush() {
+	text := inlineText(c.inline.String())
+	c.inline.Reset()
+	if text == "" {
+		return
+	}
+	if c.inItem > 0 && len(c.lists) > 0 {
+		top := &c.lists[len(c.lists)-1]
+		c.item(len(c.lists)-1, top.marker, text)
+		top.marker = ""
+		return
+	}
+	c.block(text)
+}
+
+func (c *htmlConv) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		c.inline.WriteString(collapseSpace(n.Data))
+		return
+	case html.ElementNode:
+	case html.DocumentNode:
+		c.children(n)
+		return
+	default:
+		return
+	}
+	if skipTags[n.DataAtom] {
+		return
+	}
+	if level, ok := headingTags[n.DataAtom]; ok {
+		c.flush()
+		c.heading(level, strings.ReplaceAll(textContent(n), "\n", " "))
+		return
+	}
+	switch n.DataAtom {
+	case atom.Br:
+		c.inline.WriteString("\n")
+	case atom.Hr:
+		c.flush()
+	case atom.Pre:
+		c.flush()
+		var b bytes.Buffer
+		rawText(n, &b)
+		if code := strings.Trim(b.String(), "\n"); strings.TrimSpace(code) != "" {
+			c.block("```\n" + code + "\n```")
+		}
+	case atom.Table:
+		c.flush()
+		c.block(markdownTable(tableRows(n)))
+	case atom.Ul, atom.Ol:
+		c.flush()
+		c.lists = append(c.lists, htmlList{ordered: n.DataAtom == atom.Ol})
+		c.children(n)
+		c.flush()
+		c.lists = c.lists[:len(c.lists)-1]
+		if len(c.lists) == 0 {
+			c.endList()
+		}
+	case atom.Li:
+		c.flush()
+		if len(c.lists) == 0 {
+			c.children(n)
+			c.flush()
+			return
+		}
+		top := &c.lists[len(c.lists)-1]
+		top.n++
+		top.marker = "-"
+		if top.ordered {
+			top.marker = strconv.Itoa(top.n) + "."
+		}
+		c.inItem++
+		c.children(n)
+		c.flush()
+		c.inItem--
+		c.lists[len(c.lists)-1].marker = ""
+	default:
+		if blockTags[n.DataAtom] {
+			c.flush()
+			c.children(n)
+			c.flush()
+			return
+		}
+		c.children(n)
+	}
+}
+
+func (c *htmlConv) children(n *html.Node) {
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		c.walk(ch)
+	}
+}
+
+// tableRows 收集表格的行，嵌套表格展开为单元格文字
+func tableRows(table *html.Node) [][]string {
+	var rows [][]string
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			if ch.Type != html.ElementNode {
+				continue
+			}
+			switch ch.DataAtom {
+			case atom.Tr:
+				var row []string
+				for cell := ch.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+						row = append(row, textContent(cell))
+					}
+				}
+				rows = append(rows, row)
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				visit(ch)
+			}
+		}
+	}
+	visit(table)
+	return rows
+}
+
+// textContent 元素内的文字，空白折叠，<br> 与块级元素处换行
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(collapseSpace(n.Data))
+			return
+		case html.ElementNode:
+			if skipTags[n.DataAtom] {
+				return
+			}
+			if n.DataAtom == atom.Br {
+				b.WriteString("\n")
+				return
+			}
+		}
+		block := n.Type == html.ElementNode && (blockTags[n.DataAtom] || n.DataAtom == atom.Li || n.DataAtom == atom.Tr)
+		if block {
+			b.WriteString("\n")
+		}
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			visit(ch)
+		}
+		if block {
+			b.WriteString("\n")
+		}
+	}
+	visit(n)
+	return inlineText(b.String())
+}
+
+// rawText <pre> 中的原始文字
+func rawText(n *html.Node, b *bytes.Buffer) {
+	if n.Type == html.TextNode {
+		b.WriteString(n.Data)
+		return
+	}
+	if n.Type == html.ElementNode && n.DataAtom == atom.Br {
+		b.WriteString("\n")
+		return
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		rawText(ch, b)
+	}
+}
+
+// collapseSpace 把空白（含换行）折叠为单个空格，换行只来自 <br>
+func collapseSpace(s string) string {
+	if strings.TrimSpace(s) == "" {
+		if s == "" {
+			return ""
+		}
+		return " "
+	}
+	out := strings.Join(strings.Fields(s), " ")
+	if strings.IndexAny(s[:1], " \t\n\r\f") == 0 {
+		out = " " + out
+	}
+	if strings.IndexAny(s[len(s)-1:], " \t\n\r\f") == 0 {
+		out += " "
+	}
+	return out
+}
+
+// inlineText 按换行拆分，每行去掉多余空白，丢弃空行
+func inlineText(s string) string {
+	var lines []string
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
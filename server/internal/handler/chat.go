@@ -8,6 +8,7 @@ import (
 
 	"agentic-demo/server/internal/agent"
 	"agentic-demo/server/internal/config"
+	"agentic-demo/server/internal/registry"
 	"agentic-demo/server/internal/store"
 )
 
@@ -90,6 +91,17 @@ func (h *Handler) ChatStream(w http.ResponseWriter, r *http.Request) {
 		OnToast: func(msg string) {
 			SendEvent(w, flusher, "toast", map[string]string{"message": msg})
 		},
+		OnToolProgress: func(callID, tool, message string) {
+			SendEvent(w, flusher, "toolProgress", map[string]string{
+				"callId": callID, "tool": tool, "message": message,
+			})
+		},
+		OnFileProgress: func(callID string, p registry.FileProgress) {
+			SendEvent(w, flusher, "fileProgress", struct {
+				CallID string `json:"callId"`
+				registry.FileProgress
+			}{callID, p})
+		},
 	}
 
 	err := agent.RunSupervisor(ctx, agent.SupervisorDeps{
@@ -97,6 +109,8 @@ func (h *Handler) ChatStream(w http.ResponseWriter, r *http.Request) {
 		TodoStore:  h.todoStore,
 		Registry:   h.registry,
 		ToolEnable: h.toolEnable,
+		ToolProfiles: h.toolProfiles,
+		McpResources: h.mcpResourceRefs(),
 	}, req.SessionID, req.Message, opts, callbacks, req.Params)
 	if err != nil {
 		SendEvent(w, flusher, "error", map[string]string{"message": err.Error()})
@@ -1,6 +1,12 @@
 package handler
 
 import (
+	"log"
+	"time"
+
+	"agentic-demo/server/internal/config"
+	"agentic-demo/server/internal/mcp"
+	"agentic-demo/server/internal/plugin"
 	"agentic-demo/server/internal/registry"
 	"agentic-demo/server/internal/store"
 )
@@ -12,6 +18,17 @@ type Handler struct {
 	toolEnable   *store.ToolEnableStore
 	mcpStore     *store.McpStore
 	mcpStatus    *store.McpStatusStore
+	mcpProcs     *mcp.ProcessManager
+	mcpMonitor   *mcp.Monitor
+	mcpCatalog   *mcp.Catalog
+	mcpToolSync  *mcp.ToolSync
+	httpTools    *store.HttpToolStore
+	openAPISpecs *store.OpenAPIStore
+	plugins      *plugin.Manager
+	toolLimits   *store.ToolLimitStore
+	toolUsage    *store.ToolUsageStore
+	toolProfiles *store.ToolProfileStore
+	exportRoot   string
 }
 
 func NewHandler(s *store.SessionStore, todoStore *store.TodoStore, reg *registry.Registry) *Handler {
@@ -25,3 +42,86 @@ func NewHandlerWithTools(s *store.SessionStore, todoStore *store.TodoStore, reg
 		toolEnable: toolEnable, mcpStore: mcpStore, mcpStatus: mcpStatus,
 	}
 }
+
+// SetMcpProcessManager 注入 stdio MCP 进程管理器；未注入时 stdio 服务器不会被拉起
+func (h *Handler) SetMcpProcessManager(pm *mcp.ProcessManager) {
+	h.mcpProcs = pm
+}
+
+// SetMcpMonitor 注入后台健康检查器；手动检查会复用其调度，使退避状态与手动结果一致
+func (h *Handler) SetMcpMonitor(m *mcp.Monitor) {
+	h.mcpMonitor = m
+}
+
+// SetMcpCatalog 注入 MCP 资源目录；注入后对话时会向 Supervisor 声明已发现的资源
+func (h *Handler) SetMcpCatalog(c *mcp.Catalog) {
+	h.mcpCatalog = c
+}
+
+// SetHttpToolStore 注入用户自定义 HTTP 工具的存储；工具的增删改会同步到 registry
+func (h *Handler) SetHttpToolStore(s *store.HttpToolStore) {
+	h.httpTools = s
+}
+
+// SetOpenAPIStore 注入导入的 OpenAPI 文档存储；文档选中操作的增删会同步到 registry
+func (h *Handler) SetOpenAPIStore(s *store.OpenAPIStore) {
+	h.openAPISpecs = s
+}
+
+// SetPluginManager 注入外部命令插件管理器，用于查看加载结果与重新加载插件目录
+func (h *Handler) SetPluginManager(m *plugin.Manager) {
+	h.plugins = m
+}
+
+// SetToolProfileStore 注入工具配置存储；对话按模式/行业绑定的配置与会话覆盖计算可用工具
+func (h *Handler) SetToolProfileStore(s *store.ToolProfileStore) {
+	h.toolProfiles = s
+}
+
+// SetToolLimitStore 注入单工具执行限制的存储，并让 registry 按「全局默认值 + 单工具配置」执行
+func (h *Handler) SetToolLimitStore(s *store.ToolLimitStore) {
+	h.toolLimits = s
+	h.registry.SetLimits(h.toolLimitsFor)
+}
+
+// SetToolUsageStore 注入工具调用记录的存储，registry 每次执行后写入一条记录
+func (h *Handler) SetToolUsageStore(s *store.ToolUsageStore) {
+	h.toolUsage = s
+	h.registry.SetRecorder(func(c store.ToolCall) {
+		if err := s.Record(c); err != nil {
+			log.Printf("[tools] record usage of %s: %v", c.Tool, err)
+		}
+	})
+}
+
+// toolLimitsFor 合并 TOOL_TIMEOUT / TOOL_MAX_RESULT_BYTES 与单工具配置
+func (h *Handler) toolLimitsFor(id string) registry.Limits {
+	l := registry.Limits{Timeout: config.ToolTimeout, MaxResultBytes: config.ToolMaxResultBytes}
+	if h.toolLimits == nil {
+		return l
+	}
+	o := h.toolLimits.Get(id)
+	switch {
+	case o.TimeoutMs == store.ToolLimitUnlimited:
+		l.Timeout = 0
+	case o.TimeoutMs > 0:
+		l.Timeout = time.Duration(o.TimeoutMs) * time.Millisecond
+	}
+	switch {
+	case o.MaxResultBytes == store.ToolLimitUnlimited:
+		l.MaxResultBytes = 0
+	case o.MaxResultBytes > 0:
+		l.MaxResultBytes = o.MaxResultBytes
+	}
+	return l
+}
+
+// SetVFSExportRoot 设置 VFS 导出的根目录；未设置时导出接口返回 500
+func (h *Handler) SetVFSExportRoot(dir string) {
+	h.exportRoot = dir
+}
+
+// SetMcpToolSync 注入 MCP 工具同步器：删除或修改服务器时注销/重连其工具，并向前端推送工具集变更
+func (h *Handler) SetMcpToolSync(t *mcp.ToolSync) {
+	h.mcpToolSync = t
+}
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"agentic-demo/server/internal/httptool"
+	"agentic-demo/server/internal/registry"
+	"agentic-demo/server/internal/store"
+)
+
+// httpToolBody 创建/更新 HTTP 工具的请求体
+type httpToolBody struct {
+	Name             string            `json:"name"`
+	Description      string            `json:"description"`
+	Parameters       json.RawMessage   `json:"parameters"`
+	Method           string            `json:"method"`
+	URL              string            `json:"url"`
+	Headers          map[string]string `json:"headers"`
+	Body             string            `json:"body"`
+	ResponsePath     string            `json:"responsePath"`
+	TimeoutMs        int               `json:"timeoutMs"`
+	MaxResponseBytes int64             `json:"maxResponseBytes"`
+}
+
+// redactHttpToolHeaders 脱敏名称像凭证的请求头（Authorization、X-Api-Key、Cookie 等），其余模板原样返回
+func redactHttpToolHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if isSensitiveEnv(k) || strings.EqualFold(k, "Cookie") {
+			v = redactedSecret
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func httpToolResp(t store.HttpTool) store.HttpTool {
+	t.Headers = redactHttpToolHeaders(t.Headers)
+	return t
+}
+
+// ListHttpTools GET /api/http-tools
+func (h *Handler) ListHttpTools(w http.ResponseWriter, r *http.Request) {
+	if h.httpTools == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "http tool store not configured"})
+		return
+	}
+	list := h.httpTools.List()
+	out := make([]store.HttpTool, len(list))
+	for i, t := range list {
+		out[i] = httpToolResp(t)
+	}
+	writeJSON(w, map[string]interface{}{"tools": out})
+}
+
+// GetHttpTool GET /api/http-tools/{id}
+func (h *Handler) GetHttpTool(w http.ResponseWriter, r *http.Request, id string) {
+	if h.httpTools == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "http tool store not configured"})
+		return
+	}
+	t := h.httpTools.Get(id)
+	if t == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	writeJSON(w, httpToolResp(*t))
+}
+
+// CreateHttpTool POST /api/http-tools：校验、保存并注册到 registry
+func (h *Handler) CreateHttpTool(w http.ResponseWriter, r *http.Request) {
+	if h.httpTools == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "http tool store not configured"})
+		return
+	}
+	var body httpToolBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	t := body.toTool(nil)
+	if !h.checkHttpTool(w, t, "") {
+		return
+	}
+	created, err := h.httpTools.Add(t)
+	if err != nil {
+		if errors.Is(err, store.ErrHttpToolExists) {
+			writeJSONStatus(w, http.StatusConflict, map[string]string{"error": "工具名已存在"})
+			return
+		}
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	httptool.Register(h.registry, created)
+	writeJSONStatus(w, http.StatusCreated, httpToolResp(created))
+}
+
+// UpdateHttpTool PUT /api/http-tools/{id}：整体替换定义；脱敏占位符的请求头沿用原值，改名时同步注销旧名
+func (h *Handler) UpdateHttpTool(w http.ResponseWriter, r *http.Request, id string) {
+	if h.httpTools == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "http tool store not configured"})
+		return
+	}
+	prev := h.httpTools.Get(id)
+	if prev == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	var body httpToolBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	t := body.toTool(prev)
+	if !h.checkHttpTool(w, t, prev.Name) {
+		return
+	}
+	updated, err := h.httpTools.Replace(t)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrHttpToolExists):
+			writeJSONStatus(w, http.StatusConflict, map[string]string{"error": "工具名已存在"})
+		case errors.Is(err, store.ErrHttpToolNotFound):
+			writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		default:
+			writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return
+	}
+	if prev.Name != updated.Name {
+		h.registry.Unregister(prev.Name)
+	}
+	httptool.Register(h.registry, updated)
+	writeJSON(w, httpToolResp(updated))
+}
+
+// DeleteHttpTool DELETE /api/http-tools/{id}
+func (h *Handler) DeleteHttpTool(w http.ResponseWriter, r *http.Request, id string) {
+	if h.httpTools == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "http tool store not configured"})
+		return
+	}
+	t := h.httpTools.Get(id)
+	if t == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	if err := h.httpTools.Remove(id); err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	h.registry.Unregister(t.Name)
+	writeJSONStatus(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// toTool 把请求体转换为工具定义；更新时沿用 prev 的 ID 与脱敏请求头
+func (b httpToolBody) toTool(prev *store.HttpTool) store.HttpTool {
+	t := store.HttpTool{
+		Name:             b.Name,
+		Description:      strings.TrimSpace(b.Description),
+		Method:           b.Method,
+		URL:              b.URL,
+		Headers:          mergeMcpHeaders(nil, b.Headers),
+		Body:             b.Body,
+		ResponsePath:     b.ResponsePath,
+		TimeoutMs:        b.TimeoutMs,
+		MaxResponseBytes: b.MaxResponseBytes,
+	}
+	if len(b.Parameters) > 0 && string(b.Parameters) != "null" {
+		t.Parameters = b.Parameters
+	}
+	if prev != nil {
+		t.ID = prev.ID
+		t.Headers = mergeMcpHeaders(prev.Headers, b.Headers)
+	}
+	httptool.Normalize(&t)
+	return t
+}
+
+// checkHttpTool 校验定义，并确保名称不与 builtin、MCP 等其他来源的工具冲突；失败时已写入响应
+func (h *Handler) checkHttpTool(w http.ResponseWriter, t store.HttpTool, prevName string) bool {
+	if err := httptool.Validate(t); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	if t.Name != prevName {
+		if src := h.registry.GetSource(t.Name); src != "" && src != registry.SourceHTTP {
+			writeJSONStatus(w, http.StatusConflict, map[string]string{"error": "工具名与已有的 " + src + " 工具冲突"})
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"agentic-demo/server/internal/registry"
+	"agentic-demo/server/internal/store"
+)
+
+func initTestHandlerWithHttpTools(t *testing.T) *Handler {
+	t.Helper()
+	h := initTestHandlerWithTools(t)
+	s, err := store.NewHttpToolStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewHttpToolStore: %v", err)
+	}
+	h.SetHttpToolStore(s)
+	return h
+}
+
+func TestHttpTools_CreateAndExecute(t *testing.T) {
+	var gotQuery, gotAuth, gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		gotAuth = r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"items":[{"name":"a"},{"name":"b"}]}}`))
+	}))
+	defer upstream.Close()
+
+	h := initTestHandlerWithHttpTools(t)
+	def := map[string]any{
+		"name":         "lookup_items",
+		"description":  "查询条目",
+		"method":       "post",
+		"url":          upstream.URL + "/search?q={{query}}",
+		"headers":      map[string]string{"Authorization": "Bearer secret-token"},
+		"body":         `{"q":"{{query}}","limit":{{limit}}}`,
+		"responsePath": "$.data.items[*].name",
+		"parameters":   map[string]any{"type": "object", "properties": map[string]any{"query": map[string]any{"type": "string"}, "limit": map[string]any{"type": "integer"}}},
+	}
+	raw, _ := json.Marshal(def)
+	rec := httptest.NewRecorder()
+	h.CreateHttpTool(rec, httptest.NewRequest(http.MethodPost, "/api/http-tools", bytes.NewReader(raw)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("CreateHttpTool code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var created store.HttpTool
+	_ = json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.Headers["Authorization"] != redactedSecret {
+		t.Errorf("Authorization header not redacted: %v", created.Headers)
+	}
+	if h.registry.GetSource("lookup_items") != registry.SourceHTTP {
+		t.Fatalf("tool not registered")
+	}
+
+	res, err := h.registry.Execute(registry.ExecuteRequest{Ctx: context.Background()}, "lookup_items", json.RawMessage(`{"query":"a b\"c","limit":5}`))
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if gotQuery != "q=a+b%22c" || gotAuth != "Bearer secret-token" || gotBody != `{"q":"a b\"c","limit":5}` {
+		t.Errorf("request: query=%q auth=%q body=%q", gotQuery, gotAuth, gotBody)
+	}
+	data := res.(map[string]interface{})["data"].([]any)
+	if len(data) != 2 || data[0] != "a" {
+		t.Errorf("data = %v", data)
+	}
+
+	// 改名：旧名注销，脱敏请求头沿用原值
+	def["name"] = "find_items"
+	def["headers"] = map[string]string{"Authorization": redactedSecret}
+	raw, _ = json.Marshal(def)
+	rec = httptest.NewRecorder()
+	h.UpdateHttpTool(rec, httptest.NewRequest(http.MethodPut, "/api/http-tools/"+created.ID, bytes.NewReader(raw)), created.ID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("UpdateHttpTool code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if h.registry.GetSource("lookup_items") != "" || h.registry.GetSource("find_items") != registry.SourceHTTP {
+		t.Error("rename should re-register the tool")
+	}
+	if got := h.httpTools.Get(created.ID); got.Headers["Authorization"] != "Bearer secret-token" {
+		t.Errorf("header after update = %v", got.Headers)
+	}
+
+	rec = httptest.NewRecorder()
+	h.DeleteHttpTool(rec, httptest.NewRequest(http.MethodDelete, "/api/http-tools/"+created.ID, nil), created.ID)
+	if rec.Code != http.StatusOK || h.registry.GetSource("find_items") != "" {
+		t.Errorf("delete code = %d, registered = %q", rec.Code, h.registry.GetSource("find_items"))
+	}
+}
+
+func TestHttpTools_Invalid(t *testing.T) {
+	h := initTestHandlerWithHttpTools(t)
+	cases := map[string]string{
+		"builtin name":     `{"name":"create_todo","description":"x","url":"http://127.0.0.1/x"}`,
+		"templated host":   `{"name":"t1","description":"x","url":"http://{{host}}/x"}`,
+		"metadata address": `{"name":"t2","description":"x","url":"http://169.254.169.254/latest"}`,
+		"bad jsonpath":     `{"name":"t3","description":"x","url":"http://127.0.0.1/x","responsePath":"data.x"}`,
+	}
+	for name, body := range cases {
+		rec := httptest.NewRecorder()
+		h.CreateHttpTool(rec, httptest.NewRequest(http.MethodPost, "/api/http-tools", bytes.NewBufferString(body)))
+		if rec.Code != http.StatusBadRequest && rec.Code != http.StatusConflict {
+			t.Errorf("%s: code = %d, want 400/409", name, rec.Code)
+		}
+	}
+}
+
+func TestHttpToolStore_KeyMismatch(t *testing.T) {
+	dir := t.TempDir()
+	box, _ := store.NewSecretBox(dir, "old-key")
+	s, err := store.NewHttpToolStore(dir, box)
+	if err != nil {
+		t.Fatalf("NewHttpToolStore: %v", err)
+	}
+	if _, err := s.Add(store.HttpTool{Name: "weather", Method: "GET", URL: "http://localhost/w", Headers: map[string]string{"Authorization": "Bearer t1"}}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	before, _ := os.ReadFile(filepath.Join(dir, "http_tools.json"))
+	other, _ := store.NewSecretBox(dir, "new-key")
+	if _, err := store.NewHttpToolStore(dir, other); !errors.Is(err, store.ErrSecretCorrupt) {
+		t.Fatalf("open with another key: err = %v, want ErrSecretCorrupt", err)
+	}
+	if after, _ := os.ReadFile(filepath.Join(dir, "http_tools.json")); !bytes.Equal(before, after) {
+		t.Error("http tools file changed after failed load")
+	}
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"agentic-demo/server/internal/chunker"
+	"agentic-demo/server/internal/docparse"
+	"agentic-demo/server/internal/store"
+
+	"google.golang.org/genai"
+)
+
+// maxIngestBytes 单次导入文本的大小上限（上传文档时为提取后的文本）
+const maxIngestBytes = 2 << 20
+
+// maxDocumentBytes 上传文档文件的大小上限
+const maxDocumentBytes = 20 << 20
+
+// ingestTimeout 单次导入调用模型切分的总时长
+const ingestTimeout = 3 * time.Minute
+
+// errNoGemini 显式要求语义切分但未配置模型
+var errNoGemini = errors.New("GEMINI_API_KEY not configured")
+
+func validIngestMode(mode string) (string, bool) {
+	switch mode {
+	case "":
+		return chunker.ModeAuto, true
+	case chunker.ModeAuto, chunker.ModeSemantic, chunker.ModeRule:
+		return mode, true
+	}
+	return "", false
+}
+
+// splitKnowledge 按 mode 切分文本；mode 为 rule 时不创建模型客户端
+func splitKnowledge(ctx context.Context, text, mode string) ([]store.KnowledgeChunk, chunker.Stats, error) {
+	var client *genai.Client
+	if mode != chunker.ModeRule {
+		client = newGeminiClient(ctx)
+	}
+	if client == nil && mode == chunker.ModeSemantic {
+		return nil, chunker.Stats{}, errNoGemini
+	}
+	chunks, stats := chunker.Split(ctx, client, text, mode)
+	return chunks, stats, nil
+}
+
+func ingestResult(chunks []store.KnowledgeChunk, stats chunker.Stats) map[string]any {
+	return map[string]any{
+		"success":         true,
+		"added":           len(chunks),
+		"chunks":          chunks,
+		"windows":         stats.Windows,
+		"semanticWindows": stats.SemanticWindows,
+		"ruleWindows":     stats.RuleWindows,
+		"errors":          stats.Errors,
+	}
+}
+
+// IngestKnowledge POST {text, mode}：切分原始文本并追加到会话知识库。
+// mode 为 auto（默认，配置了 GEMINI_API_KEY 时按语义切分）、semantic 或 rule；语义切分失败的窗口退回规则切分
+func (h *Handler) IngestKnowledge(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if state, err := h.store.GetSessionDoc(sessionID); err != nil || state == nil {
+		writeJSONError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	var body struct {
+		Text string `json:"text"`
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxIngestBytes+4096)).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid body")
+		return
+	}
+	if len(body.Text) > maxIngestBytes {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "text too large")
+		return
+	}
+	if strings.TrimSpace(body.Text) == "" {
+		writeJSONError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+	mode, ok := validIngestMode(body.Mode)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "mode must be auto, semantic or rule")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), ingestTimeout)
+	defer cancel()
+	chunks, stats, err := splitKnowledge(ctx, body.Text, mode)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := h.store.AppendKnowledgeChunks(sessionID, chunks); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, ingestResult(chunks, stats))
+}
+
+// KnowledgeDocuments 路由 knowledge/documents[/{docId}]：GET 列出文档或返回单个文档及其提取文本，POST 上传文档
+func (h *Handler) KnowledgeDocuments(w http.ResponseWriter, r *http.Request, sessionID string, rest []string) {
+	state, err := h.store.GetSessionDoc(sessionID)
+	if err != nil || state == nil {
+		writeJSONError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		docs := state.KnowledgeDocuments
+		if docs == nil {
+			docs = []store.KnowledgeDocument{}
+		}
+		writeJSON(w, map[string]any{"documents": docs})
+	case len(rest) == 0 && r.Method == http.MethodPost:
+		h.uploadKnowledgeDocument(w, r, sessionID)
+	case len(rest) == 1 && r.Method == http.MethodGet:
+		doc, text, err := h.store.GetKnowledgeDocument(sessionID, rest[0])
+		if errors.Is(err, store.ErrDocumentNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, map[string]any{"document": doc, "text": text})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// uploadKnowledgeDocument multipart 表单：file 为文档，可选 name、format（覆盖自动识别）与 mode（同 IngestKnowledge）。
+// 提取出的文本经切分后追加到知识库，块带有文档名、章节路径与字符偏移
+func (h *Handler) uploadKnowledgeDocument(w http.ResponseWriter, r *http.Request, sessionID string) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxDocumentBytes+1<<20)
+	if err := r.ParseMultipartForm(8 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "document too large")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "invalid multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "file is required")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxDocumentBytes+1))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(data) > maxDocumentBytes {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "document too large")
+		return
+	}
+	mode, ok := validIngestMode(r.FormValue("mode"))
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "mode must be auto, semantic or rule")
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		name = header.Filename
+	}
+	format := r.FormValue("format")
+	if format == "" {
+		format = docparse.Detect(header.Filename, data)
+	}
+	if !docparse.Valid(format) {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "unsupported document format, expected markdown, html, text, csv or docx")
+		return
+	}
+	text, err := docparse.Extract(format, header.Filename, data)
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if text == "" {
+		writeJSONError(w, http.StatusUnprocessableEntity, "document contains no text")
+		return
+	}
+	if len(text) > maxIngestBytes {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "extracted text too large")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), ingestTimeout)
+	defer cancel()
+	chunks, stats, err := splitKnowledge(ctx, text, mode)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	doc := store.KnowledgeDocument{
+		ID:          store.NewDocumentID(),
+		Name:        name,
+		Format:      format,
+		ContentType: header.Header.Get("Content-Type"),
+		Size:        len(data),
+		Chars:       utf8.RuneCountInString(text),
+	}
+	chunker.Annotate(text, chunks, doc.ID, doc.Name)
+	if err := h.store.AddKnowledgeDocument(sessionID, &doc, text, chunks); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := ingestResult(chunks, stats)
+	out["document"] = doc
+	writeJSON(w, out)
+}
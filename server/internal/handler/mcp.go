@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"agentic-demo/server/internal/mcp"
@@ -11,13 +12,170 @@ import (
 )
 
 type mcpServerResp struct {
-	ID          string `json:"id"`
-	Name        string `json:"name,omitempty"`
-	URL         string `json:"url"`
-	Status      string `json:"status,omitempty"`
-	LastError   string `json:"lastError,omitempty"`
-	ToolsCount  int    `json:"toolsCount,omitempty"`
-	LastCheckAt int64  `json:"lastCheckAt,omitempty"`
+	ID          string             `json:"id"`
+	Name        string             `json:"name,omitempty"`
+	URL         string             `json:"url"`
+	Transport   string             `json:"transport"`
+	Command     string             `json:"command,omitempty"`
+	Args        []string           `json:"args,omitempty"`
+	Env         map[string]string  `json:"env,omitempty"`
+	Cwd         string             `json:"cwd,omitempty"`
+	Status      string             `json:"status,omitempty"`
+	LastError   string             `json:"lastError,omitempty"`
+	ToolsCount  int                `json:"toolsCount,omitempty"`
+	LastCheckAt int64              `json:"lastCheckAt,omitempty"`
+	Process     *mcp.ProcessStatus `json:"process,omitempty"` // 仅 stdio
+	Headers     map[string]string  `json:"headers,omitempty"` // 仅返回头名称，值已脱敏
+	Auth        *mcpAuthResp       `json:"auth,omitempty"`
+}
+
+// mcpAuthResp 鉴权配置的脱敏视图：不回显 token、密码与 client secret，仅标记是否已设置
+type mcpAuthResp struct {
+	Type            string   `json:"type"`
+	Username        string   `json:"username,omitempty"`
+	TokenURL        string   `json:"tokenUrl,omitempty"`
+	ClientID        string   `json:"clientId,omitempty"`
+	Scopes          []string `json:"scopes,omitempty"`
+	HasToken        bool     `json:"hasToken,omitempty"`
+	HasPassword     bool     `json:"hasPassword,omitempty"`
+	HasClientSecret bool     `json:"hasClientSecret,omitempty"`
+}
+
+// redactedSecret 脱敏占位符；更新时请求头取该值表示保留原值
+const redactedSecret = "******"
+
+func redactMcpHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(headers))
+	for k := range headers {
+		out[k] = redactedSecret
+	}
+	return out
+}
+
+// redactMcpEnv 脱敏名称像凭证的环境变量，其余原样返回
+func redactMcpEnv(env map[string]string) map[string]string {
+	if len(env) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(env))
+	for k, v := range env {
+		if isSensitiveEnv(k) {
+			v = redactedSecret
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func redactMcpAuth(a *store.McpAuth) *mcpAuthResp {
+	if a == nil {
+		return nil
+	}
+	return &mcpAuthResp{
+		Type: a.Type, Username: a.Username, TokenURL: a.TokenURL, ClientID: a.ClientID, Scopes: a.Scopes,
+		HasToken: a.Token != "", HasPassword: a.Password != "", HasClientSecret: a.ClientSecret != "",
+	}
+}
+
+// mergeMcpHeaders 合并请求头更新：值为脱敏占位符时沿用原值，未出现的头被删除
+func mergeMcpHeaders(prev, next map[string]string) map[string]string {
+	if next == nil {
+		return prev
+	}
+	out := make(map[string]string, len(next))
+	for k, v := range next {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		if v == redactedSecret {
+			if old, ok := prev[k]; ok {
+				out[k] = old
+			}
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// validateMcpAuth 校验鉴权配置，返回空串表示合法
+func validateMcpAuth(a *store.McpAuth) string {
+	if a == nil {
+		return ""
+	}
+	switch a.Type {
+	case store.McpAuthBearer:
+		if a.Token == "" {
+			return "bearer 鉴权需要 token"
+		}
+	case store.McpAuthBasic:
+		if a.Username == "" {
+			return "basic 鉴权需要 username"
+		}
+	case store.McpAuthOAuth2:
+		if a.TokenURL == "" || a.ClientID == "" {
+			return "oauth2 鉴权需要 tokenUrl 与 clientId"
+		}
+		return validateMcpURL(a.TokenURL)
+	default:
+		return "auth.type 必须为 none、bearer、basic 或 oauth2"
+	}
+	return ""
+}
+
+// validateMcpURL 按出站 URL 策略校验地址，返回错误信息（空表示通过）
+func validateMcpURL(raw string) string {
+	if err := mcp.Policy().CheckURL(raw); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func (h *Handler) mcpServerToResp(svr store.McpServer) mcpServerResp {
+	out := mcpServerResp{
+		ID: svr.ID, Name: svr.Name, URL: svr.URL, Transport: store.McpTransportHTTP,
+	}
+	if svr.IsStdio() {
+		out.Transport = store.McpTransportStdio
+		out.Command = svr.Command
+		out.Args = svr.Args
+		out.Env = redactMcpEnv(svr.Env)
+		out.Cwd = svr.Cwd
+		if p := h.mcpProcess(svr.ID); p != nil {
+			st := p.Status()
+			out.Process = &st
+		}
+	}
+	out.Headers = redactMcpHeaders(svr.Headers)
+	out.Auth = redactMcpAuth(svr.Auth)
+	return out
+}
+
+func (h *Handler) mcpProcess(id string) *mcp.StdioProcess {
+	if h.mcpProcs == nil {
+		return nil
+	}
+	return h.mcpProcs.Get(id)
+}
+
+func stdioConfig(svr store.McpServer) mcp.StdioConfig {
+	return mcp.StdioConfig{Command: svr.Command, Args: svr.Args, Env: svr.Env, Dir: svr.Cwd}
+}
+
+// StartMcpProcesses 拉起所有已配置的 stdio MCP 服务器（服务启动时调用）
+func (h *Handler) StartMcpProcesses() {
+	if h.mcpStore == nil || h.mcpProcs == nil {
+		return
+	}
+	for _, svr := range h.mcpStore.List() {
+		if svr.IsStdio() {
+			h.mcpProcs.Start(svr.ID, stdioConfig(svr))
+		}
+	}
 }
 
 func (h *Handler) ListMcpServers(w http.ResponseWriter, r *http.Request) {
@@ -32,7 +190,7 @@ func (h *Handler) ListMcpServers(w http.ResponseWriter, r *http.Request) {
 	list := h.mcpStore.List()
 	out := make([]mcpServerResp, len(list))
 	for i, s := range list {
-		out[i] = mcpServerResp{ID: s.ID, Name: s.Name, URL: s.URL}
+		out[i] = h.mcpServerToResp(s)
 		if h.mcpStatus != nil {
 			if st := h.mcpStatus.Get(s.ID); st != nil {
 				out[i].Status = st.Status
@@ -55,19 +213,57 @@ func (h *Handler) AddMcpServer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var body struct {
-		URL  string `json:"url"`
-		Name string `json:"name"`
+		URL       string            `json:"url"`
+		Name      string            `json:"name"`
+		Transport string            `json:"transport"`
+		Command   string            `json:"command"`
+		Args      []string          `json:"args"`
+		Env       map[string]string `json:"env"`
+		Cwd       string            `json:"cwd"`
+		Headers   map[string]string `json:"headers"`
+		Auth      *store.McpAuth    `json:"auth"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
 		return
 	}
-	body.URL = strings.TrimSpace(body.URL)
-	if body.URL == "" {
-		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "url required"})
+	candidate := store.McpServer{Name: body.Name}
+	switch body.Transport {
+	case "", store.McpTransportHTTP:
+		candidate.URL = strings.TrimSpace(body.URL)
+		if candidate.URL == "" {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "url required"})
+			return
+		}
+		if msg := validateMcpURL(candidate.URL); msg != "" {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": msg})
+			return
+		}
+		candidate.Headers = mergeMcpHeaders(nil, body.Headers)
+		candidate.Auth = store.MergeMcpAuth(nil, body.Auth)
+		if msg := validateMcpAuth(candidate.Auth); msg != "" {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": msg})
+			return
+		}
+	case store.McpTransportStdio:
+		if body.Headers != nil || body.Auth != nil {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "headers/auth 仅适用于 http 服务器"})
+			return
+		}
+		candidate.Transport = store.McpTransportStdio
+		candidate.Command = strings.TrimSpace(body.Command)
+		candidate.Args = body.Args
+		candidate.Env = body.Env
+		candidate.Cwd = strings.TrimSpace(body.Cwd)
+		if candidate.Command == "" {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "command required"})
+			return
+		}
+	default:
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "transport must be http or stdio"})
 		return
 	}
-	svr, err := h.mcpStore.Add(body.Name, body.URL)
+	svr, err := h.mcpStore.AddServer(candidate)
 	if err != nil {
 		if errors.Is(err, store.ErrMcpExists) {
 			writeJSONStatus(w, http.StatusConflict, map[string]string{"error": "该 MCP 地址已存在"})
@@ -79,7 +275,10 @@ func (h *Handler) AddMcpServer(w http.ResponseWriter, r *http.Request) {
 	if h.mcpStatus != nil {
 		h.mcpStatus.EnsureEntry(svr.ID)
 	}
-	writeJSONStatus(w, http.StatusCreated, mcpServerResp{ID: svr.ID, Name: svr.Name, URL: svr.URL})
+	if svr.IsStdio() && h.mcpProcs != nil {
+		h.mcpProcs.Start(svr.ID, stdioConfig(svr))
+	}
+	writeJSONStatus(w, http.StatusCreated, h.mcpServerToResp(svr))
 }
 
 func (h *Handler) UpdateMcpServer(w http.ResponseWriter, r *http.Request, id string) {
@@ -92,19 +291,37 @@ func (h *Handler) UpdateMcpServer(w http.ResponseWriter, r *http.Request, id str
 		return
 	}
 	var body struct {
-		Name string `json:"name"`
-		URL  string `json:"url"`
+		Name    string            `json:"name"`
+		URL     string            `json:"url"`
+		Command *string           `json:"command"`
+		Args    []string          `json:"args"`
+		Env     map[string]string `json:"env"`
+		Cwd     *string           `json:"cwd"`
+		Headers map[string]string `json:"headers"`
+		Auth    *store.McpAuth    `json:"auth"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
 		return
 	}
+	if body.Command != nil || body.Args != nil || body.Env != nil || body.Cwd != nil {
+		h.updateMcpStdio(w, id, body.Name, body.Command, body.Args, body.Env, body.Cwd)
+		return
+	}
+	if body.Headers != nil || body.Auth != nil {
+		h.updateMcpAuth(w, id, body.Name, body.URL, body.Headers, body.Auth)
+		return
+	}
 	updates := make(map[string]string)
 	if body.Name != "" {
 		updates["name"] = strings.TrimSpace(body.Name)
 	}
 	if body.URL != "" {
 		updates["url"] = strings.TrimSpace(body.URL)
+		if msg := validateMcpURL(updates["url"]); msg != "" {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": msg})
+			return
+		}
 	}
 	if len(updates) == 0 {
 		svr, _ := h.mcpStore.Get(id)
@@ -112,7 +329,7 @@ func (h *Handler) UpdateMcpServer(w http.ResponseWriter, r *http.Request, id str
 			writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
 			return
 		}
-		writeJSON(w, mcpServerResp{ID: svr.ID, Name: svr.Name, URL: svr.URL})
+		writeJSON(w, h.mcpServerToResp(*svr))
 		return
 	}
 	if err := h.mcpStore.Update(id, updates); err != nil {
@@ -127,14 +344,110 @@ func (h *Handler) UpdateMcpServer(w http.ResponseWriter, r *http.Request, id str
 		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	}
+	if _, ok := updates["url"]; ok && h.mcpToolSync != nil {
+		h.mcpToolSync.Disconnect(id)
+	}
 	svr, _ := h.mcpStore.Get(id)
 	if svr != nil {
-		writeJSON(w, mcpServerResp{ID: svr.ID, Name: svr.Name, URL: svr.URL})
+		writeJSON(w, h.mcpServerToResp(*svr))
 	} else {
 		writeJSONStatus(w, http.StatusOK, map[string]string{"status": "ok"})
 	}
 }
 
+// updateMcpAuth 更新 http 服务器的请求头与鉴权（可同时修改名称与地址）；脱敏占位符与空密钥沿用原值
+func (h *Handler) updateMcpAuth(w http.ResponseWriter, id, name, url string, headers map[string]string, auth *store.McpAuth) {
+	svr, _ := h.mcpStore.Get(id)
+	if svr == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	if svr.IsStdio() {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "headers/auth 仅适用于 http 服务器"})
+		return
+	}
+	if name != "" {
+		svr.Name = strings.TrimSpace(name)
+	}
+	if url != "" {
+		svr.URL = strings.TrimSpace(url)
+		if msg := validateMcpURL(svr.URL); msg != "" {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": msg})
+			return
+		}
+	}
+	svr.Headers = mergeMcpHeaders(svr.Headers, headers)
+	svr.Auth = store.MergeMcpAuth(svr.Auth, auth)
+	if msg := validateMcpAuth(svr.Auth); msg != "" {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+	if err := h.mcpStore.Replace(*svr); err != nil {
+		if errors.Is(err, store.ErrMcpExists) {
+			writeJSONStatus(w, http.StatusConflict, map[string]string{"error": "该 MCP 地址已被其他服务器使用"})
+			return
+		}
+		if errors.Is(err, store.ErrMcpNotFound) {
+			writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			return
+		}
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if h.mcpToolSync != nil {
+		h.mcpToolSync.Disconnect(id)
+	}
+	writeJSON(w, h.mcpServerToResp(*svr))
+}
+
+// updateMcpStdio 更新 stdio 服务器的启动参数并重启进程；nil 字段保持不变
+func (h *Handler) updateMcpStdio(w http.ResponseWriter, id, name string, command *string, args []string, env map[string]string, cwd *string) {
+	svr, _ := h.mcpStore.Get(id)
+	if svr == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	if !svr.IsStdio() {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "command/args/env/cwd 仅适用于 stdio 服务器"})
+		return
+	}
+	if name != "" {
+		svr.Name = strings.TrimSpace(name)
+	}
+	if command != nil {
+		svr.Command = strings.TrimSpace(*command)
+		if svr.Command == "" {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "command required"})
+			return
+		}
+	}
+	if args != nil {
+		svr.Args = args
+	}
+	if env != nil {
+		svr.Env = mergeRedactedEnv(svr.Env, env)
+	}
+	if cwd != nil {
+		svr.Cwd = strings.TrimSpace(*cwd)
+	}
+	if err := h.mcpStore.Replace(*svr); err != nil {
+		if errors.Is(err, store.ErrMcpExists) {
+			writeJSONStatus(w, http.StatusConflict, map[string]string{"error": "该命令已被其他服务器使用"})
+			return
+		}
+		if errors.Is(err, store.ErrMcpNotFound) {
+			writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			return
+		}
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if h.mcpProcs != nil {
+		h.mcpProcs.Start(svr.ID, stdioConfig(*svr))
+	}
+	writeJSON(w, h.mcpServerToResp(*svr))
+}
+
 func (h *Handler) DeleteMcpServer(w http.ResponseWriter, r *http.Request, id string) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -155,6 +468,15 @@ func (h *Handler) DeleteMcpServer(w http.ResponseWriter, r *http.Request, id str
 	if h.mcpStatus != nil {
 		h.mcpStatus.RemoveServer(id)
 	}
+	if h.mcpProcs != nil {
+		h.mcpProcs.Stop(id)
+	}
+	if h.mcpCatalog != nil {
+		h.mcpCatalog.Forget(id)
+	}
+	if h.mcpToolSync != nil {
+		h.mcpToolSync.Remove(id)
+	}
 	writeJSON(w, map[string]string{"status": "deleted"})
 }
 
@@ -176,8 +498,12 @@ func (h *Handler) CheckMcpServer(w http.ResponseWriter, r *http.Request, id stri
 	h.mcpStatus.EnsureEntry(id)
 	h.mcpStatus.SetChecking(id)
 
-	result, _ := mcp.Check(r.Context(), svr.URL)
-	h.mcpStatus.SetResult(id, result.Status, result.Error, result.ToolsCount, result.Endpoint)
+	var result *mcp.CheckResult
+	if h.mcpMonitor != nil {
+		result = h.mcpMonitor.CheckNow(r.Context(), *svr)
+	} else {
+		result = mcp.RunCheck(r.Context(), *svr, h.mcpProcs, h.mcpStatus)
+	}
 
 	writeJSON(w, map[string]interface{}{
 		"id":         id,
@@ -187,7 +513,7 @@ func (h *Handler) CheckMcpServer(w http.ResponseWriter, r *http.Request, id stri
 	})
 }
 
-// GetMcpServerStatus 获取单个 MCP 服务器的状态
+// GetMcpServerStatus 获取单个 MCP 服务器的状态，含可用率、最近状态变化与检查历史（?history=N，默认 20）
 func (h *Handler) GetMcpServerStatus(w http.ResponseWriter, r *http.Request, id string) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -202,11 +528,65 @@ func (h *Handler) GetMcpServerStatus(w http.ResponseWriter, r *http.Request, id
 		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
 		return
 	}
-	writeJSON(w, map[string]interface{}{
+	historyLimit := 20
+	if v, err := strconv.Atoi(r.URL.Query().Get("history")); err == nil && v >= 0 {
+		historyLimit = v
+	}
+	history := st.History
+	if len(history) > historyLimit {
+		history = history[len(history)-historyLimit:]
+	}
+	out := map[string]interface{}{
 		"id":          id,
 		"status":      st.Status,
 		"lastCheckAt": st.LastCheckAt,
 		"lastError":   st.LastError,
 		"toolsCount":  st.ToolsCount,
+		"latencyMs":   st.LatencyMs,
+		"transitions": st.Transitions(10),
+		"history":     history,
+		"checks":      len(st.History),
+	}
+	if uptime := st.Uptime(); uptime >= 0 {
+		out["uptime"] = uptime
+	}
+	if p := h.mcpProcess(id); p != nil {
+		out["process"] = p.Status()
+	}
+	writeJSON(w, out)
+}
+
+// GetMcpServerLogs 返回 stdio 服务器进程最近的 stderr 输出，limit 默认 200
+func (h *Handler) GetMcpServerLogs(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.mcpStore == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "mcp store not configured"})
+		return
+	}
+	svr, _ := h.mcpStore.Get(id)
+	if svr == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	if !svr.IsStdio() {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "仅 stdio 服务器提供进程日志"})
+		return
+	}
+	limit := 200
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	p := h.mcpProcess(id)
+	if p == nil {
+		writeJSON(w, map[string]interface{}{
+			"id": id, "process": mcp.ProcessStatus{State: mcp.ProcessStopped}, "lines": []mcp.LogLine{},
+		})
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"id": id, "process": p.Status(), "lines": p.Logs(limit),
 	})
 }
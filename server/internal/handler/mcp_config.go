@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"agentic-demo/server/internal/store"
+)
+
+// mcpConfigEntry 通用 mcpServers 配置中的一项（与桌面端 MCP 客户端格式兼容）
+type mcpConfigEntry struct {
+	Type    string            `json:"type,omitempty"` // stdio | sse | http | streamable-http，可省略
+	URL     string            `json:"url,omitempty"`
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Cwd     string            `json:"cwd,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Auth    *store.McpAuth    `json:"auth,omitempty"`
+}
+
+type mcpConfigFile struct {
+	McpServers map[string]mcpConfigEntry `json:"mcpServers"`
+}
+
+// 导入预览中每项的处理动作
+const (
+	mcpImportCreate   = "create"
+	mcpImportConflict = "conflict" // 与已有服务器冲突，按 onConflict=skip 跳过
+	mcpImportReplace  = "replace"
+	mcpImportInvalid  = "invalid"
+)
+
+type mcpImportItem struct {
+	Name         string   `json:"name"`
+	Transport    string   `json:"transport"`
+	Action       string   `json:"action"`
+	ID           string   `json:"id,omitempty"` // 新建或被替换的服务器 ID
+	ConflictID   string   `json:"conflictId,omitempty"`
+	ConflictName string   `json:"conflictName,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+// sensitiveEnvMarkers 环境变量名包含这些片段时导出会脱敏
+var sensitiveEnvMarkers = []string{"KEY", "TOKEN", "SECRET", "PASSWORD", "PASSWD", "CREDENTIAL", "AUTH"}
+
+func isSensitiveEnv(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, m := range sensitiveEnvMarkers {
+		if strings.Contains(upper, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExportMcpConfig 以 {"mcpServers": {...}} 格式导出全部服务器；请求头、鉴权密钥与敏感环境变量已脱敏
+func (h *Handler) ExportMcpConfig(w http.ResponseWriter, r *http.Request) {
+	if h.mcpStore == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "mcp store not configured"})
+		return
+	}
+	out := mcpConfigFile{McpServers: map[string]mcpConfigEntry{}}
+	for _, svr := range h.mcpStore.List() {
+		name := uniqueConfigName(out.McpServers, svr)
+		if svr.IsStdio() {
+			out.McpServers[name] = mcpConfigEntry{Command: svr.Command, Args: svr.Args, Env: redactMcpEnv(svr.Env), Cwd: svr.Cwd}
+			continue
+		}
+		entry := mcpConfigEntry{URL: svr.URL, Headers: redactMcpHeaders(svr.Headers)}
+		if svr.Auth != nil {
+			a := *svr.Auth
+			for _, secret := range []*string{&a.Token, &a.Password, &a.ClientSecret} {
+				if *secret != "" {
+					*secret = redactedSecret
+				}
+			}
+			entry.Auth = &a
+		}
+		out.McpServers[name] = entry
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="mcp_servers.json"`)
+	writeJSON(w, out)
+}
+
+// uniqueConfigName 导出时的服务器名：优先使用名称，空名或重名时依次追加序号
+func uniqueConfigName(taken map[string]mcpConfigEntry, svr store.McpServer) string {
+	base := strings.TrimSpace(svr.Name)
+	if base == "" {
+		base = svr.ID
+	}
+	name := base
+	for i := 2; ; i++ {
+		if _, ok := taken[name]; !ok {
+			return name
+		}
+		name = base + "-" + strconv.Itoa(i)
+	}
+}
+
+// ImportMcpConfig 导入 {"mcpServers": {...}} 配置。?dryRun=1 仅返回预览；
+// 冲突按地址（normalizeMcpUrl）或命令行判定，onConflict=skip（默认）跳过、replace 覆盖已有配置
+func (h *Handler) ImportMcpConfig(w http.ResponseWriter, r *http.Request) {
+	if h.mcpStore == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "mcp store not configured"})
+		return
+	}
+	var body struct {
+		mcpConfigFile
+		OnConflict string `json:"onConflict"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	if len(body.McpServers) == 0 {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "mcpServers required"})
+		return
+	}
+	switch body.OnConflict {
+	case "":
+		body.OnConflict = "skip"
+	case "skip", "replace":
+	default:
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "onConflict 必须为 skip 或 replace"})
+		return
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "1" || r.URL.Query().Get("dryRun") == "true"
+
+	names := make([]string, 0, len(body.McpServers))
+	for name := range body.McpServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]mcpImportItem, 0, len(names))
+	counts := map[string]int{}
+	seen := map[string]string{} // 本批已处理的去重键 -> 配置名
+	for _, name := range names {
+		item := h.importMcpEntry(name, body.McpServers[name], seen, body.OnConflict == "replace", dryRun)
+		counts[item.Action]++
+		items = append(items, item)
+	}
+	writeJSON(w, map[string]interface{}{
+		"dryRun":  dryRun,
+		"items":   items,
+		"summary": counts,
+	})
+}
+
+// importMcpEntry 校验并（非 dryRun 时）落盘一项配置；与本批中前面的配置地址/命令相同时视为冲突
+func (h *Handler) importMcpEntry(name string, e mcpConfigEntry, seen map[string]string, replace, dryRun bool) mcpImportItem {
+	item := mcpImportItem{Name: name}
+	svr, err := mcpServerFromConfig(name, e)
+	if err != nil {
+		item.Action = mcpImportInvalid
+		item.Error = err.Error()
+		return item
+	}
+	item.Transport = store.McpTransportHTTP
+	if svr.IsStdio() {
+		item.Transport = store.McpTransportStdio
+	}
+	key := store.McpServerKey(svr)
+	if first, ok := seen[key]; ok {
+		item.Action = mcpImportConflict
+		item.ConflictName = first
+		item.Error = "与本次导入的 " + first + " 地址/命令相同"
+		return item
+	}
+	seen[key] = name
+
+	existing := h.mcpStore.FindConflict(svr)
+	if existing == nil {
+		item.Action = mcpImportCreate
+		item.Warnings = dropRedacted(&svr)
+		if dryRun {
+			return item
+		}
+		created, err := h.mcpStore.AddServer(svr)
+		if err != nil {
+			item.Action = mcpImportInvalid
+			item.Error = err.Error()
+			return item
+		}
+		item.ID = created.ID
+		h.afterMcpImport(created, false)
+		return item
+	}
+
+	item.ConflictID = existing.ID
+	item.ConflictName = existing.Name
+	if !replace {
+		item.Action = mcpImportConflict
+		return item
+	}
+	item.Action = mcpImportReplace
+	item.ID = existing.ID
+	// 导出文件中的脱敏占位符沿用已有服务器的原值
+	svr.ID = existing.ID
+	svr.Headers = mergeMcpHeaders(existing.Headers, svr.Headers)
+	svr.Auth = store.MergeMcpAuth(existing.Auth, blankRedactedAuth(svr.Auth))
+	svr.Env = mergeRedactedEnv(existing.Env, svr.Env)
+	if msg := validateMcpAuth(svr.Auth); msg != "" {
+		item.Action = mcpImportInvalid
+		item.Error = msg
+		return item
+	}
+	if dryRun {
+		return item
+	}
+	if err := h.mcpStore.Replace(svr); err != nil {
+		if errors.Is(err, store.ErrMcpExists) {
+			err = errors.New("该 MCP 地址已被其他服务器使用")
+		}
+		item.Action = mcpImportInvalid
+		item.Error = err.Error()
+		return item
+	}
+	h.afterMcpImport(svr, true)
+	return item
+}
+
+// afterMcpImport 导入后拉起 stdio 进程；替换时断开旧连接以按新配置重连
+func (h *Handler) afterMcpImport(svr store.McpServer, replaced bool) {
+	if h.mcpStatus != nil {
+		h.mcpStatus.EnsureEntry(svr.ID)
+	}
+	if svr.IsStdio() && h.mcpProcs != nil {
+		h.mcpProcs.Start(svr.ID, stdioConfig(svr))
+	}
+	if replaced && h.mcpToolSync != nil {
+		h.mcpToolSync.Disconnect(svr.ID)
+	}
+}
+
+// mcpServerFromConfig 把配置项转换为服务器定义：有 command 或 type=stdio 视为 stdio，否则需要 url
+func mcpServerFromConfig(name string, e mcpConfigEntry) (store.McpServer, error) {
+	svr := store.McpServer{Name: strings.TrimSpace(name)}
+	stdio := e.Command != "" || e.Type == store.McpTransportStdio
+	switch {
+	case stdio:
+		if strings.TrimSpace(e.Command) == "" {
+			return svr, errors.New("command required")
+		}
+		if e.URL != "" || len(e.Headers) > 0 || e.Auth != nil {
+			return svr, errors.New("stdio 服务器不能同时配置 url/headers/auth")
+		}
+		svr.Transport = store.McpTransportStdio
+		svr.Command = strings.TrimSpace(e.Command)
+		svr.Args = e.Args
+		svr.Env = e.Env
+		svr.Cwd = strings.TrimSpace(e.Cwd)
+	case e.Type != "" && e.Type != "sse" && e.Type != store.McpTransportHTTP && e.Type != "streamable-http" && e.Type != "streamableHttp":
+		return svr, errors.New("unsupported type: " + e.Type)
+	default:
+		svr.URL = strings.TrimSpace(e.URL)
+		if svr.URL == "" {
+			return svr, errors.New("url or command required")
+		}
+		if msg := validateMcpURL(svr.URL); msg != "" {
+			return svr, errors.New(msg)
+		}
+		svr.Headers = e.Headers
+		if e.Auth != nil && e.Auth.Type != "" && e.Auth.Type != store.McpAuthNone {
+			a := *e.Auth
+			svr.Auth = &a
+			if msg := validateMcpAuth(blankRedactedAuth(svr.Auth)); msg != "" && !hasRedacted(svr.Auth) {
+				return svr, errors.New(msg)
+			}
+		}
+	}
+	return svr, nil
+}
+
+// dropRedacted 新建时无法还原脱敏占位符：移除对应字段并返回提示
+func dropRedacted(svr *store.McpServer) []string {
+	var warnings []string
+	for k, v := range svr.Headers {
+		if v == redactedSecret {
+			delete(svr.Headers, k)
+			warnings = append(warnings, "请求头 "+k+" 为脱敏占位符，已忽略")
+		}
+	}
+	for k, v := range svr.Env {
+		if v == redactedSecret {
+			delete(svr.Env, k)
+			warnings = append(warnings, "环境变量 "+k+" 为脱敏占位符，已忽略")
+		}
+	}
+	if svr.Auth != nil && hasRedacted(svr.Auth) {
+		svr.Auth = nil
+		warnings = append(warnings, "鉴权密钥为脱敏占位符，已忽略鉴权配置，请导入后补充")
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+func hasRedacted(a *store.McpAuth) bool {
+	return a != nil && (a.Token == redactedSecret || a.Password == redactedSecret || a.ClientSecret == redactedSecret)
+}
+
+// blankRedactedAuth 把脱敏占位符置空，交给 MergeMcpAuth 沿用原值
+func blankRedactedAuth(a *store.McpAuth) *store.McpAuth {
+	if a == nil {
+		return nil
+	}
+	c := *a
+	for _, secret := range []*string{&c.Token, &c.Password, &c.ClientSecret} {
+		if *secret == redactedSecret {
+			*secret = ""
+		}
+	}
+	return &c
+}
+
+// mergeRedactedEnv 值为脱敏占位符的环境变量沿用原值
+func mergeRedactedEnv(prev, next map[string]string) map[string]string {
+	if next == nil {
+		return nil
+	}
+	out := make(map[string]string, len(next))
+	for k, v := range next {
+		if v == redactedSecret {
+			if old, ok := prev[k]; ok {
+				out[k] = old
+			}
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
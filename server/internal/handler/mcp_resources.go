@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+
+	"agentic-demo/server/internal/mcp"
+	"agentic-demo/server/internal/prompts"
+	"agentic-demo/server/internal/store"
+)
+
+// connectMcp 为服务器建立会话；失败时已写入错误响应并返回 ok=false
+func (h *Handler) connectMcp(w http.ResponseWriter, r *http.Request, id string) (*store.McpServer, mcp.Caller, func(), bool) {
+	if h.mcpStore == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "mcp store not configured"})
+		return nil, nil, nil, false
+	}
+	svr, _ := h.mcpStore.Get(id)
+	if svr == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return nil, nil, nil, false
+	}
+	caller, closeFn, err := mcp.Connect(r.Context(), *svr, h.mcpProcs)
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadGateway, map[string]string{"error": "连接 MCP 服务器失败: " + err.Error()})
+		return nil, nil, nil, false
+	}
+	return svr, caller, closeFn, true
+}
+
+// ListMcpResources 列举服务器资源，并同步到资源目录
+func (h *Handler) ListMcpResources(w http.ResponseWriter, r *http.Request, id string) {
+	_, caller, closeFn, ok := h.connectMcp(w, r, id)
+	if !ok {
+		return
+	}
+	defer closeFn()
+	list, err := mcp.ListResources(r.Context(), caller)
+	if err != nil {
+		if mcp.IsMethodNotFound(err) {
+			writeJSON(w, map[string]interface{}{"resources": []mcp.Resource{}, "supported": false})
+			return
+		}
+		writeJSONStatus(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	if h.mcpCatalog != nil {
+		h.mcpCatalog.Set(id, list)
+	}
+	if list == nil {
+		list = []mcp.Resource{}
+	}
+	writeJSON(w, map[string]interface{}{"resources": list, "supported": true})
+}
+
+// ReadMcpResource 读取资源内容：?uri=
+func (h *Handler) ReadMcpResource(w http.ResponseWriter, r *http.Request, id string) {
+	uri := r.URL.Query().Get("uri")
+	if uri == "" {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "uri required"})
+		return
+	}
+	_, caller, closeFn, ok := h.connectMcp(w, r, id)
+	if !ok {
+		return
+	}
+	defer closeFn()
+	contents, err := mcp.ReadResource(r.Context(), caller, uri)
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"uri": uri, "contents": contents})
+}
+
+// ImportMcpResource 把资源导入会话：target=knowledge（默认）追加为知识库分块，target=file 写入 VFS 作为可引用文件
+func (h *Handler) ImportMcpResource(w http.ResponseWriter, r *http.Request, id string) {
+	var body struct {
+		SessionID string `json:"sessionId"`
+		URI       string `json:"uri"`
+		Target    string `json:"target"`
+		Path      string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	if body.SessionID == "" || body.URI == "" {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "sessionId and uri required"})
+		return
+	}
+	if body.Target == "" {
+		body.Target = "knowledge"
+	}
+	if body.Target != "knowledge" && body.Target != "file" {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "target 必须为 knowledge 或 file"})
+		return
+	}
+	if body.Target == "file" && body.Path != "" {
+		p, err := store.NormalizeVFSPath(body.Path)
+		if err != nil {
+			writeVFSError(w, err)
+			return
+		}
+		body.Path = p
+	}
+	svr, caller, closeFn, ok := h.connectMcp(w, r, id)
+	if !ok {
+		return
+	}
+	defer closeFn()
+	contents, err := mcp.ReadResource(r.Context(), caller, body.URI)
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if body.Target == "file" {
+		p := body.Path
+		if p == "" {
+			// 默认路径来自服务器名与资源 URI，同样不可信
+			if p, err = store.NormalizeVFSPath(resourceFilePath(svr.Name, body.URI)); err != nil {
+				writeVFSError(w, err)
+				return
+			}
+		}
+		mime := ""
+		if len(contents) > 0 {
+			mime = contents[0].MimeType
+		}
+		src := store.RevisionSource{Source: "mcp_resource"}
+		if err := h.store.CommitVFS(body.SessionID, p, mcp.ResourceText(contents), languageForResource(p, mime), src); err != nil {
+			writeVFSError(w, err)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"success": true, "path": p})
+		return
+	}
+
+	var chunks []store.KnowledgeChunk
+	for _, c := range contents {
+		if c.Text == "" {
+			continue
+		}
+		chunks = append(chunks, store.KnowledgeChunk{
+			Content:        c.Text,
+			Summary:        svr.Name + " · " + c.URI,
+			BoundaryReason: "MCP 资源",
+		})
+	}
+	if len(chunks) == 0 {
+		writeJSONStatus(w, http.StatusUnprocessableEntity, map[string]string{"error": "资源不含文本内容"})
+		return
+	}
+	if err := h.store.AppendKnowledgeChunks(body.SessionID, chunks); err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"success": true, "chunks": len(chunks)})
+}
+
+// ListMcpPrompts 列举服务器提供的提示词模板
+func (h *Handler) ListMcpPrompts(w http.ResponseWriter, r *http.Request, id string) {
+	_, caller, closeFn, ok := h.connectMcp(w, r, id)
+	if !ok {
+		return
+	}
+	defer closeFn()
+	list, err := mcp.ListPrompts(r.Context(), caller)
+	if err != nil {
+		if mcp.IsMethodNotFound(err) {
+			writeJSON(w, map[string]interface{}{"prompts": []mcp.Prompt{}, "supported": false})
+			return
+		}
+		writeJSONStatus(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	if list == nil {
+		list = []mcp.Prompt{}
+	}
+	writeJSON(w, map[string]interface{}{"prompts": list, "supported": true})
+}
+
+// GetMcpPrompt 以参数渲染提示词模板，text 字段可直接作为会话的起始消息
+func (h *Handler) GetMcpPrompt(w http.ResponseWriter, r *http.Request, id, name string) {
+	var body struct {
+		Arguments map[string]string `json:"arguments"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+			return
+		}
+	}
+	_, caller, closeFn, ok := h.connectMcp(w, r, id)
+	if !ok {
+		return
+	}
+	defer closeFn()
+	res, err := mcp.GetPrompt(r.Context(), caller, name, body.Arguments)
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"name":        name,
+		"description": res.Description,
+		"messages":    res.Messages,
+		"text":        res.Text(),
+	})
+}
+
+// mcpResourceRefs 资源目录中供系统提示词声明的资源
+func (h *Handler) mcpResourceRefs() []prompts.McpResourceRef {
+	if h.mcpCatalog == nil {
+		return nil
+	}
+	var refs []prompts.McpResourceRef
+	for _, r := range h.mcpCatalog.Resources() {
+		refs = append(refs, prompts.McpResourceRef{URI: r.URI, Name: r.Name, Description: r.Description})
+	}
+	return refs
+}
+
+// resourceFilePath 由资源 URI 生成 VFS 路径：mcp/<服务器名>/<URI 末段>
+func resourceFilePath(serverName, uri string) string {
+	base := uri
+	if i := strings.Index(base, "://"); i >= 0 {
+		base = base[i+3:]
+	}
+	base = path.Base(strings.TrimRight(base, "/"))
+	if base == "" || base == "." || base == ".." || base == "/" {
+		base = "resource.txt"
+	}
+	name := strings.TrimSpace(serverName)
+	if name == "" || name == "." || name == ".." {
+		name = "server"
+	}
+	return "mcp/" + strings.ReplaceAll(name, "/", "_") + "/" + base
+}
+
+func languageForResource(p, mime string) string {
+	switch {
+	case strings.HasSuffix(p, ".md") || mime == "text/markdown":
+		return "markdown"
+	case strings.HasSuffix(p, ".json") || mime == "application/json":
+		return "json"
+	case strings.HasSuffix(p, ".csv") || mime == "text/csv":
+		return "csv"
+	case strings.HasSuffix(p, ".html") || mime == "text/html":
+		return "html"
+	default:
+		return "plaintext"
+	}
+}
@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"agentic-demo/server/internal/config"
+	"agentic-demo/server/internal/registry"
+
+	"google.golang.org/genai"
+)
+
+// 对外 MCP 服务（Streamable HTTP，无状态）：把已启用的 registry 工具暴露给其他 Agent
+const (
+	mcpServeName       = "AgenticDemo"
+	mcpServeVersion    = "1.0.0"
+	mcpServeMaxBody    = 4 << 20
+	mcpAgentSessionHdr = "X-Session-Id"
+)
+
+// mcpServeProtocolVersions 支持的协议版本，首项为默认
+var mcpServeProtocolVersions = []string{"2025-03-26", "2025-06-18", "2024-11-05"}
+
+// mcpSessionTools 读写会话数据的工具，调用时必须指定会话
+var mcpSessionTools = map[string]bool{
+	"search_knowledge": true,
+	"write_file":       true,
+	"read_file":        true,
+	"list_files":       true,
+	"grep_files":       true,
+	"edit_file":        true,
+}
+
+// JSON-RPC 错误码
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+type mcpRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type mcpRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type mcpRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *mcpRPCError    `json:"error,omitempty"`
+}
+
+type mcpServeTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// McpServe /mcp：以 Streamable HTTP 提供 MCP 服务。仅支持 POST（单条或批量 JSON-RPC），响应为 application/json；
+// 不维护传输层会话。工具调用的会话 ID 取自 params._meta.sessionId、X-Session-Id 请求头或 ?sessionId=
+func (h *Handler) McpServe(w http.ResponseWriter, r *http.Request) {
+	if !mcpServeAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "only POST is supported")
+		return
+	}
+	body, err := readLimited(w, r, mcpServeMaxBody)
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, mcpRPCResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &mcpRPCError{Code: rpcParseError, Message: err.Error()}})
+		return
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(trimmed, &batch); err != nil || len(batch) == 0 {
+			writeJSONStatus(w, http.StatusBadRequest, mcpRPCResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+				Error: &mcpRPCError{Code: rpcParseError, Message: "invalid batch"}})
+			return
+		}
+		var out []mcpRPCResponse
+		for _, raw := range batch {
+			if resp := h.mcpServeOne(r, raw); resp != nil {
+				out = append(out, *resp)
+			}
+		}
+		if len(out) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		writeJSON(w, out)
+		return
+	}
+	resp := h.mcpServeOne(r, trimmed)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// mcpServeAuthorized 配置了 MCP_SERVER_TOKEN 时校验 Bearer 令牌；
+// 未配置时仅允许来自本机的连接，且 Origin 须为空或本机，防止网页经浏览器调用本机工具
+func mcpServeAuthorized(r *http.Request) bool {
+	if config.McpServerToken != "" {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return subtle.ConstantTimeCompare([]byte(got), []byte(config.McpServerToken)) == 1
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil || !isLoopbackHost(host) {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return isLoopbackHost(u.Hostname())
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func readLimited(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(http.MaxBytesReader(w, r.Body, limit)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mcpServeOne 处理一条消息；通知与客户端响应返回 nil
+func (h *Handler) mcpServeOne(r *http.Request, raw json.RawMessage) *mcpRPCResponse {
+	var req mcpRPCRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return &mcpRPCResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &mcpRPCError{Code: rpcParseError, Message: err.Error()}}
+	}
+	if len(req.ID) == 0 {
+		return nil
+	}
+	if req.Method == "" {
+		return &mcpRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &mcpRPCError{Code: rpcInvalidRequest, Message: "method required"}}
+	}
+	result, rpcErr := h.mcpServeDispatch(r, req)
+	resp := &mcpRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcErr}
+	if rpcErr == nil {
+		resp.Result = result
+	}
+	return resp
+}
+
+func (h *Handler) mcpServeDispatch(r *http.Request, req mcpRPCRequest) (any, *mcpRPCError) {
+	switch req.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		version := mcpServeProtocolVersions[0]
+		for _, v := range mcpServeProtocolVersions {
+			if v == p.ProtocolVersion {
+				version = v
+			}
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": mcpServeName, "version": mcpServeVersion},
+			"instructions":    "读写会话数据的工具（search_knowledge、write_file）需通过 _meta.sessionId 或 X-Session-Id 请求头指定会话",
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": h.mcpServeTools()}, nil
+	case "tools/call":
+		return h.mcpServeCall(r, req.Params)
+	default:
+		return nil, &mcpRPCError{Code: rpcMethodNotFound, Message: "method not found: " + req.Method}
+	}
+}
+
+// mcpExposedTool 返回可对外暴露的工具定义：已启用、非阻塞（需用户交互）且不是代理自其他 MCP 服务器的工具
+func (h *Handler) mcpExposedTool(id string) (*genai.FunctionDeclaration, bool) {
+	def, blocking, ok := h.registry.GetTool(id)
+	if !ok || blocking || h.registry.GetSource(id) == registry.SourceMcp {
+		return nil, false
+	}
+	if h.toolEnable != nil && !h.toolEnable.GetEnabled(id) {
+		return nil, false
+	}
+	return def, true
+}
+
+func (h *Handler) mcpServeTools() []mcpServeTool {
+	ids := h.registry.GetIDs()
+	sort.Strings(ids)
+	tools := make([]mcpServeTool, 0, len(ids))
+	for _, id := range ids {
+		def, ok := h.mcpExposedTool(id)
+		if !ok {
+			continue
+		}
+		tools = append(tools, mcpServeTool{
+			Name:        id,
+			Description: def.Description,
+			InputSchema: toolInputSchema(def),
+		})
+	}
+	return tools
+}
+
+func toolInputSchema(def *genai.FunctionDeclaration) map[string]any {
+	if m, ok := def.ParametersJsonSchema.(map[string]any); ok {
+		return m
+	}
+	s := registry.SchemaToJSON(def.Parameters)
+	s["type"] = "object"
+	return s
+}
+
+// mcpServeCall 执行 tools/call；工具自身的失败以 isError 结果返回，参数与工具名错误以 JSON-RPC 错误返回
+func (h *Handler) mcpServeCall(r *http.Request, params json.RawMessage) (any, *mcpRPCError) {
+	var p struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+		Meta      struct {
+			SessionID string `json:"sessionId"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil || p.Name == "" {
+		return nil, &mcpRPCError{Code: rpcInvalidParams, Message: "name required"}
+	}
+	if _, ok := h.mcpExposedTool(p.Name); !ok {
+		return nil, &mcpRPCError{Code: rpcInvalidParams, Message: "unknown tool: " + p.Name}
+	}
+	args := p.Arguments
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+
+	sessionID := p.Meta.SessionID
+	if sessionID == "" {
+		sessionID = r.Header.Get(mcpAgentSessionHdr)
+	}
+	if sessionID == "" {
+		sessionID = r.URL.Query().Get("sessionId")
+	}
+	if sessionID == "" && mcpSessionTools[p.Name] {
+		return mcpToolError(p.Name + " 需要指定会话：_meta.sessionId 或 " + mcpAgentSessionHdr + " 请求头"), nil
+	}
+	if sessionID != "" {
+		if sess, _ := h.store.GetSessionDoc(sessionID); sess == nil {
+			return mcpToolError("session not found: " + sessionID), nil
+		}
+	}
+
+	ctx := r.Context()
+	req := registry.ExecuteRequest{
+		Ctx:          ctx,
+		SessionID:    sessionID,
+		Store:        h.store,
+		TodoStore:    h.todoStore,
+		GeminiClient: newGeminiClient(ctx),
+		Caller:       "mcp",
+	}
+	res, err := h.registry.Execute(req, p.Name, args)
+	if err != nil {
+		out := mcpToolError(err.Error())
+		out["structuredContent"] = map[string]any{"error": err.Error(), "errorClass": registry.ErrorClassOf(err, "")}
+		return out, nil
+	}
+	if res == nil {
+		return mcpToolError("tool has no executor: " + p.Name), nil
+	}
+	text, _ := json.Marshal(res)
+	out := map[string]any{
+		"content": []map[string]any{{"type": "text", "text": string(text)}},
+	}
+	if m, ok := res.(map[string]interface{}); ok {
+		out["structuredContent"] = m
+		if msg, ok := m["error"].(string); ok && msg != "" {
+			out["isError"] = true
+		}
+	}
+	return out, nil
+}
+
+func mcpToolError(msg string) map[string]any {
+	return map[string]any{
+		"content": []map[string]any{{"type": "text", "text": msg}},
+		"isError": true,
+	}
+}
+
+// newGeminiClient 已配置 API Key 时创建 Gemini 客户端，供需要模型的工具使用
+func newGeminiClient(ctx context.Context) *genai.Client {
+	if config.GeminiAPIKey == "" {
+		return nil
+	}
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  config.GeminiAPIKey,
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		return nil
+	}
+	return client
+}
@@ -1,13 +1,65 @@
 package handler
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"agentic-demo/server/internal/mcp"
+	"agentic-demo/server/internal/registry"
+	"agentic-demo/server/internal/store"
 )
 
+// TestMain 以 MCP_TEST_HELPER=1 启动测试二进制时充当 stdio MCP 服务器
+func TestMain(m *testing.M) {
+	if os.Getenv("MCP_TEST_HELPER") == "1" {
+		runMcpTestHelper()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMcpTestHelper 按行读写 JSON-RPC：tools/call env 返回 API_TOKEN，crash 使进程异常退出
+func runMcpTestHelper() {
+	sc := bufio.NewScanner(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for sc.Scan() {
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				Name string `json:"name"`
+			} `json:"params"`
+		}
+		if json.Unmarshal(sc.Bytes(), &msg) != nil || len(msg.ID) == 0 {
+			continue
+		}
+		var result any
+		switch {
+		case msg.Method == "initialize":
+			result = map[string]any{"protocolVersion": "2025-03-26", "capabilities": map[string]any{}, "serverInfo": map[string]any{"name": "helper", "version": "1"}}
+		case msg.Method == "tools/call" && msg.Params.Name == "crash":
+			os.Exit(3)
+		case msg.Method == "tools/call":
+			result = map[string]any{"content": []any{map[string]any{"type": "text", "text": os.Getenv("API_TOKEN")}}}
+		default:
+			result = map[string]any{}
+		}
+		_ = enc.Encode(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+	}
+}
+
 func TestListMcpServers(t *testing.T) {
 	h := initTestHandlerWithTools(t)
 	req := httptest.NewRequest(http.MethodGet, "/api/mcp/servers", nil)
@@ -157,3 +209,661 @@ func TestCheckMcpServer_NotFound(t *testing.T) {
 		t.Errorf("CheckMcpServer notfound code = %d, want 404", rec.Code)
 	}
 }
+
+func TestAddMcpServer_Stdio(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	body := bytes.NewBufferString(`{"transport":"stdio","name":"mcp-notes","command":"uv","args":["run","python","mcp_notes.py"],"cwd":"mcp/mcp-notes"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/mcp/servers", body)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.AddMcpServer(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("AddMcpServer stdio code = %d, want 201", rec.Code)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out["transport"] != "stdio" || out["command"] != "uv" {
+		t.Errorf("unexpected response: %v", out)
+	}
+	id := out["id"].(string)
+
+	logReq := httptest.NewRequest(http.MethodGet, "/api/mcp/servers/"+id+"/logs", nil)
+	logRec := httptest.NewRecorder()
+	h.GetMcpServerLogs(logRec, logReq, id)
+	if logRec.Code != http.StatusOK {
+		t.Errorf("GetMcpServerLogs code = %d, want 200", logRec.Code)
+	}
+}
+
+func TestAddMcpServer_StdioMissingCommand(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	body := bytes.NewBufferString(`{"transport":"stdio","name":"broken"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/mcp/servers", body)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.AddMcpServer(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("AddMcpServer stdio without command code = %d, want 400", rec.Code)
+	}
+}
+
+func TestGetMcpServerLogs_HttpServer(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	body := bytes.NewBufferString(`{"url":"http://localhost:5206/mcp"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/mcp/servers", body)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.AddMcpServer(rec, req)
+	var addOut map[string]interface{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &addOut)
+	id := addOut["id"].(string)
+
+	logReq := httptest.NewRequest(http.MethodGet, "/api/mcp/servers/"+id+"/logs", nil)
+	logRec := httptest.NewRecorder()
+	h.GetMcpServerLogs(logRec, logReq, id)
+	if logRec.Code != http.StatusBadRequest {
+		t.Errorf("GetMcpServerLogs http server code = %d, want 400", logRec.Code)
+	}
+}
+
+func TestGetMcpServerStatus_History(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	body := bytes.NewBufferString(`{"url":"http://localhost:5207/mcp"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/mcp/servers", body)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.AddMcpServer(rec, req)
+	var addOut map[string]interface{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &addOut)
+	id := addOut["id"].(string)
+
+	h.mcpStatus.RecordCheck(id, store.McpCheckRecord{Status: store.McpStatusReady, LatencyMs: 12, ToolsCount: 3}, "")
+	h.mcpStatus.RecordCheck(id, store.McpCheckRecord{Status: store.McpStatusFailed, LatencyMs: 40, Error: "connection refused"}, "")
+
+	statusReq := httptest.NewRequest(http.MethodGet, "/api/mcp/servers/"+id+"/status", nil)
+	statusRec := httptest.NewRecorder()
+	h.GetMcpServerStatus(statusRec, statusReq, id)
+	if statusRec.Code != http.StatusOK {
+		t.Fatalf("GetMcpServerStatus code = %d, want 200", statusRec.Code)
+	}
+	var out struct {
+		Status      string                      `json:"status"`
+		Uptime      float64                     `json:"uptime"`
+		LatencyMs   int64                       `json:"latencyMs"`
+		Transitions []store.McpStatusTransition `json:"transitions"`
+		History     []store.McpCheckRecord      `json:"history"`
+	}
+	if err := json.Unmarshal(statusRec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Status != store.McpStatusFailed || out.LatencyMs != 40 {
+		t.Errorf("status = %q latency = %d, want failed/40", out.Status, out.LatencyMs)
+	}
+	if out.Uptime != 50 {
+		t.Errorf("uptime = %v, want 50", out.Uptime)
+	}
+	if len(out.Transitions) != 1 || out.Transitions[0].From != store.McpStatusReady || out.Transitions[0].To != store.McpStatusFailed {
+		t.Errorf("unexpected transitions: %+v", out.Transitions)
+	}
+	if len(out.History) != 2 {
+		t.Errorf("history len = %d, want 2", len(out.History))
+	}
+}
+
+func TestAddMcpServer_AuthRedacted(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	body := bytes.NewBufferString(`{"url":"http://localhost:5208/mcp","headers":{"X-Api-Key":"k1"},"auth":{"type":"bearer","token":"s3cret"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/mcp/servers", body)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.AddMcpServer(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("AddMcpServer code = %d, want 201: %s", rec.Code, rec.Body.String())
+	}
+	if bytes.Contains(rec.Body.Bytes(), []byte("s3cret")) || bytes.Contains(rec.Body.Bytes(), []byte("k1")) {
+		t.Errorf("response leaks secrets: %s", rec.Body.String())
+	}
+	var addOut map[string]interface{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &addOut)
+	id := addOut["id"].(string)
+
+	// 占位符表示保留原值，空 token 沿用原 token
+	upBody := bytes.NewBufferString(`{"headers":{"X-Api-Key":"******"},"auth":{"type":"bearer"}}`)
+	upReq := httptest.NewRequest(http.MethodPut, "/api/mcp/servers/"+id, upBody)
+	upRec := httptest.NewRecorder()
+	h.UpdateMcpServer(upRec, upReq, id)
+	if upRec.Code != http.StatusOK {
+		t.Fatalf("UpdateMcpServer code = %d, want 200: %s", upRec.Code, upRec.Body.String())
+	}
+	svr, _ := h.mcpStore.Get(id)
+	if svr == nil || svr.Headers["X-Api-Key"] != "k1" || svr.Auth == nil || svr.Auth.Token != "s3cret" {
+		t.Errorf("secrets not preserved on update: %+v", svr)
+	}
+}
+
+func TestMcpStore_KeyMismatch(t *testing.T) {
+	dir := t.TempDir()
+	box, _ := store.NewSecretBox(dir, "old-key")
+	s, err := store.NewMcpStoreWithSecret(dir, box)
+	if err != nil {
+		t.Fatalf("NewMcpStoreWithSecret: %v", err)
+	}
+	if _, err := s.AddServer(store.McpServer{Name: "a", URL: "http://localhost:5208/mcp", Auth: &store.McpAuth{Type: "bearer", Token: "s3cret"}}); err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+	before, _ := os.ReadFile(filepath.Join(dir, "mcp_servers.json"))
+
+	// 密钥变更后无法解密：拒绝启动，而不是以空列表启动并在下次保存时覆盖文件
+	other, _ := store.NewSecretBox(dir, "new-key")
+	if _, err := store.NewMcpStoreWithSecret(dir, other); !errors.Is(err, store.ErrSecretCorrupt) {
+		t.Fatalf("open with another key: err = %v, want ErrSecretCorrupt", err)
+	}
+	if after, _ := os.ReadFile(filepath.Join(dir, "mcp_servers.json")); !bytes.Equal(before, after) {
+		t.Error("servers file changed after failed load")
+	}
+}
+
+func TestAddMcpServer_AuthInvalid(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	body := bytes.NewBufferString(`{"url":"http://localhost:5209/mcp","auth":{"type":"oauth2","clientId":"c"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/mcp/servers", body)
+	rec := httptest.NewRecorder()
+	h.AddMcpServer(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("AddMcpServer invalid auth code = %d, want 400", rec.Code)
+	}
+}
+
+func TestAddMcpServer_URLPolicy(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	for _, u := range []string{"http://169.254.169.254/latest/meta-data", "file:///etc/passwd", "http://[fe80::1]:8080/mcp"} {
+		body := bytes.NewBufferString(`{"url":"` + u + `"}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/mcp/servers", body)
+		rec := httptest.NewRecorder()
+		h.AddMcpServer(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("AddMcpServer %s code = %d, want 400", u, rec.Code)
+		}
+	}
+}
+
+// newFakeMcpServer 最小的 Streamable HTTP MCP 服务器：支持 resources 与 prompts
+func newFakeMcpServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params map[string]any  `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		if len(msg.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		var result any
+		switch msg.Method {
+		case "initialize":
+			result = map[string]any{"protocolVersion": "2024-11-05", "capabilities": map[string]any{}}
+		case "resources/list":
+			result = map[string]any{"resources": []any{map[string]any{"uri": "file:///guide.md", "name": "guide", "mimeType": "text/markdown"}}}
+		case "resources/read":
+			result = map[string]any{"contents": []any{map[string]any{"uri": msg.Params["uri"], "text": "# Guide\nhello"}}}
+		case "tools/list":
+			result = map[string]any{"tools": []any{map[string]any{"name": "echo", "description": "Echo text", "inputSchema": map[string]any{"type": "object", "properties": map[string]any{"text": map[string]any{"type": "string"}}, "required": []any{"text"}}}}}
+		case "tools/call":
+			args, _ := msg.Params["arguments"].(map[string]any)
+			result = map[string]any{"content": []any{map[string]any{"type": "text", "text": "echo: " + args["text"].(string)}}}
+		case "prompts/get":
+			args, _ := msg.Params["arguments"].(map[string]any)
+			result = map[string]any{"messages": []any{map[string]any{"role": "user", "content": map[string]any{"type": "text", "text": "Review " + args["topic"].(string)}}}}
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "error": map[string]any{"code": -32601, "message": "method not found"}})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newFakeSSEMcpServer 旧版 SSE 传输的 MCP 服务器：GET 长连接下发 endpoint 事件，POST 的响应经长连接返回；
+// failPost 为 true 时 POST 一律返回 500
+func newFakeSSEMcpServer(t *testing.T, failPost bool) *httptest.Server {
+	t.Helper()
+	replies := make(chan string, 8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: endpoint\ndata: /messages\n\n")
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case msg := <-replies:
+					fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}
+		if failPost {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		if len(msg.ID) > 0 {
+			result := map[string]any{"protocolVersion": "2024-11-05", "capabilities": map[string]any{}}
+			if msg.Method == "tools/list" {
+				result = map[string]any{"tools": []any{map[string]any{"name": "a"}, map[string]any{"name": "b"}}}
+			}
+			data, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+			replies <- string(data)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheckMcpServer_Transports(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	cases := []struct {
+		name   string
+		url    string
+		status string
+		tools  int
+	}{
+		{"streamable", newFakeMcpServer(t).URL, store.McpStatusReady, 1},
+		{"sse", newFakeSSEMcpServer(t, false).URL + "/sse", store.McpStatusReady, 2},
+		{"sse init failed", newFakeSSEMcpServer(t, true).URL + "/sse", store.McpStatusReachable, 0},
+	}
+	for _, c := range cases {
+		id := addTestMcpServer(t, h, c.url)
+		rec := httptest.NewRecorder()
+		h.CheckMcpServer(rec, httptest.NewRequest(http.MethodPost, "/api/mcp/servers/"+id+"/check", nil), id)
+		var out struct {
+			Status     string `json:"status"`
+			Error      string `json:"error"`
+			ToolsCount int    `json:"toolsCount"`
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		if out.Status != c.status || out.ToolsCount != c.tools {
+			t.Errorf("%s: check = %+v, want %s with %d tools", c.name, out, c.status, c.tools)
+		}
+	}
+}
+
+func TestMcpMonitor_SerializesChecks(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte("{}"))
+			return
+		}
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		if len(msg.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		result := map[string]any{"protocolVersion": "2024-11-05", "capabilities": map[string]any{}}
+		if msg.Method == "initialize" {
+			mu.Lock()
+			active++
+			maxActive = max(maxActive, active)
+			mu.Unlock()
+			entered <- struct{}{}
+			<-release
+		}
+		if msg.Method == "tools/list" {
+			result = map[string]any{"tools": []any{}}
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+	}))
+	defer srv.Close()
+	svr, err := h.mcpStore.AddServer(store.McpServer{URL: srv.URL, Name: "fake"})
+	if err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+	m := mcp.NewMonitor(h.mcpStore, h.mcpStatus, nil, time.Minute)
+
+	done := make(chan *mcp.CheckResult, 2)
+	for i := 0; i < 2; i++ {
+		go func() { done <- m.CheckNow(context.Background(), svr) }()
+	}
+	<-entered
+	select {
+	case <-entered:
+		t.Error("second check ran while the first was still in progress")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if res := <-done; res.Status != store.McpStatusReady {
+			t.Errorf("check %d = %+v", i, res)
+		}
+	}
+	if maxActive != 1 {
+		t.Errorf("concurrent checks of one server = %d, want 1", maxActive)
+	}
+}
+
+func addTestMcpServer(t *testing.T, h *Handler, url string) string {
+	t.Helper()
+	body := bytes.NewBufferString(`{"url":"` + url + `","name":"fake"}`)
+	rec := httptest.NewRecorder()
+	h.AddMcpServer(rec, httptest.NewRequest(http.MethodPost, "/api/mcp/servers", body))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("AddMcpServer code = %d: %s", rec.Code, rec.Body.String())
+	}
+	var out map[string]interface{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	return out["id"].(string)
+}
+
+func TestMcpResources_ListAndImport(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	id := addTestMcpServer(t, h, newFakeMcpServer(t).URL+"/mcp")
+
+	rec := httptest.NewRecorder()
+	h.ListMcpResources(rec, httptest.NewRequest(http.MethodGet, "/api/mcp/servers/"+id+"/resources", nil), id)
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte("file:///guide.md")) {
+		t.Fatalf("ListMcpResources code = %d body = %s", rec.Code, rec.Body.String())
+	}
+
+	sessionID, _ := h.store.CreateSession()
+	body := bytes.NewBufferString(`{"sessionId":"` + sessionID + `","uri":"file:///guide.md","target":"file"}`)
+	impRec := httptest.NewRecorder()
+	h.ImportMcpResource(impRec, httptest.NewRequest(http.MethodPost, "/api/mcp/servers/"+id+"/resources/import", body), id)
+	if impRec.Code != http.StatusOK {
+		t.Fatalf("ImportMcpResource code = %d body = %s", impRec.Code, impRec.Body.String())
+	}
+	sess, _ := h.store.GetSession(sessionID)
+	f, ok := sess.VFS["mcp/fake/guide.md"]
+	if !ok || f.Content != "# Guide\nhello" || f.Language != "markdown" {
+		t.Errorf("imported file = %+v, ok = %v", f, ok)
+	}
+
+	// 指定路径与由 URI 推导的默认路径都须规范化，不能越出 VFS
+	importFile := func(uri, p string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(map[string]string{"sessionId": sessionID, "uri": uri, "target": "file", "path": p})
+		rec := httptest.NewRecorder()
+		h.ImportMcpResource(rec, httptest.NewRequest(http.MethodPost, "/api/mcp/servers/"+id+"/resources/import", bytes.NewReader(b)), id)
+		return rec
+	}
+	for _, p := range []string{"../escape.md", "/abs.md", "docs/../../x.md"} {
+		if rec := importFile("file:///guide.md", p); rec.Code != http.StatusBadRequest {
+			t.Errorf("import to %q code = %d, want 400", p, rec.Code)
+		}
+	}
+	if rec := importFile("file:///guide.md", "./docs//g.md"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"path":"docs/g.md"`) {
+		t.Errorf("normalized import = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := importFile("file:///a/..", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"path":"mcp/fake/resource.txt"`) {
+		t.Errorf("import of dot-dot URI = %d %s", rec.Code, rec.Body.String())
+	}
+	sess, _ = h.store.GetSession(sessionID)
+	for p := range sess.VFS {
+		if np, err := store.NormalizeVFSPath(p); err != nil || np != p {
+			t.Errorf("unnormalized VFS path %q", p)
+		}
+	}
+}
+
+func TestMcpPrompts_GetAndUnsupportedList(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	id := addTestMcpServer(t, h, newFakeMcpServer(t).URL+"/mcp")
+
+	rec := httptest.NewRecorder()
+	h.ListMcpPrompts(rec, httptest.NewRequest(http.MethodGet, "/api/mcp/servers/"+id+"/prompts", nil), id)
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"supported":false`)) {
+		t.Errorf("ListMcpPrompts code = %d body = %s", rec.Code, rec.Body.String())
+	}
+
+	body := bytes.NewBufferString(`{"arguments":{"topic":"budget"}}`)
+	getRec := httptest.NewRecorder()
+	h.GetMcpPrompt(getRec, httptest.NewRequest(http.MethodPost, "/api/mcp/servers/"+id+"/prompts/review", body), id, "review")
+	var out map[string]interface{}
+	_ = json.Unmarshal(getRec.Body.Bytes(), &out)
+	if getRec.Code != http.StatusOK || out["text"] != "Review budget" {
+		t.Errorf("GetMcpPrompt code = %d body = %s", getRec.Code, getRec.Body.String())
+	}
+}
+
+func TestMcpToolSync_RegisterAndRemove(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	sync := mcp.NewToolSync(h.mcpStore, h.mcpStatus, nil, h.registry)
+	defer sync.Close()
+	h.SetMcpToolSync(sync)
+	id := addTestMcpServer(t, h, newFakeMcpServer(t).URL+"/mcp")
+	changes, cancel := sync.Subscribe()
+	defer cancel()
+
+	svr, _ := h.mcpStore.Get(id)
+	if err := sync.Sync(context.Background(), *svr); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	toolID := mcp.ToolID(id, "echo")
+	if h.registry.GetSource(toolID) != "mcp" {
+		t.Fatalf("tool %s not registered", toolID)
+	}
+	if c := <-changes; len(c.Added) != 1 || c.Added[0] != toolID {
+		t.Errorf("change = %+v", c)
+	}
+	res, err := h.registry.Execute(registry.ExecuteRequest{Ctx: context.Background()}, toolID, json.RawMessage(`{"text":"hi"}`))
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if m, _ := res.(map[string]interface{}); m["content"] != "echo: hi" {
+		t.Errorf("result = %v", res)
+	}
+
+	rec := httptest.NewRecorder()
+	h.DeleteMcpServer(rec, httptest.NewRequest(http.MethodDelete, "/api/mcp/servers/"+id, nil), id)
+	if h.registry.GetSource(toolID) != "" {
+		t.Error("tool should be unregistered after server delete")
+	}
+	if c := <-changes; len(c.Removed) != 1 {
+		t.Errorf("remove change = %+v", c)
+	}
+}
+
+func TestMcpToolID_LongNames(t *testing.T) {
+	long := strings.Repeat("search_documents_", 4)
+	a, b := mcp.ToolID("mcp_srv1", long+"by_title"), mcp.ToolID("mcp_srv1", long+"by_author")
+	if a == b || len(a) > 64 || len(b) > 64 {
+		t.Errorf("long tool IDs = %q, %q", a, b)
+	}
+	if id := mcp.ToolID("mcp_srv1", "echo"); id != "mcp_mcp_srv1__echo" {
+		t.Errorf("short tool ID = %q", id)
+	}
+}
+
+func TestMcpStdioProcess_Lifecycle(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	pm := mcp.NewProcessManager()
+	defer pm.StopAll()
+	h.SetMcpProcessManager(pm)
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	body, _ := json.Marshal(map[string]any{"transport": "stdio", "name": "helper", "command": exe,
+		"env": map[string]string{"MCP_TEST_HELPER": "1", "API_TOKEN": "t1"}})
+	rec := httptest.NewRecorder()
+	h.AddMcpServer(rec, httptest.NewRequest(http.MethodPost, "/api/mcp/servers", bytes.NewReader(body)))
+	var created mcpServerResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &created)
+	if rec.Code != http.StatusCreated || created.Env["API_TOKEN"] != redactedSecret || created.Env["MCP_TEST_HELPER"] != "1" {
+		t.Fatalf("AddMcpServer = %d %s", rec.Code, rec.Body.String())
+	}
+	p := pm.Get(created.ID)
+	if p == nil {
+		t.Fatal("process not started")
+	}
+	call := func(tool string) (json.RawMessage, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return p.Call(ctx, "tools/call", map[string]any{"name": tool, "arguments": map[string]any{}})
+	}
+	waitFor := func(what string, ok func(mcp.ProcessStatus) bool) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for !ok(p.Status()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s: %+v", what, p.Status())
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	// 进程拿到解密后的环境变量
+	if res, err := call("env"); err != nil || !bytes.Contains(res, []byte("t1")) {
+		t.Fatalf("call env = %s, %v", res, err)
+	}
+	waitFor("running", func(st mcp.ProcessStatus) bool { return st.State == mcp.ProcessRunning })
+
+	// 崩溃后退避至少 1 秒再重启
+	crashed := time.Now()
+	_, _ = call("crash")
+	waitFor("restart", func(st mcp.ProcessStatus) bool { return st.State == mcp.ProcessRunning && st.Restarts == 1 })
+	if elapsed := time.Since(crashed); elapsed < 900*time.Millisecond {
+		t.Errorf("restarted after %v, want backoff", elapsed)
+	}
+	if st := p.Status(); st.LastExit == "" {
+		t.Errorf("last exit not recorded: %+v", st)
+	}
+	if res, err := call("env"); err != nil || !bytes.Contains(res, []byte("t1")) {
+		t.Errorf("call after restart = %s, %v", res, err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.DeleteMcpServer(rec, httptest.NewRequest(http.MethodDelete, "/api/mcp/servers/"+created.ID, nil), created.ID)
+	if st := p.Status(); rec.Code != http.StatusOK || st.State != mcp.ProcessStopped || pm.Get(created.ID) != nil {
+		t.Errorf("after delete: code = %d, status = %+v", rec.Code, st)
+	}
+	if _, err := call("env"); err == nil {
+		t.Error("call after stop should fail")
+	}
+}
+
+func TestMcpStore_EnvEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := store.NewMcpStore(dir)
+	if _, err := s.AddServer(store.McpServer{Transport: store.McpTransportStdio, Command: "mcp-fs", Env: map[string]string{"API_TOKEN": "t1-secret"}}); err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "mcp_servers.json"))
+	if bytes.Contains(data, []byte("t1-secret")) || !bytes.Contains(data, []byte("enc:v1:")) {
+		t.Errorf("env stored in plaintext: %s", data)
+	}
+	reopened, _ := store.NewMcpStore(dir)
+	if list := reopened.List(); len(list) != 1 || list[0].Env["API_TOKEN"] != "t1-secret" {
+		t.Errorf("reloaded env = %+v", list)
+	}
+}
+
+func TestExportMcpConfig_Redacted(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	body := bytes.NewBufferString(`{"url":"http://localhost:5210/mcp","name":"notes","headers":{"X-Api-Key":"k1"},"auth":{"type":"bearer","token":"s3cret"}}`)
+	rec := httptest.NewRecorder()
+	h.AddMcpServer(rec, httptest.NewRequest(http.MethodPost, "/api/mcp/servers", body))
+	stdio := bytes.NewBufferString(`{"transport":"stdio","name":"fs","command":"mcp-fs","env":{"API_TOKEN":"t1","PORT":"80"}}`)
+	h.AddMcpServer(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/mcp/servers", stdio))
+
+	exp := httptest.NewRecorder()
+	h.ExportMcpConfig(exp, httptest.NewRequest(http.MethodGet, "/api/mcp/config/export", nil))
+	if exp.Code != http.StatusOK {
+		t.Fatalf("ExportMcpConfig code = %d", exp.Code)
+	}
+	for _, secret := range []string{"s3cret", "k1", "t1"} {
+		if bytes.Contains(exp.Body.Bytes(), []byte(secret)) {
+			t.Errorf("export leaks %q: %s", secret, exp.Body.String())
+		}
+	}
+	var out mcpConfigFile
+	_ = json.Unmarshal(exp.Body.Bytes(), &out)
+	if out.McpServers["notes"].URL != "http://localhost:5210/mcp" || out.McpServers["fs"].Env["PORT"] != "80" {
+		t.Errorf("unexpected export: %s", exp.Body.String())
+	}
+}
+
+func TestImportMcpConfig_DryRunConflict(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	addTestMcpServer(t, h, "http://localhost:5211/mcp")
+	cfg := `{"mcpServers":{"dup":{"url":"http://localhost:5211/mcp/"},"fresh":{"url":"http://localhost:5212/mcp"},"bad":{"args":["x"]}}}`
+
+	rec := httptest.NewRecorder()
+	h.ImportMcpConfig(rec, httptest.NewRequest(http.MethodPost, "/api/mcp/config/import?dryRun=1", bytes.NewBufferString(cfg)))
+	var out struct {
+		Items []mcpImportItem `json:"items"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	actions := map[string]string{}
+	for _, it := range out.Items {
+		actions[it.Name] = it.Action
+	}
+	if actions["dup"] != mcpImportConflict || actions["fresh"] != mcpImportCreate || actions["bad"] != mcpImportInvalid {
+		t.Errorf("dry-run actions = %v", actions)
+	}
+	if n := len(h.mcpStore.List()); n != 1 {
+		t.Errorf("dry run should not persist, servers = %d", n)
+	}
+
+	rec2 := httptest.NewRecorder()
+	h.ImportMcpConfig(rec2, httptest.NewRequest(http.MethodPost, "/api/mcp/config/import", bytes.NewBufferString(cfg)))
+	if n := len(h.mcpStore.List()); n != 2 {
+		t.Errorf("import should create one server, servers = %d", n)
+	}
+}
+
+func TestImportMcpConfig_DuplicateInBatch(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	cfg := `{"mcpServers":{"a":{"url":"http://localhost:5213/mcp"},"b":{"url":"http://localhost:5213/mcp/"}}}`
+
+	for _, q := range []string{"?dryRun=1", ""} {
+		rec := httptest.NewRecorder()
+		h.ImportMcpConfig(rec, httptest.NewRequest(http.MethodPost, "/api/mcp/config/import"+q, bytes.NewBufferString(cfg)))
+		var out struct {
+			Items []mcpImportItem `json:"items"`
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		if len(out.Items) != 2 || out.Items[0].Action != mcpImportCreate ||
+			out.Items[1].Action != mcpImportConflict || out.Items[1].ConflictName != "a" {
+			t.Errorf("import%s items = %+v", q, out.Items)
+		}
+		if q != "" {
+			if n := len(h.mcpStore.List()); n != 0 {
+				t.Errorf("dry run should not persist, servers = %d", n)
+			}
+		}
+	}
+	if n := len(h.mcpStore.List()); n != 1 {
+		t.Errorf("duplicate entry should not be created, servers = %d", n)
+	}
+}
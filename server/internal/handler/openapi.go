@@ -0,0 +1,355 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"agentic-demo/server/internal/config"
+	"agentic-demo/server/internal/openapi"
+	"agentic-demo/server/internal/store"
+)
+
+// maxOpenAPIDocBytes 上传或读取的 OpenAPI 文档大小上限
+const maxOpenAPIDocBytes = 10 << 20
+
+// openAPISpecBody 导入或更新文档的请求体；更新时省略的字段保持不变
+type openAPISpecBody struct {
+	Document   json.RawMessage   `json:"document"` // 文档对象或 JSON 字符串
+	Path       string            `json:"path"`     // OPENAPI_DIR 下的本地文件
+	Prefix     *string           `json:"prefix"`
+	BaseURL    *string           `json:"baseUrl"`
+	Operations []string          `json:"operations"`
+	Headers    map[string]string `json:"headers"`
+	Query      map[string]string `json:"query"`
+	Auth       *store.McpAuth    `json:"auth"`
+}
+
+type openAPISpecResp struct {
+	ID         string            `json:"id"`
+	Title      string            `json:"title"`
+	Version    string            `json:"version,omitempty"`
+	Prefix     string            `json:"prefix"`
+	BaseURL    string            `json:"baseUrl,omitempty"`
+	Source     string            `json:"source"`
+	Operations []string          `json:"operations"`
+	Tools      []string          `json:"tools"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Query      map[string]string `json:"query,omitempty"`
+	Auth       *mcpAuthResp      `json:"auth,omitempty"`
+	CreatedAt  int64             `json:"createdAt,omitempty"`
+	UpdatedAt  int64             `json:"updatedAt,omitempty"`
+}
+
+type openAPIOperationItem struct {
+	Key         string `json:"key"`
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	OperationID string `json:"operationId,omitempty"`
+	Summary     string `json:"summary,omitempty"`
+	Deprecated  bool   `json:"deprecated,omitempty"`
+	ToolName    string `json:"toolName"`
+	Selected    bool   `json:"selected"`
+}
+
+// openAPIDetailResp 单个文档的详情：包含文档中全部可选操作
+type openAPIDetailResp struct {
+	openAPISpecResp
+	Servers             []string                 `json:"servers"`
+	SecuritySchemes     []openapi.SecurityScheme `json:"securitySchemes"`
+	AvailableOperations []openAPIOperationItem   `json:"availableOperations"`
+	Conflicts           []string                 `json:"conflicts,omitempty"`
+}
+
+func openAPIResp(spec store.OpenAPISpec) openAPISpecResp {
+	out := openAPISpecResp{
+		ID: spec.ID, Title: spec.Title, Version: spec.Version, Prefix: spec.Prefix, BaseURL: spec.BaseURL,
+		Source: spec.Source, Operations: spec.Operations, Tools: []string{},
+		Headers: redactMcpHeaders(spec.Headers), Query: redactMcpHeaders(spec.Query), Auth: redactMcpAuth(spec.Auth),
+		CreatedAt: spec.CreatedAt, UpdatedAt: spec.UpdatedAt,
+	}
+	if out.Operations == nil {
+		out.Operations = []string{}
+	}
+	if tools, _, err := openapi.Tools(spec); err == nil {
+		for _, t := range tools {
+			out.Tools = append(out.Tools, t.Name)
+		}
+	}
+	return out
+}
+
+func openAPIDetail(spec store.OpenAPISpec, doc *openapi.Document, conflicts []string) openAPIDetailResp {
+	out := openAPIDetailResp{
+		openAPISpecResp: openAPIResp(spec),
+		Servers:         doc.Servers,
+		SecuritySchemes: doc.SecuritySchemes,
+		Conflicts:       conflicts,
+	}
+	if out.Servers == nil {
+		out.Servers = []string{}
+	}
+	if out.SecuritySchemes == nil {
+		out.SecuritySchemes = []openapi.SecurityScheme{}
+	}
+	selected := map[string]bool{}
+	for _, k := range spec.Operations {
+		selected[k] = true
+	}
+	ops := doc.Operations()
+	names := openapi.ToolNames(spec.Prefix, ops)
+	out.AvailableOperations = make([]openAPIOperationItem, 0, len(ops))
+	for _, op := range ops {
+		out.AvailableOperations = append(out.AvailableOperations, openAPIOperationItem{
+			Key: op.Key, Method: op.Method, Path: op.Path, OperationID: op.OperationID, Summary: op.Summary,
+			Deprecated: op.Deprecated, ToolName: names[op.Key], Selected: selected[op.Key],
+		})
+	}
+	return out
+}
+
+// ListOpenAPISpecs GET /api/openapi/specs
+func (h *Handler) ListOpenAPISpecs(w http.ResponseWriter, r *http.Request) {
+	if h.openAPISpecs == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "openapi store not configured"})
+		return
+	}
+	list := h.openAPISpecs.List()
+	out := make([]openAPISpecResp, len(list))
+	for i, spec := range list {
+		out[i] = openAPIResp(spec)
+	}
+	writeJSON(w, map[string]interface{}{"specs": out})
+}
+
+// GetOpenAPISpec GET /api/openapi/specs/{id}：含文档中全部操作及其选中状态
+func (h *Handler) GetOpenAPISpec(w http.ResponseWriter, r *http.Request, id string) {
+	if h.openAPISpecs == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "openapi store not configured"})
+		return
+	}
+	spec := h.openAPISpecs.Get(id)
+	if spec == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	doc, err := openapi.Parse(spec.Document)
+	if err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, openAPIDetail(*spec, doc, nil))
+}
+
+// ImportOpenAPISpec POST /api/openapi/specs：上传文档（document）或读取 OPENAPI_DIR 下的本地文件（path），
+// 选中的操作（operations）注册为工具。?dryRun=1 只解析并返回可选操作，不保存
+func (h *Handler) ImportOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	if h.openAPISpecs == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "openapi store not configured"})
+		return
+	}
+	var body openAPISpecBody
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxOpenAPIDocBytes+4096)).Decode(&body); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	data, source, err := loadOpenAPIDocument(body)
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	doc, err := openapi.Parse(data)
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	spec := store.OpenAPISpec{
+		Title: doc.Title, Version: doc.Version, Source: source, Document: data,
+		Prefix: openapi.DefaultPrefix(doc.Title), Operations: body.Operations,
+		Headers: mergeMcpHeaders(nil, body.Headers), Query: mergeMcpHeaders(nil, body.Query),
+		Auth: store.MergeMcpAuth(nil, body.Auth),
+	}
+	if spec.Title == "" {
+		spec.Title = source
+	}
+	if body.Prefix != nil {
+		spec.Prefix = strings.TrimSpace(*body.Prefix)
+	}
+	if body.BaseURL != nil {
+		spec.BaseURL = strings.TrimSpace(*body.BaseURL)
+	}
+	if !h.checkOpenAPISpec(w, spec, doc) {
+		return
+	}
+	if r.URL.Query().Get("dryRun") == "1" || r.URL.Query().Get("dryRun") == "true" {
+		writeJSON(w, openAPIDetail(spec, doc, nil))
+		return
+	}
+	created, err := h.openAPISpecs.Add(spec)
+	if err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	_, conflicts, _ := openapi.Register(h.registry, created)
+	writeJSONStatus(w, http.StatusCreated, openAPIDetail(created, doc, conflicts))
+}
+
+// UpdateOpenAPISpec PUT /api/openapi/specs/{id}：修改选中的操作、前缀、地址与鉴权，并重新注册工具
+func (h *Handler) UpdateOpenAPISpec(w http.ResponseWriter, r *http.Request, id string) {
+	if h.openAPISpecs == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "openapi store not configured"})
+		return
+	}
+	prev := h.openAPISpecs.Get(id)
+	if prev == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	var body openAPISpecBody
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxOpenAPIDocBytes+4096)).Decode(&body); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	spec := *prev
+	if len(body.Document) > 0 || body.Path != "" {
+		data, source, err := loadOpenAPIDocument(body)
+		if err != nil {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		spec.Document, spec.Source = data, source
+	}
+	doc, err := openapi.Parse(spec.Document)
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	spec.Title, spec.Version = doc.Title, doc.Version
+	if spec.Title == "" {
+		spec.Title = prev.Title
+	}
+	if body.Prefix != nil {
+		spec.Prefix = strings.TrimSpace(*body.Prefix)
+	}
+	if body.BaseURL != nil {
+		spec.BaseURL = strings.TrimSpace(*body.BaseURL)
+	}
+	if body.Operations != nil {
+		spec.Operations = body.Operations
+	}
+	spec.Headers = mergeMcpHeaders(prev.Headers, body.Headers)
+	spec.Query = mergeMcpHeaders(prev.Query, body.Query)
+	spec.Auth = store.MergeMcpAuth(prev.Auth, body.Auth)
+	if !h.checkOpenAPISpec(w, spec, doc) {
+		return
+	}
+	updated, err := h.openAPISpecs.Replace(spec)
+	if err != nil {
+		if errors.Is(err, store.ErrOpenAPINotFound) {
+			writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			return
+		}
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	openapi.Unregister(h.registry, *prev)
+	_, conflicts, _ := openapi.Register(h.registry, updated)
+	writeJSON(w, openAPIDetail(updated, doc, conflicts))
+}
+
+// DeleteOpenAPISpec DELETE /api/openapi/specs/{id}：删除文档并注销其工具
+func (h *Handler) DeleteOpenAPISpec(w http.ResponseWriter, r *http.Request, id string) {
+	if h.openAPISpecs == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "openapi store not configured"})
+		return
+	}
+	spec := h.openAPISpecs.Get(id)
+	if spec == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	if err := h.openAPISpecs.Remove(id); err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	openapi.Unregister(h.registry, *spec)
+	writeJSONStatus(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// checkOpenAPISpec 校验前缀、鉴权与选中的操作；有选中操作时须能确定调用地址。失败时已写入响应
+func (h *Handler) checkOpenAPISpec(w http.ResponseWriter, spec store.OpenAPISpec, doc *openapi.Document) bool {
+	if spec.Prefix == "" || openapi.DefaultPrefix(spec.Prefix) != strings.ToLower(spec.Prefix) {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "prefix 须为小写字母开头的字母、数字或下划线，最长 20 个字符"})
+		return false
+	}
+	if msg := validateMcpAuth(spec.Auth); msg != "" {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return false
+	}
+	var unknown []string
+	for _, k := range spec.Operations {
+		if _, ok := doc.Operation(k); !ok {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "文档中不存在的操作：" + strings.Join(unknown, ", ")})
+		return false
+	}
+	if len(spec.Operations) > 0 {
+		if _, err := openapi.BaseURL(spec, doc); err != nil {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return false
+		}
+	}
+	return true
+}
+
+// loadOpenAPIDocument 取得文档原文：document 可为对象或 JSON 字符串；path 须位于 OPENAPI_DIR 内
+func loadOpenAPIDocument(body openAPISpecBody) (json.RawMessage, string, error) {
+	if len(body.Document) > 0 && string(body.Document) != "null" {
+		var text string
+		if json.Unmarshal(body.Document, &text) == nil {
+			return json.RawMessage(text), "upload", nil
+		}
+		return body.Document, "upload", nil
+	}
+	if body.Path == "" {
+		return nil, "", errors.New("document or path required")
+	}
+	root, err := filepath.Abs(config.OpenAPIDir)
+	if err != nil {
+		return nil, "", err
+	}
+	p := body.Path
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+	p, err = filepath.EvalSymlinks(filepath.Clean(p))
+	if err != nil {
+		return nil, "", errors.New("无法读取文件：" + body.Path)
+	}
+	if realRoot, err := filepath.EvalSymlinks(root); err == nil {
+		root = realRoot
+	}
+	if rel, err := filepath.Rel(root, p); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, "", errors.New("path 必须位于 OPENAPI_DIR（" + config.OpenAPIDir + "）内")
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, "", errors.New("无法读取文件：" + body.Path)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxOpenAPIDocBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxOpenAPIDocBytes {
+		return nil, "", errors.New("文档超过 10MB 上限")
+	}
+	return data, body.Path, nil
+}
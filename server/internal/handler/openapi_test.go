@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"agentic-demo/server/internal/config"
+	"agentic-demo/server/internal/registry"
+	"agentic-demo/server/internal/store"
+)
+
+const petstoreSpec = `{
+  "openapi": "3.0.3",
+  "info": {"title": "Pet Store", "version": "1.0"},
+  "servers": [{"url": "%s/v1"}],
+  "components": {
+    "securitySchemes": {"key": {"type": "apiKey", "in": "header", "name": "X-Api-Key"}},
+    "schemas": {"Pet": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}, "tags": {"type": "array", "items": {"type": "string"}}}}}
+  },
+  "paths": {
+    "/pets/{petId}": {
+      "parameters": [{"name": "petId", "in": "path", "required": true, "schema": {"type": "integer"}}],
+      "get": {"operationId": "getPet", "summary": "查询宠物", "parameters": [{"name": "fields", "in": "query", "schema": {"type": "string"}}]},
+      "put": {"operationId": "updatePet", "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}}
+    },
+    "/pets": {"get": {"operationId": "listPets"}}
+  }
+}`
+
+func initTestHandlerWithOpenAPI(t *testing.T) *Handler {
+	t.Helper()
+	h := initTestHandlerWithTools(t)
+	s, err := store.NewOpenAPIStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewOpenAPIStore: %v", err)
+	}
+	h.SetOpenAPIStore(s)
+	return h
+}
+
+func TestOpenAPI_ImportAndExecute(t *testing.T) {
+	var gotMethod, gotPath, gotQuery, gotKey, gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotQuery = r.Method, r.URL.Path, r.URL.RawQuery
+		gotKey = r.Header.Get("X-Api-Key")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"rex"}`))
+	}))
+	defer upstream.Close()
+
+	h := initTestHandlerWithOpenAPI(t)
+	doc := json.RawMessage(bytes.ReplaceAll([]byte(petstoreSpec), []byte("%s"), []byte(upstream.URL)))
+	raw, _ := json.Marshal(map[string]any{
+		"document":   doc,
+		"operations": []string{"GET /pets/{petId}", "PUT /pets/{petId}"},
+		"headers":    map[string]string{"X-Api-Key": "k-123"},
+	})
+
+	// 预览不保存也不注册
+	rec := httptest.NewRecorder()
+	h.ImportOpenAPISpec(rec, httptest.NewRequest(http.MethodPost, "/api/openapi/specs?dryRun=1", bytes.NewReader(raw)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("dry run code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var preview openAPIDetailResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &preview)
+	if len(preview.AvailableOperations) != 3 || len(preview.SecuritySchemes) != 1 || h.registry.GetSource("pet_store_getPet") != "" {
+		t.Fatalf("preview = %+v", preview)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ImportOpenAPISpec(rec, httptest.NewRequest(http.MethodPost, "/api/openapi/specs", bytes.NewReader(raw)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("import code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var created openAPIDetailResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.Headers["X-Api-Key"] != redactedSecret {
+		t.Errorf("header not redacted: %v", created.Headers)
+	}
+	if len(created.Tools) != 2 || h.registry.GetSource("pet_store_getPet") != registry.SourceOpenAPI {
+		t.Fatalf("tools = %v, source = %q", created.Tools, h.registry.GetSource("pet_store_getPet"))
+	}
+
+	ctx := registry.ExecuteRequest{Ctx: context.Background()}
+	res, err := h.registry.Execute(ctx, "pet_store_getPet", json.RawMessage(`{"petId":7,"fields":"a b"}`))
+	if err != nil {
+		t.Fatalf("Execute getPet: %v", err)
+	}
+	if gotMethod != http.MethodGet || gotPath != "/v1/pets/7" || gotQuery != "fields=a+b" || gotKey != "k-123" {
+		t.Errorf("request: %s %s ?%s key=%q", gotMethod, gotPath, gotQuery, gotKey)
+	}
+	if data, _ := res.(map[string]interface{})["data"].(map[string]any); data["name"] != "rex" {
+		t.Errorf("result = %v", res)
+	}
+	if _, err := h.registry.Execute(ctx, "pet_store_updatePet", json.RawMessage(`{"petId":7,"body":{"name":"max"}}`)); err != nil {
+		t.Fatalf("Execute updatePet: %v", err)
+	}
+	if gotMethod != http.MethodPut || gotBody != `{"name":"max"}` {
+		t.Errorf("request: %s body=%q", gotMethod, gotBody)
+	}
+
+	// 取消选中的操作随更新注销；脱敏占位符沿用原值
+	raw, _ = json.Marshal(map[string]any{"operations": []string{"GET /pets"}, "headers": map[string]string{"X-Api-Key": redactedSecret}})
+	rec = httptest.NewRecorder()
+	h.UpdateOpenAPISpec(rec, httptest.NewRequest(http.MethodPut, "/api/openapi/specs/"+created.ID, bytes.NewReader(raw)), created.ID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if h.registry.GetSource("pet_store_getPet") != "" || h.registry.GetSource("pet_store_listPets") != registry.SourceOpenAPI {
+		t.Error("update should re-register selected operations")
+	}
+	if got := h.openAPISpecs.Get(created.ID); got.Headers["X-Api-Key"] != "k-123" {
+		t.Errorf("header after update = %v", got.Headers)
+	}
+
+	// 另一份文档生成同名工具时报告冲突，删除它不影响原文档的工具
+	raw, _ = json.Marshal(map[string]any{"document": doc, "operations": []string{"GET /pets", "GET /pets/{petId}"}})
+	rec = httptest.NewRecorder()
+	h.ImportOpenAPISpec(rec, httptest.NewRequest(http.MethodPost, "/api/openapi/specs", bytes.NewReader(raw)))
+	var second openAPIDetailResp
+	_ = json.Unmarshal(rec.Body.Bytes(), &second)
+	if rec.Code != http.StatusCreated || len(second.Conflicts) != 1 || second.Conflicts[0] != "pet_store_listPets" {
+		t.Fatalf("second import = %d, conflicts = %v", rec.Code, second.Conflicts)
+	}
+	rec = httptest.NewRecorder()
+	h.DeleteOpenAPISpec(rec, httptest.NewRequest(http.MethodDelete, "/api/openapi/specs/"+second.ID, nil), second.ID)
+	if rec.Code != http.StatusOK || h.registry.GetSource("pet_store_listPets") != registry.SourceOpenAPI || h.registry.GetSource("pet_store_getPet") != "" {
+		t.Errorf("deleting the second spec changed the first spec's tools")
+	}
+
+	rec = httptest.NewRecorder()
+	h.DeleteOpenAPISpec(rec, httptest.NewRequest(http.MethodDelete, "/api/openapi/specs/"+created.ID, nil), created.ID)
+	if rec.Code != http.StatusOK || h.registry.GetSource("pet_store_listPets") != "" {
+		t.Errorf("delete code = %d, registered = %q", rec.Code, h.registry.GetSource("pet_store_listPets"))
+	}
+}
+
+func TestOpenAPI_ImportInvalid(t *testing.T) {
+	h := initTestHandlerWithOpenAPI(t)
+	dir := t.TempDir()
+	prev := config.OpenAPIDir
+	config.OpenAPIDir = filepath.Join(dir, "specs")
+	defer func() { config.OpenAPIDir = prev }()
+	_ = os.MkdirAll(config.OpenAPIDir, 0755)
+	_ = os.WriteFile(filepath.Join(dir, "outside.json"), []byte(`{"openapi":"3.0.0","paths":{}}`), 0644)
+
+	cases := map[string]string{
+		"outside dir":       `{"path":"../outside.json"}`,
+		"swagger 2":         `{"document":{"swagger":"2.0","paths":{}}}`,
+		"unknown operation": `{"document":{"openapi":"3.0.0","servers":[{"url":"http://127.0.0.1"}],"paths":{}},"operations":["GET /x"]}`,
+		"relative server":   `{"document":{"openapi":"3.0.0","servers":[{"url":"/api"}],"paths":{"/x":{"get":{}}}},"operations":["GET /x"]}`,
+	}
+	for name, body := range cases {
+		rec := httptest.NewRecorder()
+		h.ImportOpenAPISpec(rec, httptest.NewRequest(http.MethodPost, "/api/openapi/specs", bytes.NewBufferString(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: code = %d, want 400, body = %s", name, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestOpenAPIStore_KeyMismatch(t *testing.T) {
+	dir := t.TempDir()
+	box, _ := store.NewSecretBox(dir, "old-key")
+	s, err := store.NewOpenAPIStore(dir, box)
+	if err != nil {
+		t.Fatalf("NewOpenAPIStore: %v", err)
+	}
+	if _, err := s.Add(store.OpenAPISpec{Title: "Pets", Prefix: "pets", Document: json.RawMessage(`{}`), Headers: map[string]string{"X-Api-Key": "k1"}}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	before, _ := os.ReadFile(filepath.Join(dir, "openapi_specs.json"))
+	other, _ := store.NewSecretBox(dir, "new-key")
+	if _, err := store.NewOpenAPIStore(dir, other); !errors.Is(err, store.ErrSecretCorrupt) {
+		t.Fatalf("open with another key: err = %v, want ErrSecretCorrupt", err)
+	}
+	if after, _ := os.ReadFile(filepath.Join(dir, "openapi_specs.json")); !bytes.Equal(before, after) {
+		t.Error("specs file changed after failed load")
+	}
+}
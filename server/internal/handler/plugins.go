@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+)
+
+// ListPlugins GET /api/plugins：插件目录与最近一次加载的结果
+func (h *Handler) ListPlugins(w http.ResponseWriter, r *http.Request) {
+	if h.plugins == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "plugin manager not configured"})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"dir": h.plugins.Dir(), "plugins": h.plugins.Statuses()})
+}
+
+// ReloadPlugins POST /api/plugins/reload：重新扫描插件目录，注销旧工具后注册新清单
+func (h *Handler) ReloadPlugins(w http.ResponseWriter, r *http.Request) {
+	if h.plugins == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "plugin manager not configured"})
+		return
+	}
+	statuses := h.plugins.Reload()
+	writeJSON(w, map[string]interface{}{"dir": h.plugins.Dir(), "plugins": statuses})
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agentic-demo/server/internal/plugin"
+	"agentic-demo/server/internal/registry"
+)
+
+func writePlugin(t *testing.T, dir, name, script string, extra map[string]any) {
+	t.Helper()
+	path := filepath.Join(dir, name+".sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	man := map[string]any{"name": name, "description": "测试插件 " + name, "command": "./" + name + ".sh"}
+	for k, v := range extra {
+		man[k] = v
+	}
+	data, _ := json.Marshal(man)
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlugins_ReloadAndExecute(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PLUGIN_TEST_SECRET", "s3cret")
+	t.Setenv("PLUGIN_TEST_PASS", "visible")
+	writePlugin(t, dir, "echo_args", `input=$(cat)
+echo "debug: got input" >&2
+printf '{"input":%s,"secret":"%s","pass":"%s","cwd":"%s"}' "$input" "$PLUGIN_TEST_SECRET" "$PLUGIN_TEST_PASS" "$(pwd)"
+`, map[string]any{
+		"passEnv":    []string{"PLUGIN_TEST_PASS"},
+		"parameters": map[string]any{"type": "object", "properties": map[string]any{"q": map[string]any{"type": "string"}}},
+	})
+	writePlugin(t, dir, "slow_tool", "sleep 5\necho '{}'\n", map[string]any{"timeoutMs": 200})
+	writePlugin(t, dir, "noisy_tool", "head -c 4096 /dev/zero | tr '\\0' a\n", map[string]any{"maxOutputBytes": 1024})
+	writePlugin(t, dir, "fail_tool", "echo 'boom' >&2\nexit 3\n", nil)
+	_ = os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"name":"bad","description":"x","command":"./missing.sh"}`), 0644)
+
+	h := initTestHandlerWithTools(t)
+	h.SetPluginManager(plugin.NewManager(dir, h.registry))
+	rec := httptest.NewRecorder()
+	h.ReloadPlugins(rec, httptest.NewRequest(http.MethodPost, "/api/plugins/reload", nil))
+	var resp struct {
+		Plugins []plugin.Status `json:"plugins"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || len(resp.Plugins) != 5 {
+		t.Fatalf("reload code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	for _, st := range resp.Plugins {
+		if st.Registered == (st.File == "bad.json") {
+			t.Errorf("status = %+v", st)
+		}
+	}
+	if h.registry.GetSource("echo_args") != registry.SourcePlugin {
+		t.Fatalf("plugin not registered")
+	}
+
+	var log strings.Builder
+	req := registry.ExecuteRequest{Ctx: context.Background(), SessionID: "s1", OnLog: func(s string) { log.WriteString(s) }}
+	res, err := h.registry.Execute(req, "echo_args", json.RawMessage(`{"q":"hi"}`))
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	m := res.(map[string]interface{})
+	input, _ := m["input"].(map[string]any)
+	if input["tool"] != "echo_args" || input["sessionId"] != "s1" || input["arguments"].(map[string]any)["q"] != "hi" {
+		t.Errorf("input = %v", input)
+	}
+	if m["secret"] != "" || m["pass"] != "visible" {
+		t.Errorf("env not restricted: secret=%v pass=%v", m["secret"], m["pass"])
+	}
+	if real, _ := filepath.EvalSymlinks(dir); m["cwd"] != real && m["cwd"] != dir {
+		t.Errorf("cwd = %v, want %s", m["cwd"], dir)
+	}
+	if !strings.Contains(log.String(), "debug: got input") {
+		t.Errorf("stderr not captured: %q", log.String())
+	}
+
+	for name, want := range map[string]string{"slow_tool": "超时", "noisy_tool": "上限", "fail_tool": "boom"} {
+		if _, err := h.registry.Execute(registry.ExecuteRequest{Ctx: context.Background()}, name, nil); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", name, err, want)
+		}
+	}
+
+	// 删除清单后重新加载即注销
+	_ = os.Remove(filepath.Join(dir, "echo_args.json"))
+	h.ReloadPlugins(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/plugins/reload", nil))
+	if h.registry.GetSource("echo_args") != "" {
+		t.Error("removed plugin still registered")
+	}
+}
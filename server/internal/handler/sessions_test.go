@@ -1,13 +1,19 @@
 package handler
 
 import (
+	"archive/zip"
 	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"agentic-demo/server/internal/registry"
 	"agentic-demo/server/internal/setup"
@@ -187,3 +193,276 @@ func TestAppendSessionChunks(t *testing.T) {
 	}
 }
 
+func TestIngestKnowledge_Rule(t *testing.T) {
+	h := initTestHandler(t)
+	id, _ := h.store.CreateSession()
+	intro := strings.Repeat("这是简介部分的内容。", 15)
+	detail := strings.Repeat("细节段落中的一句话，用于测试句子边界的切分！", 60)
+	text := "# 简介\n\n" + intro + "\n\n# 细节\n\n" + detail + "\n\nThe end. Version 1.5 is stable."
+	payload, _ := json.Marshal(map[string]string{"text": text, "mode": "rule"})
+	req := httptest.NewRequest(http.MethodPost, "/api/sessions/"+id+"/knowledge/ingest", bytes.NewReader(payload))
+	rec := httptest.NewRecorder()
+	h.IngestKnowledge(rec, req, id)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("IngestKnowledge code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var out struct {
+		Added           int                    `json:"added"`
+		Chunks          []store.KnowledgeChunk `json:"chunks"`
+		Windows         int                    `json:"windows"`
+		SemanticWindows int                    `json:"semanticWindows"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	if out.Windows != 1 || out.SemanticWindows != 0 || out.Added != len(out.Chunks) || out.Added < 3 {
+		t.Fatalf("unexpected result: %+v", out)
+	}
+	if !strings.HasPrefix(out.Chunks[0].Content, "# 简介") || out.Chunks[0].BoundaryReason != "下一节标题" || out.Chunks[0].Summary != "简介" {
+		t.Errorf("first chunk = %+v", out.Chunks[0])
+	}
+	if !strings.HasPrefix(out.Chunks[1].Content, "# 细节") {
+		t.Errorf("second chunk should start at heading: %q", out.Chunks[1].Content)
+	}
+	for i, c := range out.Chunks {
+		if n := utf8.RuneCountInString(c.Content); n > 500 {
+			t.Errorf("chunk %d has %d characters", i, n)
+		}
+		if i > 0 && i < len(out.Chunks)-1 && !strings.HasSuffix(c.Content, "！") {
+			t.Errorf("chunk %d should end at a sentence boundary: %q", i, c.Content)
+		}
+	}
+	if last := out.Chunks[len(out.Chunks)-1]; !strings.HasSuffix(last.Content, "Version 1.5 is stable.") {
+		t.Errorf("last chunk = %q", last.Content)
+	}
+	sess, _ := h.store.GetSession(id)
+	if len(sess.KnowledgeChunks) != out.Added {
+		t.Errorf("stored chunks = %d, want %d", len(sess.KnowledgeChunks), out.Added)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/sessions/"+id+"/knowledge/ingest", bytes.NewBufferString(`{"text":"x","mode":"fast"}`))
+	rec = httptest.NewRecorder()
+	h.IngestKnowledge(rec, req, id)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid mode code = %d, want 400", rec.Code)
+	}
+}
+
+func TestIngestKnowledge_LongParagraph(t *testing.T) {
+	h := initTestHandler(t)
+	id, _ := h.store.CreateSession()
+	// 没有句末标点的超长段落按长度硬切，每块不超过上限且拼接后与原文一致
+	text := strings.Repeat("数据", 100000)
+	payload, _ := json.Marshal(map[string]string{"text": text, "mode": "rule"})
+	rec := httptest.NewRecorder()
+	h.IngestKnowledge(rec, httptest.NewRequest(http.MethodPost, "/api/sessions/"+id+"/knowledge/ingest", bytes.NewReader(payload)), id)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("IngestKnowledge code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var out struct {
+		Chunks []store.KnowledgeChunk `json:"chunks"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	var joined strings.Builder
+	for i, c := range out.Chunks {
+		if n := utf8.RuneCountInString(c.Content); n > 500 {
+			t.Fatalf("chunk %d has %d characters", i, n)
+		}
+		joined.WriteString(c.Content)
+	}
+	if joined.String() != text {
+		t.Errorf("chunks do not reassemble the input: %d of %d bytes", joined.Len(), len(text))
+	}
+}
+
+func TestSessionVFSStorage(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{"sessionId":"sess_old","title":"旧会话","geminiHistory":[],"uiMessages":[],"vfs":{"a.md":{"path":"a.md","content":"# A","language":"markdown"}},"lastUpdated":1}`
+	_ = os.WriteFile(filepath.Join(dir, "sess_old.json"), []byte(legacy), 0644)
+	s, err := store.NewSessionStore(dir)
+	if err != nil {
+		t.Fatalf("NewSessionStore: %v", err)
+	}
+	docHasVFS := func(id string) bool {
+		var doc map[string]json.RawMessage
+		data, _ := os.ReadFile(filepath.Join(dir, id+".json"))
+		_ = json.Unmarshal(data, &doc)
+		_, ok := doc["vfs"]
+		return ok
+	}
+	// 旧会话的内嵌 vfs 在启动时拆分出来
+	if docHasVFS("sess_old") {
+		t.Error("legacy session document should no longer contain vfs")
+	}
+	if vfs, _ := s.GetVFS("sess_old"); vfs["a.md"].Content != "# A" {
+		t.Errorf("migrated vfs = %v", vfs)
+	}
+
+	// 流式写入的中间内容只在内存中，不改写会话文档
+	docInfo, _ := os.Stat(filepath.Join(dir, "sess_old.json"))
+	_ = s.UpdateVFS("sess_old", "b.md", "partial", "markdown", true)
+	if vfs, _ := s.GetVFS("sess_old"); !vfs["b.md"].IsWriting || vfs["b.md"].Content != "partial" {
+		t.Errorf("writing file = %+v", vfs["b.md"])
+	}
+	reopened, _ := store.NewSessionStore(dir)
+	if vfs, _ := reopened.GetVFS("sess_old"); len(vfs) != 1 {
+		t.Errorf("in-progress write should not be persisted: %v", vfs)
+	}
+	_ = s.CommitVFS("sess_old", "b.md", "done", "markdown", store.RevisionSource{Source: "tool"})
+	if after, _ := os.Stat(filepath.Join(dir, "sess_old.json")); !after.ModTime().Equal(docInfo.ModTime()) {
+		t.Error("writing a file should not rewrite the session document")
+	}
+	reopened, _ = store.NewSessionStore(dir)
+	if vfs, _ := reopened.GetVFS("sess_old"); vfs["b.md"].Content != "done" || vfs["b.md"].IsWriting {
+		t.Errorf("committed file = %+v", vfs["b.md"])
+	}
+
+	// 保存会话文档不会覆盖期间写入的文件
+	state, _ := s.GetSession("sess_old")
+	_ = s.CommitVFS("sess_old", "c.md", "c", "markdown", store.RevisionSource{Source: "tool"})
+	state.Title = "改名"
+	_ = s.SaveSession("sess_old", state)
+	if docHasVFS("sess_old") {
+		t.Error("SaveSession should not write vfs into the session document")
+	}
+	if vfs, _ := s.GetVFS("sess_old"); vfs["c.md"].Content != "c" {
+		t.Errorf("file written during turn was lost: %v", vfs)
+	}
+
+	// 目录移动到自身上级时目标与源重叠（a/b/b/y -> a/b/y），结果不能依赖遍历顺序
+	for i := 0; i < 20; i++ {
+		_, _ = s.PutFile("sess_old", "a/b/y", "outer", "", store.RevisionSource{})
+		_, _ = s.PutFile("sess_old", "a/b/b/y", "inner", "", store.RevisionSource{})
+		moved, err := s.MoveFile("sess_old", "a/b", "a", false, store.RevisionSource{})
+		vfs, _ := s.GetVFS("sess_old")
+		if err != nil || len(moved) != 2 || vfs["a/y"].Content != "outer" || vfs["a/b/y"].Content != "inner" {
+			t.Fatalf("overlapping move = %v, %v; a/y = %q, a/b/y = %q", moved, err, vfs["a/y"].Content, vfs["a/b/y"].Content)
+		}
+		_, _ = s.DeleteFile("sess_old", "a", store.RevisionSource{})
+	}
+
+	// 写入目标失败时源文件保留
+	_, _ = s.PutFile("sess_old", "m/src.md", "keep", "", store.RevisionSource{})
+	sum := sha1.Sum([]byte("n/src.md"))
+	blocker := filepath.Join(dir, "vfs", "sess_old", hex.EncodeToString(sum[:])+".json")
+	_ = os.MkdirAll(blocker, 0755)
+	if _, err := s.MoveFile("sess_old", "m", "n", false, store.RevisionSource{}); err == nil {
+		t.Error("move onto an unwritable destination should fail")
+	}
+	_ = os.RemoveAll(blocker)
+	if vfs, _ := s.GetVFS("sess_old"); vfs["m/src.md"].Content != "keep" {
+		t.Errorf("source lost after failed move: %v", vfs["m/src.md"])
+	}
+
+	_ = s.DeleteSession("sess_old")
+	if _, err := os.Stat(filepath.Join(dir, "vfs", "sess_old")); !os.IsNotExist(err) {
+		t.Errorf("vfs dir after delete: %v", err)
+	}
+}
+
+func uploadDocument(t *testing.T, h *Handler, id, filename string, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, _ := mw.CreateFormFile("file", filename)
+	fw.Write(data)
+	mw.WriteField("mode", "rule")
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/sessions/"+id+"/knowledge/documents", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	h.KnowledgeDocuments(rec, req, id, nil)
+	return rec
+}
+
+func TestUploadKnowledgeDocument(t *testing.T) {
+	h := initTestHandler(t)
+	id, _ := h.store.CreateSession()
+
+	page := `<html><head><title>t</title><style>p{}</style></head><body>
+<h1>员工手册</h1><p>适用于全体  员工。</p>
+<h2>休假</h2><ul><li>年假 <b>10</b> 天</li><li>病假<ol><li>需证明</li></ol></li></ul>
+<table><tr><th>类型</th><th>天数</th></tr><tr><td>婚假</td><td>3</td></tr></table>
+<script>alert(1)</script></body></html>`
+	rec := uploadDocument(t, h, id, "handbook.html", []byte(page))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload html code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var out struct {
+		Document store.KnowledgeDocument `json:"document"`
+		Chunks   []store.KnowledgeChunk  `json:"chunks"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	if out.Document.Format != "html" || out.Document.Name != "handbook.html" || out.Document.Chunks != len(out.Chunks) {
+		t.Fatalf("document = %+v", out.Document)
+	}
+	_, text, err := h.store.GetKnowledgeDocument(id, out.Document.ID)
+	if err != nil {
+		t.Fatalf("GetKnowledgeDocument: %v", err)
+	}
+	want := "# 员工手册\n\n适用于全体 员工。\n\n## 休假\n\n- 年假 10 天\n- 病假\n  1. 需证明\n\n| 类型 | 天数 |\n| --- | --- |\n| 婚假 | 3 |"
+	if text != want {
+		t.Errorf("extracted text = %q, want %q", text, want)
+	}
+	if len(out.Chunks) != 2 {
+		t.Fatalf("chunks = %+v", out.Chunks)
+	}
+	runes := []rune(text)
+	for i, wantSection := range [][]string{{"员工手册"}, {"员工手册", "休假"}} {
+		src := out.Chunks[i].Source
+		if src == nil || src.DocumentID != out.Document.ID || src.Document != "handbook.html" {
+			t.Fatalf("chunk %d source = %+v", i, src)
+		}
+		if strings.Join(src.Section, "/") != strings.Join(wantSection, "/") {
+			t.Errorf("chunk %d section = %v, want %v", i, src.Section, wantSection)
+		}
+		if got := string(runes[src.Start:src.End]); got != out.Chunks[i].Content {
+			t.Errorf("chunk %d offsets [%d,%d) = %q", i, src.Start, src.End, got)
+		}
+	}
+
+	// 中文 Word 的标题样式 ID 为数字，按 styles.xml 中的样式名识别
+	var docx bytes.Buffer
+	zw := zip.NewWriter(&docx)
+	part := func(name, content string) {
+		fw, _ := zw.Create(name)
+		fw.Write([]byte(content))
+	}
+	part("word/styles.xml", `<w:styles xmlns:w="w"><w:style w:styleId="1"><w:name w:val="heading 1"/></w:style></w:styles>`)
+	part("word/document.xml", `<w:document xmlns:w="w"><w:body>
+<w:p><w:pPr><w:pStyle w:val="1"/></w:pPr><w:r><w:t>报销制度</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">差旅费 </w:t></w:r><w:r><w:t>按实报销。</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="1"/></w:numPr></w:pPr><w:r><w:t>保留发票</w:t></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:p><w:r><w:t>项目</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>上限</w:t></w:r></w:p></w:tc></w:tr>
+<w:tr><w:tc><w:p><w:r><w:t>住宿</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>500|晚</w:t></w:r></w:p></w:tc></w:tr></w:tbl>
+</w:body></w:document>`)
+	zw.Close()
+	rec = uploadDocument(t, h, id, "policy.docx", docx.Bytes())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload docx code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	_, text, _ = h.store.GetKnowledgeDocument(id, out.Document.ID)
+	want = "# 报销制度\n\n差旅费 按实报销。\n\n  - 保留发票\n\n| 项目 | 上限 |\n| --- | --- |\n| 住宿 | 500\\|晚 |"
+	if out.Document.Format != "docx" || text != want {
+		t.Errorf("docx format = %q, text = %q, want %q", out.Document.Format, text, want)
+	}
+
+	rec = uploadDocument(t, h, id, "data.bin", []byte{0xff, 0xfe, 0x00, 0x01})
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("binary upload code = %d, want 415", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions/"+id+"/knowledge/documents", nil)
+	rec = httptest.NewRecorder()
+	h.KnowledgeDocuments(rec, req, id, nil)
+	var list struct {
+		Documents []store.KnowledgeDocument `json:"documents"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list.Documents) != 2 || list.Documents[1].Name != "policy.docx" {
+		t.Errorf("documents = %+v", list.Documents)
+	}
+	sess, _ := h.store.GetSession(id)
+	if len(sess.KnowledgeChunks) != 2+out.Document.Chunks {
+		t.Errorf("stored chunks = %d", len(sess.KnowledgeChunks))
+	}
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"agentic-demo/server/internal/store"
+	"agentic-demo/server/internal/toolset"
+)
+
+// toolProfileBody 创建/更新工具配置的请求体
+type toolProfileBody struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Tools       []string          `json:"tools"`
+	Approvals   map[string]string `json:"approvals"`
+	Modes       []string          `json:"modes"`
+	Industries  []string          `json:"industries"`
+}
+
+// ListToolProfiles GET /api/tool-profiles
+func (h *Handler) ListToolProfiles(w http.ResponseWriter, r *http.Request) {
+	if h.toolProfiles == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "tool profile store not configured"})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"profiles": h.toolProfiles.List()})
+}
+
+// GetToolProfile GET /api/tool-profiles/{id}
+func (h *Handler) GetToolProfile(w http.ResponseWriter, r *http.Request, id string) {
+	if h.toolProfiles == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "tool profile store not configured"})
+		return
+	}
+	p := h.toolProfiles.Get(id)
+	if p == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	writeJSON(w, p)
+}
+
+// CreateToolProfile POST /api/tool-profiles
+func (h *Handler) CreateToolProfile(w http.ResponseWriter, r *http.Request) {
+	if h.toolProfiles == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "tool profile store not configured"})
+		return
+	}
+	p, ok := decodeToolProfile(w, r)
+	if !ok {
+		return
+	}
+	created, err := h.toolProfiles.Add(p)
+	if err != nil {
+		writeToolProfileError(w, err)
+		return
+	}
+	writeJSONStatus(w, http.StatusCreated, created)
+}
+
+// UpdateToolProfile PUT /api/tool-profiles/{id}：整体替换
+func (h *Handler) UpdateToolProfile(w http.ResponseWriter, r *http.Request, id string) {
+	if h.toolProfiles == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "tool profile store not configured"})
+		return
+	}
+	p, ok := decodeToolProfile(w, r)
+	if !ok {
+		return
+	}
+	p.ID = id
+	updated, err := h.toolProfiles.Replace(p)
+	if err != nil {
+		writeToolProfileError(w, err)
+		return
+	}
+	writeJSON(w, updated)
+}
+
+// DeleteToolProfile DELETE /api/tool-profiles/{id}；指定了该配置的会话回退为按模式/行业绑定
+func (h *Handler) DeleteToolProfile(w http.ResponseWriter, r *http.Request, id string) {
+	if h.toolProfiles == nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "tool profile store not configured"})
+		return
+	}
+	if err := h.toolProfiles.Remove(id); err != nil {
+		writeToolProfileError(w, err)
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func decodeToolProfile(w http.ResponseWriter, r *http.Request) (store.ToolProfile, bool) {
+	var body toolProfileBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return store.ToolProfile{}, false
+	}
+	p := store.ToolProfile{
+		Name:        strings.TrimSpace(body.Name),
+		Description: strings.TrimSpace(body.Description),
+		Tools:       compactStrings(body.Tools),
+		Approvals:   body.Approvals,
+		Modes:       compactStrings(body.Modes),
+		Industries:  compactStrings(body.Industries),
+	}
+	if p.Name == "" {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "name required"})
+		return store.ToolProfile{}, false
+	}
+	if !checkApprovals(w, p.Approvals) {
+		return store.ToolProfile{}, false
+	}
+	return p, true
+}
+
+// checkApprovals 审批策略只能是 auto 或 plan；失败时已写入响应
+func checkApprovals(w http.ResponseWriter, approvals map[string]string) bool {
+	for id, a := range approvals {
+		if a != store.ApprovalAuto && a != store.ApprovalPlan {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "approvals." + id + " must be auto or plan"})
+			return false
+		}
+	}
+	return true
+}
+
+func writeToolProfileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrToolProfileNotFound):
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	case errors.Is(err, store.ErrToolProfileExists):
+		writeJSONStatus(w, http.StatusConflict, map[string]string{"error": "配置名已存在"})
+	case errors.Is(err, store.ErrToolProfileBound):
+		writeJSONStatus(w, http.StatusConflict, map[string]string{"error": "模式或行业已绑定到其他配置"})
+	default:
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
+
+// compactStrings 去掉空白项与重复项，保持顺序
+func compactStrings(list []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s != "" && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// resolveTools 计算会话（可为空）在指定模式/行业下的可用工具
+func (h *Handler) resolveTools(sess *store.AgentSessionState, mode, industry string) *toolset.Result {
+	in := toolset.Input{IDs: h.registry.GetIDs(), Profiles: h.toolProfiles, Mode: mode, Industry: industry}
+	if h.toolEnable != nil {
+		in.Global = h.toolEnable.GetEnabled
+	}
+	if sess != nil {
+		in.Session = sess.Tools
+	}
+	return toolset.Resolve(in)
+}
+
+// GetEffectiveTools GET /api/tools/effective?sessionId=&mode=&industry=：
+// 说明每个工具是否可用、由哪一层（global、profile、session）决定以及审批策略
+func (h *Handler) GetEffectiveTools(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var sess *store.AgentSessionState
+	if id := q.Get("sessionId"); id != "" {
+		if sess, _ = h.store.GetSessionDoc(id); sess == nil {
+			writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "session not found"})
+			return
+		}
+	}
+	writeJSON(w, h.resolveTools(sess, q.Get("mode"), q.Get("industry")))
+}
+
+// GetSessionTools GET /api/sessions/{id}/tools?mode=&industry=：会话的工具设置与计算结果
+func (h *Handler) GetSessionTools(w http.ResponseWriter, r *http.Request, sessionID string) {
+	sess, _ := h.store.GetSessionDoc(sessionID)
+	if sess == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "session not found"})
+		return
+	}
+	settings := sess.Tools
+	if settings == nil {
+		settings = &store.SessionTools{}
+	}
+	writeJSON(w, map[string]interface{}{
+		"settings":  settings,
+		"effective": h.resolveTools(sess, r.URL.Query().Get("mode"), r.URL.Query().Get("industry")),
+	})
+}
+
+// UpdateSessionTools PUT /api/sessions/{id}/tools：整体替换会话的工具设置
+func (h *Handler) UpdateSessionTools(w http.ResponseWriter, r *http.Request, sessionID string) {
+	sess, _ := h.store.GetSessionDoc(sessionID)
+	if sess == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "session not found"})
+		return
+	}
+	var body store.SessionTools
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	if body.Profile != "" && body.Profile != store.NoToolProfile && (h.toolProfiles == nil || h.toolProfiles.Get(body.Profile) == nil) {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "tool profile not found: " + body.Profile})
+		return
+	}
+	if !checkApprovals(w, body.Approvals) {
+		return
+	}
+	var settings *store.SessionTools
+	if body.Profile != "" || len(body.Enabled) > 0 || len(body.Approvals) > 0 {
+		settings = &body
+	}
+	if err := h.store.UpdateSession(sessionID, map[string]any{"tools": settings}); err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	sess.Tools = settings
+	if settings == nil {
+		settings = &store.SessionTools{}
+	}
+	writeJSON(w, map[string]interface{}{
+		"settings":  settings,
+		"effective": h.resolveTools(sess, r.URL.Query().Get("mode"), r.URL.Query().Get("industry")),
+	})
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"agentic-demo/server/internal/store"
+	"agentic-demo/server/internal/toolset"
+)
+
+func TestToolProfiles_EffectiveTools(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	ps, err := store.NewToolProfileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewToolProfileStore: %v", err)
+	}
+	h.SetToolProfileStore(ps)
+
+	rec := httptest.NewRecorder()
+	h.CreateToolProfile(rec, httptest.NewRequest(http.MethodPost, "/api/tool-profiles", strings.NewReader(
+		`{"name":"演示","tools":["get_current_date","create_todo","list_todos"],"approvals":{"create_todo":"plan"},"modes":["演示模式"]}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("CreateToolProfile code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var profile store.ToolProfile
+	_ = json.Unmarshal(rec.Body.Bytes(), &profile)
+
+	rec = httptest.NewRecorder()
+	h.CreateToolProfile(rec, httptest.NewRequest(http.MethodPost, "/api/tool-profiles", strings.NewReader(`{"name":"另一个","modes":["演示模式"]}`)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("duplicate binding code = %d, want 409", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.CreateToolProfile(rec, httptest.NewRequest(http.MethodPost, "/api/tool-profiles", strings.NewReader(`{"name":"x","approvals":{"a":"always"}}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid approval code = %d, want 400", rec.Code)
+	}
+
+	sessionID, _ := h.store.CreateSession()
+	_ = h.toolEnable.SetEnabled("list_todos", false)
+	rec = httptest.NewRecorder()
+	h.UpdateSessionTools(rec, httptest.NewRequest(http.MethodPut, "/api/sessions/"+sessionID+"/tools?mode=演示模式", strings.NewReader(
+		`{"enabled":{"write_file":true,"list_todos":true},"approvals":{"get_current_date":"plan"}}`)), sessionID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("UpdateSessionTools code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.GetEffectiveTools(rec, httptest.NewRequest(http.MethodGet, "/api/tools/effective?sessionId="+sessionID+"&mode=演示模式", nil))
+	var eff struct {
+		Profile    *store.ToolProfile `json:"profile"`
+		ProfileVia string             `json:"profileVia"`
+		Tools      []toolset.Tool     `json:"tools"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &eff)
+	if eff.Profile == nil || eff.Profile.ID != profile.ID || eff.ProfileVia != "mode" {
+		t.Fatalf("profile = %+v via %q", eff.Profile, eff.ProfileVia)
+	}
+	tools := map[string]toolset.Tool{}
+	for _, tl := range eff.Tools {
+		tools[tl.ID] = tl
+	}
+	for id, want := range map[string]struct {
+		available bool
+		layer     string
+		approval  string
+	}{
+		"create_todo":      {true, toolset.LayerProfile, store.ApprovalPlan},
+		"get_current_date": {true, toolset.LayerProfile, store.ApprovalPlan},
+		"write_file":       {true, toolset.LayerSession, store.ApprovalAuto},
+		"list_todos":       {false, toolset.LayerGlobal, store.ApprovalAuto},
+		"propose_plan":     {false, toolset.LayerProfile, store.ApprovalAuto},
+	} {
+		got := tools[id]
+		if got.Available != want.available || got.Layer != want.layer || got.Approval != want.approval || got.Reason == "" {
+			t.Errorf("%s = %+v, want %+v", id, got, want)
+		}
+	}
+
+	// 直接调用使用相同的计算
+	invoke := func(id, body string) int {
+		rec := httptest.NewRecorder()
+		h.InvokeTool(rec, httptest.NewRequest(http.MethodPost, "/api/tools/"+id+"/invoke", strings.NewReader(body)), id)
+		return rec.Code
+	}
+	if code := invoke("propose_plan", `{"sessionId":"`+sessionID+`","mode":"演示模式","approved":true,"arguments":{}}`); code != http.StatusForbidden {
+		t.Errorf("tool outside profile: code = %d, want 403", code)
+	}
+	if code := invoke("create_todo", `{"sessionId":"`+sessionID+`","mode":"演示模式","arguments":{"title":"a"}}`); code != http.StatusConflict {
+		t.Errorf("plan approval tool: code = %d, want 409", code)
+	}
+	if code := invoke("create_todo", `{"sessionId":"`+sessionID+`","mode":"演示模式","approved":true,"arguments":{"title":"a"}}`); code != http.StatusOK {
+		t.Errorf("approved plan tool: code = %d, want 200", code)
+	}
+
+	// 会话显式不使用配置后，propose_plan 恢复默认启用
+	rec = httptest.NewRecorder()
+	h.UpdateSessionTools(rec, httptest.NewRequest(http.MethodPut, "/api/sessions/"+sessionID+"/tools?mode=演示模式", strings.NewReader(`{"profile":"none"}`)), sessionID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("UpdateSessionTools none code = %d", rec.Code)
+	}
+	sess, _ := h.store.GetSession(sessionID)
+	res := h.resolveTools(sess, "演示模式", "")
+	if res.Profile != nil || !res.Available("propose_plan") {
+		t.Errorf("profile none: profile = %+v, propose_plan available = %v", res.Profile, res.Available("propose_plan"))
+	}
+	rec = httptest.NewRecorder()
+	h.UpdateSessionTools(rec, httptest.NewRequest(http.MethodPut, "/api/sessions/"+sessionID+"/tools", strings.NewReader(`{"profile":"missing"}`)), sessionID)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown profile code = %d, want 400", rec.Code)
+	}
+}
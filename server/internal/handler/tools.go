@@ -3,6 +3,9 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"time"
+
+	"agentic-demo/server/internal/store"
 )
 
 // ToolItem for API response
@@ -14,6 +17,20 @@ type ToolItem struct {
 	Enabled     bool                   `json:"enabled"`
 	Source      string                 `json:"source"`
 	Definition  map[string]interface{}  `json:"definition,omitempty"`
+	// 生效的执行限制（全局默认值或单工具配置），0 表示不限制
+	TimeoutMs      int `json:"timeoutMs"`
+	MaxResultBytes int `json:"maxResultBytes"`
+	// 调用统计：列表须传 ?stats=1，单个工具始终返回
+	Stats       *store.ToolStats `json:"stats,omitempty"`
+	RecentCalls []store.ToolCall `json:"recentCalls,omitempty"`
+}
+
+// withLimits 填入工具当前生效的执行限制
+func (h *Handler) withLimits(item ToolItem) ToolItem {
+	l := h.registry.LimitsFor(item.ID)
+	item.TimeoutMs = int(l.Timeout / time.Millisecond)
+	item.MaxResultBytes = l.MaxResultBytes
+	return item
 }
 
 func (h *Handler) ListTools(w http.ResponseWriter, r *http.Request) {
@@ -25,20 +42,29 @@ func (h *Handler) ListTools(w http.ResponseWriter, r *http.Request) {
 		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "tool enable store not configured"})
 		return
 	}
+	var stats map[string]store.ToolStats
+	if r.URL.Query().Get("stats") == "1" && h.toolUsage != nil {
+		stats = h.toolUsage.Stats()
+	}
 	var items []ToolItem
 	for _, id := range h.registry.GetIDs() {
 		def, blocking, ok := h.registry.GetTool(id)
 		if !ok || def == nil {
 			continue
 		}
-		items = append(items, ToolItem{
+		item := h.withLimits(ToolItem{
 			ID:          id,
 			Name:        def.Name,
 			Description: def.Description,
 			Blocking:    blocking,
 			Enabled:     h.toolEnable.GetEnabled(id),
-			Source:      "builtin",
+			Source:      h.registry.GetSource(id),
 		})
+		if stats != nil {
+			st := stats[id]
+			item.Stats = &st
+		}
+		items = append(items, item)
 	}
 	writeJSON(w, map[string]interface{}{"tools": items})
 }
@@ -67,14 +93,19 @@ func (h *Handler) GetTool(w http.ResponseWriter, r *http.Request, id string) {
 	}
 	def, blocking, ok := h.registry.GetTool(id)
 	if ok && def != nil {
-		writeJSON(w, ToolItem{
+		item := h.withLimits(ToolItem{
 			ID:          id,
 			Name:        def.Name,
 			Description: def.Description,
 			Blocking:    blocking,
 			Enabled:     h.toolEnable.GetEnabled(id),
-			Source:      "builtin",
+			Source:      h.registry.GetSource(id),
 		})
+		if h.toolUsage != nil {
+			st, recent := h.toolUsage.ToolStats(id)
+			item.Stats, item.RecentCalls = &st, recent
+		}
+		writeJSON(w, item)
 		return
 	}
 	// MCP 等非 builtin：仅返回启用状态
@@ -92,24 +123,86 @@ func (h *Handler) UpdateTool(w http.ResponseWriter, r *http.Request, id string)
 		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "tool enable store not configured"})
 		return
 	}
-	// 支持任意工具 ID（含 builtin 与 MCP），仅持久化启用状态
+	// 支持任意工具 ID（含 builtin 与 MCP），持久化启用状态与单工具执行限制（0 表示恢复默认值，-1 表示不限制）
 	var body struct {
-		Enabled *bool `json:"enabled"`
+		Enabled        *bool `json:"enabled"`
+		TimeoutMs      *int  `json:"timeoutMs"`
+		MaxResultBytes *int  `json:"maxResultBytes"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
 		return
 	}
-	if body.Enabled == nil {
-		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "enabled field required"})
+	if body.Enabled == nil && body.TimeoutMs == nil && body.MaxResultBytes == nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "enabled, timeoutMs or maxResultBytes required"})
 		return
 	}
-	if err := h.toolEnable.SetEnabled(id, *body.Enabled); err != nil {
-		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
-		return
+	if body.TimeoutMs != nil || body.MaxResultBytes != nil {
+		if h.toolLimits == nil {
+			writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "tool limit store not configured"})
+			return
+		}
+		limits := h.toolLimits.Get(id)
+		if body.TimeoutMs != nil {
+			limits.TimeoutMs = *body.TimeoutMs
+		}
+		if body.MaxResultBytes != nil {
+			limits.MaxResultBytes = *body.MaxResultBytes
+		}
+		if limits.TimeoutMs < store.ToolLimitUnlimited || limits.MaxResultBytes < store.ToolLimitUnlimited {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "timeoutMs and maxResultBytes must be >= -1"})
+			return
+		}
+		if err := h.toolLimits.Set(id, limits); err != nil {
+			writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
 	}
+	if body.Enabled != nil {
+		if err := h.toolEnable.SetEnabled(id, *body.Enabled); err != nil {
+			writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	l := h.registry.LimitsFor(id)
 	writeJSON(w, map[string]interface{}{
-		"id":      id,
-		"enabled": *body.Enabled,
+		"id":             id,
+		"enabled":        h.toolEnable.GetEnabled(id),
+		"timeoutMs":      int(l.Timeout / time.Millisecond),
+		"maxResultBytes": l.MaxResultBytes,
 	})
 }
+
+// toolEventsKeepAlive SSE 心跳间隔，避免代理断开空闲连接
+const toolEventsKeepAlive = 30 * time.Second
+
+// ToolEvents 以 SSE 推送工具集变更（MCP 服务器 tools/list_changed 等），前端据此刷新工具列表
+func (h *Handler) ToolEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.mcpToolSync == nil {
+		writeJSONStatus(w, http.StatusNotImplemented, map[string]string{"error": "tool sync not configured"})
+		return
+	}
+	changes, cancel := h.mcpToolSync.Subscribe()
+	defer cancel()
+	flusher := SetupSSE(w)
+	SendEvent(w, flusher, "ready", map[string]any{})
+	ticker := time.NewTicker(toolEventsKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case c, ok := <-changes:
+			if !ok {
+				return
+			}
+			SendEvent(w, flusher, "toolsChanged", c)
+		case <-ticker.C:
+			SendEvent(w, flusher, "ping", map[string]any{})
+		}
+	}
+}
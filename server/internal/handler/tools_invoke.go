@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"agentic-demo/server/internal/registry"
+	"agentic-demo/server/internal/store"
+)
+
+// invokeToolBody POST /api/tools/{id}/invoke 的请求体
+type invokeToolBody struct {
+	Arguments json.RawMessage `json:"arguments"`
+	SessionID string          `json:"sessionId"`
+	DryRun    bool            `json:"dryRun"`   // 只校验参数，不执行
+	Approved  bool            `json:"approved"` // 需要用户确认的工具（如 propose_plan）须显式确认
+	// Mode、Industry 用于按绑定选择工具配置，与对话请求的 options 一致
+	Mode     string `json:"mode"`
+	Industry string `json:"industry"`
+}
+
+// toolSideEffects 一次调用对会话 VFS 与待办的改动
+type toolSideEffects struct {
+	FilesWritten []string `json:"filesWritten"`
+	FilesDeleted []string `json:"filesDeleted"`
+	TodosCreated []string `json:"todosCreated"`
+	TodosUpdated []string `json:"todosUpdated"`
+	TodosDeleted []string `json:"todosDeleted"`
+}
+
+type invokeToolResp struct {
+	Tool        string           `json:"tool"`
+	Source      string           `json:"source"`
+	DryRun      bool             `json:"dryRun,omitempty"`
+	OK          bool             `json:"ok"`
+	Result      interface{}      `json:"result,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	ErrorClass  string           `json:"errorClass,omitempty"`
+	DurationMs  int64            `json:"durationMs"`
+	Progress    []string         `json:"progress,omitempty"`
+	Logs        string           `json:"logs,omitempty"`
+	SideEffects *toolSideEffects `json:"sideEffects,omitempty"`
+}
+
+// InvokeTool POST /api/tools/{id}/invoke：不经模型直接执行工具，便于调试。
+// 与对话中的调用使用相同的 ExecuteRequest；已禁用的工具返回 403，需要用户确认的工具须传 approved
+func (h *Handler) InvokeTool(w http.ResponseWriter, r *http.Request, id string) {
+	def, blocking, ok := h.registry.GetTool(id)
+	if !ok {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "tool not found", "errorClass": registry.ErrNotFound})
+		return
+	}
+	var body invokeToolBody
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<20)).Decode(&body); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	if body.SessionID == "" && mcpSessionTools[id] {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": id + " 读写会话数据，须指定 sessionId"})
+		return
+	}
+	var sess *store.AgentSessionState
+	if body.SessionID != "" {
+		if sess, _ = h.store.GetSessionDoc(body.SessionID); sess == nil {
+			writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "session not found"})
+			return
+		}
+	}
+	// 与对话相同的三层计算：全局启用状态、工具配置、会话覆盖
+	avail, _ := h.resolveTools(sess, body.Mode, body.Industry).Lookup(id)
+	if !avail.Available {
+		writeJSONStatus(w, http.StatusForbidden, map[string]string{"error": "工具不可用：" + avail.Reason, "errorClass": registry.ErrPermissionDenied, "layer": avail.Layer})
+		return
+	}
+	if (blocking || avail.Approval == store.ApprovalPlan) && !body.Approved && !body.DryRun {
+		writeJSONStatus(w, http.StatusConflict, map[string]string{"error": id + " 在对话中需要用户确认，直接调用须传 approved: true"})
+		return
+	}
+
+	resp := invokeToolResp{Tool: id, Source: h.registry.GetSource(id), DryRun: body.DryRun}
+	if err := registry.ValidateArgs(def, body.Arguments); err != nil {
+		resp.Error, resp.ErrorClass = err.Error(), registry.ErrInvalidArgs
+		// 参数校验未进入 registry.Execute，实际调用时单独记一次失败
+		if !body.DryRun && h.toolUsage != nil {
+			_ = h.toolUsage.Record(store.ToolCall{
+				Tool: id, SessionID: body.SessionID, Caller: "invoke", StartedAt: time.Now().UnixMilli(),
+				ErrorClass: resp.ErrorClass, Error: resp.Error, ArgBytes: len(body.Arguments),
+			})
+		}
+		writeJSON(w, resp)
+		return
+	}
+	if body.DryRun {
+		resp.OK = true
+		writeJSON(w, resp)
+		return
+	}
+
+	vfsBefore := h.sessionVFS(body.SessionID)
+	todosBefore := h.todoSnapshot()
+	var logs strings.Builder
+	ctx := r.Context()
+	req := registry.ExecuteRequest{
+		Ctx:          ctx,
+		SessionID:    body.SessionID,
+		Store:        h.store,
+		TodoStore:    h.todoStore,
+		GeminiClient: newGeminiClient(ctx),
+		OnProgress:   func(msg string) { resp.Progress = append(resp.Progress, msg) },
+		OnLog:        func(s string) { logs.WriteString(s) },
+		Caller:       "invoke",
+	}
+	start := time.Now()
+	res, err := h.registry.Execute(req, id, body.Arguments)
+	resp.DurationMs = time.Since(start).Milliseconds()
+	resp.Logs = logs.String()
+	if err != nil {
+		resp.Error, resp.ErrorClass = err.Error(), registry.ErrorClassOf(err, resp.Source)
+	} else {
+		resp.OK, resp.Result = true, res
+	}
+	resp.SideEffects = diffSideEffects(vfsBefore, h.sessionVFS(body.SessionID), todosBefore, h.todoSnapshot())
+	writeJSON(w, resp)
+}
+
+func (h *Handler) sessionVFS(sessionID string) map[string]store.VfsFile {
+	if sessionID == "" {
+		return nil
+	}
+	sess, _ := h.store.GetSession(sessionID)
+	if sess == nil {
+		return nil
+	}
+	return sess.VFS
+}
+
+func (h *Handler) todoSnapshot() map[string]store.TodoItem {
+	if h.todoStore == nil {
+		return nil
+	}
+	items, _ := h.todoStore.List(true)
+	out := make(map[string]store.TodoItem, len(items))
+	for _, it := range items {
+		out[it.ID] = it
+	}
+	return out
+}
+
+func diffSideEffects(vfsBefore, vfsAfter map[string]store.VfsFile, todosBefore, todosAfter map[string]store.TodoItem) *toolSideEffects {
+	fx := &toolSideEffects{
+		FilesWritten: []string{}, FilesDeleted: []string{},
+		TodosCreated: []string{}, TodosUpdated: []string{}, TodosDeleted: []string{},
+	}
+	for p, f := range vfsAfter {
+		if prev, ok := vfsBefore[p]; !ok || prev.Content != f.Content || prev.Language != f.Language {
+			fx.FilesWritten = append(fx.FilesWritten, p)
+		}
+	}
+	for p := range vfsBefore {
+		if _, ok := vfsAfter[p]; !ok {
+			fx.FilesDeleted = append(fx.FilesDeleted, p)
+		}
+	}
+	for id, it := range todosAfter {
+		if prev, ok := todosBefore[id]; !ok {
+			fx.TodosCreated = append(fx.TodosCreated, id)
+		} else if prev != it {
+			fx.TodosUpdated = append(fx.TodosUpdated, id)
+		}
+	}
+	for id := range todosBefore {
+		if _, ok := todosAfter[id]; !ok {
+			fx.TodosDeleted = append(fx.TodosDeleted, id)
+		}
+	}
+	for _, list := range [][]string{fx.FilesWritten, fx.FilesDeleted, fx.TodosCreated, fx.TodosUpdated, fx.TodosDeleted} {
+		sort.Strings(list)
+	}
+	return fx
+}
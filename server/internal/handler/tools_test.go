@@ -2,16 +2,25 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"agentic-demo/server/internal/registry"
+	"agentic-demo/server/internal/registry/builtin"
 	"agentic-demo/server/internal/setup"
 	"agentic-demo/server/internal/store"
+	"agentic-demo/server/internal/textdiff"
+
+	"google.golang.org/genai"
 )
 
 func initTestHandlerWithTools(t *testing.T) *Handler {
@@ -151,3 +160,606 @@ func TestUpdateTool_InvalidBody(t *testing.T) {
 		t.Errorf("UpdateTool invalid body code = %d, want 400", rec.Code)
 	}
 }
+
+func mcpServeRPC(t *testing.T, h *Handler, sessionID, body string) map[string]any {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+	req.RemoteAddr = "127.0.0.1:50000"
+	if sessionID != "" {
+		req.Header.Set("X-Session-Id", sessionID)
+	}
+	rec := httptest.NewRecorder()
+	h.McpServe(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("McpServe code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var out map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return out
+}
+
+func TestMcpServe_ListAndCall(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	if err := h.toolEnable.SetEnabled("generate_chart", false); err != nil {
+		t.Fatal(err)
+	}
+	init := mcpServeRPC(t, h, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`)
+	if v := init["result"].(map[string]any)["protocolVersion"]; v != "2024-11-05" {
+		t.Errorf("protocolVersion = %v", v)
+	}
+
+	list := mcpServeRPC(t, h, "", `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	names := map[string]bool{}
+	for _, tool := range list["result"].(map[string]any)["tools"].([]any) {
+		names[tool.(map[string]any)["name"].(string)] = true
+	}
+	if !names["create_todo"] || !names["write_file"] {
+		t.Errorf("tools missing builtins: %v", names)
+	}
+	if names["generate_chart"] || names["propose_plan"] {
+		t.Errorf("disabled or blocking tools exposed: %v", names)
+	}
+
+	call := mcpServeRPC(t, h, "", `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"create_todo","arguments":{"title":"来自 MCP"}}}`)
+	if res := call["result"].(map[string]any); res["isError"] == true {
+		t.Errorf("create_todo result = %v", res)
+	}
+	if items, _ := h.todoStore.List(false); len(items) != 1 {
+		t.Errorf("todos = %d, want 1", len(items))
+	}
+
+	call = mcpServeRPC(t, h, "", `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"write_file","arguments":{"path":"a.md","content":"x"}}}`)
+	if res := call["result"].(map[string]any); res["isError"] != true {
+		t.Errorf("write_file without session should fail: %v", res)
+	}
+	sid, _ := h.store.CreateSession()
+	call = mcpServeRPC(t, h, sid, `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"write_file","arguments":{"path":"a.md","content":"x","language":"markdown"}}}`)
+	if res := call["result"].(map[string]any); res["isError"] == true {
+		t.Errorf("write_file result = %v", res)
+	}
+	if sess, _ := h.store.GetSession(sid); sess == nil || sess.VFS["a.md"].Content != "x" {
+		t.Error("write_file should write to the session VFS")
+	}
+	call = mcpServeRPC(t, h, "", `{"jsonrpc":"2.0","id":6,"method":"tools/call","params":{"name":"generate_chart","arguments":{}}}`)
+	if call["error"] == nil {
+		t.Errorf("disabled tool call should be rejected: %v", call)
+	}
+}
+
+func TestMcpServe_Authorization(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	body := `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`
+	for _, tc := range []struct {
+		remote, origin string
+		want           int
+	}{
+		{"127.0.0.1:50000", "", http.StatusOK},
+		{"[::1]:50000", "http://localhost:5173", http.StatusOK},
+		{"192.168.1.20:50000", "", http.StatusUnauthorized},
+		{"127.0.0.1:50000", "https://evil.example", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+		req.RemoteAddr = tc.remote
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		rec := httptest.NewRecorder()
+		h.McpServe(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("remote %s origin %q: code = %d, want %d", tc.remote, tc.origin, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestUpdateTool_LimitsAndErrorClass(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	ls, err := store.NewToolLimitStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewToolLimitStore: %v", err)
+	}
+	h.SetToolLimitStore(ls)
+	decl := func(name string) *genai.FunctionDeclaration {
+		return &genai.FunctionDeclaration{Name: name, Description: name}
+	}
+	release := make(chan struct{})
+	defer close(release)
+	h.registry.RegisterExternal("slow_probe", registry.SourceHTTP, decl("slow_probe"), func(req registry.ExecuteRequest, _ json.RawMessage) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	big := strings.Repeat("数据", 400)
+	h.registry.RegisterExternal("big_probe", registry.SourceHTTP, decl("big_probe"), func(registry.ExecuteRequest, json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{"text": big}, nil
+	})
+
+	for id, body := range map[string]string{"slow_probe": `{"timeoutMs":50}`, "big_probe": `{"maxResultBytes":500}`} {
+		rec := httptest.NewRecorder()
+		h.UpdateTool(rec, httptest.NewRequest(http.MethodPut, "/api/tools/"+id, strings.NewReader(body)), id)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("UpdateTool %s code = %d, body = %s", id, rec.Code, rec.Body.String())
+		}
+	}
+
+	req := registry.ExecuteRequest{Ctx: context.Background(), SessionID: "s1"}
+	if _, err := h.registry.Execute(req, "slow_probe", nil); registry.ErrorClassOf(err, "") != registry.ErrTimeout {
+		t.Errorf("slow_probe err = %v, want timeout", err)
+	}
+	// -1 覆盖全局默认值表示不限制，小于 -1 非法
+	for body, code := range map[string]int{`{"timeoutMs":-1,"maxResultBytes":-1}`: http.StatusOK, `{"timeoutMs":-2}`: http.StatusBadRequest} {
+		rec := httptest.NewRecorder()
+		h.UpdateTool(rec, httptest.NewRequest(http.MethodPut, "/api/tools/big_probe", strings.NewReader(body)), "big_probe")
+		if rec.Code != code {
+			t.Errorf("UpdateTool %s code = %d, want %d", body, rec.Code, code)
+		}
+	}
+	if l := h.registry.LimitsFor("big_probe"); l.Timeout != 0 || l.MaxResultBytes != 0 {
+		t.Errorf("unlimited limits = %+v", l)
+	}
+	if _, err := h.registry.Execute(req, "big_probe", nil); err != nil {
+		t.Fatalf("big_probe unlimited: %v", err)
+	}
+	if err := ls.Set("big_probe", store.ToolLimits{MaxResultBytes: 500}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := h.registry.Execute(req, "no_such_tool", nil); registry.ErrorClassOf(err, "") != registry.ErrNotFound {
+		t.Errorf("unknown tool err = %v, want not_found", err)
+	}
+	if _, err := h.registry.Execute(req, "create_todo", json.RawMessage(`{}`)); registry.ErrorClassOf(err, "") != registry.ErrInvalidArgs {
+		t.Errorf("create_todo err = %v, want invalid_args", err)
+	}
+
+	// 超限结果分段读取后应还原为完整 JSON
+	res, err := h.registry.Execute(req, "big_probe", nil)
+	if err != nil {
+		t.Fatalf("big_probe: %v", err)
+	}
+	var full strings.Builder
+	chunk := res.(map[string]interface{})
+	for i := 0; ; i++ {
+		full.WriteString(chunk["content"].(string))
+		cont, ok := chunk["continuation"].(map[string]interface{})
+		if !ok {
+			break
+		}
+		if i > 20 {
+			t.Fatal("too many chunks")
+		}
+		args, _ := json.Marshal(cont)
+		next, err := h.registry.Execute(req, registry.ReadResultTool, args)
+		if err != nil {
+			t.Fatalf("read_tool_result: %v", err)
+		}
+		chunk = next.(map[string]interface{})
+		if i == 0 {
+			other := registry.ExecuteRequest{Ctx: context.Background(), SessionID: "s2"}
+			if _, err := h.registry.Execute(other, registry.ReadResultTool, args); registry.ErrorClassOf(err, "") != registry.ErrNotFound {
+				t.Errorf("handle readable from another session: %v", err)
+			}
+		}
+	}
+	want, _ := json.Marshal(map[string]interface{}{"text": big})
+	if full.String() != string(want) {
+		t.Errorf("reassembled result mismatch: %d vs %d bytes", full.Len(), len(want))
+	}
+}
+
+func TestWriteTools_Canceled(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	sessionID, _ := h.store.CreateSession()
+	_, _ = h.store.PutFile(sessionID, "a.md", "old\n", "markdown", store.RevisionSource{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ec := builtin.ExecutorContext{Ctx: ctx, SessionID: sessionID, Store: h.store, TodoStore: h.todoStore}
+	for name, args := range map[string]string{
+		"write_file":  `{"path":"b.md","contentChunks":["x","y"],"language":"markdown"}`,
+		"edit_file":   `{"path":"a.md","oldString":"old","newString":"new"}`,
+		"create_todo": `{"title":"late"}`,
+	} {
+		exec, _ := builtin.GetExecutor(name)
+		if _, err := exec(ec, json.RawMessage(args)); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s after cancel err = %v", name, err)
+		}
+	}
+	vfs, _ := h.store.GetVFS(sessionID)
+	if _, ok := vfs["b.md"]; ok {
+		t.Error("write_file committed after cancel")
+	}
+	if vfs["a.md"].Content != "old\n" {
+		t.Errorf("edit_file committed after cancel: %q", vfs["a.md"].Content)
+	}
+	if todos, _ := h.todoStore.List(true); len(todos) != 0 {
+		t.Errorf("create_todo persisted after cancel: %+v", todos)
+	}
+}
+
+func TestInvokeTool(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	sessionID, _ := h.store.CreateSession()
+	invoke := func(id, body string) (int, invokeToolResp) {
+		rec := httptest.NewRecorder()
+		h.InvokeTool(rec, httptest.NewRequest(http.MethodPost, "/api/tools/"+id+"/invoke", strings.NewReader(body)), id)
+		var resp invokeToolResp
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	if code, resp := invoke("create_todo", `{"dryRun":true,"arguments":{"priority":1}}`); code != http.StatusOK || resp.OK || resp.ErrorClass != registry.ErrInvalidArgs {
+		t.Errorf("dry run invalid: code = %d, resp = %+v", code, resp)
+	}
+	if code, resp := invoke("create_todo", `{"dryRun":true,"arguments":{"title":"x"}}`); code != http.StatusOK || !resp.OK || resp.SideEffects != nil {
+		t.Errorf("dry run valid: code = %d, resp = %+v", code, resp)
+	}
+	code, resp := invoke("create_todo", `{"arguments":{"title":"写周报"}}`)
+	if code != http.StatusOK || !resp.OK || resp.SideEffects == nil || len(resp.SideEffects.TodosCreated) != 1 {
+		t.Errorf("create_todo: code = %d, resp = %+v", code, resp)
+	}
+	code, resp = invoke("write_file", `{"sessionId":"`+sessionID+`","arguments":{"path":"a.md","content":"# hi","language":"markdown"}}`)
+	if code != http.StatusOK || !resp.OK || len(resp.SideEffects.FilesWritten) != 1 || resp.SideEffects.FilesWritten[0] != "a.md" {
+		t.Errorf("write_file: code = %d, resp = %+v", code, resp)
+	}
+	if code, _ := invoke("write_file", `{"arguments":{"path":"a.md","content":"x","language":"markdown"}}`); code != http.StatusBadRequest {
+		t.Errorf("write_file without session: code = %d, want 400", code)
+	}
+	if code, _ := invoke("propose_plan", `{"arguments":{}}`); code != http.StatusConflict {
+		t.Errorf("propose_plan without approval: code = %d, want 409", code)
+	}
+	_ = h.toolEnable.SetEnabled("get_current_date", false)
+	if code, _ := invoke("get_current_date", `{}`); code != http.StatusForbidden {
+		t.Errorf("disabled tool: code = %d, want 403", code)
+	}
+	if code, _ := invoke("no_such_tool", `{}`); code != http.StatusNotFound {
+		t.Errorf("unknown tool: code = %d, want 404", code)
+	}
+}
+
+func TestToolUsageStats(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	dir := t.TempDir()
+	us, err := store.NewToolUsageStore(dir)
+	if err != nil {
+		t.Fatalf("NewToolUsageStore: %v", err)
+	}
+	h.SetToolUsageStore(us)
+	for _, body := range []string{`{"arguments":{"title":"a"}}`, `{"arguments":{"title":"b"}}`, `{"arguments":{}}`} {
+		rec := httptest.NewRecorder()
+		h.InvokeTool(rec, httptest.NewRequest(http.MethodPost, "/api/tools/create_todo/invoke", strings.NewReader(body)), "create_todo")
+	}
+
+	rec := httptest.NewRecorder()
+	h.GetTool(rec, httptest.NewRequest(http.MethodGet, "/api/tools/create_todo", nil), "create_todo")
+	var item ToolItem
+	_ = json.Unmarshal(rec.Body.Bytes(), &item)
+	if item.Stats == nil || item.Stats.Calls != 3 || item.Stats.Errors != 1 || item.Stats.ErrorClasses[registry.ErrInvalidArgs] != 1 {
+		t.Fatalf("stats = %+v", item.Stats)
+	}
+	if len(item.RecentCalls) != 3 || item.RecentCalls[0].OK || item.RecentCalls[0].Caller != "invoke" || item.RecentCalls[1].ResultBytes == 0 {
+		t.Errorf("recent calls = %+v", item.RecentCalls)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ListTools(rec, httptest.NewRequest(http.MethodGet, "/api/tools?stats=1", nil))
+	var list struct {
+		Tools []ToolItem `json:"tools"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &list)
+	for _, it := range list.Tools {
+		if it.Stats == nil {
+			t.Fatalf("%s: missing stats", it.ID)
+		}
+		if it.ID == "create_todo" && it.Stats.Calls != 3 {
+			t.Errorf("list stats = %+v", it.Stats)
+		}
+	}
+
+	// 重新加载后统计保持
+	reloaded, _ := store.NewToolUsageStore(dir)
+	if st, _ := reloaded.ToolStats("create_todo"); st.Calls != 3 {
+		t.Errorf("reloaded calls = %d, want 3", st.Calls)
+	}
+
+	// 超出保留条数后统计只取最近 20000 条，文件在运行期间也会压缩
+	bulkDir := t.TempDir()
+	bulk, _ := store.NewToolUsageStore(bulkDir)
+	const n = 2*20000 + 5
+	for i := 1; i <= n; i++ {
+		if err := bulk.Record(store.ToolCall{Tool: "t", StartedAt: int64(i), OK: true}); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if st, recent := bulk.ToolStats("t"); st.Calls != 20000 || st.LastUsed != n || recent[0].StartedAt != n {
+		t.Errorf("bulk stats = %d calls, last used %d", st.Calls, st.LastUsed)
+	}
+	data, _ := os.ReadFile(filepath.Join(bulkDir, "tool_usage.jsonl"))
+	if lines := bytes.Count(data, []byte("\n")); lines > 2*20000 {
+		t.Errorf("usage file has %d lines, should be compacted", lines)
+	}
+	reloaded, _ = store.NewToolUsageStore(bulkDir)
+	if st, _ := reloaded.ToolStats("t"); st.Calls != 20000 || st.LastUsed != n {
+		t.Errorf("reloaded bulk stats = %d calls, last used %d", st.Calls, st.LastUsed)
+	}
+}
+
+func TestFileTools(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	sessionID, _ := h.store.CreateSession()
+	var long strings.Builder
+	for i := 1; i <= 450; i++ {
+		long.WriteString("line " + strings.Repeat("x", i%7) + "\n")
+	}
+	_, _ = h.store.PutFile(sessionID, "src/app/main.go", "package main\n\nfunc main() {\n\tTODO()\n}\n", "go", store.RevisionSource{})
+	_, _ = h.store.PutFile(sessionID, "docs/long.md", long.String(), "markdown", store.RevisionSource{})
+	req := registry.ExecuteRequest{Ctx: context.Background(), SessionID: sessionID, Store: h.store}
+	exec := func(name, args string) map[string]interface{} {
+		t.Helper()
+		res, err := h.registry.Execute(req, name, json.RawMessage(args))
+		if err != nil {
+			t.Fatalf("%s %s: %v", name, args, err)
+		}
+		data, _ := json.Marshal(res)
+		var m map[string]interface{}
+		_ = json.Unmarshal(data, &m)
+		return m
+	}
+
+	res := exec("read_file", `{"path":"src/app/main.go","startLine":3,"endLine":4}`)
+	if res["content"] != "func main() {\n\tTODO()\n" || res["totalLines"] != float64(5) {
+		t.Errorf("read range = %+v", res)
+	}
+	res = exec("read_file", `{"path":"docs/long.md"}`)
+	if res["truncated"] != true || res["nextStartLine"] != float64(401) {
+		t.Errorf("read long: truncated = %v, next = %v", res["truncated"], res["nextStartLine"])
+	}
+	if _, err := h.registry.Execute(req, "read_file", json.RawMessage(`{"path":"missing.md"}`)); registry.ErrorClassOf(err, "") != registry.ErrNotFound {
+		t.Errorf("missing file err = %v", err)
+	}
+	if _, err := h.registry.Execute(req, "read_file", json.RawMessage(`{"path":"../x"}`)); registry.ErrorClassOf(err, "") != registry.ErrInvalidArgs {
+		t.Errorf("traversal err = %v", err)
+	}
+
+	for glob, want := range map[string]float64{"": 3, "*.md": 2, "src/**/*.go": 1, "**/*.go": 1, "docs/*": 1} {
+		if res := exec("list_files", `{"glob":"`+glob+`"}`); res["total"] != want {
+			t.Errorf("list_files %q total = %v, want %v", glob, res["total"], want)
+		}
+	}
+
+	res = exec("grep_files", `{"pattern":"todo\\(","ignoreCase":true,"contextLines":1}`)
+	matches, _ := res["matches"].([]interface{})
+	if len(matches) != 1 {
+		t.Fatalf("grep matches = %+v", res)
+	}
+	m := matches[0].(map[string]interface{})
+	if m["path"] != "src/app/main.go" || m["line"] != float64(4) || len(m["before"].([]interface{})) != 1 {
+		t.Errorf("grep match = %+v", m)
+	}
+	if res := exec("grep_files", `{"pattern":"^line","glob":"*.md","maxMatches":10}`); res["total"] != float64(450) || res["truncated"] != true {
+		t.Errorf("grep cap: total = %v, truncated = %v", res["total"], res["truncated"])
+	}
+	if _, err := h.registry.Execute(req, "grep_files", json.RawMessage(`{"pattern":"("}`)); registry.ErrorClassOf(err, "") != registry.ErrInvalidArgs {
+		t.Errorf("bad regex err = %v", err)
+	}
+
+	// write_file 同样使用规范化路径，写入后可被其他文件工具读取
+	if res := exec("write_file", `{"path":"./notes//a.md","content":"hi\n","language":"markdown"}`); res["path"] != "notes/a.md" {
+		t.Errorf("write_file path = %v", res["path"])
+	}
+	if res := exec("read_file", `{"path":"notes/a.md"}`); res["content"] != "hi\n" {
+		t.Errorf("read after write = %+v", res)
+	}
+	for _, p := range []string{"../x.md", "/abs.md", "a/../../x.md"} {
+		if _, err := h.registry.Execute(req, "write_file", json.RawMessage(`{"path":"`+p+`","content":"x","language":"markdown"}`)); registry.ErrorClassOf(err, "") != registry.ErrInvalidArgs {
+			t.Errorf("write_file %q err = %v", p, err)
+		}
+	}
+	if vfs, _ := h.store.GetVFS(sessionID); len(vfs) != 4 {
+		t.Errorf("vfs after writes = %d files, want 4", len(vfs))
+	}
+}
+
+func TestTextDiffRoundTrip(t *testing.T) {
+	check := func(a, b string, context int) {
+		t.Helper()
+		patch := textdiff.Unified("a", "b", a, b, context)
+		if patch == "" {
+			if a != b {
+				t.Fatalf("empty patch for %q -> %q", a, b)
+			}
+			return
+		}
+		got, conflicts, err := textdiff.Apply(a, patch)
+		if err != nil || len(conflicts) > 0 || got != b {
+			t.Fatalf("apply(%q -> %q, context %d) = %q, %v, %v\n%s", a, b, context, got, conflicts, err, patch)
+		}
+	}
+	// 多个 hunk 且上下文行重复：后面 hunk 的行号不能再叠加前面 hunk 的行数变化
+	a := "b\nc\nb\nc\na\nc\nc\na\na\na\n"
+	for c := 0; c <= 2; c++ {
+		check(a, "b\nc\nb\nc\na\nc\nc\na\na\na\nx\ny\n", c)
+		check(a, "x\nb\nc\nb\nc\na\nc\nc\na\na\na\ny\n", c)
+		check(a, "b\nc\na\nc\nc\nx\na\na\na\nc\n", c)
+	}
+	// 只改变末尾换行
+	check("a\nb", "a\nb\n", 2)
+	check("a\nb\n", "a\nb", 2)
+	check("", "x", 0)
+	if patch := textdiff.Unified("a", "b", "a\nb\n", "a\nb", 2); !strings.Contains(patch, "\\ No newline at end of file") {
+		t.Errorf("patch without end-of-file marker:\n%s", patch)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	gen := func() string {
+		lines := make([]string, r.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(3)))
+		}
+		s := strings.Join(lines, "\n")
+		if len(lines) > 0 && r.Intn(3) > 0 {
+			s += "\n"
+		}
+		return s
+	}
+	for i := 0; i < 5000; i++ {
+		a, b := gen(), gen()
+		for c := 0; c <= 3; c++ {
+			check(a, b, c)
+		}
+	}
+}
+
+func TestEditFile(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	sessionID, _ := h.store.CreateSession()
+	const orig = "# Title\n\nintro\n\n## Usage\nrun it\n\n## Notes\nrun it\n"
+	_, _ = h.store.PutFile(sessionID, "README.md", orig, "markdown", store.RevisionSource{})
+	req := registry.ExecuteRequest{Ctx: context.Background(), SessionID: sessionID, Store: h.store}
+	edit := func(args string) (map[string]interface{}, error) {
+		res, err := h.registry.Execute(req, "edit_file", json.RawMessage(args))
+		m, _ := res.(map[string]interface{})
+		return m, err
+	}
+	content := func() string {
+		vfs, _ := h.store.GetVFS(sessionID)
+		return vfs["README.md"].Content
+	}
+
+	if _, err := edit(`{"path":"README.md","oldString":"run it","newString":"go run ."}`); err == nil || !strings.Contains(err.Error(), "第 6、9 行") {
+		t.Errorf("ambiguous replace err = %v", err)
+	}
+	res, err := edit(`{"path":"README.md","oldString":"## Usage\nrun it","newString":"## Usage\ngo run ."}`)
+	if err != nil || res["linesAdded"] != 1 || res["linesRemoved"] != 1 || !strings.Contains(res["diff"].(string), "-run it\n+go run .\n") {
+		t.Fatalf("unique replace: res = %+v, err = %v", res, err)
+	}
+	if _, err := edit(`{"path":"README.md","startLine":3,"newContent":"Intro text.\nSecond line."}`); err != nil {
+		t.Fatalf("range replace: %v", err)
+	}
+	if _, err := edit(`{"path":"README.md","startLine":1,"endLine":0,"newContent":"<!-- top -->"}`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	want := "<!-- top -->\n# Title\n\nIntro text.\nSecond line.\n\n## Usage\ngo run .\n\n## Notes\nrun it\n"
+	if got := content(); got != want {
+		t.Fatalf("content = %q, want %q", got, want)
+	}
+
+	// 行号偏移的补丁按上下文定位
+	patch := "--- a/README.md\n+++ b/README.md\n@@ -8,3 +8,3 @@\n ## Notes\n-run it\n+see docs\n"
+	if _, err := edit(`{"path":"README.md","patch":` + mustJSON(patch) + `}`); err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	if got := content(); !strings.HasSuffix(got, "## Notes\nsee docs\n") {
+		t.Errorf("after patch = %q", got)
+	}
+	before := content()
+	conflict := "@@ -2,2 +2,2 @@\n # Title\n-missing line\n+x\n"
+	_, err = edit(`{"path":"README.md","patch":` + mustJSON(conflict) + `}`)
+	if registry.ErrorClassOf(err, "") != registry.ErrInvalidArgs || !strings.Contains(err.Error(), `"hunk":1`) {
+		t.Errorf("conflict err = %v", err)
+	}
+	if content() != before {
+		t.Error("conflicting patch modified the file")
+	}
+}
+
+func mustJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func TestWriteFileProgress(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	sessionID, _ := h.store.CreateSession()
+	big := strings.Repeat("数据", 3000) // 18000 字节，超过单个事件的增量上限
+	var events []registry.FileProgress
+	var seenWriting bool
+	req := registry.ExecuteRequest{
+		Ctx: context.Background(), SessionID: sessionID, Store: h.store,
+		OnFileProgress: func(p registry.FileProgress) {
+			events = append(events, p)
+			if vfs, _ := h.store.GetVFS(sessionID); vfs["app.js"].IsWriting {
+				seenWriting = true
+			}
+		},
+	}
+	args := mustJSON(map[string]any{"path": "app.js", "language": "javascript", "contentChunks": []string{"const a = 1;\n", big}})
+	if _, err := h.registry.Execute(req, "write_file", json.RawMessage(args)); err != nil {
+		t.Fatalf("write_file: %v", err)
+	}
+	if len(events) < 4 || !seenWriting {
+		t.Fatalf("events = %d, seenWriting = %v", len(events), seenWriting)
+	}
+	var content strings.Builder
+	for _, e := range events[:len(events)-1] {
+		if len(e.Delta) > 4096 || !utf8.ValidString(e.Delta) {
+			t.Errorf("delta of %d bytes, valid utf-8 = %v", len(e.Delta), utf8.ValidString(e.Delta))
+		}
+		content.WriteString(e.Delta)
+		if e.BytesWritten != content.Len() || e.TotalBytes != len(big)+13 {
+			t.Errorf("progress = %d/%d, want %d", e.BytesWritten, e.TotalBytes, content.Len())
+		}
+	}
+	if last := events[len(events)-1]; !last.Done || last.BytesWritten != last.TotalBytes || content.String() != "const a = 1;\n"+big {
+		t.Errorf("last event = %+v", last)
+	}
+}
+
+func TestSearchKnowledge(t *testing.T) {
+	h := initTestHandlerWithTools(t)
+	sessionID, _ := h.store.CreateSession()
+	_ = h.store.AppendKnowledgeChunks(sessionID, []store.KnowledgeChunk{
+		{Content: "公司年会在每年十二月举行，全体员工参加。", Summary: "年会"},
+		{Content: "员工每年享有带薪年假十天，年假需提前一周申请。", Summary: "年假规定"},
+		{Content: "病假需提供医院证明，病假期间工资按比例发放。", Summary: "病假"},
+		{Content: "Travel expenses are reimbursed within 30 days after approval.", Summary: "Travel policy"},
+	})
+	req := registry.ExecuteRequest{Ctx: context.Background(), SessionID: sessionID, Store: h.store}
+	search := func(query string) []store.KnowledgeMatch {
+		t.Helper()
+		res, err := h.registry.Execute(req, "search_knowledge", json.RawMessage(mustJSON(map[string]any{"query": query})))
+		if err != nil {
+			t.Fatalf("search_knowledge %q: %v", query, err)
+		}
+		matches, _ := res.(map[string]interface{})["matches"].([]store.KnowledgeMatch)
+		return matches
+	}
+
+	// 中文查询不分词也能按二元组命中
+	got := search("年假有几天？")
+	if len(got) != 1 || got[0].Index != 1 || got[0].Score <= 0 {
+		t.Fatalf("matches = %+v", got)
+	}
+	if !strings.Contains(got[0].Snippet, "**年假**") {
+		t.Errorf("snippet = %q", got[0].Snippet)
+	}
+	got = search("REIMBURSED travel")
+	if len(got) != 1 || got[0].Index != 3 || !strings.Contains(got[0].Snippet, "**Travel**") {
+		t.Fatalf("matches = %+v", got)
+	}
+
+	// 追加的块增量进入索引，命中词更集中的块得分更高
+	_ = h.store.AppendKnowledgeChunks(sessionID, []store.KnowledgeChunk{
+		{Content: "年假天数按工龄计算：满一年十天，满十年十五天。", Summary: "年假天数"},
+	})
+	got = search("年假天数")
+	if len(got) != 2 || got[0].Index != 4 || got[1].Index != 1 || got[0].Score <= got[1].Score {
+		t.Fatalf("matches after append = %+v", got)
+	}
+	if !strings.Contains(got[0].Snippet, "**年假天数**") {
+		t.Errorf("snippet = %q", got[0].Snippet)
+	}
+
+	// 单字查询命中词中的字
+	_ = h.store.AppendKnowledgeChunks(sessionID, []store.KnowledgeChunk{
+		{Content: "A股分红需缴纳个人所得税。", Summary: "分红"},
+	})
+	for _, q := range []string{"税", "股", "A股"} {
+		got = search(q)
+		if len(got) != 1 || got[0].Index != 5 || !strings.Contains(got[0].Snippet, q+"**") {
+			t.Errorf("search %q = %+v", q, got)
+		}
+	}
+
+	_ = h.store.ClearSessionContent(sessionID)
+	if got = search("年假"); len(got) != 0 {
+		t.Errorf("matches after clear = %+v", got)
+	}
+}
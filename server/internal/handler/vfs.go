@@ -0,0 +1,295 @@
+package handler
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"agentic-demo/server/internal/store"
+)
+
+// vfsFileMeta 文件列表项：不含内容
+type vfsFileMeta struct {
+	Path        string `json:"path"`
+	Language    string `json:"language"`
+	Size        int    `json:"size"`
+	ContentType string `json:"contentType"`
+	IsWriting   bool   `json:"isWriting,omitempty"`
+	UpdatedAt   int64  `json:"updatedAt,omitempty"`
+}
+
+type vfsFileResp struct {
+	vfsFileMeta
+	Content string `json:"content"`
+}
+
+func newVFSFileMeta(f store.VfsFile) vfsFileMeta {
+	return vfsFileMeta{
+		Path: f.Path, Language: f.Language, Size: len(f.Content),
+		ContentType: vfsContentType(f.Path, f.Language), IsWriting: f.IsWriting, UpdatedAt: f.UpdatedAt,
+	}
+}
+
+// apiRevision 经 VFS 接口写入产生的版本来源
+var apiRevision = store.RevisionSource{Source: "api"}
+
+// SessionVFS /api/sessions/{id}/vfs[/...]：
+// GET vfs 列表，GET/PUT/DELETE vfs/files/{path}，GET vfs/raw/{path}，POST vfs/move，GET vfs/zip，
+// GET vfs/history[/{path}]，GET vfs/diff/{path}，POST vfs/restore/{path}，POST vfs/export
+func (h *Handler) SessionVFS(w http.ResponseWriter, r *http.Request, sessionID string, rest []string) {
+	sess, _ := h.store.GetSession(sessionID)
+	if sess == nil {
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "session not found"})
+		return
+	}
+	action, filePath := "", ""
+	if len(rest) > 0 {
+		action, filePath = rest[0], strings.Join(rest[1:], "/")
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.listVFS(w, sess)
+	case action == "files" && r.Method == http.MethodGet:
+		h.readVFSFile(w, sess, filePath)
+	case action == "files" && r.Method == http.MethodPut:
+		h.writeVFSFile(w, r, sess, filePath)
+	case action == "files" && r.Method == http.MethodDelete:
+		h.deleteVFSFile(w, sess, filePath)
+	case action == "raw" && r.Method == http.MethodGet:
+		h.rawVFSFile(w, r, sess, filePath)
+	case action == "move" && r.Method == http.MethodPost:
+		h.moveVFSFile(w, r, sess)
+	case action == "zip" && r.Method == http.MethodGet:
+		h.zipVFS(w, sess)
+	case action == "history" && r.Method == http.MethodGet:
+		h.vfsHistory(w, r, sess, filePath)
+	case action == "diff" && r.Method == http.MethodGet:
+		h.diffVFSRevisions(w, r, sess, filePath)
+	case action == "restore" && r.Method == http.MethodPost:
+		h.restoreVFSRevision(w, r, sess, filePath)
+	case action == "export" && r.Method == http.MethodPost:
+		h.exportVFS(w, r, sess)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) listVFS(w http.ResponseWriter, sess *store.AgentSessionState) {
+	files := make([]vfsFileMeta, 0, len(sess.VFS))
+	for _, f := range sess.VFS {
+		files = append(files, newVFSFileMeta(f))
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	writeJSON(w, map[string]interface{}{
+		"files":      files,
+		"totalBytes": store.VFSTotalBytes(sess.VFS),
+		"limits":     h.store.VFSLimits(),
+	})
+}
+
+// lookupVFSFile 规范化路径并取文件；失败时已写入响应
+func lookupVFSFile(w http.ResponseWriter, sess *store.AgentSessionState, p string) (store.VfsFile, bool) {
+	p, err := store.NormalizeVFSPath(p)
+	if err != nil {
+		writeVFSError(w, err)
+		return store.VfsFile{}, false
+	}
+	f, ok := sess.VFS[p]
+	if !ok {
+		writeVFSError(w, store.ErrVFSNotFound)
+		return store.VfsFile{}, false
+	}
+	return f, true
+}
+
+func (h *Handler) readVFSFile(w http.ResponseWriter, sess *store.AgentSessionState, p string) {
+	if f, ok := lookupVFSFile(w, sess, p); ok {
+		writeJSON(w, vfsFileResp{vfsFileMeta: newVFSFileMeta(f), Content: f.Content})
+	}
+}
+
+// rawVFSFile 按扩展名返回原始内容；?download=1 时作为附件下载。
+// 内容来自模型输出，统一加 sandbox CSP 与 nosniff，避免 HTML 在同源下执行脚本
+func (h *Handler) rawVFSFile(w http.ResponseWriter, r *http.Request, sess *store.AgentSessionState, p string) {
+	f, ok := lookupVFSFile(w, sess, p)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", vfsContentType(f.Path, f.Language))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	disposition := "inline"
+	if r.URL.Query().Get("download") == "1" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", disposition+"; filename*=UTF-8''"+url.PathEscape(path.Base(f.Path)))
+	_, _ = w.Write([]byte(f.Content))
+}
+
+// writeVFSFile PUT：{content, language}，language 为空时沿用原值或按扩展名推断；新建返回 201
+func (h *Handler) writeVFSFile(w http.ResponseWriter, r *http.Request, sess *store.AgentSessionState, p string) {
+	p, err := store.NormalizeVFSPath(p)
+	if err != nil {
+		writeVFSError(w, err)
+		return
+	}
+	limit := int64(32 << 20)
+	if l := h.store.VFSLimits().MaxFileBytes; l > 0 {
+		limit = int64(l)*2 + 4096 // JSON 转义可能使正文变长
+	}
+	var body struct {
+		Content  *string `json:"content"`
+		Language string  `json:"language"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(&body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeVFSError(w, store.ErrVFSFileTooLarge)
+			return
+		}
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	if body.Content == nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "content required"})
+		return
+	}
+	prev, exists := sess.VFS[p]
+	lang := body.Language
+	if lang == "" && exists {
+		lang = prev.Language
+	}
+	if lang == "" {
+		lang = languageForResource(p, "")
+	}
+	f, err := h.store.PutFile(sess.SessionID, p, *body.Content, lang, apiRevision)
+	if err != nil {
+		writeVFSError(w, err)
+		return
+	}
+	status := http.StatusOK
+	if !exists {
+		status = http.StatusCreated
+	}
+	writeJSONStatus(w, status, newVFSFileMeta(f))
+}
+
+// deleteVFSFile DELETE：路径为目录时删除其下所有文件
+func (h *Handler) deleteVFSFile(w http.ResponseWriter, sess *store.AgentSessionState, p string) {
+	p, err := store.NormalizeVFSPath(p)
+	if err != nil {
+		writeVFSError(w, err)
+		return
+	}
+	removed, err := h.store.DeleteFile(sess.SessionID, p, apiRevision)
+	if err != nil {
+		writeVFSError(w, err)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"deleted": removed})
+}
+
+// moveVFSFile POST {from, to, overwrite}：重命名文件或移动整个目录
+func (h *Handler) moveVFSFile(w http.ResponseWriter, r *http.Request, sess *store.AgentSessionState) {
+	var body struct {
+		From      string `json:"from"`
+		To        string `json:"to"`
+		Overwrite bool   `json:"overwrite"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	from, err := store.NormalizeVFSPath(body.From)
+	if err != nil {
+		writeVFSError(w, err)
+		return
+	}
+	to, err := store.NormalizeVFSPath(body.To)
+	if err != nil {
+		writeVFSError(w, err)
+		return
+	}
+	if from == to || strings.HasPrefix(to, from+"/") {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "目标路径不能与源路径相同或位于其下"})
+		return
+	}
+	moved, err := h.store.MoveFile(sess.SessionID, from, to, body.Overwrite, apiRevision)
+	if err != nil {
+		writeVFSError(w, err)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"moved": moved})
+}
+
+// zipVFS 把整个 VFS 打包为 zip 下载
+func (h *Handler) zipVFS(w http.ResponseWriter, sess *store.AgentSessionState) {
+	paths := make([]string, 0, len(sess.VFS))
+	for p := range sess.VFS {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+sess.SessionID+`.zip"`)
+	zw := zip.NewWriter(w)
+	for _, p := range paths {
+		// 旧数据可能含未规范化的路径，打包时跳过以免解压越界
+		if np, err := store.NormalizeVFSPath(p); err != nil || np != p {
+			continue
+		}
+		fw, err := zw.Create(p)
+		if err != nil {
+			return
+		}
+		if _, err := fw.Write([]byte(sess.VFS[p].Content)); err != nil {
+			return
+		}
+	}
+	_ = zw.Close()
+}
+
+// vfsContentType 按扩展名推断，未知时按 language，文本统一 utf-8
+func vfsContentType(p, language string) string {
+	ct := mime.TypeByExtension(path.Ext(p))
+	if ct == "" {
+		switch strings.ToLower(language) {
+		case "markdown":
+			ct = "text/markdown; charset=utf-8"
+		case "json":
+			ct = "application/json"
+		case "html":
+			ct = "text/html; charset=utf-8"
+		case "csv":
+			ct = "text/csv; charset=utf-8"
+		default:
+			ct = "text/plain; charset=utf-8"
+		}
+	}
+	if strings.HasPrefix(ct, "text/") && !strings.Contains(ct, "charset") {
+		ct += "; charset=utf-8"
+	}
+	return ct
+}
+
+func writeVFSError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrVFSInvalidPath):
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "非法路径：须为不含 .. 的相对路径"})
+	case errors.Is(err, store.ErrVFSNotFound):
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "file not found"})
+	case errors.Is(err, store.ErrVFSRevisionNotFound):
+		writeJSONStatus(w, http.StatusNotFound, map[string]string{"error": "revision not found"})
+	case errors.Is(err, store.ErrVFSExists):
+		writeJSONStatus(w, http.StatusConflict, map[string]string{"error": "目标文件已存在，覆盖须传 overwrite: true"})
+	case errors.Is(err, store.ErrVFSFileTooLarge), errors.Is(err, store.ErrVFSQuotaExceeded):
+		writeJSONStatus(w, http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+	default:
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"agentic-demo/server/internal/store"
+	"agentic-demo/server/internal/vfsexport"
+)
+
+// exportVFS POST {dir, onConflict, gitignore, git, message}：把 VFS 写入导出根目录下的 dir（默认会话 ID）。
+// onConflict 为 fail（默认，有冲突时返回 409 与冲突列表）、overwrite 或 skip；gitignore 为 true 或 .gitignore 内容；
+// git 为 true 时初始化仓库并提交，message 为空时由最近一轮对话生成
+func (h *Handler) exportVFS(w http.ResponseWriter, r *http.Request, sess *store.AgentSessionState) {
+	if h.exportRoot == "" {
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": "export root not configured"})
+		return
+	}
+	var body struct {
+		Dir        string          `json:"dir"`
+		OnConflict string          `json:"onConflict"`
+		Gitignore  json.RawMessage `json:"gitignore"`
+		Git        bool            `json:"git"`
+		Message    string          `json:"message"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+			return
+		}
+	}
+	switch body.OnConflict {
+	case "":
+		body.OnConflict = vfsexport.ConflictFail
+	case vfsexport.ConflictFail, vfsexport.ConflictOverwrite, vfsexport.ConflictSkip:
+	default:
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "onConflict must be fail, overwrite or skip"})
+		return
+	}
+	gitignore := ""
+	if len(body.Gitignore) > 0 {
+		var on bool
+		if json.Unmarshal(body.Gitignore, &on) == nil {
+			if on {
+				gitignore = vfsexport.DefaultGitignore
+			}
+		} else if json.Unmarshal(body.Gitignore, &gitignore) != nil {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "gitignore must be a boolean or string"})
+			return
+		}
+	}
+	dir := body.Dir
+	if dir == "" {
+		dir = sess.SessionID
+	}
+	dir, err := store.NormalizeVFSPath(dir)
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "dir 须为导出根目录下不含 .. 的相对路径"})
+		return
+	}
+	message := body.Message
+	if message == "" && body.Git {
+		message = exportCommitMessage(sess)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+	res, err := vfsexport.Export(ctx, vfsexport.Options{
+		Root: h.exportRoot, Dir: dir, Files: sess.VFS,
+		OnConflict: body.OnConflict, Gitignore: gitignore, Git: body.Git, Message: message,
+	})
+	switch {
+	case errors.Is(err, vfsexport.ErrConflict):
+		writeJSONStatus(w, http.StatusConflict, map[string]interface{}{
+			"error":     "导出目录中有文件与 VFS 冲突，未写入任何文件；可传 onConflict: overwrite 或 skip",
+			"conflicts": res.Conflicts,
+		})
+	case errors.Is(err, vfsexport.ErrInvalidDir):
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case err != nil:
+		writeJSONStatus(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, res)
+	}
+}
+
+// exportCommitMessage 以最近一条用户消息的首行作为标题，附会话与轮次 ID
+func exportCommitMessage(sess *store.AgentSessionState) string {
+	title, turn := "", ""
+	for i := len(sess.UIMessages) - 1; i >= 0; i-- {
+		m, _ := sess.UIMessages[i].(map[string]any)
+		if m == nil {
+			continue
+		}
+		if m["role"] == "assistant" && turn == "" {
+			turn, _ = m["id"].(string)
+		}
+		if m["role"] == "user" {
+			content, _ := m["content"].(string)
+			title = strings.TrimSpace(strings.SplitN(strings.TrimSpace(content), "\n", 2)[0])
+			break
+		}
+	}
+	if title == "" {
+		title = "Export generated files"
+	}
+	if r := []rune(title); len(r) > 72 {
+		title = string(r[:71]) + "…"
+	}
+	msg := title + "\n\nSession: " + sess.SessionID
+	if turn != "" {
+		msg += "\nTurn: " + turn
+	}
+	return msg
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"agentic-demo/server/internal/store"
+	"agentic-demo/server/internal/textdiff"
+)
+
+// vfsHistory GET vfs/history 列出有版本记录的路径；vfs/history/{path} 列出该文件的版本（不含内容），
+// 带 ?rev= 时返回该版本及内容
+func (h *Handler) vfsHistory(w http.ResponseWriter, r *http.Request, sess *store.AgentSessionState, p string) {
+	if p == "" {
+		paths, err := h.store.HistoryPaths(sess.SessionID)
+		if err != nil {
+			writeVFSError(w, err)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"paths": paths, "limits": h.store.VFSHistoryLimits()})
+		return
+	}
+	p, err := store.NormalizeVFSPath(p)
+	if err != nil {
+		writeVFSError(w, err)
+		return
+	}
+	if v := r.URL.Query().Get("rev"); v != "" {
+		rev, err := strconv.Atoi(v)
+		if err != nil {
+			writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "rev must be an integer"})
+			return
+		}
+		revision, err := h.store.GetRevision(sess.SessionID, p, rev)
+		if err != nil {
+			writeVFSError(w, err)
+			return
+		}
+		writeJSON(w, revision)
+		return
+	}
+	revs, err := h.store.ListRevisions(sess.SessionID, p)
+	if err != nil {
+		writeVFSError(w, err)
+		return
+	}
+	if len(revs) == 0 {
+		writeVFSError(w, store.ErrVFSNotFound)
+		return
+	}
+	_, exists := sess.VFS[p]
+	writeJSON(w, map[string]interface{}{"path": p, "exists": exists, "revisions": revs})
+}
+
+// diffVFSRevisions GET ?from=&to=：两个版本之间的 unified diff。from、to 为版本号或 current（当前内容）；
+// 省略 to 时取最新版本，省略 from 时取 to 的上一个版本
+func (h *Handler) diffVFSRevisions(w http.ResponseWriter, r *http.Request, sess *store.AgentSessionState, p string) {
+	p, err := store.NormalizeVFSPath(p)
+	if err != nil {
+		writeVFSError(w, err)
+		return
+	}
+	revs, err := h.store.ListRevisions(sess.SessionID, p)
+	if err != nil {
+		writeVFSError(w, err)
+		return
+	}
+	q := r.URL.Query()
+	to, from := q.Get("to"), q.Get("from")
+	if to == "" {
+		if len(revs) == 0 {
+			writeVFSError(w, store.ErrVFSRevisionNotFound)
+			return
+		}
+		to = strconv.Itoa(revs[len(revs)-1].Rev)
+	}
+	if from == "" {
+		from = "0" // 没有更早的版本时与空内容比较
+		for i, rev := range revs {
+			if strconv.Itoa(rev.Rev) == to && i > 0 {
+				from = strconv.Itoa(revs[i-1].Rev)
+			}
+		}
+		if to == "current" && len(revs) > 0 {
+			from = strconv.Itoa(revs[len(revs)-1].Rev)
+		}
+	}
+	a, ok := h.revisionContent(w, sess, p, from)
+	if !ok {
+		return
+	}
+	b, ok := h.revisionContent(w, sess, p, to)
+	if !ok {
+		return
+	}
+	added, removed := textdiff.Stats(a, b)
+	writeJSON(w, map[string]interface{}{
+		"path": p, "from": from, "to": to,
+		"diff":       textdiff.Unified(p+"@"+from, p+"@"+to, a, b, 3),
+		"linesAdded": added, "linesRemoved": removed,
+	})
+}
+
+// revisionContent 取版本内容：current 为当前文件，0 为空内容；失败时已写入响应
+func (h *Handler) revisionContent(w http.ResponseWriter, sess *store.AgentSessionState, p, rev string) (string, bool) {
+	switch rev {
+	case "current":
+		f, ok := sess.VFS[p]
+		if !ok {
+			writeVFSError(w, store.ErrVFSNotFound)
+		}
+		return f.Content, ok
+	case "0":
+		return "", true
+	}
+	n, err := strconv.Atoi(rev)
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "from/to must be a revision number or current"})
+		return "", false
+	}
+	revision, err := h.store.GetRevision(sess.SessionID, p, n)
+	if err != nil {
+		writeVFSError(w, err)
+		return "", false
+	}
+	return revision.Content, true
+}
+
+// restoreVFSRevision POST {rev}：把文件恢复为指定版本，恢复本身也记为一个新版本
+func (h *Handler) restoreVFSRevision(w http.ResponseWriter, r *http.Request, sess *store.AgentSessionState, p string) {
+	p, err := store.NormalizeVFSPath(p)
+	if err != nil {
+		writeVFSError(w, err)
+		return
+	}
+	var body struct {
+		Rev int `json:"rev"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Rev <= 0 {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "rev required"})
+		return
+	}
+	revision, err := h.store.RestoreRevision(sess.SessionID, p, body.Rev, apiRevision)
+	if err != nil {
+		writeVFSError(w, err)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"restored": revision})
+}
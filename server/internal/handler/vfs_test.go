@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"agentic-demo/server/internal/registry"
+	"agentic-demo/server/internal/store"
+)
+
+func TestSessionVFS(t *testing.T) {
+	h := initTestHandler(t)
+	h.store.SetVFSLimits(store.VFSLimits{MaxFileBytes: 100, MaxTotalBytes: 250})
+	sessionID, _ := h.store.CreateSession()
+	do := func(method, sub, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		var rd io.Reader
+		if body != "" {
+			rd = strings.NewReader(body)
+		}
+		target := "/api/sessions/" + sessionID + "/vfs"
+		if sub != "" {
+			target += "/" + sub
+		}
+		req := httptest.NewRequest(method, target, rd)
+		h.SessionVFS(rec, req, sessionID, strings.Split(sub, "/"))
+		return rec
+	}
+
+	if rec := do(http.MethodPut, "files/docs/a.md", `{"content":"# A"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPut, "files/docs/a.md", `{"content":"# A2"}`); rec.Code != http.StatusOK {
+		t.Errorf("update code = %d", rec.Code)
+	}
+	for _, sub := range []string{"files/../x.md", "files/a/../../x.md"} {
+		if rec := do(http.MethodPut, sub, `{"content":"x"}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s code = %d, want 400", sub, rec.Code)
+		}
+	}
+	if rec := do(http.MethodPost, "move", `{"from":"docs","to":"/etc"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("absolute move target code = %d, want 400", rec.Code)
+	}
+	if rec := do(http.MethodPut, "files/big.txt", `{"content":"`+strings.Repeat("x", 101)+`"}`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("file over limit code = %d, want 413", rec.Code)
+	}
+	_ = do(http.MethodPut, "files/b.txt", `{"content":"`+strings.Repeat("x", 100)+`"}`)
+	if rec := do(http.MethodPut, "files/c.txt", `{"content":"`+strings.Repeat("x", 100)+`"}`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("session over limit code = %d, want 413", rec.Code)
+	}
+	// 工具写入同样受上限约束，失败时文件保持原样、不留下流式写入的中间内容
+	req := registry.ExecuteRequest{Ctx: context.Background(), SessionID: sessionID, Store: h.store}
+	for _, c := range []struct{ tool, args string }{
+		{"write_file", mustJSON(map[string]any{"path": "tool.txt", "language": "text", "contentChunks": []string{strings.Repeat("x", 60), strings.Repeat("x", 41)}})},
+		{"write_file", mustJSON(map[string]any{"path": "tool.txt", "language": "text", "content": strings.Repeat("x", 99)})},
+		{"edit_file", mustJSON(map[string]any{"path": "b.txt", "oldString": strings.Repeat("x", 100), "newString": strings.Repeat("y", 101)})},
+	} {
+		if _, err := h.registry.Execute(req, c.tool, json.RawMessage(c.args)); err == nil {
+			t.Errorf("%s %s over limit should fail", c.tool, c.args[:40])
+		}
+	}
+	if vfs, _ := h.store.GetVFS(sessionID); vfs["tool.txt"].Content != "" || len(vfs["b.txt"].Content) != 100 {
+		t.Errorf("files after rejected tool writes: tool.txt = %q, b.txt = %d bytes", vfs["tool.txt"].Content, len(vfs["b.txt"].Content))
+	}
+
+	rec := do(http.MethodGet, "files/docs/a.md", "")
+	var file struct {
+		Content  string `json:"content"`
+		Language string `json:"language"`
+		Size     int    `json:"size"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &file)
+	if file.Content != "# A2" || file.Language != "markdown" || file.Size != 4 {
+		t.Errorf("read = %+v", file)
+	}
+	rec = do(http.MethodGet, "raw/docs/a.md", "")
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") || rec.Body.String() != "# A2" {
+		t.Errorf("raw: content-type = %q, body = %q", ct, rec.Body.String())
+	}
+
+	if rec := do(http.MethodPost, "move", `{"from":"docs","to":"README.md"}`); rec.Code != http.StatusConflict {
+		t.Errorf("move onto existing file code = %d, want 409", rec.Code)
+	}
+	if rec := do(http.MethodPost, "move", `{"from":"docs","to":"notes"}`); rec.Code != http.StatusOK {
+		t.Fatalf("move dir code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "files/notes/a.md", ""); rec.Code != http.StatusOK {
+		t.Errorf("moved file code = %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "files/b.txt", ""); rec.Code != http.StatusOK {
+		t.Errorf("delete code = %d", rec.Code)
+	}
+
+	rec = do(http.MethodGet, "", "")
+	var list struct {
+		Files []vfsFileMeta `json:"files"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &list)
+	var paths []string
+	for _, f := range list.Files {
+		paths = append(paths, f.Path)
+	}
+	if strings.Join(paths, ",") != "README.md,notes/a.md" {
+		t.Errorf("list = %v", paths)
+	}
+
+	rec = do(http.MethodGet, "zip", "")
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("zip: %v", err)
+	}
+	if len(zr.File) != 2 || zr.File[1].Name != "notes/a.md" {
+		t.Errorf("zip entries = %d", len(zr.File))
+	}
+}
+
+func TestVFSHistory(t *testing.T) {
+	h := initTestHandler(t)
+	h.store.SetVFSHistoryLimits(store.VFSHistoryLimits{MaxRevisions: 4})
+	sessionID, _ := h.store.CreateSession()
+	do := func(method, sub, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		var rd io.Reader
+		if body != "" {
+			rd = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, "/api/sessions/"+sessionID+"/vfs/"+sub, rd)
+		h.SessionVFS(rec, req, sessionID, strings.Split(sub, "/"))
+		return rec
+	}
+	type revision struct {
+		Rev    int    `json:"rev"`
+		Op     string `json:"op"`
+		Source string `json:"source"`
+		Tool   string `json:"tool"`
+		TurnID string `json:"turnId"`
+		CallID string `json:"callId"`
+	}
+	listRevs := func(p string) []revision {
+		var out struct {
+			Revisions []revision `json:"revisions"`
+		}
+		_ = json.Unmarshal(do(http.MethodGet, "history/"+p, "").Body.Bytes(), &out)
+		return out.Revisions
+	}
+
+	// 工具写入覆盖预置的 README 时先补记原内容
+	req := registry.ExecuteRequest{Ctx: context.Background(), SessionID: sessionID, Store: h.store, Caller: "agent", TurnID: "agent-1", CallID: "fc-1"}
+	if _, err := h.registry.Execute(req, "write_file", json.RawMessage(mustJSON(map[string]any{"path": "README.md", "content": "v1\n", "language": "markdown"}))); err != nil {
+		t.Fatalf("write_file: %v", err)
+	}
+	_ = do(http.MethodPut, "files/README.md", `{"content":"v2\n"}`)
+	_ = do(http.MethodPut, "files/README.md", `{"content":"v2\n"}`)
+	revs := listRevs("README.md")
+	if len(revs) != 3 || revs[0].Op != store.RevisionBaseline || revs[2].Source != "api" {
+		t.Fatalf("revisions = %+v", revs)
+	}
+	if r := revs[1]; r.Source != "tool" || r.Tool != "write_file" || r.TurnID != "agent-1" || r.CallID != "fc-1" {
+		t.Errorf("tool revision = %+v", r)
+	}
+
+	rec := do(http.MethodGet, "diff/README.md", "")
+	var diff struct {
+		Diff       string `json:"diff"`
+		LinesAdded int    `json:"linesAdded"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &diff)
+	if !strings.Contains(diff.Diff, "-v1\n+v2\n") || diff.LinesAdded != 1 {
+		t.Errorf("diff = %s", rec.Body.String())
+	}
+
+	if rec := do(http.MethodPost, "restore/README.md", `{"rev":`+strconv.Itoa(revs[1].Rev)+`}`); rec.Code != http.StatusOK {
+		t.Fatalf("restore code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if f, _ := h.store.GetVFS(sessionID); f["README.md"].Content != "v1\n" {
+		t.Errorf("restored content = %q", f["README.md"].Content)
+	}
+	if rec := do(http.MethodPost, "restore/README.md", `{"rev":999}`); rec.Code != http.StatusNotFound {
+		t.Errorf("missing rev code = %d, want 404", rec.Code)
+	}
+
+	// 移动带走历史，删除后仍可查询并恢复
+	_ = do(http.MethodPost, "move", `{"from":"README.md","to":"docs/intro.md"}`)
+	_ = do(http.MethodDelete, "files/docs/intro.md", "")
+	revs = listRevs("docs/intro.md")
+	if len(revs) != 4 || revs[2].Op != store.RevisionMove || revs[3].Op != store.RevisionDelete {
+		t.Fatalf("revisions after move/delete (capped at 4) = %+v", revs)
+	}
+	if rec := do(http.MethodGet, "history/README.md", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("old path history code = %d, want 404", rec.Code)
+	}
+	_ = do(http.MethodPost, "restore/docs/intro.md", `{"rev":`+strconv.Itoa(revs[2].Rev)+`}`)
+	if f, _ := h.store.GetVFS(sessionID); f["docs/intro.md"].Content != "v1\n" {
+		t.Errorf("restore after delete = %q", f["docs/intro.md"].Content)
+	}
+
+	_ = h.store.ClearSessionContent(sessionID)
+	if paths, _ := h.store.HistoryPaths(sessionID); len(paths) != 0 {
+		t.Errorf("history after clear = %v", paths)
+	}
+}
+
+func TestVFSExport(t *testing.T) {
+	h := initTestHandler(t)
+	root := t.TempDir()
+	h.SetVFSExportRoot(root)
+	sessionID, _ := h.store.CreateSession()
+	_, _ = h.store.PutFile(sessionID, "src/main.go", "package main\n", "go", store.RevisionSource{})
+	useGit := true
+	if _, err := exec.LookPath("git"); err != nil {
+		useGit = false
+	}
+	export := func(body string) (*httptest.ResponseRecorder, map[string]any) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/sessions/"+sessionID+"/vfs/export", strings.NewReader(body))
+		h.SessionVFS(rec, req, sessionID, []string{"export"})
+		var out map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		return rec, out
+	}
+	dir := filepath.Join(root, "proj")
+	opts := `{"dir":"proj","gitignore":true,"git":` + strconv.FormatBool(useGit) + `,"message":"first"}`
+
+	rec, out := export(opts)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "src", "main.go")); string(data) != "package main\n" {
+		t.Errorf("exported main.go = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".gitignore")); err != nil {
+		t.Errorf(".gitignore: %v", err)
+	}
+	if useGit && out["commit"] == nil {
+		t.Errorf("first export should commit: %v", out)
+	}
+	if _, out := export(opts); out["commit"] != nil || out["unchanged"] != float64(3) {
+		t.Errorf("re-export without changes = %v", out)
+	}
+
+	// 磁盘上被改动的文件视为冲突，默认不写入任何文件
+	_ = os.WriteFile(filepath.Join(dir, "README.md"), []byte("local edit"), 0644)
+	_, _ = h.store.PutFile(sessionID, "src/util.go", "package main\n", "go", store.RevisionSource{})
+	if rec, _ := export(opts); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), `"modified"`) {
+		t.Fatalf("conflict code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "src", "util.go")); !os.IsNotExist(err) {
+		t.Error("nothing should be written when export conflicts")
+	}
+	rec, out = export(strings.Replace(opts, `"dir"`, `"onConflict":"skip","dir"`, 1))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"skipped":["README.md"]`) {
+		t.Fatalf("skip export = %d %s", rec.Code, rec.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "README.md")); string(data) != "local edit" {
+		t.Errorf("skipped file was overwritten: %q", data)
+	}
+
+	// VFS 中删除的文件在重新导出时从磁盘删除，并产生新的提交
+	_, _ = h.store.DeleteFile(sessionID, "src", store.RevisionSource{})
+	rec, out = export(strings.Replace(opts, `"dir"`, `"onConflict":"skip","dir"`, 1))
+	if _, err := os.Stat(filepath.Join(dir, "src")); !os.IsNotExist(err) {
+		t.Errorf("deleted files remain on disk: %s", rec.Body.String())
+	}
+	if useGit {
+		if out["commit"] == nil {
+			t.Fatalf("incremental export should commit: %v", out)
+		}
+		log, _ := exec.Command("git", "-C", dir, "log", "--format=%s").Output()
+		if n := len(strings.Fields(string(log))); n != 3 {
+			t.Errorf("git log = %q, want 3 commits", log)
+		}
+	}
+
+	if rec, _ := export(`{"dir":"../escape"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("escaping dir code = %d, want 400", rec.Code)
+	}
+
+	// 任何层级的 .git 都不能作为导出目录或导出文件，否则可改写仓库配置
+	for _, d := range []string{"proj/.git", "proj/.GIT/hooks", ".git"} {
+		if rec, _ := export(`{"dir":"` + d + `","onConflict":"overwrite"}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("export into %s code = %d, want 400", d, rec.Code)
+		}
+	}
+	_, _ = h.store.PutFile(sessionID, "sub/.Git/config", "[core]\n\tfsmonitor = touch pwned\n", "", store.RevisionSource{})
+	rec, _ = export(`{"dir":"other"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"sub/.Git/config"`) {
+		t.Errorf("export with .git file = %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "other", "sub", ".Git", "config")); !os.IsNotExist(err) {
+		t.Error("file under .git was exported")
+	}
+}
+
+// 版本历史按文件分开存储：记录一个文件的版本不改写其他文件的历史
+func TestVFSHistoryStorage(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.NewSessionStore(dir)
+	if err != nil {
+		t.Fatalf("NewSessionStore: %v", err)
+	}
+	sessionID, _ := s.CreateSession()
+	_, _ = s.PutFile(sessionID, "a.md", "# A", "markdown", store.RevisionSource{})
+	_ = s.CommitVFS(sessionID, "b.md", "done", "markdown", store.RevisionSource{Source: "tool"})
+	if revs, _ := s.ListRevisions(sessionID, "b.md"); len(revs) != 1 || revs[0].Rev != 2 {
+		t.Errorf("history after commit = %+v", revs)
+	}
+	historyDir := filepath.Join(dir, "history", sessionID)
+	modTimes := map[string]time.Time{}
+	entries, _ := os.ReadDir(historyDir)
+	for _, e := range entries {
+		info, _ := e.Info()
+		modTimes[e.Name()] = info.ModTime()
+	}
+	time.Sleep(10 * time.Millisecond)
+	_, _ = s.PutFile(sessionID, "a.md", "# A2", "markdown", store.RevisionSource{})
+	changed := 0
+	entries, _ = os.ReadDir(historyDir)
+	for _, e := range entries {
+		if info, _ := e.Info(); !info.ModTime().Equal(modTimes[e.Name()]) {
+			changed++
+		}
+	}
+	if len(entries) != 3 || changed != 2 {
+		t.Errorf("history files = %d, changed = %d; want only a.md and the index rewritten", len(entries), changed)
+	}
+
+	_ = s.DeleteSession(sessionID)
+	if _, err := os.Stat(historyDir); !os.IsNotExist(err) {
+		t.Errorf("history dir after delete: %v", err)
+	}
+}
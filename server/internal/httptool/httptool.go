@@ -0,0 +1,270 @@
+// Package httptool 执行用户通过 API 定义的声明式 HTTP 工具，并把它们注册到 registry
+package httptool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"agentic-demo/server/internal/mcp"
+	"agentic-demo/server/internal/registry"
+	"agentic-demo/server/internal/store"
+
+	"google.golang.org/genai"
+)
+
+const (
+	DefaultTimeout          = 15 * time.Second
+	MaxTimeout              = 2 * time.Minute
+	DefaultMaxResponseBytes = 1 << 20
+	MaxResponseBytes        = 10 << 20
+	// errorSnippetLen 上游返回错误状态码时附带的响应片段长度
+	errorSnippetLen = 500
+)
+
+var nameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+var allowedMethods = map[string]bool{
+	http.MethodGet: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodHead: true,
+}
+
+// Normalize 补齐默认值：方法大写、空方法为 GET
+func Normalize(t *store.HttpTool) {
+	t.Name = strings.TrimSpace(t.Name)
+	t.Method = strings.ToUpper(strings.TrimSpace(t.Method))
+	if t.Method == "" {
+		t.Method = http.MethodGet
+	}
+	t.URL = strings.TrimSpace(t.URL)
+	t.ResponsePath = strings.TrimSpace(t.ResponsePath)
+}
+
+// Validate 校验工具定义，返回面向用户的错误
+func Validate(t store.HttpTool) error {
+	if !nameRe.MatchString(t.Name) {
+		return fmt.Errorf("name 须以字母或下划线开头，仅含字母、数字、下划线，最长 64 个字符")
+	}
+	if strings.TrimSpace(t.Description) == "" {
+		return fmt.Errorf("description required")
+	}
+	if !allowedMethods[t.Method] {
+		return fmt.Errorf("不支持的 method：%s", t.Method)
+	}
+	if t.URL == "" {
+		return fmt.Errorf("url required")
+	}
+	if err := checkTemplate("url", t.URL); err != nil {
+		return err
+	}
+	// 协议与主机不能来自参数，静态部分须符合出站 URL 策略
+	if host := hostPart(t.URL); strings.Contains(host, "{{") {
+		return fmt.Errorf("url 的协议与主机部分不能包含占位符")
+	}
+	if err := mcp.Policy().CheckURL(placeholderRe.ReplaceAllString(t.URL, "x")); err != nil {
+		return err
+	}
+	for k, v := range t.Headers {
+		if err := checkTemplate("header "+k, v); err != nil {
+			return err
+		}
+	}
+	if err := checkTemplate("body", t.Body); err != nil {
+		return err
+	}
+	if t.Body != "" && (t.Method == http.MethodGet || t.Method == http.MethodHead) {
+		return fmt.Errorf("%s 请求不能带 body", t.Method)
+	}
+	if t.ResponsePath != "" {
+		if _, err := parsePath(t.ResponsePath); err != nil {
+			return err
+		}
+	}
+	if len(t.Parameters) > 0 {
+		var schema map[string]any
+		if err := json.Unmarshal(t.Parameters, &schema); err != nil {
+			return fmt.Errorf("parameters 必须是 JSON Schema 对象")
+		}
+	}
+	if t.TimeoutMs < 0 || time.Duration(t.TimeoutMs)*time.Millisecond > MaxTimeout {
+		return fmt.Errorf("timeoutMs 须在 0 到 %d 之间", MaxTimeout.Milliseconds())
+	}
+	if t.MaxResponseBytes < 0 || t.MaxResponseBytes > MaxResponseBytes {
+		return fmt.Errorf("maxResponseBytes 须在 0 到 %d 之间", MaxResponseBytes)
+	}
+	return nil
+}
+
+// hostPart 返回 URL 模板中 scheme://host 部分
+func hostPart(raw string) string {
+	i := strings.Index(raw, "://")
+	if i < 0 {
+		return raw
+	}
+	rest := raw[i+3:]
+	if j := strings.IndexAny(rest, "/?#"); j >= 0 {
+		rest = rest[:j]
+	}
+	return raw[:i+3] + rest
+}
+
+// Declaration 生成函数声明；未提供参数 Schema 时由模板中的占位符推导为字符串参数
+func Declaration(t store.HttpTool) *genai.FunctionDeclaration {
+	var schema any
+	if len(t.Parameters) > 0 {
+		_ = json.Unmarshal(t.Parameters, &schema)
+	} else {
+		props := map[string]any{}
+		var required []any
+		all := placeholders(t.URL + t.Body)
+		for _, v := range t.Headers {
+			all = append(all, placeholders(v)...)
+		}
+		sort.Strings(all)
+		for _, name := range all {
+			if _, ok := props[name]; !ok {
+				props[name] = map[string]any{"type": "string"}
+				required = append(required, name)
+			}
+		}
+		schema = map[string]any{"type": "object", "properties": props, "required": required}
+	}
+	return &genai.FunctionDeclaration{
+		Name:        t.Name,
+		Description: t.Description,
+		Parameters:  registry.SchemaFromJSON(schema),
+	}
+}
+
+// Register 以工具名为 ID 注册到 registry（来源 http）
+func Register(reg *registry.Registry, t store.HttpTool) {
+	reg.RegisterExternal(t.Name, registry.SourceHTTP, Declaration(t), executor(t))
+}
+
+// RegisterAll 启动时注册全部已保存的工具；与已有工具重名的跳过并返回其名称
+func RegisterAll(reg *registry.Registry, s *store.HttpToolStore) []string {
+	var skipped []string
+	for _, t := range s.List() {
+		if src := reg.GetSource(t.Name); src != "" && src != registry.SourceHTTP {
+			skipped = append(skipped, t.Name)
+			continue
+		}
+		Register(reg, t)
+	}
+	return skipped
+}
+
+func executor(t store.HttpTool) registry.Executor {
+	return func(req registry.ExecuteRequest, raw json.RawMessage) (interface{}, error) {
+		args := map[string]any{}
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return nil, registry.NewToolError(registry.ErrInvalidArgs, fmt.Errorf("invalid arguments: %w", err))
+			}
+		}
+		return Execute(req, t, args)
+	}
+}
+
+// Execute 渲染模板并发起请求；超时、响应大小与出站地址受限
+func Execute(req registry.ExecuteRequest, t store.HttpTool, args map[string]any) (map[string]interface{}, error) {
+	timeout := DefaultTimeout
+	if t.TimeoutMs > 0 {
+		timeout = time.Duration(t.TimeoutMs) * time.Millisecond
+	}
+	limit := int64(DefaultMaxResponseBytes)
+	if t.MaxResponseBytes > 0 {
+		limit = t.MaxResponseBytes
+	}
+
+	target := renderURL(t.URL, args)
+	if err := mcp.Policy().CheckURL(target); err != nil {
+		return nil, err
+	}
+	headers := make(http.Header)
+	for k, v := range t.Headers {
+		headers.Set(k, renderHeader(v, args))
+	}
+	var body io.Reader
+	if t.Body != "" {
+		mode := detectBodyMode(headers.Get("Content-Type"), t.Body)
+		if mode == bodyJSON && headers.Get("Content-Type") == "" {
+			headers.Set("Content-Type", "application/json")
+		}
+		body = strings.NewReader(renderBody(t.Body, mode, args))
+	}
+
+	httpReq, err := http.NewRequestWithContext(req.Ctx, t.Method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header = headers
+	return Send(httpReq, timeout, limit, t.ResponsePath)
+}
+
+// StatusClass 非 2xx 响应的错误分类
+func StatusClass(code int) string {
+	switch code {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return registry.ErrInvalidArgs
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return registry.ErrPermissionDenied
+	case http.StatusNotFound, http.StatusGone:
+		return registry.ErrNotFound
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return registry.ErrTimeout
+	}
+	return registry.ErrUpstream
+}
+
+// Send 按出站 URL 策略发送请求并解析响应：非 2xx 返回错误，JSON 响应解码后可按 responsePath 提取
+func Send(httpReq *http.Request, timeout time.Duration, limit int64, responsePath string) (map[string]interface{}, error) {
+	if httpReq.Header.Get("Accept") == "" {
+		httpReq.Header.Set("Accept", "application/json, text/plain;q=0.9, */*;q=0.8")
+	}
+	resp, err := mcp.Policy().HTTPClient(timeout).Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("响应超过 %d 字节上限", limit)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet := string(data)
+		if len(snippet) > errorSnippetLen {
+			snippet = snippet[:errorSnippetLen] + "..."
+		}
+		return nil, registry.NewToolError(StatusClass(resp.StatusCode), fmt.Errorf("upstream HTTP %d: %s", resp.StatusCode, strings.TrimSpace(snippet)))
+	}
+
+	out := map[string]interface{}{"status": resp.StatusCode}
+	var doc any
+	isJSON := len(bytes.TrimSpace(data)) > 0 && json.Unmarshal(data, &doc) == nil
+	switch {
+	case responsePath != "":
+		if !isJSON {
+			return nil, fmt.Errorf("响应不是 JSON，无法按 %s 提取", responsePath)
+		}
+		v, err := extractPath(doc, responsePath)
+		if err != nil {
+			return nil, err
+		}
+		out["data"] = v
+	case isJSON:
+		out["data"] = doc
+	default:
+		out["data"] = string(data)
+	}
+	return out, nil
+}
@@ -0,0 +1,121 @@
+package httptool
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathStep JSONPath 的一段：字段名、数组下标或通配符
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parsePath 解析 JSONPath 子集：$、.key、['key']、[n]（支持负数）、[*] 与 .*
+func parsePath(path string) ([]pathStep, error) {
+	p := strings.TrimSpace(path)
+	if !strings.HasPrefix(p, "$") {
+		return nil, fmt.Errorf("JSONPath 必须以 $ 开头")
+	}
+	p = p[1:]
+	var steps []pathStep
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			name := p[:end]
+			if name == "" {
+				return nil, fmt.Errorf("JSONPath 字段名为空")
+			}
+			if name == "*" {
+				steps = append(steps, pathStep{wildcard: true})
+			} else {
+				steps = append(steps, pathStep{key: name})
+			}
+			p = p[end:]
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath 缺少 ]")
+			}
+			inner := strings.TrimSpace(p[1:end])
+			p = p[end+1:]
+			switch {
+			case inner == "*":
+				steps = append(steps, pathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, pathStep{key: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("JSONPath 下标无效：%s", inner)
+				}
+				steps = append(steps, pathStep{index: n, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("JSONPath 语法错误：%s", p)
+		}
+	}
+	return steps, nil
+}
+
+// extractPath 按 JSONPath 从解码后的 JSON 中取值；含通配符时返回所有匹配组成的数组，无匹配时返回 nil
+func extractPath(doc any, path string) (any, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	wildcard := false
+	current := []any{doc}
+	for _, st := range steps {
+		var next []any
+		for _, v := range current {
+			switch {
+			case st.wildcard:
+				wildcard = true
+				switch c := v.(type) {
+				case []any:
+					next = append(next, c...)
+				case map[string]any:
+					for _, item := range c {
+						next = append(next, item)
+					}
+				}
+			case st.isIndex:
+				if arr, ok := v.([]any); ok {
+					i := st.index
+					if i < 0 {
+						i += len(arr)
+					}
+					if i >= 0 && i < len(arr) {
+						next = append(next, arr[i])
+					}
+				}
+			default:
+				if m, ok := v.(map[string]any); ok {
+					if item, ok := m[st.key]; ok {
+						next = append(next, item)
+					}
+				}
+			}
+		}
+		current = next
+	}
+	if wildcard {
+		if current == nil {
+			return []any{}, nil
+		}
+		return current, nil
+	}
+	if len(current) == 0 {
+		return nil, nil
+	}
+	return current[0], nil
+}
@@ -0,0 +1,136 @@
+package httptool
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// 模板占位符 {{name}}，name 对应工具参数；按所处位置自动转义
+var placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// bodyMode 请求体模板的转义方式
+type bodyMode int
+
+const (
+	bodyRaw bodyMode = iota
+	bodyJSON
+	bodyForm
+)
+
+// placeholders 返回模板中引用的参数名
+func placeholders(tmpl string) []string {
+	var names []string
+	for _, m := range placeholderRe.FindAllStringSubmatch(tmpl, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// stringify 参数值的文本形式：字符串原样，缺失为空，其余按 JSON 编码
+func stringify(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	default:
+		b, _ := json.Marshal(x)
+		return string(b)
+	}
+}
+
+// renderURL 渲染 URL 模板：路径中的值按路径段转义，? 之后按查询参数转义
+func renderURL(tmpl string, args map[string]any) string {
+	q := strings.IndexByte(tmpl, '?')
+	if q < 0 {
+		return replace(tmpl, args, url.PathEscape)
+	}
+	return replace(tmpl[:q], args, url.PathEscape) + "?" + replace(tmpl[q+1:], args, url.QueryEscape)
+}
+
+// renderHeader 渲染请求头模板，值中的换行会被移除以防止注入额外请求头
+func renderHeader(tmpl string, args map[string]any) string {
+	return replace(tmpl, args, func(s string) string {
+		return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+	})
+}
+
+// renderBody 渲染请求体模板。JSON 模式下，位于字符串字面量内的占位符按字符串内容转义，
+// 其余位置替换为参数的 JSON 值（缺失为 null）；表单模式按查询参数转义
+func renderBody(tmpl string, mode bodyMode, args map[string]any) string {
+	switch mode {
+	case bodyForm:
+		return replace(tmpl, args, url.QueryEscape)
+	case bodyJSON:
+	default:
+		return replace(tmpl, args, func(s string) string { return s })
+	}
+	var b strings.Builder
+	inString := false
+	for i := 0; i < len(tmpl); {
+		if loc := placeholderRe.FindStringSubmatchIndex(tmpl[i:]); loc != nil && loc[0] == 0 {
+			v := args[tmpl[i+loc[2]:i+loc[3]]]
+			if inString {
+				enc, _ := json.Marshal(stringify(v))
+				b.Write(enc[1 : len(enc)-1])
+			} else {
+				enc, err := json.Marshal(v)
+				if err != nil {
+					enc = []byte("null")
+				}
+				b.Write(enc)
+			}
+			i += loc[1]
+			continue
+		}
+		c := tmpl[i]
+		switch {
+		case c == '\\' && inString && i+1 < len(tmpl):
+			b.WriteByte(c)
+			b.WriteByte(tmpl[i+1])
+			i += 2
+			continue
+		case c == '"':
+			inString = !inString
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.String()
+}
+
+func replace(tmpl string, args map[string]any, escape func(string) string) string {
+	return placeholderRe.ReplaceAllStringFunc(tmpl, func(m string) string {
+		name := placeholderRe.FindStringSubmatch(m)[1]
+		return escape(stringify(args[name]))
+	})
+}
+
+// detectBodyMode 按 Content-Type 与模板内容决定请求体转义方式
+func detectBodyMode(contentType, tmpl string) bodyMode {
+	ct := strings.ToLower(contentType)
+	switch {
+	case strings.Contains(ct, "x-www-form-urlencoded"):
+		return bodyForm
+	case strings.Contains(ct, "json"):
+		return bodyJSON
+	case ct == "":
+		t := strings.TrimSpace(tmpl)
+		if strings.HasPrefix(t, "{") || strings.HasPrefix(t, "[") {
+			return bodyJSON
+		}
+	}
+	return bodyRaw
+}
+
+// checkTemplate 检查模板中未闭合或格式错误的占位符
+func checkTemplate(field, tmpl string) error {
+	rest := placeholderRe.ReplaceAllString(tmpl, "")
+	if strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+		return fmt.Errorf("%s 模板中有无效的占位符（格式为 {{参数名}}）", field)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"agentic-demo/server/internal/store"
+)
+
+// tokenRefreshMargin 令牌过期前提前刷新的余量
+const tokenRefreshMargin = 30 * time.Second
+
+// Auth 出站 HTTP 请求的鉴权：静态请求头 + bearer / basic / OAuth2 client credentials
+type Auth struct {
+	Headers map[string]string
+	Config  *store.McpAuth
+}
+
+// AuthFor 从服务器配置构造鉴权；无任何鉴权配置时返回 nil
+func AuthFor(svr store.McpServer) *Auth {
+	if len(svr.Headers) == 0 && svr.Auth == nil {
+		return nil
+	}
+	return &Auth{Headers: svr.Headers, Config: svr.Auth}
+}
+
+// apply 为请求附加鉴权头；OAuth2 模式下按需获取并缓存 access token
+func (a *Auth) apply(ctx context.Context, req *http.Request) error {
+	if a == nil {
+		return nil
+	}
+	for k, v := range a.Headers {
+		req.Header.Set(k, v)
+	}
+	c := a.Config
+	if c == nil {
+		return nil
+	}
+	switch c.Type {
+	case store.McpAuthBearer:
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case store.McpAuthBasic:
+		req.SetBasicAuth(c.Username, c.Password)
+	case store.McpAuthOAuth2:
+		token, err := tokens.get(ctx, c)
+		if err != nil {
+			return fmt.Errorf("oauth2 token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// Apply 为其他出站 HTTP 请求（如 OpenAPI 工具）附加同样的鉴权
+func (a *Auth) Apply(ctx context.Context, req *http.Request) error {
+	return a.apply(ctx, req)
+}
+
+// invalidate 在收到 401 时丢弃缓存的 OAuth2 令牌，下次请求重新获取
+func (a *Auth) invalidate() {
+	if a != nil && a.Config != nil && a.Config.Type == store.McpAuthOAuth2 {
+		tokens.drop(a.Config)
+	}
+}
+
+type cachedToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+}
+
+var tokens = &tokenCache{tokens: make(map[string]cachedToken)}
+
+func tokenCacheKey(c *store.McpAuth) string {
+	return c.TokenURL + "|" + c.ClientID + "|" + strings.Join(c.Scopes, " ")
+}
+
+func (t *tokenCache) get(ctx context.Context, c *store.McpAuth) (string, error) {
+	key := tokenCacheKey(c)
+	t.mu.Lock()
+	cached, ok := t.tokens[key]
+	t.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.value, nil
+	}
+	token, expiresIn, err := fetchClientCredentialsToken(ctx, c)
+	if err != nil {
+		return "", err
+	}
+	if expiresIn <= 0 {
+		expiresIn = time.Hour
+	}
+	t.mu.Lock()
+	t.tokens[key] = cachedToken{value: token, expiresAt: time.Now().Add(expiresIn - tokenRefreshMargin)}
+	t.mu.Unlock()
+	return token, nil
+}
+
+func (t *tokenCache) drop(c *store.McpAuth) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.tokens, tokenCacheKey(c))
+}
+
+// fetchClientCredentialsToken 向 token endpoint 发起 client_credentials 授权
+func fetchClientCredentialsToken(ctx context.Context, c *store.McpAuth) (string, time.Duration, error) {
+	if c.TokenURL == "" || c.ClientID == "" {
+		return "", 0, fmt.Errorf("tokenUrl and clientId required")
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+	}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	if err := Policy().CheckURL(c.TokenURL); err != nil {
+		return "", 0, err
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient(checkTimeout).Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("token endpoint: HTTP %d", resp.StatusCode)
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", 0, err
+	}
+	if out.AccessToken == "" {
+		return "", 0, fmt.Errorf("token endpoint returned no access_token")
+	}
+	return out.AccessToken, time.Duration(out.ExpiresIn) * time.Second, nil
+}
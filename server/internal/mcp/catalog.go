@@ -0,0 +1,185 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"agentic-demo/server/internal/registry"
+	"agentic-demo/server/internal/store"
+
+	"google.golang.org/genai"
+)
+
+const (
+	// ReadResourceTool 供模型按 URI 读取 MCP 资源的工具名
+	ReadResourceTool = "read_mcp_resource"
+	// resourceTextLimit 单次读取返回给模型的最大字符数
+	resourceTextLimit = 20000
+)
+
+// ServerResource 目录中的一条资源，附带所属服务器
+type ServerResource struct {
+	ServerID   string `json:"serverId"`
+	ServerName string `json:"serverName"`
+	Resource
+}
+
+// Catalog 缓存各服务器已发现的资源，供系统提示词声明与 read_mcp_resource 查找
+type Catalog struct {
+	servers *store.McpStore
+	procs   *ProcessManager
+
+	mu        sync.RWMutex
+	resources map[string][]Resource
+}
+
+func NewCatalog(servers *store.McpStore, procs *ProcessManager) *Catalog {
+	return &Catalog{servers: servers, procs: procs, resources: make(map[string][]Resource)}
+}
+
+// Refresh 重新列举服务器资源；服务器未实现 resources 时记为空
+func (c *Catalog) Refresh(ctx context.Context, svr store.McpServer) error {
+	caller, closeFn, err := Connect(ctx, svr, c.procs)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	list, err := ListResources(ctx, caller)
+	if err != nil && !IsMethodNotFound(err) {
+		return err
+	}
+	c.Set(svr.ID, list)
+	return nil
+}
+
+// Set 更新服务器的资源列表
+func (c *Catalog) Set(serverID string, list []Resource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(list) == 0 {
+		delete(c.resources, serverID)
+		return
+	}
+	c.resources[serverID] = list
+}
+
+// Forget 移除服务器的资源（服务器删除或不可用时）
+func (c *Catalog) Forget(serverID string) {
+	c.Set(serverID, nil)
+}
+
+// Resources 返回所有仍存在的服务器的资源，按服务器名与 URI 排序
+func (c *Catalog) Resources() []ServerResource {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var out []ServerResource
+	for id, list := range c.resources {
+		svr, _ := c.servers.Get(id)
+		if svr == nil {
+			continue
+		}
+		for _, r := range list {
+			out = append(out, ServerResource{ServerID: id, ServerName: svr.Name, Resource: r})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ServerName != out[j].ServerName {
+			return out[i].ServerName < out[j].ServerName
+		}
+		return out[i].URI < out[j].URI
+	})
+	return out
+}
+
+// serverFor 按 URI 查找提供该资源的服务器
+func (c *Catalog) serverFor(uri string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for id, list := range c.resources {
+		for _, r := range list {
+			if r.URI == uri {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// Read 读取资源并拼接文本内容；serverID 为空时按 URI 在目录中查找
+func (c *Catalog) Read(ctx context.Context, serverID, uri string) (string, error) {
+	if serverID == "" {
+		serverID = c.serverFor(uri)
+	}
+	if serverID == "" {
+		return "", fmt.Errorf("resource not found: %s", uri)
+	}
+	svr, _ := c.servers.Get(serverID)
+	if svr == nil {
+		return "", fmt.Errorf("mcp server not found: %s", serverID)
+	}
+	caller, closeFn, err := Connect(ctx, *svr, c.procs)
+	if err != nil {
+		return "", err
+	}
+	defer closeFn()
+	contents, err := ReadResource(ctx, caller, uri)
+	if err != nil {
+		return "", err
+	}
+	return ResourceText(contents), nil
+}
+
+// ResourceText 拼接资源的文本内容，二进制内容以占位说明代替
+func ResourceText(contents []ResourceContent) string {
+	var parts []string
+	for _, rc := range contents {
+		if rc.Text != "" {
+			parts = append(parts, rc.Text)
+		} else if rc.Blob != "" {
+			parts = append(parts, fmt.Sprintf("[二进制内容 %s，%d 字节 base64]", rc.MimeType, len(rc.Blob)))
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// RegisterResourceTool 向 registry 注册 read_mcp_resource 工具
+func RegisterResourceTool(reg *registry.Registry, c *Catalog) {
+	def := &genai.FunctionDeclaration{
+		Name:        ReadResourceTool,
+		Description: "读取 MCP 服务器提供的资源内容（系统提示词「MCP 资源」中列出的 URI）。",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"uri":      {Type: genai.TypeString, Description: "资源 URI"},
+				"serverId": {Type: genai.TypeString, Description: "服务器 ID（可选，URI 唯一时可省略）"},
+			},
+			Required: []string{"uri"},
+		},
+	}
+	reg.RegisterExternal(ReadResourceTool, registry.SourceMcp, def, func(req registry.ExecuteRequest, args json.RawMessage) (interface{}, error) {
+		var inp struct {
+			URI      string `json:"uri"`
+			ServerID string `json:"serverId"`
+		}
+		if err := json.Unmarshal(args, &inp); err != nil {
+			return nil, err
+		}
+		if inp.URI == "" {
+			return nil, fmt.Errorf("missing required argument: uri")
+		}
+		text, err := c.Read(req.Ctx, inp.ServerID, inp.URI)
+		if err != nil {
+			return nil, err
+		}
+		truncated := false
+		if r := []rune(text); len(r) > resourceTextLimit {
+			text = string(r[:resourceTextLimit])
+			truncated = true
+		}
+		return map[string]interface{}{"uri": inp.URI, "content": text, "truncated": truncated}, nil
+	})
+}
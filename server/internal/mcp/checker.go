@@ -2,15 +2,10 @@
 package mcp
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
+	"errors"
 	"net/url"
-	"strings"
 	"time"
 )
 
@@ -29,11 +24,12 @@ type CheckResult struct {
 	Endpoint    string
 }
 
-// Check 对 MCP 服务器执行可用性检查，流程参考 use-mcp 与 dist-server：
-// 1. GET url with Accept: text/event-stream (SSE)
-// 2. 解析 SSE 流中的 event: endpoint 与 data: <post_url>
-// 3. 若有 endpoint，则 POST Initialize + tools/list 完成全链路验证
-func Check(ctx context.Context, serverURL string) (*CheckResult, error) {
+// Check 对 MCP 服务器执行可用性检查，复用 DialHTTP 的连接流程（SSE endpoint 发现或 Streamable HTTP）：
+// 1. 建立会话：SSE 服务器须在超时内下发 endpoint 事件
+// 2. 完成 initialize 握手
+// 3. tools/list 统计工具数，完成全链路验证
+// auth 为 nil 时不附加任何鉴权头
+func Check(ctx context.Context, serverURL string, auth *Auth) (*CheckResult, error) {
 	u, err := url.Parse(serverURL)
 	if err != nil {
 		return &CheckResult{Status: "failed", Error: "invalid URL: " + err.Error()}, nil
@@ -42,186 +38,65 @@ func Check(ctx context.Context, serverURL string) (*CheckResult, error) {
 		return &CheckResult{Status: "failed", Error: "URL must have scheme and host"}, nil
 	}
 
-	// 1. 创建带超时的 HTTP 请求
 	reqCtx, cancel := context.WithTimeout(ctx, checkTimeout)
 	defer cancel()
-	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, serverURL, nil)
-	if err != nil {
-		return &CheckResult{Status: "failed", Error: err.Error()}, nil
-	}
-	req.Header.Set("Accept", "application/json, text/event-stream")
-
-	client := &http.Client{Timeout: checkTimeout}
-	resp, err := client.Do(req)
+	s, err := openHTTPSession(reqCtx, serverURL, auth)
 	if err != nil {
+		if res := policyFailure(err); res != nil {
+			return res, nil
+		}
+		if errors.Is(err, errNoEndpoint) {
+			return &CheckResult{Status: "reachable", Error: err.Error()}, nil
+		}
 		return &CheckResult{Status: "failed", Error: err.Error()}, nil
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return &CheckResult{
-			Status: "failed",
-			Error:  fmt.Sprintf("HTTP %d: %s", resp.StatusCode, resp.Status),
-		}, nil
-	}
-
-	// 2. 解析 SSE 流，查找 event: endpoint 与 data:
-	ct := resp.Header.Get("Content-Type")
-	isSSE := strings.Contains(ct, "text/event-stream")
+	defer s.Close()
 	var endpoint string
-	if isSSE {
-		endpoint = parseSSEEndpoint(resp.Body, serverURL, sseReadTimeout)
-	} else {
-		// 可能是 Streamable HTTP，直接尝试对原 URL 发 JSON-RPC
-		endpoint = serverURL
+	if s.legacySSE {
+		endpoint = s.endpoint
 	}
 
-	if endpoint == "" {
-		return &CheckResult{
-			Status: "reachable",
-			Error:  "SSE 响应正常但未在超时内收到 endpoint 事件",
-		}, nil
-	}
-
-	// 3. 对 endpoint 发送 Initialize + tools/list，完成全链路验证
-	toolsCount, initErr := initializeAndListTools(ctx, endpoint)
-	if initErr != nil {
-		return &CheckResult{
-			Status:   "reachable",
-			Error:    "endpoint 已获取但初始化失败: " + initErr.Error(),
-			Endpoint: endpoint,
-		}, nil
-	}
-
-	return &CheckResult{
-		Status:     "ready",
-		ToolsCount: toolsCount,
-		Endpoint:   endpoint,
-	}, nil
-}
-
-func parseSSEEndpoint(r io.Reader, baseURL string, timeout time.Duration) string {
-	type result struct {
-		endpoint string
-	}
-	done := make(chan result, 1)
-	go func() {
-		var endpoint string
-		scanner := bufio.NewScanner(r)
-		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
-		var eventType, dataLine string
-		for scanner.Scan() {
-			line := scanner.Text()
-			if strings.HasPrefix(line, "event: ") {
-				eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
-			} else if strings.HasPrefix(line, "data: ") {
-				dataLine = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
-			} else if line == "" && eventType != "" && dataLine != "" {
-				if eventType == "endpoint" {
-					raw := strings.Trim(strings.TrimSpace(dataLine), `"`)
-					if base, err := url.Parse(baseURL); err == nil {
-						if resolved, err := base.Parse(raw); err == nil {
-							endpoint = resolved.String()
-						} else {
-							endpoint = raw
-						}
-					} else {
-						endpoint = raw
-					}
-					break
-				}
-				eventType = ""
-				dataLine = ""
-			}
+	// SSE 已下发 endpoint 时服务器可达，握手失败记为 reachable；Streamable HTTP 握手失败即不可用
+	if err := s.initialize(reqCtx); err != nil {
+		if s.legacySSE {
+			return &CheckResult{Status: "reachable", Error: "endpoint 已获取但初始化失败: " + err.Error(), Endpoint: endpoint}, nil
 		}
-		done <- result{endpoint: endpoint}
-	}()
-
-	select {
-	case res := <-done:
-		return res.endpoint
-	case <-time.After(timeout):
-		return ""
-	}
-}
-
-// initializeAndListTools 发送 MCP Initialize 与 tools/list，返回工具数量
-func initializeAndListTools(ctx context.Context, endpoint string) (int, error) {
-	// Initialize
-	initReq := map[string]any{
-		"jsonrpc": "2.0",
-		"id":      1,
-		"method":  "initialize",
-		"params": map[string]any{
-			"protocolVersion": protocolVersion,
-			"capabilities":    map[string]any{},
-			"clientInfo":     map[string]any{"name": clientName, "version": "1.0.0"},
-		},
-	}
-	initBody, _ := json.Marshal(initReq)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(initBody))
-	if err != nil {
-		return 0, err
+		return &CheckResult{Status: "failed", Error: err.Error()}, nil
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
+	raw, err := s.Call(reqCtx, "tools/list", map[string]any{})
 	if err != nil {
-		return 0, err
+		return &CheckResult{Status: "reachable", Error: "tools/list 失败: " + err.Error(), Endpoint: endpoint}, nil
 	}
-	resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("initialize: HTTP %d", resp.StatusCode)
+	var res struct {
+		Tools []map[string]any `json:"tools"`
 	}
-
-	// notifications/initialized (可选，部分服务器不要求)
-	notifReq := map[string]any{
-		"jsonrpc": "2.0",
-		"method":  "notifications/initialized",
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return &CheckResult{Status: "reachable", Error: "tools/list 响应无法解析: " + err.Error(), Endpoint: endpoint}, nil
 	}
-	notifBody, _ := json.Marshal(notifReq)
-	notif, _ := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(notifBody))
-	notif.Header.Set("Content-Type", "application/json")
-	_ = client.Do(notif)
+	return &CheckResult{Status: "ready", ToolsCount: len(res.Tools), Endpoint: endpoint}, nil
+}
 
-	// tools/list
-	toolsReq := map[string]any{
-		"jsonrpc": "2.0",
-		"id":      2,
-		"method":  "tools/list",
+// CheckStdio 对后端托管的 stdio 进程执行可用性检查：进程需已完成 initialize，再通过 tools/list 统计工具数
+func CheckStdio(ctx context.Context, p *StdioProcess) (*CheckResult, error) {
+	if p == nil {
+		return &CheckResult{Status: "failed", Error: "stdio 进程未启动"}, nil
 	}
-	toolsBody, _ := json.Marshal(toolsReq)
-	toolsHTTPReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(toolsBody))
-	if err != nil {
-		return 0, err
-	}
-	toolsHTTPReq.Header.Set("Content-Type", "application/json")
-	toolsHTTPReq.Header.Set("Accept", "application/json")
-	toolsResp, err := client.Do(toolsHTTPReq)
+	reqCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	raw, err := p.Call(reqCtx, "tools/list", map[string]any{})
 	if err != nil {
-		return 0, err
-	}
-	defer toolsResp.Body.Close()
-	if toolsResp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("tools/list: HTTP %d", toolsResp.StatusCode)
-	}
-	var toolsRes struct {
-		Result *struct {
-			Tools []map[string]any `json:"tools"`
-		} `json:"result"`
-		Error *struct {
-			Message string `json:"message"`
-		} `json:"error"`
-	}
-	if err := json.NewDecoder(toolsResp.Body).Decode(&toolsRes); err != nil {
-		return 0, err
+		st := p.Status()
+		msg := err.Error()
+		if st.LastExit != "" {
+			msg += "（上次退出：" + st.LastExit + "）"
+		}
+		return &CheckResult{Status: "failed", Error: msg}, nil
 	}
-	if toolsRes.Error != nil {
-		return 0, fmt.Errorf("tools/list: %s", toolsRes.Error.Message)
+	var res struct {
+		Tools []map[string]any `json:"tools"`
 	}
-	if toolsRes.Result == nil {
-		return 0, nil
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return &CheckResult{Status: "reachable", Error: "tools/list 响应无法解析: " + err.Error()}, nil
 	}
-	return len(toolsRes.Result.Tools), nil
+	return &CheckResult{Status: "ready", ToolsCount: len(res.Tools)}, nil
 }
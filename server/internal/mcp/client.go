@@ -0,0 +1,503 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"agentic-demo/server/internal/store"
+)
+
+const (
+	httpCallTimeout = 30 * time.Second
+	sessionHeader   = "Mcp-Session-Id"
+)
+
+var ErrSessionClosed = errors.New("mcp session closed")
+
+// Caller 发送 JSON-RPC 请求并返回 result；StdioProcess 与 HTTPSession 均实现
+type Caller interface {
+	Call(ctx context.Context, method string, params any) (json.RawMessage, error)
+}
+
+// Connect 为服务器建立可调用的会话；stdio 复用托管进程，http 新建会话。
+// 返回的 close 必须调用（stdio 为空操作）
+func Connect(ctx context.Context, svr store.McpServer, procs *ProcessManager) (Caller, func(), error) {
+	if svr.IsStdio() {
+		var p *StdioProcess
+		if procs != nil {
+			p = procs.Get(svr.ID)
+		}
+		if p == nil {
+			return nil, nil, ErrProcessNotRunning
+		}
+		return p, func() {}, nil
+	}
+	s, err := DialHTTP(ctx, svr.URL, AuthFor(svr))
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, s.Close, nil
+}
+
+// HTTPSession 一次 HTTP MCP 会话，兼容两种传输：
+// SSE：GET 长连接下发 endpoint 事件，请求 POST 到 endpoint，响应经 SSE 流返回；
+// Streamable HTTP：请求直接 POST 到服务器地址，响应为 JSON 或 SSE 响应体，会话由 Mcp-Session-Id 维持
+type HTTPSession struct {
+	url    string
+	auth   *Auth
+	client *http.Client
+
+	endpoint  string
+	legacySSE bool
+	cancel    context.CancelFunc
+
+	mu        sync.Mutex
+	sessionID string
+	pending   map[int64]chan rpcMessage
+	nextID    int64
+	closed    bool
+	broken    bool // SSE 长连接已断开，会话不可再用
+	onNotify  func(method string, params json.RawMessage)
+}
+
+var errNoEndpoint = errors.New("SSE 响应正常但未在超时内收到 endpoint 事件")
+
+// DialHTTP 建立会话并完成 initialize 握手
+func DialHTTP(ctx context.Context, serverURL string, auth *Auth) (*HTTPSession, error) {
+	s, err := openHTTPSession(ctx, serverURL, auth)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.initialize(ctx); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// openHTTPSession 校验地址并建立连接（SSE 等待 endpoint 事件），尚未握手
+func openHTTPSession(ctx context.Context, serverURL string, auth *Auth) (*HTTPSession, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid MCP URL: %s", serverURL)
+	}
+	if err := Policy().CheckURL(serverURL); err != nil {
+		return nil, err
+	}
+	s := &HTTPSession{
+		url:     serverURL,
+		auth:    auth,
+		client:  httpClient(httpCallTimeout),
+		pending: make(map[int64]chan rpcMessage),
+	}
+	if err := s.openStream(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// initialize 发送 initialize 与 notifications/initialized 完成握手
+func (s *HTTPSession) initialize(ctx context.Context) error {
+	if _, err := s.Call(ctx, "initialize", map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": clientName, "version": "1.0.0"},
+	}); err != nil {
+		return fmt.Errorf("initialize: %w", err)
+	}
+	if err := s.Notify(ctx, "notifications/initialized", nil); err != nil {
+		return fmt.Errorf("initialized: %w", err)
+	}
+	return nil
+}
+
+// openStream 尝试以 SSE 打开长连接；服务器不返回 SSE 时按 Streamable HTTP 处理
+func (s *HTTPSession) openStream(ctx context.Context) error {
+	streamCtx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, s.url, nil)
+	if err != nil {
+		cancel()
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if err := s.auth.apply(ctx, req); err != nil {
+		cancel()
+		return err
+	}
+	// 长连接不设整体超时，由 cancel 关闭；收到响应头之前随 ctx 一起取消
+	stop := context.AfterFunc(ctx, cancel)
+	resp, err := httpClient(0).Do(req)
+	stop()
+	if err != nil {
+		cancel()
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		resp.Body.Close()
+		cancel()
+		s.auth.invalidate()
+		return fmt.Errorf("鉴权失败 HTTP %d：请检查服务器的鉴权配置", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body.Close()
+		cancel()
+		s.endpoint = s.url
+		return nil
+	}
+
+	endpointCh := make(chan string, 1)
+	go s.readStream(resp.Body, endpointCh)
+	select {
+	case ep := <-endpointCh:
+		if ep == "" {
+			cancel()
+			return errNoEndpoint
+		}
+		if err := Policy().CheckEndpoint(s.url, ep); err != nil {
+			cancel()
+			return err
+		}
+		s.endpoint = ep
+		s.legacySSE = true
+		s.cancel = cancel
+		return nil
+	case <-time.After(sseReadTimeout):
+		cancel()
+		return errNoEndpoint
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
+}
+
+// readStream 读取 SSE 长连接：首个 endpoint 事件写入 endpointCh，其后的 message 事件分发给等待中的请求
+func (s *HTTPSession) readStream(body io.ReadCloser, endpointCh chan<- string) {
+	defer body.Close()
+	sentEndpoint := false
+	readSSE(body, func(event, data string) bool {
+		switch event {
+		case "endpoint":
+			if !sentEndpoint {
+				sentEndpoint = true
+				endpointCh <- resolveURL(s.url, strings.Trim(data, `"`))
+			}
+		case "", "message":
+			var msg rpcMessage
+			if err := json.Unmarshal([]byte(data), &msg); err == nil {
+				s.dispatch(msg)
+			}
+		}
+		return true
+	})
+	if !sentEndpoint {
+		endpointCh <- ""
+	}
+	s.mu.Lock()
+	s.broken = true
+	s.mu.Unlock()
+	s.failPending()
+}
+
+// readSSE 逐个解析 SSE 事件，fn 返回 false 时停止
+func readSSE(r io.Reader, fn func(event, data string) bool) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if !fn(event, strings.Join(data, "\n")) {
+					return
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if len(data) > 0 {
+		fn(event, strings.Join(data, "\n"))
+	}
+}
+
+func resolveURL(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := b.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return r.String()
+}
+
+// dispatch 把响应交给对应请求；服务端通知交给 onNotify，服务端请求不支持时忽略
+func (s *HTTPSession) dispatch(msg rpcMessage) {
+	if msg.Method != "" {
+		s.mu.Lock()
+		fn := s.onNotify
+		s.mu.Unlock()
+		if fn != nil && len(msg.ID) == 0 {
+			go fn(msg.Method, msg.Params)
+		}
+		return
+	}
+	var id int64
+	if err := json.Unmarshal(msg.ID, &id); err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ch, ok := s.pending[id]; ok {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+func (s *HTTPSession) failPending() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, ch := range s.pending {
+		close(ch)
+		delete(s.pending, id)
+	}
+}
+
+// Call 发送 JSON-RPC 请求并等待 result
+func (s *HTTPSession) Call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	s.nextID++
+	id := s.nextID
+	ch := make(chan rpcMessage, 1)
+	s.pending[id] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+	}()
+
+	if params == nil {
+		params = map[string]any{}
+	}
+	ctx, cancel := context.WithTimeout(ctx, httpCallTimeout)
+	defer cancel()
+	resp, err := s.post(ctx, map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", method, err)
+	}
+	if !s.legacySSE {
+		// Streamable HTTP：响应在 POST 响应体中
+		go func() {
+			defer resp.Body.Close()
+			s.readPostResponse(resp)
+		}()
+	} else {
+		resp.Body.Close()
+	}
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", method, ErrSessionClosed)
+		}
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+// readPostResponse 解析 Streamable HTTP 的响应体（JSON 或 SSE）并分发
+func (s *HTTPSession) readPostResponse(resp *http.Response) {
+	if strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		readSSE(resp.Body, func(_, data string) bool {
+			var msg rpcMessage
+			if err := json.Unmarshal([]byte(data), &msg); err == nil {
+				s.dispatch(msg)
+			}
+			return true
+		})
+		return
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var batch []rpcMessage
+		if json.Unmarshal(data, &batch) == nil {
+			for _, msg := range batch {
+				s.dispatch(msg)
+			}
+		}
+		return
+	}
+	var msg rpcMessage
+	if json.Unmarshal(data, &msg) == nil {
+		s.dispatch(msg)
+	}
+}
+
+// Listen 设置服务端通知回调。SSE 传输的通知经已有长连接下发；
+// Streamable HTTP 需另开 GET 流，服务器不支持（非 SSE 响应）时返回 false
+func (s *HTTPSession) Listen(fn func(method string, params json.RawMessage)) bool {
+	s.mu.Lock()
+	s.onNotify = fn
+	sid := s.sessionID
+	s.mu.Unlock()
+	if s.legacySSE {
+		return true
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint, nil)
+	if err != nil {
+		cancel()
+		return false
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if sid != "" {
+		req.Header.Set(sessionHeader, sid)
+	}
+	if err := s.auth.apply(ctx, req); err != nil {
+		cancel()
+		return false
+	}
+	resp, err := httpClient(0).Do(req)
+	if err != nil {
+		cancel()
+		return false
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body.Close()
+		cancel()
+		return false
+	}
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+	go func() {
+		defer resp.Body.Close()
+		readSSE(resp.Body, func(_, data string) bool {
+			var msg rpcMessage
+			if err := json.Unmarshal([]byte(data), &msg); err == nil {
+				s.dispatch(msg)
+			}
+			return true
+		})
+	}()
+	return true
+}
+
+// Done 在会话关闭或 SSE 长连接断开后返回 true
+func (s *HTTPSession) Done() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed || s.broken
+}
+
+// Notify 发送 JSON-RPC 通知
+func (s *HTTPSession) Notify(ctx context.Context, method string, params any) error {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		msg["params"] = params
+	}
+	resp, err := s.post(ctx, msg)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// post 发送一条 JSON-RPC 消息；记录服务端下发的会话 ID
+func (s *HTTPSession) post(ctx context.Context, msg map[string]any) (*http.Response, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	s.mu.Lock()
+	if s.sessionID != "" {
+		req.Header.Set(sessionHeader, s.sessionID)
+	}
+	s.mu.Unlock()
+	if err := s.auth.apply(ctx, req); err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			s.auth.invalidate()
+		}
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if sid := resp.Header.Get(sessionHeader); sid != "" {
+		s.mu.Lock()
+		s.sessionID = sid
+		s.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// Close 关闭会话：断开 SSE 长连接，Streamable HTTP 下尽力发送 DELETE 结束服务端会话
+func (s *HTTPSession) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	sid := s.sessionID
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	if !s.legacySSE && sid != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.endpoint, nil); err == nil {
+			req.Header.Set(sessionHeader, sid)
+			if s.auth.apply(ctx, req) == nil {
+				if resp, err := s.client.Do(req); err == nil {
+					resp.Body.Close()
+				}
+			}
+		}
+	}
+	s.failPending()
+}
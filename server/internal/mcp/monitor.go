@@ -0,0 +1,209 @@
+package mcp
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"agentic-demo/server/internal/store"
+)
+
+const (
+	monitorTickMin    = time.Second
+	monitorTickMax    = 15 * time.Second
+	monitorJitter     = 0.1 // 下次检查时间 ±10% 随机抖动，避免所有服务器同时检查
+	monitorMaxBackoff = 30 * time.Minute
+)
+
+// Monitor 后台周期性检查所有 MCP 服务器，失败的服务器按指数退避降低检查频率
+type Monitor struct {
+	servers  *store.McpStore
+	status   *store.McpStatusStore
+	procs    *ProcessManager
+	catalog  *Catalog  // 可选：检查成功后刷新资源目录
+	tools    *ToolSync // 可选：检查成功后同步工具到 registry
+	interval time.Duration
+
+	mu       sync.Mutex
+	next     map[string]time.Time   // 下一次检查时间
+	failures map[string]int         // 连续失败次数
+	inFlight map[string]int         // 进行中与等待中的检查数
+	locks    map[string]*sync.Mutex // 同一服务器的检查串行执行
+}
+
+func NewMonitor(servers *store.McpStore, status *store.McpStatusStore, procs *ProcessManager, interval time.Duration) *Monitor {
+	return &Monitor{
+		servers:  servers,
+		status:   status,
+		procs:    procs,
+		interval: interval,
+		next:     make(map[string]time.Time),
+		failures: make(map[string]int),
+		inFlight: make(map[string]int),
+		locks:    make(map[string]*sync.Mutex),
+	}
+}
+
+// SetCatalog 设置资源目录，检查成功时刷新、失败时移除该服务器的资源
+func (m *Monitor) SetCatalog(c *Catalog) {
+	m.catalog = c
+}
+
+// SetToolSync 设置工具同步器，检查成功时连接并注册服务器工具、失败时注销
+func (m *Monitor) SetToolSync(t *ToolSync) {
+	m.tools = t
+}
+
+// Run 阻塞运行检查循环直到 ctx 结束；interval<=0 时直接返回
+func (m *Monitor) Run(ctx context.Context) {
+	if m.interval <= 0 {
+		return
+	}
+	tick := m.interval / 10
+	if tick < monitorTickMin {
+		tick = monitorTickMin
+	}
+	if tick > monitorTickMax {
+		tick = monitorTickMax
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	m.checkDue(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.checkDue(ctx)
+		}
+	}
+}
+
+// checkDue 对到期的服务器各起一个 goroutine 检查，同一服务器不会并发检查
+func (m *Monitor) checkDue(ctx context.Context) {
+	now := time.Now()
+	servers := m.servers.List()
+	known := make(map[string]bool, len(servers))
+	for _, svr := range servers {
+		known[svr.ID] = true
+		m.mu.Lock()
+		next, scheduled := m.next[svr.ID]
+		due := m.inFlight[svr.ID] == 0 && (!scheduled || !now.Before(next))
+		if due {
+			m.inFlight[svr.ID]++
+		}
+		m.mu.Unlock()
+		if due {
+			go m.check(ctx, svr)
+		}
+	}
+	// 清理已删除服务器的调度状态
+	m.mu.Lock()
+	for id := range m.next {
+		if !known[id] {
+			delete(m.next, id)
+			delete(m.failures, id)
+		}
+	}
+	for id := range m.locks {
+		if !known[id] && m.inFlight[id] == 0 {
+			delete(m.locks, id)
+		}
+	}
+	m.mu.Unlock()
+}
+
+// CheckNow 立即检查一个服务器，记录历史并安排下一次检查；该服务器已有检查在进行时等其结束后再检查
+func (m *Monitor) CheckNow(ctx context.Context, svr store.McpServer) *CheckResult {
+	m.mu.Lock()
+	m.inFlight[svr.ID]++
+	m.mu.Unlock()
+	return m.check(ctx, svr)
+}
+
+// check 持有服务器的锁执行检查（手动检查与后台检查共用）；调用方须已增加 inFlight 计数
+func (m *Monitor) check(ctx context.Context, svr store.McpServer) *CheckResult {
+	m.mu.Lock()
+	lock := m.locks[svr.ID]
+	if lock == nil {
+		lock = &sync.Mutex{}
+		m.locks[svr.ID] = lock
+	}
+	m.mu.Unlock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	result := RunCheck(ctx, svr, m.procs, m.status)
+	if m.catalog != nil {
+		if result.Status == store.McpStatusReady {
+			_ = m.catalog.Refresh(ctx, svr)
+		} else {
+			m.catalog.Forget(svr.ID)
+		}
+	}
+	if m.tools != nil {
+		if result.Status == store.McpStatusReady {
+			_ = m.tools.Sync(ctx, svr)
+		} else {
+			m.tools.Remove(svr.ID)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.inFlight[svr.ID]--; m.inFlight[svr.ID] <= 0 {
+		delete(m.inFlight, svr.ID)
+	}
+	if result.Status == store.McpStatusReady {
+		m.failures[svr.ID] = 0
+	} else {
+		m.failures[svr.ID]++
+	}
+	m.next[svr.ID] = time.Now().Add(m.delay(m.failures[svr.ID]))
+	return result
+}
+
+// delay 计算下次检查间隔：连续失败时翻倍（上限 monitorMaxBackoff），并叠加随机抖动
+func (m *Monitor) delay(failures int) time.Duration {
+	d := m.interval
+	if d <= 0 {
+		d = time.Minute
+	}
+	for i := 0; i < failures && d < monitorMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > monitorMaxBackoff {
+		d = monitorMaxBackoff
+	}
+	jitter := (rand.Float64()*2 - 1) * monitorJitter * float64(d)
+	return d + time.Duration(jitter)
+}
+
+// RunCheck 检查服务器并把结果（含耗时）写入状态历史
+func RunCheck(ctx context.Context, svr store.McpServer, procs *ProcessManager, status *store.McpStatusStore) *CheckResult {
+	start := time.Now()
+	result := CheckServer(ctx, svr, procs)
+	status.RecordCheck(svr.ID, store.McpCheckRecord{
+		Status:     result.Status,
+		LatencyMs:  time.Since(start).Milliseconds(),
+		Error:      result.Error,
+		ToolsCount: result.ToolsCount,
+	}, result.Endpoint)
+	return result
+}
+
+// CheckServer 按传输方式选择 HTTP 或 stdio 检查
+func CheckServer(ctx context.Context, svr store.McpServer, procs *ProcessManager) *CheckResult {
+	var result *CheckResult
+	if svr.IsStdio() {
+		var p *StdioProcess
+		if procs != nil {
+			p = procs.Get(svr.ID)
+		}
+		result, _ = CheckStdio(ctx, p)
+	} else {
+		result, _ = Check(ctx, svr.URL, AuthFor(svr))
+	}
+	return result
+}
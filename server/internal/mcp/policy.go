@@ -0,0 +1,309 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"agentic-demo/server/internal/registry"
+)
+
+// DefaultDenyCIDRs 默认禁止访问的网段：云厂商元数据地址与链路本地、未指定地址
+var DefaultDenyCIDRs = []string{
+	"169.254.0.0/16",     // 链路本地（含 169.254.169.254 元数据服务）
+	"100.100.100.200/32", // 阿里云元数据
+	"0.0.0.0/8",
+	"fe80::/10",
+	"fd00:ec2::254/128", // AWS IPv6 元数据
+	"::/128",
+}
+
+const maxRedirects = 10
+
+// PolicyError URL 策略拒绝的原因
+type PolicyError struct {
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return "URL 策略拒绝：" + e.Reason
+}
+
+// ErrorClass 工具调用被策略拒绝时归类为 permission_denied
+func (e *PolicyError) ErrorClass() string {
+	return registry.ErrPermissionDenied
+}
+
+// AsPolicyError 从错误链中取出 PolicyError
+func AsPolicyError(err error) *PolicyError {
+	var pe *PolicyError
+	if errors.As(err, &pe) {
+		return pe
+	}
+	return nil
+}
+
+// URLPolicy 出站请求的 URL 策略：允许的协议、主机与网段黑白名单。
+// 网段检查作用于每次实际建立连接的 IP（含重定向与 DNS 解析结果），防止 DNS 重绑定绕过
+type URLPolicy struct {
+	Schemes    []string
+	AllowHosts []string // 非空时主机必须命中其一；支持 *.example.com 与 .example.com 后缀匹配
+	DenyHosts  []string
+	AllowCIDRs []*net.IPNet // 非空时 IP 必须位于其中之一
+	DenyCIDRs  []*net.IPNet
+	// AllowCrossOriginEndpoint 允许 SSE endpoint 事件指向与服务器地址不同源的地址
+	AllowCrossOriginEndpoint bool
+
+	transportOnce sync.Once
+	transport     *http.Transport
+}
+
+// NewURLPolicy 由配置项构造策略，CIDR 格式错误时返回错误
+func NewURLPolicy(schemes, allowHosts, denyHosts, allowCIDRs, denyCIDRs []string, allowCrossOrigin bool) (*URLPolicy, error) {
+	p := &URLPolicy{
+		Schemes:                  lowerAll(schemes),
+		AllowHosts:               lowerAll(allowHosts),
+		DenyHosts:                lowerAll(denyHosts),
+		AllowCrossOriginEndpoint: allowCrossOrigin,
+	}
+	var err error
+	if p.AllowCIDRs, err = parseCIDRs(allowCIDRs); err != nil {
+		return nil, err
+	}
+	if p.DenyCIDRs, err = parseCIDRs(denyCIDRs); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DefaultURLPolicy 允许 http/https，禁止 DefaultDenyCIDRs；本机与内网地址默认放行（本地 MCP 服务器常用）
+func DefaultURLPolicy() *URLPolicy {
+	p, _ := NewURLPolicy([]string{"http", "https"}, nil, nil, nil, DefaultDenyCIDRs, false)
+	return p
+}
+
+func lowerAll(list []string) []string {
+	var out []string
+	for _, s := range list {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+var (
+	policyMu      sync.RWMutex
+	currentPolicy = DefaultURLPolicy()
+)
+
+// SetURLPolicy 设置全局出站 URL 策略（服务启动时由配置调用）
+func SetURLPolicy(p *URLPolicy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	currentPolicy = p
+}
+
+// Policy 返回当前出站 URL 策略
+func Policy() *URLPolicy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return currentPolicy
+}
+
+// CheckURL 静态检查 URL：协议、主机名黑白名单；主机为 IP 字面量时同时检查网段
+func (p *URLPolicy) CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return &PolicyError{Reason: "无法解析 URL：" + err.Error()}
+	}
+	return p.checkParsed(u)
+}
+
+func (p *URLPolicy) checkParsed(u *url.URL) error {
+	scheme := strings.ToLower(u.Scheme)
+	if len(p.Schemes) > 0 && !containsString(p.Schemes, scheme) {
+		return &PolicyError{Reason: fmt.Sprintf("不允许的协议 %q（允许：%s）", u.Scheme, strings.Join(p.Schemes, ", "))}
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return &PolicyError{Reason: "URL 缺少主机"}
+	}
+	for _, pattern := range p.DenyHosts {
+		if hostMatches(host, pattern) {
+			return &PolicyError{Reason: fmt.Sprintf("主机 %s 在禁止列表中", host)}
+		}
+	}
+	if len(p.AllowHosts) > 0 {
+		allowed := false
+		for _, pattern := range p.AllowHosts {
+			if hostMatches(host, pattern) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &PolicyError{Reason: fmt.Sprintf("主机 %s 不在允许列表中", host)}
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return p.checkIP(ip)
+	}
+	return nil
+}
+
+// hostMatches 精确匹配，或 *.example.com / .example.com 匹配其子域
+func hostMatches(host, pattern string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		pattern = pattern[1:]
+	}
+	if strings.HasPrefix(pattern, ".") {
+		return strings.HasSuffix(host, pattern) || host == pattern[1:]
+	}
+	return host == pattern
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIP 网段检查：禁止列表优先，其次要求命中允许列表（若配置）
+func (p *URLPolicy) checkIP(ip net.IP) error {
+	for _, n := range p.DenyCIDRs {
+		if n.Contains(ip) {
+			return &PolicyError{Reason: fmt.Sprintf("地址 %s 属于禁止网段 %s", ip, n)}
+		}
+	}
+	if len(p.AllowCIDRs) > 0 {
+		for _, n := range p.AllowCIDRs {
+			if n.Contains(ip) {
+				return nil
+			}
+		}
+		return &PolicyError{Reason: fmt.Sprintf("地址 %s 不在允许网段内", ip)}
+	}
+	return nil
+}
+
+// CheckEndpoint 检查 SSE endpoint 事件给出的 POST 地址：须通过 CheckURL，且默认须与服务器地址同源
+func (p *URLPolicy) CheckEndpoint(serverURL, endpoint string) error {
+	if err := p.CheckURL(endpoint); err != nil {
+		return err
+	}
+	if p.AllowCrossOriginEndpoint {
+		return nil
+	}
+	base, err1 := url.Parse(serverURL)
+	ep, err2 := url.Parse(endpoint)
+	if err1 != nil || err2 != nil {
+		return &PolicyError{Reason: "无法解析 endpoint"}
+	}
+	if !sameOrigin(base, ep) {
+		return &PolicyError{Reason: fmt.Sprintf("endpoint %s 与服务器地址不同源", ep.Scheme+"://"+ep.Host)}
+	}
+	return nil
+}
+
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Hostname(), b.Hostname()) && effectivePort(a) == effectivePort(b)
+}
+
+func effectivePort(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+	if strings.EqualFold(u.Scheme, "https") {
+		return "443"
+	}
+	return "80"
+}
+
+// HTTPClient 返回受策略约束的 HTTP 客户端：连接前检查实际 IP，重定向时重新检查 URL。
+// 不使用环境代理，避免绕过 IP 检查；同一策略的客户端共享连接池
+func (p *URLPolicy) HTTPClient(timeout time.Duration) *http.Client {
+	p.transportOnce.Do(p.initTransport)
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: p.transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return p.checkParsed(req.URL)
+		},
+	}
+}
+
+func (p *URLPolicy) initTransport() {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return &PolicyError{Reason: "无法识别的连接地址 " + address}
+			}
+			return p.checkIP(ip)
+		},
+	}
+	p.transport = &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// httpClient 当前策略下的 HTTP 客户端
+func httpClient(timeout time.Duration) *http.Client {
+	return Policy().HTTPClient(timeout)
+}
+
+// policyFailure 把策略错误转换为 failed 检查结果；非策略错误返回 nil
+func policyFailure(err error) *CheckResult {
+	if pe := AsPolicyError(err); pe != nil {
+		return &CheckResult{Status: "failed", Error: pe.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// listPageLimit 分页列举的最大页数，防止服务器返回循环游标
+const listPageLimit = 20
+
+// Resource MCP resources/list 中的一项
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceContent resources/read 返回的一段内容；文本在 Text，二进制为 base64 的 Blob
+type ResourceContent struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// Prompt MCP prompts/list 中的一项
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptMessage prompts/get 返回的消息；content 为 text、image 或内嵌 resource
+type PromptMessage struct {
+	Role    string `json:"role"`
+	Content struct {
+		Type     string           `json:"type"`
+		Text     string           `json:"text,omitempty"`
+		Resource *ResourceContent `json:"resource,omitempty"`
+	} `json:"content"`
+}
+
+// PromptResult prompts/get 的结果
+type PromptResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+// Text 把提示词消息拼接为一段文本，用作会话的起始消息
+func (r *PromptResult) Text() string {
+	var parts []string
+	for _, m := range r.Messages {
+		switch {
+		case m.Content.Text != "":
+			parts = append(parts, m.Content.Text)
+		case m.Content.Resource != nil && m.Content.Resource.Text != "":
+			parts = append(parts, m.Content.Resource.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// ListResources 列举服务器的全部资源（自动翻页）
+func ListResources(ctx context.Context, c Caller) ([]Resource, error) {
+	var out []Resource
+	err := listPaged(ctx, c, "resources/list", func(raw json.RawMessage) (string, error) {
+		var page struct {
+			Resources  []Resource `json:"resources"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return "", err
+		}
+		out = append(out, page.Resources...)
+		return page.NextCursor, nil
+	})
+	return out, err
+}
+
+// ReadResource 读取一个资源的内容
+func ReadResource(ctx context.Context, c Caller, uri string) ([]ResourceContent, error) {
+	raw, err := c.Call(ctx, "resources/read", map[string]any{"uri": uri})
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Contents []ResourceContent `json:"contents"`
+	}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return nil, err
+	}
+	return res.Contents, nil
+}
+
+// ListPrompts 列举服务器的全部提示词模板（自动翻页）
+func ListPrompts(ctx context.Context, c Caller) ([]Prompt, error) {
+	var out []Prompt
+	err := listPaged(ctx, c, "prompts/list", func(raw json.RawMessage) (string, error) {
+		var page struct {
+			Prompts    []Prompt `json:"prompts"`
+			NextCursor string   `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return "", err
+		}
+		out = append(out, page.Prompts...)
+		return page.NextCursor, nil
+	})
+	return out, err
+}
+
+// GetPrompt 以给定参数渲染提示词模板
+func GetPrompt(ctx context.Context, c Caller, name string, args map[string]string) (*PromptResult, error) {
+	params := map[string]any{"name": name}
+	if len(args) > 0 {
+		params["arguments"] = args
+	}
+	raw, err := c.Call(ctx, "prompts/get", params)
+	if err != nil {
+		return nil, err
+	}
+	var res PromptResult
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func listPaged(ctx context.Context, c Caller, method string, page func(json.RawMessage) (string, error)) error {
+	cursor := ""
+	for i := 0; i < listPageLimit; i++ {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		raw, err := c.Call(ctx, method, params)
+		if err != nil {
+			return err
+		}
+		next, err := page(raw)
+		if err != nil {
+			return err
+		}
+		if next == "" || next == cursor {
+			return nil
+		}
+		cursor = next
+	}
+	return nil
+}
+
+// IsMethodNotFound 服务器未实现该能力（JSON-RPC -32601）
+func IsMethodNotFound(err error) bool {
+	e, ok := err.(*rpcError)
+	return ok && e.Code == -32601
+}
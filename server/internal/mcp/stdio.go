@@ -0,0 +1,523 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"agentic-demo/server/internal/registry"
+)
+
+const (
+	restartBackoffMin = time.Second
+	restartBackoffMax = 30 * time.Second
+	stableRunDuration = time.Minute // 进程运行超过该时长视为稳定，重置退避
+	stopGracePeriod   = 3 * time.Second
+	stdioCallTimeout  = 30 * time.Second
+	stderrLogLines    = 500
+)
+
+// stdio 进程状态
+const (
+	ProcessStarting = "starting" // 已拉起，尚未完成 initialize
+	ProcessRunning  = "running"  // 已完成 initialize，可接收请求
+	ProcessBackoff  = "backoff"  // 崩溃后等待重启
+	ProcessStopped  = "stopped"
+)
+
+var ErrProcessNotRunning = errors.New("mcp stdio process not running")
+
+// StdioConfig stdio 服务器的启动参数
+type StdioConfig struct {
+	Command string
+	Args    []string
+	Env     map[string]string
+	Dir     string
+}
+
+// LogLine 一行 stderr 输出
+type LogLine struct {
+	Time int64  `json:"time"`
+	Text string `json:"text"`
+}
+
+// ProcessStatus stdio 进程的运行状态快照
+type ProcessStatus struct {
+	State     string `json:"state"`
+	PID       int    `json:"pid,omitempty"`
+	Restarts  int    `json:"restarts"`
+	StartedAt int64  `json:"startedAt,omitempty"`
+	LastExit  string `json:"lastExit,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// ErrorClass 按 JSON-RPC 错误码归类：参数错误与方法或工具不存在之外都视为上游错误
+func (e *rpcError) ErrorClass() string {
+	switch e.Code {
+	case -32602:
+		return registry.ErrInvalidArgs
+	case -32601:
+		return registry.ErrNotFound
+	}
+	return registry.ErrUpstream
+}
+
+// rpcMessage 兼容响应、通知与服务端发起的请求
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// StdioProcess 托管一个 stdio MCP 服务器：拉起子进程、完成 initialize 握手、
+// 按行收发 JSON-RPC、采集 stderr，并在进程崩溃后按指数退避重启
+type StdioProcess struct {
+	id  string
+	cfg StdioConfig
+
+	mu      sync.Mutex
+	stdin   io.WriteCloser
+	cmd     *exec.Cmd
+	pending map[int64]chan rpcMessage
+	nextID  int64
+	status  ProcessStatus
+	ready   chan struct{} // 当前这一轮进程完成 initialize 后关闭
+	stopped bool
+	stopCh  chan struct{}
+	done    chan struct{}
+
+	onNotify func(method string, params json.RawMessage)
+
+	writeMu sync.Mutex
+
+	logMu sync.Mutex
+	logs  []LogLine
+}
+
+func newStdioProcess(id string, cfg StdioConfig) *StdioProcess {
+	return &StdioProcess{
+		id:      id,
+		cfg:     cfg,
+		pending: make(map[int64]chan rpcMessage),
+		status:  ProcessStatus{State: ProcessStarting},
+		ready:   make(chan struct{}),
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Status 返回进程状态快照
+func (p *StdioProcess) Status() ProcessStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+// Logs 返回最近的 stderr 输出，limit<=0 时返回全部缓存
+func (p *StdioProcess) Logs(limit int) []LogLine {
+	p.logMu.Lock()
+	defer p.logMu.Unlock()
+	start := 0
+	if limit > 0 && len(p.logs) > limit {
+		start = len(p.logs) - limit
+	}
+	out := make([]LogLine, len(p.logs)-start)
+	copy(out, p.logs[start:])
+	return out
+}
+
+func (p *StdioProcess) appendLog(text string) {
+	p.logMu.Lock()
+	defer p.logMu.Unlock()
+	p.logs = append(p.logs, LogLine{Time: time.Now().UnixMilli(), Text: text})
+	if len(p.logs) > stderrLogLines {
+		p.logs = p.logs[len(p.logs)-stderrLogLines:]
+	}
+}
+
+// Call 等待进程就绪后发送 JSON-RPC 请求并返回 result
+func (p *StdioProcess) Call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	p.mu.Lock()
+	ready := p.ready
+	stopped := p.stopped
+	p.mu.Unlock()
+	if stopped {
+		return nil, ErrProcessNotRunning
+	}
+	ctx, cancel := context.WithTimeout(ctx, stdioCallTimeout)
+	defer cancel()
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: process not ready: %w", method, ctx.Err())
+	}
+	return p.call(ctx, method, params)
+}
+
+func (p *StdioProcess) call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	p.mu.Lock()
+	if p.stdin == nil {
+		p.mu.Unlock()
+		return nil, ErrProcessNotRunning
+	}
+	p.nextID++
+	id := p.nextID
+	ch := make(chan rpcMessage, 1)
+	p.pending[id] = ch
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}()
+
+	if err := p.send(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(stdioCallTimeout)
+	defer timer.Stop()
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return nil, ErrProcessNotRunning
+		}
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%s: timeout after %s", method, stdioCallTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// SetNotificationHandler 设置服务端通知（如 notifications/tools/list_changed）的回调，进程重启后仍然有效
+func (p *StdioProcess) SetNotificationHandler(fn func(method string, params json.RawMessage)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onNotify = fn
+}
+
+// Notify 发送 JSON-RPC 通知（无 id、无响应）
+func (p *StdioProcess) Notify(method string, params any) error {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		msg["params"] = params
+	}
+	return p.send(msg)
+}
+
+func (p *StdioProcess) send(msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	w := p.stdin
+	p.mu.Unlock()
+	if w == nil {
+		return ErrProcessNotRunning
+	}
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	_, err = w.Write(append(body, '\n'))
+	return err
+}
+
+// supervise 进程守护循环：退出后按指数退避重启，直到 stop 被调用
+func (p *StdioProcess) supervise() {
+	defer close(p.done)
+	backoff := restartBackoffMin
+	for {
+		started := time.Now()
+		err := p.runOnce()
+		if p.isStopped() {
+			return
+		}
+		exit := "exited"
+		if err != nil {
+			exit = err.Error()
+		}
+		p.appendLog("[supervisor] process " + exit)
+		if time.Since(started) > stableRunDuration {
+			backoff = restartBackoffMin
+		}
+		p.mu.Lock()
+		p.status.State = ProcessBackoff
+		p.status.PID = 0
+		p.status.LastExit = exit
+		p.mu.Unlock()
+
+		select {
+		case <-time.After(backoff):
+		case <-p.stopCh:
+			return
+		}
+		backoff *= 2
+		if backoff > restartBackoffMax {
+			backoff = restartBackoffMax
+		}
+		p.mu.Lock()
+		p.status.Restarts++
+		p.mu.Unlock()
+	}
+}
+
+// runOnce 拉起一次子进程并阻塞至其退出
+func (p *StdioProcess) runOnce() error {
+	cmd := exec.Command(p.cfg.Command, p.cfg.Args...)
+	cmd.Dir = p.cfg.Dir
+	cmd.Env = os.Environ()
+	for k, v := range p.cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.cmd = cmd
+	p.stdin = stdin
+	select {
+	case <-p.ready:
+		// 上一轮进程已就绪过，重启后需要重新等待 initialize
+		p.ready = make(chan struct{})
+	default:
+	}
+	p.status.State = ProcessStarting
+	p.status.PID = cmd.Process.Pid
+	p.status.StartedAt = time.Now().UnixMilli()
+	ready := p.ready
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(stderr)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			p.appendLog(scanner.Text())
+		}
+	}()
+	go p.initialize(ready)
+
+	p.readLoop(stdout)
+	wg.Wait()
+	waitErr := cmd.Wait()
+
+	p.mu.Lock()
+	p.stdin = nil
+	p.cmd = nil
+	for id, ch := range p.pending {
+		close(ch)
+		delete(p.pending, id)
+	}
+	p.mu.Unlock()
+	return waitErr
+}
+
+// initialize 完成 MCP 握手后标记就绪；失败时终止进程交由守护循环重启
+func (p *StdioProcess) initialize(ready chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	_, err := p.call(ctx, "initialize", map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": clientName, "version": "1.0.0"},
+	})
+	if err == nil {
+		err = p.Notify("notifications/initialized", nil)
+	}
+	if err != nil {
+		p.appendLog("[supervisor] initialize failed: " + err.Error())
+		p.kill()
+		return
+	}
+	p.mu.Lock()
+	p.status.State = ProcessRunning
+	p.mu.Unlock()
+	close(ready)
+}
+
+func (p *StdioProcess) readLoop(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			p.appendLog("[stdout] " + string(line))
+			continue
+		}
+		switch {
+		case msg.Method != "" && len(msg.ID) > 0:
+			p.replyToServerRequest(msg)
+		case msg.Method != "":
+			p.mu.Lock()
+			fn := p.onNotify
+			p.mu.Unlock()
+			if fn != nil {
+				go fn(msg.Method, msg.Params)
+			}
+		default:
+			var id int64
+			if err := json.Unmarshal(msg.ID, &id); err != nil {
+				continue
+			}
+			p.mu.Lock()
+			ch, ok := p.pending[id]
+			p.mu.Unlock()
+			if ok {
+				ch <- msg
+			}
+		}
+	}
+}
+
+// replyToServerRequest 响应服务端发起的请求：支持 ping，其余返回 method not found
+func (p *StdioProcess) replyToServerRequest(msg rpcMessage) {
+	resp := map[string]any{"jsonrpc": "2.0", "id": msg.ID}
+	if msg.Method == "ping" {
+		resp["result"] = map[string]any{}
+	} else {
+		resp["error"] = rpcError{Code: -32601, Message: "method not found: " + msg.Method}
+	}
+	_ = p.send(resp)
+}
+
+func (p *StdioProcess) isStopped() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopped
+}
+
+func (p *StdioProcess) kill() {
+	p.mu.Lock()
+	cmd := p.cmd
+	p.mu.Unlock()
+	if cmd != nil && cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+}
+
+// stop 关闭 stdin 请求进程退出，超过宽限期后强制结束
+func (p *StdioProcess) stop() {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		<-p.done
+		return
+	}
+	p.stopped = true
+	close(p.stopCh)
+	stdin := p.stdin
+	p.mu.Unlock()
+
+	if stdin != nil {
+		_ = stdin.Close()
+	}
+	select {
+	case <-p.done:
+	case <-time.After(stopGracePeriod):
+		p.kill()
+		<-p.done
+	}
+	p.mu.Lock()
+	p.status.State = ProcessStopped
+	p.status.PID = 0
+	p.mu.Unlock()
+}
+
+// ProcessManager 管理所有 stdio MCP 服务器进程，key 为服务器 ID
+type ProcessManager struct {
+	mu    sync.Mutex
+	procs map[string]*StdioProcess
+}
+
+func NewProcessManager() *ProcessManager {
+	return &ProcessManager{procs: make(map[string]*StdioProcess)}
+}
+
+// Start 拉起指定服务器的进程；若已在运行则先停止旧进程
+func (m *ProcessManager) Start(id string, cfg StdioConfig) {
+	m.Stop(id)
+	p := newStdioProcess(id, cfg)
+	m.mu.Lock()
+	m.procs[id] = p
+	m.mu.Unlock()
+	go p.supervise()
+}
+
+// Stop 停止并移除指定服务器的进程
+func (m *ProcessManager) Stop(id string) {
+	m.mu.Lock()
+	p := m.procs[id]
+	delete(m.procs, id)
+	m.mu.Unlock()
+	if p != nil {
+		p.stop()
+	}
+}
+
+// StopAll 停止全部进程（服务关闭时调用）
+func (m *ProcessManager) StopAll() {
+	m.mu.Lock()
+	procs := make([]*StdioProcess, 0, len(m.procs))
+	for id, p := range m.procs {
+		procs = append(procs, p)
+		delete(m.procs, id)
+	}
+	m.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, p := range procs {
+		wg.Add(1)
+		go func(p *StdioProcess) {
+			defer wg.Done()
+			p.stop()
+		}(p)
+	}
+	wg.Wait()
+}
+
+// Get 获取指定服务器的进程，不存在时返回 nil
+func (m *ProcessManager) Get(id string) *StdioProcess {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.procs[id]
+}
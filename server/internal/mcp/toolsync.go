@@ -0,0 +1,394 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"agentic-demo/server/internal/registry"
+	"agentic-demo/server/internal/store"
+
+	"google.golang.org/genai"
+)
+
+const (
+	notifyToolsChanged = "notifications/tools/list_changed"
+	// maxToolIDLen Gemini 函数名长度上限
+	maxToolIDLen = 64
+)
+
+var toolNameSanitizer = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// ToolID MCP 工具在 registry 中的 ID，与前端约定一致：mcp_<serverId>__<toolName>。
+// 超长时截断并追加完整名称的短哈希，避免前缀相同的工具得到同一 ID
+func ToolID(serverID, toolName string) string {
+	id := "mcp_" + serverID + "__" + toolNameSanitizer.ReplaceAllString(toolName, "_")
+	if len(id) > maxToolIDLen {
+		sum := sha1.Sum([]byte(serverID + "\x00" + toolName))
+		suffix := "_" + hex.EncodeToString(sum[:4])
+		id = id[:maxToolIDLen-len(suffix)] + suffix
+	}
+	return id
+}
+
+// Tool MCP tools/list 中的一项
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+}
+
+// ToolsChange 一次工具集变更，推送给订阅者
+type ToolsChange struct {
+	ServerID   string   `json:"serverId"`
+	Added      []string `json:"added,omitempty"`
+	Removed    []string `json:"removed,omitempty"`
+	Updated    []string `json:"updated,omitempty"`
+	ToolsCount int      `json:"toolsCount"`
+	At         int64    `json:"at"`
+}
+
+// toolConn 与一个服务器的长连接
+type toolConn struct {
+	caller  Caller
+	closeFn func()
+	session *HTTPSession // http 服务器的会话；stdio 为 nil
+}
+
+// ToolSync 把已连接 MCP 服务器的工具实时注册到 registry：
+// 保持长连接并监听 notifications/tools/list_changed，收到后重新 tools/list、与已注册集合比对、增删工具并广播变更
+type ToolSync struct {
+	servers *store.McpStore
+	status  *store.McpStatusStore
+	procs   *ProcessManager
+	reg     *registry.Registry
+
+	mu      sync.Mutex
+	conns   map[string]*toolConn
+	tools   map[string]map[string]Tool // serverID -> registry ID -> 工具
+	syncing map[string]*sync.Mutex     // 每个服务器串行同步
+
+	subMu sync.Mutex
+	subs  map[chan ToolsChange]struct{}
+}
+
+func NewToolSync(servers *store.McpStore, status *store.McpStatusStore, procs *ProcessManager, reg *registry.Registry) *ToolSync {
+	return &ToolSync{
+		servers: servers,
+		status:  status,
+		procs:   procs,
+		reg:     reg,
+		conns:   make(map[string]*toolConn),
+		tools:   make(map[string]map[string]Tool),
+		syncing: make(map[string]*sync.Mutex),
+		subs:    make(map[chan ToolsChange]struct{}),
+	}
+}
+
+// Subscribe 订阅工具集变更；返回的函数用于取消订阅。订阅者处理过慢时丢弃事件
+func (t *ToolSync) Subscribe() (<-chan ToolsChange, func()) {
+	ch := make(chan ToolsChange, 16)
+	t.subMu.Lock()
+	t.subs[ch] = struct{}{}
+	t.subMu.Unlock()
+	return ch, func() {
+		t.subMu.Lock()
+		if _, ok := t.subs[ch]; ok {
+			delete(t.subs, ch)
+			close(ch)
+		}
+		t.subMu.Unlock()
+	}
+}
+
+func (t *ToolSync) broadcast(c ToolsChange) {
+	t.subMu.Lock()
+	defer t.subMu.Unlock()
+	for ch := range t.subs {
+		select {
+		case ch <- c:
+		default:
+		}
+	}
+}
+
+func (t *ToolSync) serverLock(id string) *sync.Mutex {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.syncing[id]
+	if !ok {
+		l = &sync.Mutex{}
+		t.syncing[id] = l
+	}
+	return l
+}
+
+// Sync 确保与服务器保持连接并同步其工具；由健康检查成功后与收到 list_changed 通知时调用
+func (t *ToolSync) Sync(ctx context.Context, svr store.McpServer) error {
+	l := t.serverLock(svr.ID)
+	l.Lock()
+	defer l.Unlock()
+
+	conn, err := t.connection(svr)
+	if err != nil {
+		return err
+	}
+	list, err := t.listTools(ctx, conn.caller)
+	if err != nil {
+		// 连接可能已失效：断开后下次重连，已注册工具保留到检查失败或服务器删除
+		t.disconnect(svr.ID)
+		return err
+	}
+	t.apply(svr.ID, list)
+	return nil
+}
+
+// connection 返回服务器的现有长连接，失效时新建并订阅通知
+func (t *ToolSync) connection(svr store.McpServer) (*toolConn, error) {
+	t.mu.Lock()
+	conn := t.conns[svr.ID]
+	t.mu.Unlock()
+	if conn != nil && t.alive(svr.ID, conn) {
+		return conn, nil
+	}
+	t.disconnect(svr.ID)
+	caller, closeFn, err := Connect(context.Background(), svr, t.procs)
+	if err != nil {
+		return nil, err
+	}
+	conn = &toolConn{caller: caller, closeFn: closeFn}
+	id := svr.ID
+	onNotify := func(method string, _ json.RawMessage) {
+		if method == notifyToolsChanged {
+			t.onListChanged(id)
+		}
+	}
+	switch c := caller.(type) {
+	case *HTTPSession:
+		conn.session = c
+		c.Listen(onNotify)
+	case *StdioProcess:
+		c.SetNotificationHandler(onNotify)
+	}
+	t.mu.Lock()
+	t.conns[id] = conn
+	t.mu.Unlock()
+	return conn, nil
+}
+
+// alive 判断连接是否可用：http 会话未关闭，stdio 仍是当前托管的进程
+func (t *ToolSync) alive(serverID string, conn *toolConn) bool {
+	if conn.session != nil {
+		return !conn.session.Done()
+	}
+	p, ok := conn.caller.(*StdioProcess)
+	return ok && t.procs != nil && t.procs.Get(serverID) == p
+}
+
+func (t *ToolSync) onListChanged(serverID string) {
+	svr, _ := t.servers.Get(serverID)
+	if svr == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	_ = t.Sync(ctx, *svr)
+}
+
+func (t *ToolSync) listTools(ctx context.Context, c Caller) ([]Tool, error) {
+	var out []Tool
+	err := listPaged(ctx, c, "tools/list", func(raw json.RawMessage) (string, error) {
+		var page struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return "", err
+		}
+		out = append(out, page.Tools...)
+		return page.NextCursor, nil
+	})
+	return out, err
+}
+
+// apply 比对新旧工具集，增删改 registry 并广播变更
+func (t *ToolSync) apply(serverID string, list []Tool) {
+	next := make(map[string]Tool, len(list))
+	for _, tool := range list {
+		next[ToolID(serverID, tool.Name)] = tool
+	}
+	t.mu.Lock()
+	prev := t.tools[serverID]
+	t.tools[serverID] = next
+	t.mu.Unlock()
+
+	change := ToolsChange{ServerID: serverID, ToolsCount: len(next), At: time.Now().UnixMilli()}
+	for id, tool := range next {
+		old, existed := prev[id]
+		if existed && old.Description == tool.Description && string(old.InputSchema) == string(tool.InputSchema) {
+			continue
+		}
+		t.reg.RegisterExternal(id, registry.SourceMcp, toolDeclaration(id, tool), t.executor(serverID, tool.Name))
+		if existed {
+			change.Updated = append(change.Updated, id)
+		} else {
+			change.Added = append(change.Added, id)
+		}
+	}
+	for id := range prev {
+		if _, ok := next[id]; !ok {
+			t.reg.Unregister(id)
+			change.Removed = append(change.Removed, id)
+		}
+	}
+	if t.status != nil {
+		t.status.SetToolsCount(serverID, len(next))
+	}
+	if len(change.Added)+len(change.Removed)+len(change.Updated) > 0 {
+		sort.Strings(change.Added)
+		sort.Strings(change.Removed)
+		sort.Strings(change.Updated)
+		t.broadcast(change)
+	}
+}
+
+// Remove 注销服务器的全部工具并断开连接（服务器删除或检查失败时）
+func (t *ToolSync) Remove(serverID string) {
+	l := t.serverLock(serverID)
+	l.Lock()
+	defer l.Unlock()
+	t.disconnect(serverID)
+	t.mu.Lock()
+	prev := t.tools[serverID]
+	delete(t.tools, serverID)
+	t.mu.Unlock()
+	if len(prev) == 0 {
+		return
+	}
+	change := ToolsChange{ServerID: serverID, At: time.Now().UnixMilli()}
+	for id := range prev {
+		t.reg.Unregister(id)
+		change.Removed = append(change.Removed, id)
+	}
+	sort.Strings(change.Removed)
+	t.broadcast(change)
+}
+
+// Disconnect 断开服务器连接（配置变更后），已注册工具保留，下次同步或调用时按新配置重连
+func (t *ToolSync) Disconnect(serverID string) {
+	l := t.serverLock(serverID)
+	l.Lock()
+	defer l.Unlock()
+	t.disconnect(serverID)
+}
+
+// disconnect 关闭连接但保留已注册工具
+func (t *ToolSync) disconnect(serverID string) {
+	t.mu.Lock()
+	conn := t.conns[serverID]
+	delete(t.conns, serverID)
+	t.mu.Unlock()
+	if conn != nil && conn.closeFn != nil {
+		conn.closeFn()
+	}
+}
+
+// Close 断开所有连接（进程退出时）
+func (t *ToolSync) Close() {
+	t.mu.Lock()
+	all := t.conns
+	t.conns = make(map[string]*toolConn)
+	t.mu.Unlock()
+	for _, conn := range all {
+		if conn.closeFn != nil {
+			conn.closeFn()
+		}
+	}
+}
+
+// executor 通过服务器的长连接执行 tools/call；连接失效时重连一次
+func (t *ToolSync) executor(serverID, toolName string) registry.Executor {
+	return func(req registry.ExecuteRequest, args json.RawMessage) (interface{}, error) {
+		svr, _ := t.servers.Get(serverID)
+		if svr == nil {
+			return nil, registry.NewToolError(registry.ErrNotFound, fmt.Errorf("mcp server not found: %s", serverID))
+		}
+		var arguments map[string]any
+		if len(args) > 0 {
+			if err := json.Unmarshal(args, &arguments); err != nil {
+				return nil, registry.NewToolError(registry.ErrInvalidArgs, err)
+			}
+		}
+		if arguments == nil {
+			arguments = map[string]any{}
+		}
+		l := t.serverLock(serverID)
+		l.Lock()
+		conn, err := t.connection(*svr)
+		l.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		raw, err := conn.caller.Call(req.Ctx, "tools/call", map[string]any{"name": toolName, "arguments": arguments})
+		if err != nil {
+			return nil, err
+		}
+		return callToolResult(raw)
+	}
+}
+
+// callToolResult 解析 CallToolResult：拼接文本内容，isError 时作为错误返回
+func callToolResult(raw json.RawMessage) (interface{}, error) {
+	var res struct {
+		Content []struct {
+			Type     string           `json:"type"`
+			Text     string           `json:"text,omitempty"`
+			MimeType string           `json:"mimeType,omitempty"`
+			Resource *ResourceContent `json:"resource,omitempty"`
+		} `json:"content"`
+		StructuredContent any  `json:"structuredContent,omitempty"`
+		IsError           bool `json:"isError"`
+	}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return nil, err
+	}
+	var parts []string
+	for _, c := range res.Content {
+		switch {
+		case c.Text != "":
+			parts = append(parts, c.Text)
+		case c.Resource != nil && c.Resource.Text != "":
+			parts = append(parts, c.Resource.Text)
+		case c.Type != "text":
+			parts = append(parts, fmt.Sprintf("[%s %s]", c.Type, c.MimeType))
+		}
+	}
+	text := strings.Join(parts, "\n")
+	if res.IsError {
+		return nil, fmt.Errorf("%s", text)
+	}
+	out := map[string]interface{}{"content": text}
+	if res.StructuredContent != nil {
+		out["structuredContent"] = res.StructuredContent
+	}
+	return out, nil
+}
+
+func toolDeclaration(id string, tool Tool) *genai.FunctionDeclaration {
+	var schema any
+	if len(tool.InputSchema) > 0 {
+		_ = json.Unmarshal(tool.InputSchema, &schema)
+	}
+	return &genai.FunctionDeclaration{
+		Name:        id,
+		Description: tool.Description,
+		Parameters:  registry.SchemaFromJSON(schema),
+	}
+}
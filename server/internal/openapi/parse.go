@@ -0,0 +1,368 @@
+// Package openapi 解析 OpenAPI 3 文档，把选中的操作转换为 registry 工具并负责执行
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// refMaxDepth $ref 连续展开的最大层数，超过或遇到循环引用时以空对象代替
+const refMaxDepth = 12
+
+var methods = []string{"get", "put", "post", "delete", "patch", "head", "options"}
+
+// Document 解析后的 OpenAPI 文档
+type Document struct {
+	Title           string           `json:"title"`
+	Version         string           `json:"version"`
+	Description     string           `json:"description,omitempty"`
+	Servers         []string         `json:"servers"`
+	SecuritySchemes []SecurityScheme `json:"securitySchemes,omitempty"`
+	raw             map[string]any
+}
+
+// SecurityScheme 文档声明的鉴权方式，供管理员配置文档级鉴权时参考
+type SecurityScheme struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`             // apiKey | http | oauth2 | openIdConnect
+	Scheme string `json:"scheme,omitempty"` // http: bearer | basic
+	In     string `json:"in,omitempty"`     // apiKey: header | query | cookie
+	Param  string `json:"param,omitempty"`  // apiKey 的参数名
+}
+
+// Param 操作的一个参数；Arg 为工具参数名（已清理为合法标识符并去重）
+type Param struct {
+	Name        string `json:"name"`
+	In          string `json:"in"` // path | query | header | cookie
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+	Arg         string `json:"arg"`
+	schema      any
+}
+
+// Operation 文档中的一个操作
+type Operation struct {
+	Key          string  `json:"key"` // "GET /pets/{id}"
+	Method       string  `json:"method"`
+	Path         string  `json:"path"`
+	OperationID  string  `json:"operationId,omitempty"`
+	Summary      string  `json:"summary,omitempty"`
+	Description  string  `json:"description,omitempty"`
+	Deprecated   bool    `json:"deprecated,omitempty"`
+	Params       []Param `json:"params"`
+	HasBody      bool    `json:"hasBody,omitempty"`
+	BodyRequired bool    `json:"bodyRequired,omitempty"`
+	// BodyArg 请求体对应的工具参数名，通常为 body
+	BodyArg         string `json:"bodyArg,omitempty"`
+	BodyType        string `json:"bodyType,omitempty"` // 请求体 Content-Type
+	bodySchema      any
+	bodyDescription string
+}
+
+// Parse 解析 JSON 格式的 OpenAPI 3 文档
+func Parse(data []byte) (*Document, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("仅支持 JSON 格式的 OpenAPI 文档：%v", err)
+	}
+	version, _ := raw["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		if _, ok := raw["swagger"]; ok {
+			return nil, fmt.Errorf("不支持 Swagger 2.0，请先转换为 OpenAPI 3")
+		}
+		return nil, fmt.Errorf("缺少 openapi 版本字段或版本不是 3.x")
+	}
+	if _, ok := raw["paths"].(map[string]any); !ok {
+		return nil, fmt.Errorf("文档缺少 paths")
+	}
+	doc := &Document{raw: raw}
+	if info, ok := raw["info"].(map[string]any); ok {
+		doc.Title, _ = info["title"].(string)
+		doc.Version, _ = info["version"].(string)
+		doc.Description, _ = info["description"].(string)
+	}
+	if servers, ok := raw["servers"].([]any); ok {
+		for _, s := range servers {
+			if m, ok := s.(map[string]any); ok {
+				doc.Servers = append(doc.Servers, serverURL(m))
+			}
+		}
+	}
+	if comps, ok := raw["components"].(map[string]any); ok {
+		if schemes, ok := comps["securitySchemes"].(map[string]any); ok {
+			for name, v := range schemes {
+				m, _ := doc.resolve(v, 0, nil).(map[string]any)
+				if m == nil {
+					continue
+				}
+				sc := SecurityScheme{Name: name}
+				sc.Type, _ = m["type"].(string)
+				sc.Scheme, _ = m["scheme"].(string)
+				sc.In, _ = m["in"].(string)
+				sc.Param, _ = m["name"].(string)
+				doc.SecuritySchemes = append(doc.SecuritySchemes, sc)
+			}
+			sort.Slice(doc.SecuritySchemes, func(i, j int) bool { return doc.SecuritySchemes[i].Name < doc.SecuritySchemes[j].Name })
+		}
+	}
+	return doc, nil
+}
+
+// serverURL 以变量默认值展开 server url 中的 {var}
+func serverURL(m map[string]any) string {
+	u, _ := m["url"].(string)
+	vars, _ := m["variables"].(map[string]any)
+	for name, v := range vars {
+		if vm, ok := v.(map[string]any); ok {
+			if def, ok := vm["default"].(string); ok {
+				u = strings.ReplaceAll(u, "{"+name+"}", def)
+			}
+		}
+	}
+	return u
+}
+
+// Operations 按路径与方法排序列出全部操作
+func (d *Document) Operations() []Operation {
+	paths, _ := d.raw["paths"].(map[string]any)
+	keys := make([]string, 0, len(paths))
+	for p := range paths {
+		keys = append(keys, p)
+	}
+	sort.Strings(keys)
+	var ops []Operation
+	for _, p := range keys {
+		item, _ := d.resolve(paths[p], 0, nil).(map[string]any)
+		if item == nil {
+			continue
+		}
+		common, _ := item["parameters"].([]any)
+		for _, m := range methods {
+			raw, ok := item[m].(map[string]any)
+			if !ok {
+				continue
+			}
+			ops = append(ops, d.operation(strings.ToUpper(m), p, raw, common))
+		}
+	}
+	return ops
+}
+
+// Operation 按 key 查找操作
+func (d *Document) Operation(key string) (Operation, bool) {
+	for _, op := range d.Operations() {
+		if op.Key == key {
+			return op, true
+		}
+	}
+	return Operation{}, false
+}
+
+var argSanitizer = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func (d *Document) operation(method, path string, raw map[string]any, common []any) Operation {
+	op := Operation{Key: method + " " + path, Method: method, Path: path}
+	op.OperationID, _ = raw["operationId"].(string)
+	op.Summary, _ = raw["summary"].(string)
+	op.Description, _ = raw["description"].(string)
+	op.Deprecated, _ = raw["deprecated"].(bool)
+
+	// 操作级参数覆盖路径级同名同位置参数
+	byKey := map[string]map[string]any{}
+	var order []string
+	for _, list := range [][]any{common, toList(raw["parameters"])} {
+		for _, p := range list {
+			m, _ := d.resolve(p, 0, nil).(map[string]any)
+			if m == nil {
+				continue
+			}
+			name, _ := m["name"].(string)
+			in, _ := m["in"].(string)
+			if name == "" || in == "" {
+				continue
+			}
+			k := in + ":" + name
+			if _, seen := byKey[k]; !seen {
+				order = append(order, k)
+			}
+			byKey[k] = m
+		}
+	}
+	used := map[string]bool{}
+	for _, k := range order {
+		m := byKey[k]
+		p := Param{}
+		p.Name, _ = m["name"].(string)
+		p.In, _ = m["in"].(string)
+		p.Required, _ = m["required"].(bool)
+		p.Description, _ = m["description"].(string)
+		if p.In == "path" {
+			p.Required = true
+		}
+		p.schema = m["schema"]
+		p.Arg = uniqueArg(used, argSanitizer.ReplaceAllString(p.Name, "_"), p.In)
+		op.Params = append(op.Params, p)
+	}
+
+	if rb, ok := d.resolve(raw["requestBody"], 0, nil).(map[string]any); ok {
+		content, _ := rb["content"].(map[string]any)
+		ct, media := pickMediaType(content)
+		if media != nil {
+			op.HasBody = true
+			op.BodyType = ct
+			op.BodyRequired, _ = rb["required"].(bool)
+			op.BodyArg = uniqueArg(used, "body", "request")
+			op.bodySchema = media["schema"]
+			op.bodyDescription, _ = rb["description"].(string)
+		}
+	}
+	return op
+}
+
+func toList(v any) []any {
+	list, _ := v.([]any)
+	return list
+}
+
+// uniqueArg 参数名冲突时以位置前缀区分
+func uniqueArg(used map[string]bool, name, in string) string {
+	if name == "" {
+		name = "param"
+	}
+	if !used[name] {
+		used[name] = true
+		return name
+	}
+	candidate := in + "_" + name
+	for i := 2; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s_%s_%d", in, name, i)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// pickMediaType 优先选择 JSON 请求体，其次表单
+func pickMediaType(content map[string]any) (string, map[string]any) {
+	var fallback string
+	for ct := range content {
+		lc := strings.ToLower(ct)
+		if strings.Contains(lc, "json") {
+			m, _ := content[ct].(map[string]any)
+			return ct, m
+		}
+		if lc == "application/x-www-form-urlencoded" {
+			fallback = ct
+		}
+	}
+	if fallback != "" {
+		m, _ := content[fallback].(map[string]any)
+		return fallback, m
+	}
+	return "", nil
+}
+
+// resolve 展开本地 $ref（#/...），合并 allOf，oneOf/anyOf 取第一项；返回新的值，不修改原文档
+func (d *Document) resolve(v any, depth int, stack map[string]bool) any {
+	if depth > refMaxDepth {
+		return map[string]any{"type": "object"}
+	}
+	switch x := v.(type) {
+	case map[string]any:
+		if ref, ok := x["$ref"].(string); ok {
+			if stack[ref] {
+				return map[string]any{"type": "object"}
+			}
+			target, ok := d.pointer(ref)
+			if !ok {
+				return map[string]any{"type": "object"}
+			}
+			next := map[string]bool{ref: true}
+			for k := range stack {
+				next[k] = true
+			}
+			return d.resolve(target, depth+1, next)
+		}
+		out := make(map[string]any, len(x))
+		for k, item := range x {
+			out[k] = d.resolve(item, depth, stack)
+		}
+		if all, ok := out["allOf"].([]any); ok {
+			delete(out, "allOf")
+			mergeAllOf(out, all)
+		}
+		for _, key := range []string{"oneOf", "anyOf"} {
+			if alts, ok := out[key].([]any); ok && len(alts) > 0 {
+				delete(out, key)
+				if first, ok := alts[0].(map[string]any); ok {
+					for k, v := range first {
+						if _, exists := out[k]; !exists {
+							out[k] = v
+						}
+					}
+				}
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(x))
+		for i, item := range x {
+			out[i] = d.resolve(item, depth, stack)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// mergeAllOf 把 allOf 子 Schema 的属性与必填项合并到 out
+func mergeAllOf(out map[string]any, all []any) {
+	props, _ := out["properties"].(map[string]any)
+	if props == nil {
+		props = map[string]any{}
+	}
+	required := toList(out["required"])
+	for _, item := range all {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		if p, ok := m["properties"].(map[string]any); ok {
+			for k, v := range p {
+				props[k] = v
+			}
+		}
+		required = append(required, toList(m["required"])...)
+		if _, ok := out["description"]; !ok {
+			if desc, ok := m["description"]; ok {
+				out["description"] = desc
+			}
+		}
+	}
+	out["type"] = "object"
+	out["properties"] = props
+	if len(required) > 0 {
+		out["required"] = required
+	}
+}
+
+// pointer 解析文档内 JSON Pointer 引用
+func (d *Document) pointer(ref string) (any, bool) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, false
+	}
+	var cur any = d.raw
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
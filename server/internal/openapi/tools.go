@@ -0,0 +1,329 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"agentic-demo/server/internal/httptool"
+	"agentic-demo/server/internal/mcp"
+	"agentic-demo/server/internal/registry"
+	"agentic-demo/server/internal/store"
+
+	"google.golang.org/genai"
+)
+
+const (
+	callTimeout = 30 * time.Second
+	// maxResponseBytes 单次调用响应体上限
+	maxResponseBytes = 2 << 20
+	// maxDescriptionLen 工具描述的最大长度
+	maxDescriptionLen = 1000
+	maxToolNameLen    = 64
+)
+
+var nameSanitizer = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// DefaultPrefix 由文档标题生成工具名前缀
+func DefaultPrefix(title string) string {
+	p := strings.Trim(strings.ToLower(nameSanitizer.ReplaceAllString(title, "_")), "_")
+	if p == "" || (p[0] >= '0' && p[0] <= '9') {
+		p = "api_" + p
+	}
+	if len(p) > 20 {
+		p = strings.TrimRight(p[:20], "_")
+	}
+	return p
+}
+
+// ToolNames 为文档的全部操作生成工具名：<prefix>_<operationId>（无 operationId 时由方法与路径生成），重名时追加序号
+func ToolNames(prefix string, ops []Operation) map[string]string {
+	names := make(map[string]string, len(ops))
+	used := map[string]bool{}
+	for _, op := range ops {
+		base := op.OperationID
+		if base == "" {
+			base = strings.ToLower(op.Method) + "_" + op.Path
+		}
+		name := strings.Trim(nameSanitizer.ReplaceAllString(prefix+"_"+base, "_"), "_")
+		if len(name) > maxToolNameLen {
+			name = name[:maxToolNameLen]
+		}
+		candidate := name
+		for i := 2; used[candidate]; i++ {
+			suffix := fmt.Sprintf("_%d", i)
+			if len(name)+len(suffix) > maxToolNameLen {
+				candidate = name[:maxToolNameLen-len(suffix)] + suffix
+			} else {
+				candidate = name + suffix
+			}
+		}
+		used[candidate] = true
+		names[op.Key] = candidate
+	}
+	return names
+}
+
+// Tool 一个待注册的操作
+type Tool struct {
+	Name      string
+	Operation Operation
+}
+
+// Tools 解析文档并返回 spec 中选中的操作；选中但文档中不存在的操作会被忽略
+func Tools(spec store.OpenAPISpec) ([]Tool, *Document, error) {
+	doc, err := Parse(spec.Document)
+	if err != nil {
+		return nil, nil, err
+	}
+	ops := doc.Operations()
+	names := ToolNames(spec.Prefix, ops)
+	selected := make(map[string]bool, len(spec.Operations))
+	for _, k := range spec.Operations {
+		selected[k] = true
+	}
+	var tools []Tool
+	for _, op := range ops {
+		if selected[op.Key] {
+			tools = append(tools, Tool{Name: names[op.Key], Operation: op})
+		}
+	}
+	return tools, doc, nil
+}
+
+// BaseURL 调用地址：优先使用 spec 配置，其次文档 servers[0]；相对地址视为未配置
+func BaseURL(spec store.OpenAPISpec, doc *Document) (string, error) {
+	base := spec.BaseURL
+	if base == "" && len(doc.Servers) > 0 {
+		base = doc.Servers[0]
+	}
+	u, err := url.Parse(base)
+	if base == "" || err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("文档未提供绝对的 servers 地址，请配置 baseUrl")
+	}
+	if err := mcp.Policy().CheckURL(base); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(base, "/"), nil
+}
+
+// Register 注册 spec 中选中的操作，返回注册的工具名；名称与其他来源或其他文档的工具冲突的操作跳过并通过 conflicts 返回
+func Register(reg *registry.Registry, spec store.OpenAPISpec) (registered, conflicts []string, err error) {
+	tools, doc, err := Tools(spec)
+	if err != nil || len(tools) == 0 {
+		return nil, nil, err
+	}
+	base, err := BaseURL(spec, doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, t := range tools {
+		if src, owner := reg.GetOwner(t.Name); src != "" && (src != registry.SourceOpenAPI || owner != spec.ID) {
+			conflicts = append(conflicts, t.Name)
+			continue
+		}
+		reg.RegisterOwned(t.Name, registry.SourceOpenAPI, spec.ID, Declaration(t), executor(spec, base, t.Operation))
+		registered = append(registered, t.Name)
+	}
+	return registered, conflicts, nil
+}
+
+// Unregister 注销 spec 注册过的全部工具，不影响其他文档注册的同名工具
+func Unregister(reg *registry.Registry, spec store.OpenAPISpec) {
+	reg.UnregisterOwned(registry.SourceOpenAPI, spec.ID)
+}
+
+// Declaration 参数与请求体 Schema 合并为一个对象参数；请求体放在 BodyArg 下
+func Declaration(t Tool) *genai.FunctionDeclaration {
+	op := t.Operation
+	props := map[string]any{}
+	var required []any
+	for _, p := range op.Params {
+		s, _ := p.schema.(map[string]any)
+		prop := make(map[string]any, len(s)+1)
+		for k, v := range s {
+			prop[k] = v
+		}
+		if p.Description != "" {
+			prop["description"] = p.Description
+		} else if _, ok := prop["description"]; !ok {
+			prop["description"] = p.In + " 参数 " + p.Name
+		}
+		if prop["type"] == nil && prop["properties"] == nil && prop["items"] == nil {
+			prop["type"] = "string"
+		}
+		props[p.Arg] = prop
+		if p.Required {
+			required = append(required, p.Arg)
+		}
+	}
+	if op.HasBody {
+		s, _ := op.bodySchema.(map[string]any)
+		body := make(map[string]any, len(s)+1)
+		for k, v := range s {
+			body[k] = v
+		}
+		if op.bodyDescription != "" {
+			body["description"] = op.bodyDescription
+		} else if _, ok := body["description"]; !ok {
+			body["description"] = "请求体"
+		}
+		props[op.BodyArg] = body
+		if op.BodyRequired {
+			required = append(required, op.BodyArg)
+		}
+	}
+	schema := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return &genai.FunctionDeclaration{
+		Name:        t.Name,
+		Description: describe(op),
+		Parameters:  registry.SchemaFromJSON(schema),
+	}
+}
+
+func describe(op Operation) string {
+	parts := []string{op.Method + " " + op.Path}
+	if op.Summary != "" {
+		parts = append(parts, op.Summary)
+	}
+	if op.Description != "" && op.Description != op.Summary {
+		parts = append(parts, op.Description)
+	}
+	if op.Deprecated {
+		parts = append(parts, "（已废弃）")
+	}
+	desc := strings.Join(parts, "：")
+	if r := []rune(desc); len(r) > maxDescriptionLen {
+		desc = string(r[:maxDescriptionLen]) + "..."
+	}
+	return desc
+}
+
+func executor(spec store.OpenAPISpec, base string, op Operation) registry.Executor {
+	auth := mcp.Auth{Headers: spec.Headers, Config: spec.Auth}
+	return func(req registry.ExecuteRequest, raw json.RawMessage) (interface{}, error) {
+		args := map[string]any{}
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return nil, registry.NewToolError(registry.ErrInvalidArgs, fmt.Errorf("invalid arguments: %w", err))
+			}
+		}
+		httpReq, err := buildRequest(req.Ctx, base, op, args, spec.Query)
+		if err != nil {
+			return nil, err
+		}
+		if err := auth.Apply(req.Ctx, httpReq); err != nil {
+			return nil, err
+		}
+		return httptool.Send(httpReq, callTimeout, maxResponseBytes, "")
+	}
+}
+
+// buildRequest 按参数位置组装请求：路径参数替换、查询参数（数组展开为重复键）、请求头、Cookie 与请求体
+func buildRequest(ctx context.Context, base string, op Operation, args map[string]any, extraQuery map[string]string) (*http.Request, error) {
+	path := op.Path
+	query := url.Values{}
+	headers := http.Header{}
+	var cookies []string
+	for _, p := range op.Params {
+		v, ok := args[p.Arg]
+		if !ok || v == nil {
+			if p.Required {
+				return nil, registry.NewToolError(registry.ErrInvalidArgs, fmt.Errorf("缺少必填参数 %s", p.Arg))
+			}
+			continue
+		}
+		switch p.In {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", url.PathEscape(scalar(v)))
+		case "query":
+			if list, ok := v.([]any); ok {
+				for _, item := range list {
+					query.Add(p.Name, scalar(item))
+				}
+			} else {
+				query.Set(p.Name, scalar(v))
+			}
+		case "header":
+			headers.Set(p.Name, strings.NewReplacer("\r", "", "\n", "").Replace(scalar(v)))
+		case "cookie":
+			cookies = append(cookies, p.Name+"="+url.QueryEscape(scalar(v)))
+		}
+	}
+	keys := make([]string, 0, len(extraQuery))
+	for k := range extraQuery {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		query.Set(k, extraQuery[k])
+	}
+	target := base + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	if err := mcp.Policy().CheckURL(target); err != nil {
+		return nil, err
+	}
+
+	var body *strings.Reader
+	if op.HasBody {
+		v, ok := args[op.BodyArg]
+		if !ok || v == nil {
+			if op.BodyRequired {
+				return nil, registry.NewToolError(registry.ErrInvalidArgs, fmt.Errorf("缺少必填参数 %s", op.BodyArg))
+			}
+		} else if strings.Contains(strings.ToLower(op.BodyType), "json") {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			body = strings.NewReader(string(data))
+			headers.Set("Content-Type", op.BodyType)
+		} else {
+			form := url.Values{}
+			if m, ok := v.(map[string]any); ok {
+				for k, item := range m {
+					form.Set(k, scalar(item))
+				}
+			}
+			body = strings.NewReader(form.Encode())
+			headers.Set("Content-Type", op.BodyType)
+		}
+	}
+	var httpReq *http.Request
+	var err error
+	if body != nil {
+		httpReq, err = http.NewRequestWithContext(ctx, op.Method, target, body)
+	} else {
+		httpReq, err = http.NewRequestWithContext(ctx, op.Method, target, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		httpReq.Header[k] = v
+	}
+	if len(cookies) > 0 {
+		httpReq.Header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	return httpReq, nil
+}
+
+// scalar 参数值的文本形式：字符串原样，其余按 JSON 编码
+func scalar(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
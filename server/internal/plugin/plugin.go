@@ -0,0 +1,369 @@
+// Package plugin 以外部可执行程序实现工具：参数以 JSON 写入 stdin，结果以 JSON 从 stdout 读取
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"agentic-demo/server/internal/registry"
+
+	"google.golang.org/genai"
+)
+
+const (
+	defaultTimeout     = 30 * time.Second
+	maxTimeout         = 10 * time.Minute
+	defaultOutputBytes = 1 << 20
+	maxOutputBytes     = 16 << 20
+	// maxStderrBytes stderr 只保留末尾这么多字节
+	maxStderrBytes = 16 << 10
+	killGrace      = 2 * time.Second
+)
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,63}$`)
+
+// baseEnv 子进程默认只继承这些变量；其余变量需在清单的 passEnv 中显式列出
+var baseEnv = []string{"PATH", "LANG", "LC_ALL", "TZ"}
+
+// Manifest 插件清单：配置目录下的一个 *.json 文件声明一个工具
+type Manifest struct {
+	Name           string            `json:"name"`
+	Description    string            `json:"description"`
+	Parameters     json.RawMessage   `json:"parameters,omitempty"` // JSON Schema
+	Command        string            `json:"command"`              // 相对路径相对于清单所在目录
+	Args           []string          `json:"args,omitempty"`
+	Dir            string            `json:"dir,omitempty"` // 工作目录，须位于插件目录内；默认清单所在目录
+	Env            map[string]string `json:"env,omitempty"`
+	PassEnv        []string          `json:"passEnv,omitempty"` // 允许从服务端继承的环境变量名
+	TimeoutMs      int               `json:"timeoutMs,omitempty"`
+	MaxOutputBytes int64             `json:"maxOutputBytes,omitempty"`
+
+	File string `json:"file"` // 清单文件路径（加载时填入）
+}
+
+// Status 一个清单的加载结果
+type Status struct {
+	File       string `json:"file"`
+	Name       string `json:"name,omitempty"`
+	Registered bool   `json:"registered"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Request 写入插件 stdin 的内容
+type Request struct {
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments"`
+	SessionID string          `json:"sessionId,omitempty"`
+}
+
+// Manager 从配置目录加载插件并注册到 registry；Reload 时先注销上一轮注册的工具
+type Manager struct {
+	dir string
+	reg *registry.Registry
+
+	mu       sync.Mutex
+	names    []string
+	statuses []Status
+}
+
+func NewManager(dir string, reg *registry.Registry) *Manager {
+	return &Manager{dir: dir, reg: reg, statuses: []Status{}}
+}
+
+// Dir 插件配置目录
+func (m *Manager) Dir() string {
+	return m.dir
+}
+
+// Statuses 最近一次加载的结果
+func (m *Manager) Statuses() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Status(nil), m.statuses...)
+}
+
+// Reload 重新扫描配置目录；目录不存在时视为没有插件
+func (m *Manager) Reload() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range m.names {
+		if m.reg.GetSource(name) == registry.SourcePlugin {
+			m.reg.Unregister(name)
+		}
+	}
+	m.names = nil
+	m.statuses = []Status{}
+
+	files, _ := filepath.Glob(filepath.Join(m.dir, "*.json"))
+	sort.Strings(files)
+	seen := map[string]bool{}
+	for _, f := range files {
+		st := Status{File: filepath.Base(f)}
+		man, err := Load(m.dir, f)
+		if err == nil && seen[man.Name] {
+			err = fmt.Errorf("工具名 %s 重复", man.Name)
+		}
+		if err == nil {
+			if src := m.reg.GetSource(man.Name); src != "" {
+				err = fmt.Errorf("工具名与已有的 %s 工具冲突", src)
+			}
+		}
+		if man != nil {
+			st.Name = man.Name
+		}
+		if err != nil {
+			st.Error = err.Error()
+			m.statuses = append(m.statuses, st)
+			continue
+		}
+		seen[man.Name] = true
+		m.reg.RegisterExternal(man.Name, registry.SourcePlugin, Declaration(man), executor(man))
+		m.names = append(m.names, man.Name)
+		st.Registered = true
+		m.statuses = append(m.statuses, st)
+	}
+	return append([]Status(nil), m.statuses...)
+}
+
+// Load 读取并校验一个清单；root 为插件配置目录，命令与工作目录的相对路径以清单所在目录为基准
+func Load(root, file string) (*Manifest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var man Manifest
+	if err := json.Unmarshal(data, &man); err != nil {
+		return nil, fmt.Errorf("清单不是合法 JSON：%v", err)
+	}
+	man.File = file
+	if !namePattern.MatchString(man.Name) {
+		return &man, fmt.Errorf("name 须为字母开头的字母、数字或下划线，最长 64 个字符")
+	}
+	if strings.TrimSpace(man.Description) == "" {
+		return &man, fmt.Errorf("description 不能为空")
+	}
+	if len(man.Parameters) > 0 && string(man.Parameters) != "null" {
+		var schema map[string]any
+		if err := json.Unmarshal(man.Parameters, &schema); err != nil {
+			return &man, fmt.Errorf("parameters 须为 JSON Schema 对象")
+		}
+	}
+	if man.Command == "" {
+		return &man, fmt.Errorf("command 不能为空")
+	}
+	base := filepath.Dir(file)
+	if strings.ContainsRune(man.Command, filepath.Separator) && !filepath.IsAbs(man.Command) {
+		man.Command = filepath.Join(base, man.Command)
+	}
+	if _, err := exec.LookPath(man.Command); err != nil {
+		return &man, fmt.Errorf("找不到可执行文件 %s", man.Command)
+	}
+	dir := man.Dir
+	if dir == "" {
+		dir = base
+	} else if !filepath.IsAbs(dir) {
+		dir = filepath.Join(base, dir)
+	}
+	if !within(root, dir) {
+		return &man, fmt.Errorf("dir 须位于插件目录内")
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return &man, fmt.Errorf("工作目录 %s 不存在", dir)
+	}
+	man.Dir = dir
+	for _, name := range man.PassEnv {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return &man, fmt.Errorf("passEnv 包含非法变量名 %q", name)
+		}
+	}
+	if man.TimeoutMs < 0 || time.Duration(man.TimeoutMs)*time.Millisecond > maxTimeout {
+		return &man, fmt.Errorf("timeoutMs 须在 0 到 %d 之间", maxTimeout.Milliseconds())
+	}
+	if man.MaxOutputBytes < 0 || man.MaxOutputBytes > maxOutputBytes {
+		return &man, fmt.Errorf("maxOutputBytes 须在 0 到 %d 之间", maxOutputBytes)
+	}
+	return &man, nil
+}
+
+// within 判断 path 是否位于 root 内（解析符号链接后比较）
+func within(root, path string) bool {
+	r, err := filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+	p, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if real, err := filepath.EvalSymlinks(r); err == nil {
+		r = real
+	}
+	if real, err := filepath.EvalSymlinks(p); err == nil {
+		p = real
+	}
+	rel, err := filepath.Rel(r, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Declaration 由清单生成函数声明；未声明 parameters 时为空对象
+func Declaration(man *Manifest) *genai.FunctionDeclaration {
+	var schema any = map[string]any{"type": "object", "properties": map[string]any{}}
+	if len(man.Parameters) > 0 && string(man.Parameters) != "null" {
+		_ = json.Unmarshal(man.Parameters, &schema)
+	}
+	return &genai.FunctionDeclaration{
+		Name:        man.Name,
+		Description: man.Description,
+		Parameters:  registry.SchemaFromJSON(schema),
+	}
+}
+
+// Env 子进程环境：baseEnv 与 passEnv 中服务端已设置的变量，加上清单 env；HOME 与 TMPDIR 指向工作目录
+func Env(man *Manifest) []string {
+	vars := map[string]string{"HOME": man.Dir, "TMPDIR": man.Dir}
+	for _, name := range append(append([]string(nil), baseEnv...), man.PassEnv...) {
+		if v, ok := os.LookupEnv(name); ok {
+			vars[name] = v
+		}
+	}
+	for k, v := range man.Env {
+		vars[k] = v
+	}
+	env := make([]string, 0, len(vars))
+	for k, v := range vars {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+func executor(man *Manifest) registry.Executor {
+	return func(req registry.ExecuteRequest, args json.RawMessage) (interface{}, error) {
+		return Run(req, man, args)
+	}
+}
+
+// Run 执行一次插件调用。stdout 须为一个 JSON 值：对象原样作为结果（含字符串 error 字段时视为失败），
+// 其他值包装为 {"result": ...}；stderr 经 req.OnLog 输出到思考步骤详情
+func Run(req registry.ExecuteRequest, man *Manifest, args json.RawMessage) (map[string]interface{}, error) {
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	input, err := json.Marshal(Request{Tool: man.Name, Arguments: args, SessionID: req.SessionID})
+	if err != nil {
+		return nil, err
+	}
+	timeout := defaultTimeout
+	if man.TimeoutMs > 0 {
+		timeout = time.Duration(man.TimeoutMs) * time.Millisecond
+	}
+	limit := int64(defaultOutputBytes)
+	if man.MaxOutputBytes > 0 {
+		limit = man.MaxOutputBytes
+	}
+	parent := req.Ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	stdout := &cappedBuffer{limit: limit, onOverflow: cancel}
+	stderr := &tailBuffer{limit: maxStderrBytes}
+	cmd := exec.CommandContext(ctx, man.Command, man.Args...)
+	cmd.Dir = man.Dir
+	cmd.Env = Env(man)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = killGrace
+	killProcessGroup(cmd)
+	runErr := cmd.Run()
+
+	if req.OnLog != nil && stderr.Len() > 0 {
+		req.OnLog(stderr.String())
+	}
+	switch {
+	case stdout.overflow:
+		return nil, fmt.Errorf("插件输出超过 %d 字节上限", limit)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil:
+		return nil, registry.NewToolError(registry.ErrTimeout, fmt.Errorf("插件执行超时（%s）", timeout))
+	case parent.Err() != nil:
+		return nil, parent.Err()
+	case runErr != nil:
+		msg := lastLine(stderr.String())
+		if msg == "" {
+			msg = runErr.Error()
+		}
+		return nil, fmt.Errorf("插件执行失败：%s", msg)
+	}
+
+	var out any
+	if err := json.Unmarshal(bytes.TrimSpace(stdout.buf.Bytes()), &out); err != nil {
+		return nil, fmt.Errorf("插件输出不是合法 JSON：%v", err)
+	}
+	m, ok := out.(map[string]any)
+	if !ok {
+		return map[string]interface{}{"result": out}, nil
+	}
+	if msg, ok := m["error"].(string); ok && msg != "" {
+		return nil, errors.New(msg)
+	}
+	return m, nil
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// cappedBuffer 超过上限后丢弃后续输出并调用 onOverflow（终止进程）。
+// 不内嵌 bytes.Buffer，以免 io.Copy 经 ReadFrom 绕过上限检查
+type cappedBuffer struct {
+	buf        bytes.Buffer
+	limit      int64
+	overflow   bool
+	onOverflow func()
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.overflow {
+		return len(p), nil
+	}
+	if int64(b.buf.Len()+len(p)) > b.limit {
+		b.overflow = true
+		if b.onOverflow != nil {
+			b.onOverflow()
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// tailBuffer 只保留最后 limit 字节
+type tailBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.limit {
+		b.buf = append([]byte(nil), b.buf[len(b.buf)-b.limit:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) Len() int       { return len(b.buf) }
+func (b *tailBuffer) String() string { return string(b.buf) }
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package plugin
+
+import "os/exec"
+
+// killProcessGroup 非 unix 平台只终止插件进程本身
+func killProcessGroup(cmd *exec.Cmd) {}
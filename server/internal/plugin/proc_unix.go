@@ -0,0 +1,16 @@
+//go:build unix
+
+package plugin
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup 让插件在独立进程组中运行，超时或取消时连同其子进程一起终止
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
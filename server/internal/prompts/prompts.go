@@ -28,6 +28,23 @@ func SupervisorSystem(vars SupervisorVars) string {
 	if vars.HasMcpConnected {
 		mcpSection = "\n## MCP 工具\n已有 MCP 服务器连接，优先使用 MCP 工具（如文件读写、笔记、时间等）完成任务。"
 	}
+	if len(vars.McpResources) > 0 {
+		mcpSection += "\n## MCP 资源\n以下资源可通过 read_mcp_resource(uri) 读取，涉及相关内容时按需读取后再回答："
+		for i, r := range vars.McpResources {
+			if i >= maxAdvertisedResources {
+				mcpSection += "\n- ……（其余资源省略）"
+				break
+			}
+			line := "\n- " + r.URI
+			if r.Name != "" {
+				line += "（" + r.Name + "）"
+			}
+			if r.Description != "" {
+				line += "：" + r.Description
+			}
+			mcpSection += line
+		}
+	}
 	modeSection := ""
 	switch vars.Mode {
 	case ModeTraditional:
@@ -49,6 +66,12 @@ func SupervisorSystem(vars SupervisorVars) string {
 - 调用 write_file 后，在正文中需要展示文件列表的对应位置输出占位符 ` + "`[WRITTEN_FILES]`" + `，系统将自动替换为可点击的文件链接
 - 思维链仅展示「规划 / 分析 / 调度」类步骤，不展示 write_file 的执行过程
 
+### 读取已写入的文件
+- 修改或续写 VFS 中已有的文件前，先用 read_file 读取当前内容，不要凭对话记忆重写
+- 不确定文件位置时用 list_files（支持 glob）查看，用 grep_files 按正则定位内容
+- read_file 结果被截断时，按 nextStartLine 继续读取
+- 修改已有文件的局部内容用 edit_file，不要用 write_file 重写整个文件；edit_file 返回冲突时先 read_file 再重试
+
 ### generate_chart 与正文的关联
 - generate_chart 在对话响应过程中调用，是正文创作的一部分
 - **每个图表需单独调用一次** generate_chart
@@ -89,6 +112,17 @@ type SupervisorVars struct {
 	CustomRules     string
 	Mode            string
 	HasMcpConnected bool
+	McpResources    []McpResourceRef
+}
+
+// maxAdvertisedResources 系统提示词中列出的 MCP 资源上限
+const maxAdvertisedResources = 30
+
+// McpResourceRef 在系统提示词中声明的一条 MCP 资源
+type McpResourceRef struct {
+	URI         string
+	Name        string
+	Description string
 }
 
 func AnalyzeRequirementsPrompt(context, domain, mode string) string {
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
-	"sort"
 	"strings"
 	"time"
 
@@ -22,6 +21,12 @@ type ExecutorContext struct {
 	TodoStore   *store.TodoStore
 	GeminiClient *genai.Client
 	OnProgress  func(string)
+	// OnFileProgress 接收 write_file 的写入进度；为 nil 时退回 OnProgress 文本
+	OnFileProgress func(FileProgress)
+	// Caller、TurnID、CallID 写入文件版本的来源
+	Caller string
+	TurnID string
+	CallID string
 }
 
 // ToolExecutor executes a builtin tool and returns the result.
@@ -35,6 +40,10 @@ var executors = map[string]ToolExecutor{
 	"search_knowledge":      executeSearchKnowledge,
 	"report_step_done":      executeReportStepDone,
 	"write_file":            executeWriteFile,
+	"read_file":             executeReadFile,
+	"list_files":            executeListFiles,
+	"grep_files":            executeGrepFiles,
+	"edit_file":             executeEditFile,
 	"generate_chart":        executeGenerateChart,
 	"propose_plan":          executeProposePlan,
 	"analyze_data":          executeAnalyzeData,
@@ -63,6 +72,9 @@ func executeCreateTodo(ctx ExecutorContext, args json.RawMessage) (interface{},
 	if inp.Title == "" {
 		return nil, errMissingArg("title")
 	}
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
 	item, err := ctx.TodoStore.Add(inp.Title, inp.DueAt, inp.Priority)
 	if err != nil {
 		return nil, err
@@ -99,6 +111,9 @@ func executeCompleteTodo(ctx ExecutorContext, args json.RawMessage) (interface{}
 	if inp.ID == "" {
 		return nil, errMissingArg("id")
 	}
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
 	ok, err := ctx.TodoStore.Complete(inp.ID)
 	if err != nil {
 		return nil, err
@@ -124,52 +139,16 @@ func executeSearchKnowledge(ctx ExecutorContext, args json.RawMessage) (interfac
 	if inp.Limit > 0 {
 		limit = int(inp.Limit)
 	}
-	chunks, err := ctx.Store.GetKnowledgeChunks(ctx.SessionID)
-	if err != nil || len(chunks) == 0 {
+	matches, total, err := ctx.Store.SearchKnowledge(ctx.SessionID, inp.Query, limit)
+	if err != nil || total == 0 {
 		return map[string]interface{}{
-			"matches": []store.KnowledgeChunk{},
+			"matches": []store.KnowledgeMatch{},
 			"message": "知识库为空，请先在语义切片引擎中导入分块。",
 		}, nil
 	}
-	keywords := regexp.MustCompile(`[^\p{Han}\p{Latin}\p{N}\s]+`).ReplaceAllString(inp.Query, " ")
-	kwParts := strings.Fields(keywords)
-	type scored struct {
-		chunk store.KnowledgeChunk
-		score int
-	}
-	var scoredList []scored
-	qLower := strings.ToLower(inp.Query)
-	for _, c := range chunks {
-		text := strings.ToLower(c.Content + " " + c.Summary)
-		score := 0
-		if strings.Contains(text, qLower) {
-			score += 10
-		}
-		for _, kw := range kwParts {
-			if len(kw) > 1 && strings.Contains(text, strings.ToLower(kw)) {
-				score += 2
-			}
-		}
-		if score > 0 {
-			scoredList = append(scoredList, scored{chunk: c, score: score})
-		}
-	}
-	sort.Slice(scoredList, func(i, j int) bool {
-		return scoredList[i].score < scoredList[j].score
-	})
-	for i, j := 0, len(scoredList)-1; i < j; i, j = i+1, j-1 {
-		scoredList[i], scoredList[j] = scoredList[j], scoredList[i]
-	}
-	matches := make([]store.KnowledgeChunk, 0, limit)
-	for i, s := range scoredList {
-		if i >= limit {
-			break
-		}
-		matches = append(matches, s.chunk)
-	}
 	return map[string]interface{}{
 		"matches": matches,
-		"total":   len(chunks),
+		"total":   total,
 	}, nil
 }
 
@@ -196,24 +175,57 @@ func executeWriteFile(ctx ExecutorContext, args json.RawMessage) (interface{}, e
 	if inp.Path == "" || inp.Language == "" {
 		return nil, errMissingArg("path or language")
 	}
+	p, err := store.NormalizeVFSPath(inp.Path)
+	if err != nil {
+		return nil, errInvalidArg("path 须为不含 .. 的相对路径")
+	}
+	inp.Path = p
 	chunks := inp.ContentChunks
 	if len(chunks) == 0 && inp.Content != "" {
 		chunks = []string{inp.Content}
 	}
+	total := 0
+	for _, ch := range chunks {
+		total += len(ch)
+	}
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
 	_ = ctx.Store.UpdateVFS(ctx.SessionID, inp.Path, "", inp.Language, true)
 	var accumulated string
-	for i, ch := range chunks {
+	for _, ch := range chunks {
+		if err := canceled(ctx); err != nil {
+			ctx.Store.DiscardVFSWrite(ctx.SessionID, inp.Path)
+			return nil, err
+		}
+		written := len(accumulated)
 		accumulated += ch
 		_ = ctx.Store.UpdateVFS(ctx.SessionID, inp.Path, accumulated, inp.Language, true)
-		if ctx.OnProgress != nil {
-			ctx.OnProgress("Writing " + inp.Path + "...")
+		if ctx.OnFileProgress == nil {
+			if ctx.OnProgress != nil {
+				ctx.OnProgress("Writing " + inp.Path + "...")
+			}
+			continue
 		}
-		_ = i
+		for _, delta := range splitDelta(ch, maxProgressDelta) {
+			written += len(delta)
+			ctx.OnFileProgress(FileProgress{Path: inp.Path, Language: inp.Language, BytesWritten: written, TotalBytes: total, Delta: delta})
+		}
+	}
+	if err := canceled(ctx); err != nil {
+		ctx.Store.DiscardVFSWrite(ctx.SessionID, inp.Path)
+		return nil, err
+	}
+	if err := ctx.Store.CommitVFS(ctx.SessionID, inp.Path, accumulated, inp.Language, revisionSource(ctx, "write_file")); err != nil {
+		return nil, err
+	}
+	if ctx.OnFileProgress != nil {
+		ctx.OnFileProgress(FileProgress{Path: inp.Path, Language: inp.Language, BytesWritten: total, TotalBytes: total, Done: true})
 	}
-	_ = ctx.Store.UpdateVFS(ctx.SessionID, inp.Path, accumulated, inp.Language, false)
 	return map[string]interface{}{"status": "SUCCESS", "path": inp.Path}, nil
 }
 
+
 func executeGenerateChart(_ ExecutorContext, args json.RawMessage) (interface{}, error) {
 	var result map[string]interface{}
 	if err := json.Unmarshal(args, &result); err != nil {
@@ -404,6 +416,20 @@ func (e errMissingArg) Error() string {
 	return "missing required argument: " + string(e)
 }
 
+// ErrorClass 供 registry 归类为 invalid_args
+func (e errMissingArg) ErrorClass() string {
+	return "invalid_args"
+}
+
+// canceled 执行已超时或被取消时返回 ctx 的错误；registry 超时后不再等待执行函数，
+// 写入类工具须在落盘前检查，避免调用方已收到超时后文件或待办仍被修改
+func canceled(ctx ExecutorContext) error {
+	if ctx.Ctx == nil {
+		return nil
+	}
+	return ctx.Ctx.Err()
+}
+
 // Definitions returns genai FunctionDeclaration for all builtin tools.
 func Definitions() []*genai.FunctionDeclaration {
 	return []*genai.FunctionDeclaration{
@@ -446,11 +472,11 @@ func Definitions() []*genai.FunctionDeclaration {
 		},
 		{
 			Name:        "search_knowledge",
-			Description: "从当前会话知识库检索相关分块。用于文档、长文本相关问题时获取上下文。若知识库为空则返回空结果。",
+			Description: "从当前会话知识库检索相关分块（BM25 排序），返回分块、相关度分数与高亮片段。用于文档、长文本相关问题时获取上下文。若知识库为空则返回空结果。",
 			Parameters: &genai.Schema{
 				Type: genai.TypeObject,
 				Properties: map[string]*genai.Schema{
-					"query": {Type: genai.TypeString, Description: ptr("检索关键词或问题摘要")},
+					"query": {Type: genai.TypeString, Description: ptr("检索关键词或问题摘要，中文按相邻两字匹配")},
 					"limit": {Type: genai.TypeNumber, Description: ptr("返回最大条数，默认 5")},
 				},
 				Required: []string{"query"},
@@ -479,6 +505,62 @@ func Definitions() []*genai.FunctionDeclaration {
 				Required: []string{"path", "language"},
 			},
 		},
+		{
+			Name:        "edit_file",
+			Description: "增量修改 VFS 中已有的文件，小改动优先使用，避免用 write_file 重写整个文件。三选一：oldString/newString 精确替换（oldString 须唯一，否则设置 replaceAll）；startLine/endLine/newContent 替换行范围（endLine = startLine-1 表示插入）；patch 应用 unified diff。无法应用时返回冲突详情且不修改文件，成功时返回 diff。",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"path":       {Type: genai.TypeString, Description: ptr("文件路径")},
+					"oldString":  {Type: genai.TypeString, Description: ptr("要替换的原文，须与文件内容完全一致（含缩进）")},
+					"newString":  {Type: genai.TypeString, Description: ptr("替换后的文本")},
+					"replaceAll": {Type: genai.TypeBoolean, Description: ptr("替换所有出现之处")},
+					"startLine":  {Type: genai.TypeInteger, Description: ptr("替换的起始行（从 1 开始）")},
+					"endLine":    {Type: genai.TypeInteger, Description: ptr("替换的结束行（含），默认等于 startLine")},
+					"newContent": {Type: genai.TypeString, Description: ptr("替换行范围的新内容")},
+					"patch":      {Type: genai.TypeString, Description: ptr("unified diff（@@ -l,n +l,n @@ hunk）")},
+				},
+				Required: []string{"path"},
+			},
+		},
+		{
+			Name:        "read_file",
+			Description: "读取 VFS 中的文件内容。可用 startLine/endLine 指定行范围（从 1 开始，含端点）；单次最多返回 400 行或 32KB，截断时按 nextStartLine 继续读取。修改已写入的文件前先读取。",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"path":      {Type: genai.TypeString, Description: ptr("文件路径")},
+					"startLine": {Type: genai.TypeInteger, Description: ptr("起始行，默认 1")},
+					"endLine":   {Type: genai.TypeInteger, Description: ptr("结束行，默认到文件末尾")},
+				},
+				Required: []string{"path"},
+			},
+		},
+		{
+			Name:        "list_files",
+			Description: "列出 VFS 中的文件（路径、语言、大小、行数）。glob 可选，如 *.md、src/**/*.ts；最多返回 200 个。",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"glob": {Type: genai.TypeString, Description: ptr("文件过滤模式，** 匹配任意层级目录；不含 / 时匹配文件名")},
+				},
+			},
+		},
+		{
+			Name:        "grep_files",
+			Description: "在 VFS 文件中按正则搜索，返回匹配的路径、行号与行内容；最多返回 100 条。",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"pattern":      {Type: genai.TypeString, Description: ptr("正则表达式（RE2 语法）")},
+					"glob":         {Type: genai.TypeString, Description: ptr("限定搜索的文件，语法同 list_files")},
+					"ignoreCase":   {Type: genai.TypeBoolean, Description: ptr("忽略大小写")},
+					"contextLines": {Type: genai.TypeInteger, Description: ptr("每条匹配前后附带的行数，最多 5")},
+					"maxMatches":   {Type: genai.TypeInteger, Description: ptr("最多返回的匹配数，默认 100")},
+				},
+				Required: []string{"pattern"},
+			},
+		},
 		{
 			Name:        "generate_chart",
 			Description: "生成数据可视化图表。支持柱状图(bar)、饼图(pie)、折线图(line)。需提供 labels 与 datasets。",
@@ -0,0 +1,157 @@
+package builtin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"agentic-demo/server/internal/store"
+	"agentic-demo/server/internal/textdiff"
+)
+
+// maxEditDiffBytes edit_file 返回的 diff 上限
+const maxEditDiffBytes = 8 << 10
+
+// errEditConflict 编辑无法应用：字符串不唯一/未找到，或补丁 hunk 与文件不一致
+type errEditConflict struct {
+	msg       string
+	conflicts []textdiff.Conflict
+}
+
+func (e errEditConflict) Error() string {
+	if len(e.conflicts) == 0 {
+		return "edit conflict: " + e.msg
+	}
+	report, _ := json.Marshal(e.conflicts)
+	return "edit conflict: " + e.msg + " " + string(report)
+}
+
+// ErrorClass 供 registry 归类为 invalid_args
+func (e errEditConflict) ErrorClass() string {
+	return "invalid_args"
+}
+
+// executeEditFile 增量修改 VFS 文件，三种方式任选其一：
+// oldString/newString 精确替换（默认须唯一）、startLine/endLine/newContent 按行替换、patch 应用 unified diff
+func executeEditFile(ctx ExecutorContext, args json.RawMessage) (interface{}, error) {
+	var inp struct {
+		Path       string   `json:"path"`
+		OldString  *string  `json:"oldString"`
+		NewString  string   `json:"newString"`
+		ReplaceAll bool     `json:"replaceAll"`
+		StartLine  float64  `json:"startLine"`
+		EndLine    *float64 `json:"endLine"`
+		NewContent string   `json:"newContent"`
+		Patch      string   `json:"patch"`
+	}
+	if err := json.Unmarshal(args, &inp); err != nil {
+		return nil, err
+	}
+	if inp.Path == "" {
+		return nil, errMissingArg("path")
+	}
+	p, err := store.NormalizeVFSPath(inp.Path)
+	if err != nil {
+		return nil, errInvalidArg("path 须为不含 .. 的相对路径")
+	}
+	vfs, err := sessionVFS(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := vfs[p]
+	if !ok {
+		return nil, errFileNotFound(p)
+	}
+
+	var updated string
+	switch {
+	case inp.Patch != "":
+		var conflicts []textdiff.Conflict
+		updated, conflicts, err = textdiff.Apply(f.Content, inp.Patch)
+		if err != nil {
+			return nil, errInvalidArg("patch: " + err.Error())
+		}
+		if len(conflicts) > 0 {
+			return nil, errEditConflict{msg: fmt.Sprintf("%d 个 hunk 无法应用，文件未修改；请先用 read_file 读取最新内容", len(conflicts)), conflicts: conflicts}
+		}
+	case inp.OldString != nil:
+		if updated, err = replaceString(f.Content, *inp.OldString, inp.NewString, inp.ReplaceAll); err != nil {
+			return nil, err
+		}
+	case inp.StartLine > 0:
+		end := int(inp.StartLine)
+		if inp.EndLine != nil {
+			end = int(*inp.EndLine)
+		}
+		if updated, err = replaceLines(f.Content, int(inp.StartLine), end, inp.NewContent); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errMissingArg("patch, oldString or startLine")
+	}
+	if updated == f.Content {
+		return map[string]interface{}{"status": "UNCHANGED", "path": p}, nil
+	}
+	if err := canceled(ctx); err != nil {
+		return nil, err
+	}
+	if err := ctx.Store.CommitVFS(ctx.SessionID, p, updated, f.Language, revisionSource(ctx, "edit_file")); err != nil {
+		return nil, err
+	}
+	added, removed := textdiff.Stats(f.Content, updated)
+	diff := textdiff.Unified("a/"+p, "b/"+p, f.Content, updated, 2)
+	out := map[string]interface{}{
+		"status": "SUCCESS", "path": p, "diff": diff,
+		"linesAdded": added, "linesRemoved": removed, "totalLines": len(textdiff.Lines(updated)),
+	}
+	if len(diff) > maxEditDiffBytes {
+		out["diff"] = strings.ToValidUTF8(diff[:maxEditDiffBytes], "") + "\n…（diff 已截断）"
+		out["diffTruncated"] = true
+	}
+	return out, nil
+}
+
+func replaceString(content, old, repl string, all bool) (string, error) {
+	if old == "" {
+		return "", errInvalidArg("oldString 不能为空")
+	}
+	n := strings.Count(content, old)
+	switch {
+	case n == 0:
+		return "", errEditConflict{msg: "oldString 未在文件中找到，请用 read_file 确认当前内容（包括缩进与空白）"}
+	case n > 1 && !all:
+		return "", errEditConflict{msg: fmt.Sprintf("oldString 出现 %d 次（第 %s 行），请包含更多上下文使其唯一，或设置 replaceAll", n, occurrenceLines(content, old))}
+	}
+	if all {
+		return strings.ReplaceAll(content, old, repl), nil
+	}
+	return strings.Replace(content, old, repl, 1), nil
+}
+
+// occurrenceLines 各处出现的起始行号，最多列出 10 处
+func occurrenceLines(content, sub string) string {
+	var lines []string
+	offset := 0
+	for len(lines) < 10 {
+		i := strings.Index(content[offset:], sub)
+		if i < 0 {
+			break
+		}
+		lines = append(lines, fmt.Sprint(strings.Count(content[:offset+i], "\n")+1))
+		offset += i + len(sub)
+	}
+	return strings.Join(lines, "、")
+}
+
+// replaceLines 用 newContent 替换 [start, end] 行（从 1 开始，含端点）；end = start-1 表示在 start 前插入，
+// start = 总行数+1 表示追加到末尾
+func replaceLines(content string, start, end int, newContent string) (string, error) {
+	lines := textdiff.Lines(content)
+	if start > len(lines)+1 || end < start-1 || end > len(lines) {
+		return "", errInvalidArg(fmt.Sprintf("行范围 %d-%d 超出文件（共 %d 行）", start, end, len(lines)))
+	}
+	out := append([]string(nil), lines[:start-1]...)
+	out = append(out, textdiff.Lines(newContent)...)
+	out = append(out, lines[end:]...)
+	return textdiff.Join(out, content == "" || strings.HasSuffix(content, "\n")), nil
+}
@@ -0,0 +1,299 @@
+package builtin
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"agentic-demo/server/internal/store"
+)
+
+// 文件工具的结果上限，超出时截断并提示如何继续读取
+const (
+	maxReadLines     = 400
+	maxReadBytes     = 32 << 10
+	maxListFiles     = 200
+	maxGrepMatches   = 100
+	maxGrepLineChars = 300
+	maxGrepContext   = 5
+)
+
+type errInvalidArg string
+
+func (e errInvalidArg) Error() string {
+	return "invalid argument: " + string(e)
+}
+
+// ErrorClass 供 registry 归类为 invalid_args
+func (e errInvalidArg) ErrorClass() string {
+	return "invalid_args"
+}
+
+type errFileNotFound string
+
+func (e errFileNotFound) Error() string {
+	return "file not found: " + string(e)
+}
+
+// ErrorClass 供 registry 归类为 not_found
+func (e errFileNotFound) ErrorClass() string {
+	return "not_found"
+}
+
+func sessionVFS(ctx ExecutorContext) (map[string]store.VfsFile, error) {
+	if ctx.Store == nil || ctx.SessionID == "" {
+		return nil, errMissingArg("sessionId")
+	}
+	return ctx.Store.GetVFS(ctx.SessionID)
+}
+
+// revisionSource 工具写入文件时的版本来源
+func revisionSource(ctx ExecutorContext, tool string) store.RevisionSource {
+	return store.RevisionSource{Source: "tool", Tool: tool, Caller: ctx.Caller, TurnID: ctx.TurnID, CallID: ctx.CallID}
+}
+
+func splitLines(content string) []string {
+	lines := strings.Split(content, "\n")
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// executeReadFile 按行读取文件，startLine/endLine 从 1 开始且包含端点；超出上限时返回 nextStartLine
+func executeReadFile(ctx ExecutorContext, args json.RawMessage) (interface{}, error) {
+	var inp struct {
+		Path      string  `json:"path"`
+		StartLine float64 `json:"startLine"`
+		EndLine   float64 `json:"endLine"`
+	}
+	if err := json.Unmarshal(args, &inp); err != nil {
+		return nil, err
+	}
+	if inp.Path == "" {
+		return nil, errMissingArg("path")
+	}
+	p, err := store.NormalizeVFSPath(inp.Path)
+	if err != nil {
+		return nil, errInvalidArg("path 须为不含 .. 的相对路径")
+	}
+	vfs, err := sessionVFS(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := vfs[p]
+	if !ok {
+		return nil, errFileNotFound(p)
+	}
+	lines := splitLines(f.Content)
+	start, end := int(inp.StartLine), int(inp.EndLine)
+	if start < 1 {
+		start = 1
+	}
+	if end < 1 || end > len(lines) {
+		end = len(lines)
+	}
+	if start > len(lines) && len(lines) > 0 {
+		return nil, errInvalidArg("startLine 超出文件行数")
+	}
+	var b strings.Builder
+	last := start - 1
+	for i := start; i <= end; i++ {
+		line := lines[i-1]
+		if i-start >= maxReadLines || (b.Len() > 0 && b.Len()+len(line)+1 > maxReadBytes) {
+			break
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+		last = i
+	}
+	out := map[string]interface{}{
+		"path":       p,
+		"language":   f.Language,
+		"content":    b.String(),
+		"startLine":  start,
+		"endLine":    last,
+		"totalLines": len(lines),
+	}
+	if last < end {
+		out["truncated"] = true
+		out["nextStartLine"] = last + 1
+	}
+	return out, nil
+}
+
+// globRegexp 把 glob 转为正则：** 匹配任意层级目录，* 与 ? 不跨越 /
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			i++
+			if i+1 < len(glob) && glob[i+1] == '/' {
+				i++
+				b.WriteString("(?:.*/)?")
+			} else {
+				b.WriteString(".*")
+			}
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// globMatcher 不含 / 的模式（如 *.md）匹配任意目录下的文件名；空模式匹配全部
+func globMatcher(glob string) (func(p string) bool, error) {
+	glob = strings.TrimPrefix(strings.TrimSpace(glob), "./")
+	if glob == "" {
+		return func(string) bool { return true }, nil
+	}
+	re, err := globRegexp(glob)
+	if err != nil {
+		return nil, errInvalidArg("glob: " + err.Error())
+	}
+	if !strings.Contains(glob, "/") {
+		return func(p string) bool { return re.MatchString(p[strings.LastIndex(p, "/")+1:]) }, nil
+	}
+	return re.MatchString, nil
+}
+
+func sortedPaths(vfs map[string]store.VfsFile, match func(string) bool) []string {
+	paths := make([]string, 0, len(vfs))
+	for p := range vfs {
+		if match(p) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func executeListFiles(ctx ExecutorContext, args json.RawMessage) (interface{}, error) {
+	var inp struct {
+		Glob string `json:"glob"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &inp); err != nil {
+			return nil, err
+		}
+	}
+	match, err := globMatcher(inp.Glob)
+	if err != nil {
+		return nil, err
+	}
+	vfs, err := sessionVFS(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths := sortedPaths(vfs, match)
+	files := make([]map[string]interface{}, 0, len(paths))
+	for _, p := range paths {
+		if len(files) >= maxListFiles {
+			break
+		}
+		f := vfs[p]
+		files = append(files, map[string]interface{}{
+			"path": p, "language": f.Language, "size": len(f.Content), "lines": len(splitLines(f.Content)),
+		})
+	}
+	out := map[string]interface{}{"files": files, "total": len(paths)}
+	if len(paths) > len(files) {
+		out["truncated"] = true
+		out["hint"] = "结果已截断，请用更具体的 glob 缩小范围"
+	}
+	return out, nil
+}
+
+func executeGrepFiles(ctx ExecutorContext, args json.RawMessage) (interface{}, error) {
+	var inp struct {
+		Pattern      string  `json:"pattern"`
+		Glob         string  `json:"glob"`
+		IgnoreCase   bool    `json:"ignoreCase"`
+		ContextLines float64 `json:"contextLines"`
+		MaxMatches   float64 `json:"maxMatches"`
+	}
+	if err := json.Unmarshal(args, &inp); err != nil {
+		return nil, err
+	}
+	if inp.Pattern == "" {
+		return nil, errMissingArg("pattern")
+	}
+	expr := inp.Pattern
+	if inp.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, errInvalidArg("pattern: " + err.Error())
+	}
+	match, err := globMatcher(inp.Glob)
+	if err != nil {
+		return nil, err
+	}
+	limit := maxGrepMatches
+	if n := int(inp.MaxMatches); n > 0 && n < limit {
+		limit = n
+	}
+	contextLines := int(inp.ContextLines)
+	if contextLines < 0 {
+		contextLines = 0
+	}
+	if contextLines > maxGrepContext {
+		contextLines = maxGrepContext
+	}
+	vfs, err := sessionVFS(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths := sortedPaths(vfs, match)
+	matches := []map[string]interface{}{}
+	total := 0
+	for _, p := range paths {
+		lines := splitLines(vfs[p].Content)
+		for i, line := range lines {
+			if !re.MatchString(line) {
+				continue
+			}
+			total++
+			if len(matches) >= limit {
+				continue
+			}
+			m := map[string]interface{}{"path": p, "line": i + 1, "text": clipLine(line)}
+			if contextLines > 0 {
+				m["before"] = clipLines(lines[max(0, i-contextLines):i])
+				m["after"] = clipLines(lines[i+1 : min(len(lines), i+1+contextLines)])
+			}
+			matches = append(matches, m)
+		}
+	}
+	out := map[string]interface{}{"matches": matches, "total": total, "filesSearched": len(paths)}
+	if total > len(matches) {
+		out["truncated"] = true
+		out["hint"] = "匹配过多已截断，请缩小 pattern 或用 glob 限定文件"
+	}
+	return out, nil
+}
+
+func clipLine(s string) string {
+	if r := []rune(s); len(r) > maxGrepLineChars {
+		return string(r[:maxGrepLineChars]) + "…"
+	}
+	return s
+}
+
+func clipLines(lines []string) []string {
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = clipLine(l)
+	}
+	return out
+}
@@ -0,0 +1,36 @@
+package builtin
+
+import "unicode/utf8"
+
+// maxProgressDelta 单个进度事件携带的增量上限，更大的块拆成多个事件
+const maxProgressDelta = 4 << 10
+
+// FileProgress write_file 写入过程中的进度：Delta 为本次追加的内容，Done 表示内容已写完并持久化
+type FileProgress struct {
+	Path         string `json:"path"`
+	Language     string `json:"language,omitempty"`
+	BytesWritten int    `json:"bytesWritten"`
+	TotalBytes   int    `json:"totalBytes"`
+	Delta        string `json:"delta,omitempty"`
+	Done         bool   `json:"done,omitempty"`
+}
+
+// splitDelta 按不超过 n 字节切分，不截断 UTF-8 字符
+func splitDelta(s string, n int) []string {
+	var out []string
+	for len(s) > n {
+		cut := n
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			cut = n
+		}
+		out = append(out, s[:cut])
+		s = s[cut:]
+	}
+	if s != "" {
+		out = append(out, s)
+	}
+	return out
+}
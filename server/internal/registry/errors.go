@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net"
+)
+
+// 工具错误分类，随函数响应返回给模型，并显示在失败的思考步骤中
+const (
+	ErrInvalidArgs      = "invalid_args"
+	ErrTimeout          = "timeout"
+	ErrUpstream         = "upstream_error"
+	ErrPermissionDenied = "permission_denied"
+	ErrNotFound         = "not_found"
+	ErrInternal         = "internal_error" // 无法归类的 builtin 工具错误
+)
+
+// ToolError 带分类的工具错误
+type ToolError struct {
+	Class string
+	Err   error
+}
+
+func (e *ToolError) Error() string { return e.Err.Error() }
+func (e *ToolError) Unwrap() error { return e.Err }
+
+// ErrorClass 实现 classifier，供 ErrorClassOf 识别
+func (e *ToolError) ErrorClass() string { return e.Class }
+
+// NewToolError 为错误标注分类；err 为 nil 时返回 nil
+func NewToolError(class string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ToolError{Class: class, Err: err}
+}
+
+// classifier 由错误自身声明分类；builtin 等无法依赖 registry 的包通过实现该接口参与分类
+type classifier interface {
+	ErrorClass() string
+}
+
+// ErrorClassOf 返回错误分类：优先使用错误链上声明的分类，其次按常见错误类型推断；
+// 无法推断时外部来源的工具归为 upstream_error，builtin 归为 internal_error
+func ErrorClassOf(err error, source string) string {
+	if err == nil {
+		return ""
+	}
+	var c classifier
+	if errors.As(err, &c) && c.ErrorClass() != "" {
+		return c.ErrorClass()
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrTimeout
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return ErrInvalidArgs
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return ErrPermissionDenied
+	}
+	if source == SourceBuiltin || source == "" {
+		return ErrInternal
+	}
+	return ErrUpstream
+}
@@ -0,0 +1,176 @@
+package registry
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/genai"
+)
+
+// ReadResultTool 读取被截断结果后续内容的工具
+const ReadResultTool = "read_tool_result"
+
+const (
+	resultTTL = time.Hour
+	// resultCacheBytes 暂存的完整结果总大小上限，超出时淘汰最早的结果
+	resultCacheBytes = 64 << 20
+)
+
+// Limits 单个工具的执行限制；零值表示不限制
+type Limits struct {
+	Timeout        time.Duration
+	MaxResultBytes int
+}
+
+// SetLimits 设置按工具 ID 解析执行限制的函数（合并全局默认值与单工具配置）
+func (r *Registry) SetLimits(fn func(id string) Limits) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits = fn
+}
+
+// LimitsFor 返回工具当前生效的执行限制
+func (r *Registry) LimitsFor(id string) Limits {
+	r.mu.RLock()
+	fn := r.limits
+	r.mu.RUnlock()
+	if fn == nil {
+		return Limits{}
+	}
+	return fn(id)
+}
+
+type cachedResult struct {
+	session string
+	data    []byte
+	expires time.Time
+}
+
+// resultCache 暂存超限结果的完整 JSON，按 handle 分段读取；handle 只能在产生它的会话中读取
+type resultCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedResult
+	order   []string
+	size    int
+}
+
+func newResultCache() *resultCache {
+	return &resultCache{entries: map[string]*cachedResult{}}
+}
+
+func (c *resultCache) put(session string, data []byte) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for len(c.order) > 0 {
+		e := c.entries[c.order[0]]
+		if e != nil && now.Before(e.expires) && c.size+len(data) <= resultCacheBytes {
+			break
+		}
+		if e != nil {
+			c.size -= len(e.data)
+		}
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	handle := "res_" + hex.EncodeToString(b)
+	c.entries[handle] = &cachedResult{session: session, data: data, expires: now.Add(resultTTL)}
+	c.order = append(c.order, handle)
+	c.size += len(data)
+	return handle
+}
+
+func (c *resultCache) get(handle, session string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[handle]
+	if e == nil || e.session != session || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.data, true
+}
+
+// truncateResult 结果的 JSON 超过 max 字节时暂存完整内容，返回首段与续读 handle
+func (r *Registry) truncateResult(sessionID string, res interface{}, data []byte, max int) interface{} {
+	if max <= 0 || len(data) <= max {
+		return res
+	}
+	return resultChunk(r.results.put(sessionID, data), data, 0, max)
+}
+
+// resultChunk 从 offset 起截取不超过 max 字节（不拆分 UTF-8 字符）
+func resultChunk(handle string, data []byte, offset, max int) map[string]interface{} {
+	end := offset + max
+	if end >= len(data) {
+		end = len(data)
+	} else {
+		for end > offset && !utf8.RuneStart(data[end]) {
+			end--
+		}
+		if end == offset {
+			end = offset + max
+		}
+	}
+	out := map[string]interface{}{
+		"content":    string(data[offset:end]),
+		"offset":     offset,
+		"totalBytes": len(data),
+	}
+	if end < len(data) {
+		out["truncated"] = true
+		out["continuation"] = map[string]interface{}{"handle": handle, "offset": end}
+		out["hint"] = "结果已截断，content 为完整结果 JSON 的一段；调用 " + ReadResultTool + " 并传入 continuation 的 handle 与 offset 读取后续内容"
+	}
+	return out
+}
+
+// RegisterResultReader 注册 read_tool_result，用于分段读取被截断的工具结果
+func (r *Registry) RegisterResultReader() {
+	def := &genai.FunctionDeclaration{
+		Name:        ReadResultTool,
+		Description: "读取因超过大小上限而被截断的工具结果的后续内容。传入截断结果中 continuation 的 handle 与 offset。",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"handle":   {Type: genai.TypeString, Description: "continuation.handle"},
+				"offset":   {Type: genai.TypeInteger, Description: "continuation.offset，从该字节偏移处继续读取"},
+				"maxBytes": {Type: genai.TypeInteger, Description: "本次最多读取的字节数，可选"},
+			},
+			Required: []string{"handle", "offset"},
+		},
+	}
+	r.RegisterExternal(ReadResultTool, SourceBuiltin, def, r.readResult)
+}
+
+func (r *Registry) readResult(req ExecuteRequest, args json.RawMessage) (interface{}, error) {
+	var inp struct {
+		Handle   string `json:"handle"`
+		Offset   int    `json:"offset"`
+		MaxBytes int    `json:"maxBytes"`
+	}
+	if err := json.Unmarshal(args, &inp); err != nil {
+		return nil, NewToolError(ErrInvalidArgs, err)
+	}
+	data, ok := r.results.get(inp.Handle, req.SessionID)
+	if !ok {
+		return nil, NewToolError(ErrNotFound, errors.New("handle 不存在或已过期"))
+	}
+	if inp.Offset < 0 || inp.Offset > len(data) {
+		return nil, NewToolError(ErrInvalidArgs, errors.New("offset 超出结果范围"))
+	}
+	max := r.LimitsFor(ReadResultTool).MaxResultBytes
+	if inp.MaxBytes > 0 && (max <= 0 || inp.MaxBytes < max) {
+		max = inp.MaxBytes
+	}
+	if max <= 0 {
+		max = len(data)
+	}
+	return resultChunk(inp.Handle, data, inp.Offset, max), nil
+}
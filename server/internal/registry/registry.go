@@ -3,7 +3,10 @@ package registry
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"sync"
+	"time"
 
 	"agentic-demo/server/internal/registry/builtin"
 	"agentic-demo/server/internal/store"
@@ -24,15 +27,33 @@ func Global() *Registry {
 }
 
 type Registry struct {
-	mu    sync.RWMutex
-	tools map[string]*ToolDef
+	mu       sync.RWMutex
+	tools    map[string]*ToolDef
+	limits   func(id string) Limits
+	results  *resultCache
+	recorder func(store.ToolCall)
 }
 
+// 工具来源
+const (
+	SourceBuiltin = "builtin"
+	SourceMcp     = "mcp"
+	SourceHTTP    = "http"    // 用户通过 API 定义的 HTTP 工具
+	SourceOpenAPI = "openapi" // 从 OpenAPI 文档导入的操作
+	SourcePlugin  = "plugin"  // 插件目录中声明的外部命令
+)
+
 type ToolDef struct {
 	Definition *genai.FunctionDeclaration
 	Blocking   bool
+	Source     string
+	Owner      string   // 同一来源下注册该工具的配置（如 OpenAPI 文档 ID），可为空
+	Executor   Executor // 非 builtin 工具的执行函数；为 nil 时按名称查找 builtin 执行器
 }
 
+// Executor executes a non-builtin tool registered with RegisterExternal.
+type Executor func(req ExecuteRequest, args json.RawMessage) (interface{}, error)
+
 // ExecuteRequest contains context for tool execution.
 type ExecuteRequest struct {
 	Ctx          context.Context
@@ -41,16 +62,80 @@ type ExecuteRequest struct {
 	TodoStore    *store.TodoStore
 	GeminiClient *genai.Client
 	OnProgress   func(string)
+	// OnFileProgress 接收 write_file 的结构化写入进度（路径、已写字节与增量内容）
+	OnFileProgress func(FileProgress)
+	// OnLog 接收执行过程中的诊断输出（如插件 stderr），由调用方附加到思考步骤详情
+	OnLog func(string)
+	// Caller 调用来源（agent、invoke、mcp），写入调用记录
+	Caller string
+	// TurnID、CallID 对话中调用时所在轮次（助手消息 ID）与函数调用 ID，用于标注文件版本
+	TurnID string
+	CallID string
 }
 
+// FileProgress write_file 的写入进度，见 builtin.FileProgress
+type FileProgress = builtin.FileProgress
+
 func New() *Registry {
-	return &Registry{tools: make(map[string]*ToolDef)}
+	return &Registry{tools: make(map[string]*ToolDef), results: newResultCache()}
 }
 
 func (r *Registry) Register(id string, def *genai.FunctionDeclaration, blocking bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.tools[id] = &ToolDef{Definition: def, Blocking: blocking}
+	r.tools[id] = &ToolDef{Definition: def, Blocking: blocking, Source: SourceBuiltin}
+}
+
+// RegisterExternal 注册带自定义执行函数的工具（MCP 等），source 用于前端区分来源
+func (r *Registry) RegisterExternal(id, source string, def *genai.FunctionDeclaration, exec Executor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[id] = &ToolDef{Definition: def, Source: source, Executor: exec}
+}
+
+// RegisterOwned 同 RegisterExternal，并记录注册该工具的配置，供 UnregisterOwned 按配置注销
+func (r *Registry) RegisterOwned(id, source, owner string, def *genai.FunctionDeclaration, exec Executor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[id] = &ToolDef{Definition: def, Source: source, Owner: owner, Executor: exec}
+}
+
+// UnregisterOwned 注销 source 下由 owner 注册的全部工具
+func (r *Registry) UnregisterOwned(source, owner string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, t := range r.tools {
+		if t.Source == source && t.Owner == owner {
+			delete(r.tools, id)
+		}
+	}
+}
+
+// GetOwner 返回工具的来源与所属配置，未注册时均为空
+func (r *Registry) GetOwner(id string) (source, owner string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if t, ok := r.tools[id]; ok {
+		return t.Source, t.Owner
+	}
+	return "", ""
+}
+
+// Unregister removes a tool; it is a no-op when the tool is not registered.
+func (r *Registry) Unregister(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, id)
+}
+
+// GetSource returns the source of a tool, or "" if not registered.
+func (r *Registry) GetSource(id string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if t, ok := r.tools[id]; ok {
+		return t.Source
+	}
+	return ""
 }
 
 func (r *Registry) GetDefinitions() []*genai.FunctionDeclaration {
@@ -113,18 +198,147 @@ func (r *Registry) GetBlockingIDs() map[string]bool {
 	return m
 }
 
+// SetRecorder 设置调用记录函数；每次 Execute 结束后调用一次
+func (r *Registry) SetRecorder(fn func(store.ToolCall)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recorder = fn
+}
+
+// Execute 按工具的执行限制运行：超时后立即返回 timeout 错误（执行函数仍在后台收尾），
+// 结果超过大小上限时截断并附带续读 handle；返回的错误均为带分类的 *ToolError
 func (r *Registry) Execute(req ExecuteRequest, name string, args json.RawMessage) (interface{}, error) {
+	start := time.Now()
+	res, size, err := r.run(req, name, args)
+	r.mu.RLock()
+	record := r.recorder
+	r.mu.RUnlock()
+	if record != nil {
+		call := store.ToolCall{
+			Tool: name, SessionID: req.SessionID, Caller: req.Caller,
+			StartedAt: start.UnixMilli(), DurationMs: time.Since(start).Milliseconds(),
+			OK: err == nil, ArgBytes: len(args), ResultBytes: size,
+		}
+		if err != nil {
+			call.ErrorClass, call.Error = ErrorClassOf(err, ""), err.Error()
+		}
+		record(call)
+	}
+	return res, err
+}
+
+// run 执行工具并返回结果、结果 JSON 的原始字节数与带分类的错误
+func (r *Registry) run(req ExecuteRequest, name string, args json.RawMessage) (interface{}, int, error) {
+	limits := r.LimitsFor(name)
+	source := r.GetSource(name)
+	parent := req.Ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := parent, context.CancelFunc(func() {})
+	if limits.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, limits.Timeout)
+	}
+	defer cancel()
+	req.Ctx = ctx
+
+	// 回调串行执行，且 Execute 返回后（含超时）丢弃执行函数的后续回调，调用方可直接读取收集的内容
+	var cbMu sync.Mutex
+	closed := false
+	guard := func(fn func(string)) func(string) {
+		if fn == nil {
+			return nil
+		}
+		return func(s string) {
+			cbMu.Lock()
+			defer cbMu.Unlock()
+			if !closed {
+				fn(s)
+			}
+		}
+	}
+	req.OnProgress, req.OnLog = guard(req.OnProgress), guard(req.OnLog)
+	if fn := req.OnFileProgress; fn != nil {
+		req.OnFileProgress = func(p FileProgress) {
+			cbMu.Lock()
+			defer cbMu.Unlock()
+			if !closed {
+				fn(p)
+			}
+		}
+	}
+	defer func() {
+		cbMu.Lock()
+		closed = true
+		cbMu.Unlock()
+	}()
+
+	type outcome struct {
+		res interface{}
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- outcome{err: NewToolError(ErrInternal, fmt.Errorf("tool panicked: %v", p))}
+			}
+		}()
+		res, err := r.execute(req, name, args)
+		done <- outcome{res, err}
+	}()
+	var o outcome
+	select {
+	case o = <-done:
+	case <-ctx.Done():
+		if parent.Err() == nil {
+			o.err = NewToolError(ErrTimeout, fmt.Errorf("工具 %s 执行超时（%s）", name, limits.Timeout))
+		} else {
+			o.err = NewToolError(ErrTimeout, ctx.Err())
+		}
+	}
+	if o.err != nil {
+		var te *ToolError
+		if errors.As(o.err, &te) {
+			return nil, 0, o.err
+		}
+		return nil, 0, NewToolError(ErrorClassOf(o.err, source), o.err)
+	}
+	if o.res == nil {
+		return nil, 0, nil
+	}
+	data, err := json.Marshal(o.res)
+	if err != nil || name == ReadResultTool {
+		return o.res, len(data), nil
+	}
+	return r.truncateResult(req.SessionID, o.res, data, limits.MaxResultBytes), len(data), nil
+}
+
+func (r *Registry) execute(req ExecuteRequest, name string, args json.RawMessage) (interface{}, error) {
+	r.mu.RLock()
+	t := r.tools[name]
+	r.mu.RUnlock()
+	if t != nil && t.Executor != nil {
+		return t.Executor(req, args)
+	}
 	exec, ok := builtin.GetExecutor(name)
 	if !ok {
+		if t == nil {
+			return nil, NewToolError(ErrNotFound, fmt.Errorf("工具 %s 不存在", name))
+		}
 		return nil, nil
 	}
 	ec := builtin.ExecutorContext{
-		Ctx:          req.Ctx,
-		SessionID:    req.SessionID,
-		Store:        req.Store,
-		TodoStore:    req.TodoStore,
-		GeminiClient: req.GeminiClient,
-		OnProgress:   req.OnProgress,
+		Ctx:            req.Ctx,
+		SessionID:      req.SessionID,
+		Store:          req.Store,
+		TodoStore:      req.TodoStore,
+		GeminiClient:   req.GeminiClient,
+		OnProgress:     req.OnProgress,
+		OnFileProgress: req.OnFileProgress,
+		Caller:         req.Caller,
+		TurnID:         req.TurnID,
+		CallID:         req.CallID,
 	}
 	return exec(ec, args)
 }
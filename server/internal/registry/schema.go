@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// SchemaFromJSON 把 JSON Schema（MCP inputSchema、OpenAPI 参数等）转换为 genai.Schema。
+// 仅保留 Gemini 支持的子集；无法识别的类型按 string 处理，$ref 等引用需调用方预先展开
+func SchemaFromJSON(raw any) *genai.Schema {
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return &genai.Schema{Type: genai.TypeObject, Properties: map[string]*genai.Schema{}}
+	}
+	return schemaFromMap(m, 0)
+}
+
+// schemaMaxDepth 嵌套转换的最大深度，防止自引用结构无限递归
+const schemaMaxDepth = 8
+
+func schemaFromMap(m map[string]any, depth int) *genai.Schema {
+	s := &genai.Schema{}
+	if d, ok := m["description"].(string); ok {
+		s.Description = d
+	}
+	if t, ok := m["title"].(string); ok {
+		s.Title = t
+	}
+	if f, ok := m["format"].(string); ok {
+		s.Format = f
+	}
+	typ := m["type"]
+	// ["string","null"] 形式的可空类型
+	if list, ok := typ.([]any); ok {
+		typ = nil
+		for _, v := range list {
+			if str, _ := v.(string); str == "null" {
+				t := true
+				s.Nullable = &t
+			} else if typ == nil {
+				typ = v
+			}
+		}
+	}
+	name, _ := typ.(string)
+	if name == "" {
+		switch {
+		case m["properties"] != nil:
+			name = "object"
+		case m["items"] != nil:
+			name = "array"
+		case m["enum"] != nil:
+			name = "string"
+		}
+	}
+	if depth >= schemaMaxDepth {
+		s.Type = genai.TypeString
+		return s
+	}
+	switch strings.ToLower(name) {
+	case "object", "":
+		s.Type = genai.TypeObject
+		s.Properties = map[string]*genai.Schema{}
+		if props, ok := m["properties"].(map[string]any); ok {
+			for k, v := range props {
+				if pm, ok := v.(map[string]any); ok {
+					s.Properties[k] = schemaFromMap(pm, depth+1)
+				}
+			}
+		}
+		if req, ok := m["required"].([]any); ok {
+			for _, v := range req {
+				if str, ok := v.(string); ok {
+					if _, exists := s.Properties[str]; exists {
+						s.Required = append(s.Required, str)
+					}
+				}
+			}
+		}
+	case "array":
+		s.Type = genai.TypeArray
+		if items, ok := m["items"].(map[string]any); ok {
+			s.Items = schemaFromMap(items, depth+1)
+		} else {
+			s.Items = &genai.Schema{Type: genai.TypeString}
+		}
+	case "integer":
+		s.Type = genai.TypeInteger
+	case "number":
+		s.Type = genai.TypeNumber
+	case "boolean":
+		s.Type = genai.TypeBoolean
+	default:
+		s.Type = genai.TypeString
+	}
+	if enum, ok := m["enum"].([]any); ok && s.Type == genai.TypeString {
+		for _, v := range enum {
+			if str, ok := v.(string); ok {
+				s.Enum = append(s.Enum, str)
+			}
+		}
+	}
+	return s
+}
+
+// SchemaToJSON 把 genai.Schema 转换回 JSON Schema（对外以 MCP inputSchema 暴露工具时使用）
+func SchemaToJSON(s *genai.Schema) map[string]any {
+	if s == nil {
+		return map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	m := map[string]any{}
+	if s.Type != "" && s.Type != genai.TypeUnspecified {
+		t := strings.ToLower(string(s.Type))
+		if s.Nullable != nil && *s.Nullable {
+			m["type"] = []any{t, "null"}
+		} else {
+			m["type"] = t
+		}
+	}
+	if s.Description != "" {
+		m["description"] = s.Description
+	}
+	if s.Title != "" {
+		m["title"] = s.Title
+	}
+	if s.Format != "" {
+		m["format"] = s.Format
+	}
+	if len(s.Enum) > 0 {
+		m["enum"] = s.Enum
+	}
+	if s.Type == genai.TypeObject {
+		props := map[string]any{}
+		for k, v := range s.Properties {
+			props[k] = SchemaToJSON(v)
+		}
+		m["properties"] = props
+		if len(s.Required) > 0 {
+			m["required"] = s.Required
+		}
+	}
+	if s.Items != nil {
+		m["items"] = SchemaToJSON(s.Items)
+	}
+	return m
+}
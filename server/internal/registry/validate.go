@@ -0,0 +1,120 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// ValidateArgs 按工具声明的参数 Schema 校验调用参数：必填项、基本类型与枚举。
+// 返回的错误归类为 invalid_args，消息中列出全部问题
+func ValidateArgs(def *genai.FunctionDeclaration, args json.RawMessage) error {
+	var v any = map[string]any{}
+	if len(args) > 0 && string(args) != "null" {
+		if err := json.Unmarshal(args, &v); err != nil {
+			return NewToolError(ErrInvalidArgs, fmt.Errorf("参数不是合法 JSON：%v", err))
+		}
+	}
+	if _, ok := v.(map[string]any); !ok {
+		return NewToolError(ErrInvalidArgs, fmt.Errorf("参数必须是 JSON 对象"))
+	}
+	schema := def.Parameters
+	if schema == nil {
+		schema = &genai.Schema{Type: genai.TypeObject}
+	}
+	var problems []string
+	validateValue(schema, v, "", &problems)
+	if len(problems) > 0 {
+		return NewToolError(ErrInvalidArgs, fmt.Errorf("参数校验失败：%s", strings.Join(problems, "；")))
+	}
+	return nil
+}
+
+func validateValue(s *genai.Schema, v any, path string, problems *[]string) {
+	name := path
+	if name == "" {
+		name = "参数"
+	}
+	if v == nil {
+		if s.Nullable == nil || !*s.Nullable {
+			*problems = append(*problems, name+" 不能为 null")
+		}
+		return
+	}
+	switch s.Type {
+	case genai.TypeObject:
+		m, ok := v.(map[string]any)
+		if !ok {
+			*problems = append(*problems, name+" 应为对象")
+			return
+		}
+		for _, req := range s.Required {
+			if _, ok := m[req]; !ok {
+				*problems = append(*problems, "缺少必填参数 "+join(path, req))
+			}
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ps, ok := s.Properties[k]; ok && ps != nil {
+				validateValue(ps, m[k], join(path, k), problems)
+			}
+		}
+	case genai.TypeArray:
+		list, ok := v.([]any)
+		if !ok {
+			*problems = append(*problems, name+" 应为数组")
+			return
+		}
+		if s.Items != nil {
+			for i, item := range list {
+				validateValue(s.Items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case genai.TypeString:
+		str, ok := v.(string)
+		if !ok {
+			*problems = append(*problems, name+" 应为字符串")
+			return
+		}
+		if len(s.Enum) > 0 && !contains(s.Enum, str) {
+			*problems = append(*problems, fmt.Sprintf("%s 须为 %s 之一", name, strings.Join(s.Enum, "、")))
+		}
+	case genai.TypeInteger:
+		f, ok := v.(float64)
+		if !ok || f != math.Trunc(f) {
+			*problems = append(*problems, name+" 应为整数")
+		}
+	case genai.TypeNumber:
+		if _, ok := v.(float64); !ok {
+			*problems = append(*problems, name+" 应为数字")
+		}
+	case genai.TypeBoolean:
+		if _, ok := v.(bool); !ok {
+			*problems = append(*problems, name+" 应为布尔值")
+		}
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -11,4 +11,5 @@ func RegisterBuiltinTools(reg *registry.Registry) {
 		blocking := def.Name == "propose_plan" || def.Name == "analyze_requirements"
 		reg.Register(def.Name, def, blocking)
 	}
+	reg.RegisterResultReader()
 }
@@ -0,0 +1,197 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	ErrHttpToolExists   = errors.New("http tool name already exists")
+	ErrHttpToolNotFound = errors.New("http tool not found")
+)
+
+const httpToolsFile = "http_tools.json"
+
+// HttpTool 用户自定义的声明式 HTTP 工具：参数经模板渲染为请求，响应按 JSONPath 提取后返回给模型
+type HttpTool struct {
+	ID               string            `json:"id"`
+	Name             string            `json:"name"` // 注册到 registry 的函数名
+	Description      string            `json:"description"`
+	Parameters       json.RawMessage   `json:"parameters,omitempty"` // 参数 JSON Schema
+	Method           string            `json:"method"`
+	URL              string            `json:"url"`               // URL 模板
+	Headers          map[string]string `json:"headers,omitempty"` // 请求头模板，值加密落盘
+	Body             string            `json:"body,omitempty"`    // 请求体模板
+	ResponsePath     string            `json:"responsePath,omitempty"`
+	TimeoutMs        int               `json:"timeoutMs,omitempty"`
+	MaxResponseBytes int64             `json:"maxResponseBytes,omitempty"`
+	CreatedAt        int64             `json:"createdAt"`
+	UpdatedAt        int64             `json:"updatedAt"`
+}
+
+func (t HttpTool) clone() HttpTool {
+	c := t
+	c.Parameters = append(json.RawMessage(nil), t.Parameters...)
+	c.Headers = cloneStringMap(t.Headers)
+	return c
+}
+
+type HttpToolStore struct {
+	mu      sync.RWMutex
+	dir     string
+	tools   []HttpTool
+	secrets *SecretBox
+}
+
+// NewHttpToolStore 工具定义保存在 dir/http_tools.json，请求头值用 box 加密
+func NewHttpToolStore(dir string, box *SecretBox) (*HttpToolStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if box == nil {
+		var err error
+		if box, err = NewSecretBox(dir, ""); err != nil {
+			return nil, err
+		}
+	}
+	s := &HttpToolStore{dir: dir, tools: []HttpTool{}, secrets: box}
+	if err := loadSecretStore(s.filePath(), s.load); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *HttpToolStore) filePath() string {
+	return filepath.Join(s.dir, httpToolsFile)
+}
+
+func (s *HttpToolStore) load() error {
+	data, err := os.ReadFile(s.filePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var parsed []HttpTool
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	for i := range parsed {
+		for k, v := range parsed[i].Headers {
+			if parsed[i].Headers[k], err = s.secrets.Open(v); err != nil {
+				return err
+			}
+		}
+	}
+	s.tools = parsed
+	if s.tools == nil {
+		s.tools = []HttpTool{}
+	}
+	return nil
+}
+
+func (s *HttpToolStore) save() error {
+	persisted := make([]HttpTool, len(s.tools))
+	for i, t := range s.tools {
+		persisted[i] = t.clone()
+		for k, v := range persisted[i].Headers {
+			sealed, err := s.secrets.Seal(v)
+			if err != nil {
+				return err
+			}
+			persisted[i].Headers[k] = sealed
+		}
+	}
+	data, err := json.MarshalIndent(persisted, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.filePath(), data, 0600)
+}
+
+func (s *HttpToolStore) List() []HttpTool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]HttpTool, len(s.tools))
+	for i, t := range s.tools {
+		out[i] = t.clone()
+	}
+	return out
+}
+
+func (s *HttpToolStore) Get(id string) *HttpTool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.tools {
+		if t.ID == id {
+			c := t.clone()
+			return &c
+		}
+	}
+	return nil
+}
+
+// Add 新增工具，ID 与时间戳由存储生成；名称不可重复
+func (s *HttpToolStore) Add(t HttpTool) (HttpTool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nameTaken("", t.Name) {
+		return HttpTool{}, ErrHttpToolExists
+	}
+	t.ID = "http_" + randomID()
+	t.CreatedAt = nowMs()
+	t.UpdatedAt = t.CreatedAt
+	s.tools = append(s.tools, t.clone())
+	if err := s.save(); err != nil {
+		return HttpTool{}, err
+	}
+	return t, nil
+}
+
+// Replace 整体替换指定 ID 的工具定义，保留创建时间
+func (s *HttpToolStore) Replace(t HttpTool) (HttpTool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.tools {
+		if s.tools[i].ID != t.ID {
+			continue
+		}
+		if s.nameTaken(t.ID, t.Name) {
+			return HttpTool{}, ErrHttpToolExists
+		}
+		t.CreatedAt = s.tools[i].CreatedAt
+		t.UpdatedAt = nowMs()
+		s.tools[i] = t.clone()
+		if err := s.save(); err != nil {
+			return HttpTool{}, err
+		}
+		return t, nil
+	}
+	return HttpTool{}, ErrHttpToolNotFound
+}
+
+func (s *HttpToolStore) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.tools {
+		if t.ID == id {
+			s.tools = append(s.tools[:i], s.tools[i+1:]...)
+			return s.save()
+		}
+	}
+	return ErrHttpToolNotFound
+}
+
+// nameTaken 除 skipID 外是否已有同名工具，调用方需持有锁
+func (s *HttpToolStore) nameTaken(skipID, name string) bool {
+	for _, t := range s.tools {
+		if t.ID != skipID && t.Name == name {
+			return true
+		}
+	}
+	return false
+}
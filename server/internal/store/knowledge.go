@@ -0,0 +1,99 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// 导入文档提取出的文本单独存放在 knowledge/{sessionID}/{documentID}.md，块的偏移量以它为准
+const knowledgeDirName = "knowledge"
+
+var ErrDocumentNotFound = errors.New("knowledge document not found")
+
+// ChunkSource 块在来源文档中的位置；Start、End 为提取文本中的字符（rune）偏移，找不到时为 -1
+type ChunkSource struct {
+	DocumentID string   `json:"documentId"`
+	Document   string   `json:"document"`
+	Section    []string `json:"section,omitempty"`
+	Start      int      `json:"start"`
+	End        int      `json:"end"`
+}
+
+// KnowledgeDocument 导入到知识库的文档
+type KnowledgeDocument struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Format      string `json:"format"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int    `json:"size"`
+	Chars       int    `json:"chars"`
+	Chunks      int    `json:"chunks"`
+	UploadedAt  int64  `json:"uploadedAt"`
+}
+
+// NewDocumentID 生成文档 ID，供切分前标注块的来源
+func NewDocumentID() string {
+	return "doc_" + randomID()
+}
+
+func (s *SessionStore) documentPath(sessionID, docID string) string {
+	return filepath.Join(s.dir, knowledgeDirName, sessionID, filepath.Base(docID)+".md")
+}
+
+// AddKnowledgeDocument 保存文档的提取文本，并把文档记录与块追加到会话；补全 doc 的 ID、块数与导入时间
+func (s *SessionStore) AddKnowledgeDocument(sessionID string, doc *KnowledgeDocument, text string, chunks []KnowledgeChunk) error {
+	cur, err := s.GetSessionDoc(sessionID)
+	if err != nil || cur == nil {
+		return err
+	}
+	if doc.ID == "" {
+		doc.ID = NewDocumentID()
+	}
+	doc.Chunks = len(chunks)
+	doc.UploadedAt = nowMs()
+	s.mu.Lock()
+	p := s.documentPath(sessionID, doc.ID)
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err == nil {
+		err = os.WriteFile(p, []byte(text), 0644)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	prev := len(cur.KnowledgeChunks)
+	cur.KnowledgeDocuments = append(cur.KnowledgeDocuments, *doc)
+	cur.KnowledgeChunks = append(cur.KnowledgeChunks, chunks...)
+	if err := s.SaveSession(sessionID, cur); err != nil {
+		return err
+	}
+	s.indexAppended(sessionID, prev, chunks)
+	return nil
+}
+
+// GetKnowledgeDocument 返回文档记录与提取文本
+func (s *SessionStore) GetKnowledgeDocument(sessionID, docID string) (*KnowledgeDocument, string, error) {
+	cur, err := s.GetSessionDoc(sessionID)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, d := range cur.KnowledgeDocuments {
+		if d.ID != docID {
+			continue
+		}
+		s.mu.RLock()
+		data, err := os.ReadFile(s.documentPath(sessionID, docID))
+		s.mu.RUnlock()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, "", err
+		}
+		return &d, string(data), nil
+	}
+	return nil, "", ErrDocumentNotFound
+}
+
+// removeDocuments 删除会话的文档文本；调用方须持有写锁
+func (s *SessionStore) removeDocuments(sessionID string) error {
+	return os.RemoveAll(filepath.Join(s.dir, knowledgeDirName, sessionID))
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"math"
+	"strings"
+
+	"agentic-demo/server/internal/bm25"
+)
+
+// snippetRunes search_knowledge 返回片段的长度上限
+const snippetRunes = 160
+
+// 每个会话的知识库倒排索引保存在内存中：首次检索时构建，追加块时增量更新，块被替换或清空时丢弃
+
+// KnowledgeMatch 检索命中的块，Index 为块在会话知识库中的位置
+type KnowledgeMatch struct {
+	KnowledgeChunk
+	Index   int      `json:"index"`
+	Score   float64  `json:"score"`
+	Snippet string   `json:"snippet"`
+	Terms   []string `json:"terms"`
+}
+
+// indexText 参与检索的文本：摘要、章节路径与内容
+func indexText(c KnowledgeChunk) string {
+	parts := []string{c.Summary}
+	if c.Source != nil {
+		parts = append(parts, strings.Join(c.Source.Section, " "))
+	}
+	return strings.Join(append(parts, c.Content), "\n")
+}
+
+// SearchKnowledge 按 BM25 检索会话知识库，返回命中的块（带分数与高亮片段）和块总数
+func (s *SessionStore) SearchKnowledge(sessionID, query string, limit int) ([]KnowledgeMatch, int, error) {
+	chunks, err := s.GetKnowledgeChunks(sessionID)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.indexMu.Lock()
+	idx := s.indexes[sessionID]
+	if idx == nil || idx.Len() != len(chunks) {
+		idx = bm25.New()
+		for _, c := range chunks {
+			idx.Add(indexText(c))
+		}
+		s.indexes[sessionID] = idx
+	}
+	hits := idx.Search(query, limit)
+	s.indexMu.Unlock()
+	matches := make([]KnowledgeMatch, 0, len(hits))
+	for _, h := range hits {
+		c := chunks[h.Doc]
+		matches = append(matches, KnowledgeMatch{
+			KnowledgeChunk: c,
+			Index:          h.Doc,
+			Score:          math.Round(h.Score*1e4) / 1e4,
+			Snippet:        bm25.Snippet(c.Content, h.Terms, snippetRunes),
+			Terms:          h.Terms,
+		})
+	}
+	return matches, len(chunks), nil
+}
+
+// indexAppended 追加块后增量更新已构建的索引；索引与追加前的块数不一致时丢弃，下次检索时重建
+func (s *SessionStore) indexAppended(sessionID string, prev int, chunks []KnowledgeChunk) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	idx := s.indexes[sessionID]
+	if idx == nil {
+		return
+	}
+	if idx.Len() != prev {
+		delete(s.indexes, sessionID)
+		return
+	}
+	for _, c := range chunks {
+		idx.Add(indexText(c))
+	}
+}
+
+func (s *SessionStore) dropIndex(sessionID string) {
+	s.indexMu.Lock()
+	delete(s.indexes, sessionID)
+	s.indexMu.Unlock()
+}
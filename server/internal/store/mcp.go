@@ -5,6 +5,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -15,24 +16,124 @@ var (
 
 const mcpServersFile = "mcp_servers.json"
 
+// MCP 传输方式：http 为远程 SSE/Streamable HTTP，stdio 由后端拉起子进程并通过 stdin/stdout 通信
+const (
+	McpTransportHTTP  = "http"
+	McpTransportStdio = "stdio"
+)
+
 type McpServer struct {
-	ID   string `json:"id"`
-	Name string `json:"name,omitempty"`
-	URL  string `json:"url"`
+	ID        string            `json:"id"`
+	Name      string            `json:"name,omitempty"`
+	URL       string            `json:"url"`
+	Transport string            `json:"transport,omitempty"` // 空值视为 http
+	Command   string            `json:"command,omitempty"`   // stdio：可执行文件
+	Args      []string          `json:"args,omitempty"`      // stdio：命令行参数
+	Env       map[string]string `json:"env,omitempty"`       // stdio：追加的环境变量，值加密落盘
+	Cwd       string            `json:"cwd,omitempty"`       // stdio：工作目录
+	Headers   map[string]string `json:"headers,omitempty"`   // http：附加请求头，值加密落盘
+	Auth      *McpAuth          `json:"auth,omitempty"`      // http：鉴权配置，敏感字段加密落盘
+}
+
+// MCP 鉴权方式
+const (
+	McpAuthNone   = "none"
+	McpAuthBearer = "bearer"
+	McpAuthBasic  = "basic"
+	McpAuthOAuth2 = "oauth2" // client credentials
+)
+
+// McpAuth HTTP 传输的鉴权配置；Token、Password、ClientSecret 为敏感字段
+type McpAuth struct {
+	Type         string   `json:"type"`
+	Token        string   `json:"token,omitempty"`
+	Username     string   `json:"username,omitempty"`
+	Password     string   `json:"password,omitempty"`
+	TokenURL     string   `json:"tokenUrl,omitempty"`
+	ClientID     string   `json:"clientId,omitempty"`
+	ClientSecret string   `json:"clientSecret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+// IsStdio 是否为后端托管的 stdio 服务器
+func (s McpServer) IsStdio() bool {
+	return s.Transport == McpTransportStdio
+}
+
+// clone 深拷贝，避免调用方修改 map/指针影响存储内数据
+func (s McpServer) clone() McpServer {
+	c := s
+	c.Args = append([]string(nil), s.Args...)
+	c.Env = cloneStringMap(s.Env)
+	c.Headers = cloneStringMap(s.Headers)
+	if s.Auth != nil {
+		a := *s.Auth
+		a.Scopes = append([]string(nil), s.Auth.Scopes...)
+		c.Auth = &a
+	}
+	return c
+}
+
+func cloneStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// MergeMcpAuth 合并鉴权更新：next 中为空的敏感字段沿用 prev（同类型时），便于前端在不回显密钥的情况下修改其他字段；
+// next.Type 为 none 时清除鉴权
+func MergeMcpAuth(prev, next *McpAuth) *McpAuth {
+	if next == nil {
+		return prev
+	}
+	if next.Type == "" || next.Type == McpAuthNone {
+		return nil
+	}
+	merged := *next
+	if prev != nil && prev.Type == next.Type {
+		if merged.Token == "" {
+			merged.Token = prev.Token
+		}
+		if merged.Password == "" {
+			merged.Password = prev.Password
+		}
+		if merged.ClientSecret == "" {
+			merged.ClientSecret = prev.ClientSecret
+		}
+	}
+	return &merged
 }
 
 type McpStore struct {
 	mu      sync.RWMutex
 	dir     string
 	servers []McpServer
+	secrets *SecretBox
 }
 
+// NewMcpStore 使用数据目录下的 secret.key 加密敏感字段
 func NewMcpStore(dir string) (*McpStore, error) {
+	box, err := NewSecretBox(dir, "")
+	if err != nil {
+		return nil, err
+	}
+	return NewMcpStoreWithSecret(dir, box)
+}
+
+// NewMcpStoreWithSecret 使用指定的 SecretBox 加密敏感字段
+func NewMcpStoreWithSecret(dir string, box *SecretBox) (*McpStore, error) {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, err
 	}
-	s := &McpStore{dir: dir, servers: []McpServer{}}
-	_ = s.load()
+	s := &McpStore{dir: dir, servers: []McpServer{}, secrets: box}
+	if err := loadSecretStore(s.filePath(), s.load); err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
@@ -52,6 +153,11 @@ func (s *McpStore) load() error {
 	if err := json.Unmarshal(data, &parsed); err != nil {
 		return err
 	}
+	for i := range parsed {
+		if err := s.transformSecrets(&parsed[i], s.secrets.Open); err != nil {
+			return err
+		}
+	}
 	s.servers = parsed
 	if s.servers == nil {
 		s.servers = []McpServer{}
@@ -60,18 +166,47 @@ func (s *McpStore) load() error {
 }
 
 func (s *McpStore) save() error {
-	data, err := json.MarshalIndent(s.servers, "", "  ")
+	persisted := make([]McpServer, len(s.servers))
+	for i, svr := range s.servers {
+		persisted[i] = svr.clone()
+		if err := s.transformSecrets(&persisted[i], s.secrets.Seal); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(persisted, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.filePath(), data, 0644)
+	return os.WriteFile(s.filePath(), data, 0600)
+}
+
+// transformSecrets 对敏感字段逐一执行加密或解密
+func (s *McpStore) transformSecrets(svr *McpServer, fn func(string) (string, error)) error {
+	var err error
+	for _, m := range []map[string]string{svr.Headers, svr.Env} {
+		for k, v := range m {
+			if m[k], err = fn(v); err != nil {
+				return err
+			}
+		}
+	}
+	if a := svr.Auth; a != nil {
+		for _, f := range []*string{&a.Token, &a.Password, &a.ClientSecret} {
+			if *f, err = fn(*f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 func (s *McpStore) List() []McpServer {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	out := make([]McpServer, len(s.servers))
-	copy(out, s.servers)
+	for i, svr := range s.servers {
+		out[i] = svr.clone()
+	}
 	return out
 }
 
@@ -80,7 +215,7 @@ func (s *McpStore) Get(id string) (*McpServer, int) {
 	defer s.mu.RUnlock()
 	for i, svr := range s.servers {
 		if svr.ID == id {
-			c := svr
+			c := svr.clone()
 			return &c, i
 		}
 	}
@@ -88,17 +223,21 @@ func (s *McpStore) Get(id string) (*McpServer, int) {
 }
 
 func (s *McpStore) Add(name, url string) (McpServer, error) {
+	return s.AddServer(McpServer{Name: name, URL: url})
+}
+
+// AddServer 新增服务器（http 或 stdio），ID 由存储生成；同一地址/命令不可重复添加
+func (s *McpStore) AddServer(svr McpServer) (McpServer, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	norm := normalizeMcpUrl(url)
-	for _, svr := range s.servers {
-		if normalizeMcpUrl(svr.URL) == norm {
+	key := McpServerKey(svr)
+	for _, other := range s.servers {
+		if McpServerKey(other) == key {
 			return McpServer{}, ErrMcpExists
 		}
 	}
-	id := genMcpID()
-	svr := McpServer{ID: id, Name: name, URL: url}
-	s.servers = append(s.servers, svr)
+	svr.ID = genMcpID()
+	s.servers = append(s.servers, svr.clone())
 	if err := s.save(); err != nil {
 		return McpServer{}, err
 	}
@@ -114,11 +253,10 @@ func (s *McpStore) Update(id string, updates map[string]string) error {
 				s.servers[i].Name = name
 			}
 			if url, ok := updates["url"]; ok {
-				norm := normalizeMcpUrl(url)
-				for j, other := range s.servers {
-					if j != i && normalizeMcpUrl(other.URL) == norm {
-						return ErrMcpExists
-					}
+				next := s.servers[i]
+				next.URL = url
+				if s.keyTaken(i, next) {
+					return ErrMcpExists
 				}
 				s.servers[i].URL = url
 			}
@@ -128,6 +266,47 @@ func (s *McpStore) Update(id string, updates map[string]string) error {
 	return ErrMcpNotFound
 }
 
+// Replace 整体替换指定 ID 的服务器配置（用于 stdio 命令、参数等非字符串字段的更新）
+func (s *McpStore) Replace(svr McpServer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.servers {
+		if s.servers[i].ID == svr.ID {
+			if s.keyTaken(i, svr) {
+				return ErrMcpExists
+			}
+			s.servers[i] = svr.clone()
+			return s.save()
+		}
+	}
+	return ErrMcpNotFound
+}
+
+// FindConflict 返回与 svr 地址/命令相同的已有服务器（http 按 normalizeMcpUrl 比较），无冲突时返回 nil
+func (s *McpStore) FindConflict(svr McpServer) *McpServer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key := McpServerKey(svr)
+	for _, other := range s.servers {
+		if other.ID != svr.ID && McpServerKey(other) == key {
+			c := other.clone()
+			return &c
+		}
+	}
+	return nil
+}
+
+// keyTaken 判断除下标 skip 外是否已有相同地址/命令的服务器，调用方需持有锁
+func (s *McpStore) keyTaken(skip int, svr McpServer) bool {
+	key := McpServerKey(svr)
+	for j, other := range s.servers {
+		if j != skip && McpServerKey(other) == key {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *McpStore) Remove(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -144,6 +323,14 @@ func genMcpID() string {
 	return "mcp_" + randomID()
 }
 
+// McpServerKey 服务器去重键：http 按规范化 URL，stdio 按命令行
+func McpServerKey(svr McpServer) string {
+	if svr.IsStdio() {
+		return "stdio:" + strings.TrimSpace(svr.Command+" "+strings.Join(svr.Args, " "))
+	}
+	return normalizeMcpUrl(svr.URL)
+}
+
 func normalizeMcpUrl(url string) string {
 	u := url
 	for len(u) > 0 && (u[len(u)-1] == '/' || u[len(u)-1] == ' ') {
@@ -19,13 +19,35 @@ const (
 )
 
 type McpServerStatusEntry struct {
-	Status      string `json:"status"`
-	LastCheckAt int64  `json:"lastCheckAt"`
-	LastError   string `json:"lastError,omitempty"`
-	ToolsCount  int    `json:"toolsCount,omitempty"`
-	Endpoint    string `json:"endpoint,omitempty"` // 从 SSE endpoint 事件解析出的 POST 地址
+	Status      string           `json:"status"`
+	LastCheckAt int64            `json:"lastCheckAt"`
+	LastError   string           `json:"lastError,omitempty"`
+	ToolsCount  int              `json:"toolsCount,omitempty"`
+	Endpoint    string           `json:"endpoint,omitempty"` // 从 SSE endpoint 事件解析出的 POST 地址
+	LatencyMs   int64            `json:"latencyMs,omitempty"`
+	History     []McpCheckRecord `json:"history,omitempty"` // 滚动检查历史，最旧在前
 }
 
+// McpCheckRecord 单次检查记录
+type McpCheckRecord struct {
+	At         int64  `json:"at"`
+	Status     string `json:"status"`
+	LatencyMs  int64  `json:"latencyMs"`
+	Error      string `json:"error,omitempty"`
+	ToolsCount int    `json:"toolsCount,omitempty"`
+}
+
+// McpStatusTransition 相邻两次检查之间的状态变化
+type McpStatusTransition struct {
+	At    int64  `json:"at"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Error string `json:"error,omitempty"`
+}
+
+// mcpHistoryLimit 每个服务器保留的检查记录条数
+const mcpHistoryLimit = 200
+
 type McpStatusStore struct {
 	mu   sync.RWMutex
 	dir  string
@@ -72,15 +94,14 @@ func (s *McpStatusStore) load() error {
 	return nil
 }
 
+// save 持久化全部条目，调用方需持有锁
 func (s *McpStatusStore) save() error {
-	s.mu.RLock()
 	p := mcpStatusPersist{Entries: make(map[string]McpServerStatusEntry)}
 	for id, e := range s.byID {
 		if e != nil {
 			p.Entries[id] = *e
 		}
 	}
-	s.mu.RUnlock()
 	data, err := json.MarshalIndent(p, "", "  ")
 	if err != nil {
 		return err
@@ -112,6 +133,7 @@ func (s *McpStatusStore) Get(id string) *McpServerStatusEntry {
 	defer s.mu.RUnlock()
 	if e, ok := s.byID[id]; ok {
 		cpy := *e
+		cpy.History = append([]McpCheckRecord(nil), e.History...)
 		return &cpy
 	}
 	return nil
@@ -147,3 +169,66 @@ func (s *McpStatusStore) SetResult(id string, status string, errMsg string, tool
 		s.save()
 	}
 }
+
+// SetToolsCount 更新工具数量（收到 tools/list_changed 后重新列举时），不追加检查历史
+func (s *McpStatusStore) SetToolsCount(id string, toolsCount int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.byID[id]; ok && e.ToolsCount != toolsCount {
+		e.ToolsCount = toolsCount
+		s.save()
+	}
+}
+
+// RecordCheck 写入一次检查结果并追加到滚动历史；若条目不存在则先创建
+func (s *McpStatusStore) RecordCheck(id string, rec McpCheckRecord, endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.byID[id]
+	if !ok || e == nil {
+		e = &McpServerStatusEntry{Status: McpStatusUnknown}
+		s.byID[id] = e
+	}
+	if rec.At == 0 {
+		rec.At = time.Now().UnixMilli()
+	}
+	e.Status = rec.Status
+	e.LastCheckAt = rec.At
+	e.LastError = rec.Error
+	e.ToolsCount = rec.ToolsCount
+	e.LatencyMs = rec.LatencyMs
+	if endpoint != "" {
+		e.Endpoint = endpoint
+	}
+	e.History = append(e.History, rec)
+	if len(e.History) > mcpHistoryLimit {
+		e.History = e.History[len(e.History)-mcpHistoryLimit:]
+	}
+	s.save()
+}
+
+// Uptime 返回历史记录中 ready 的占比（0-100）；无历史时返回 -1
+func (e *McpServerStatusEntry) Uptime() float64 {
+	if len(e.History) == 0 {
+		return -1
+	}
+	ready := 0
+	for _, r := range e.History {
+		if r.Status == McpStatusReady {
+			ready++
+		}
+	}
+	return float64(ready) * 100 / float64(len(e.History))
+}
+
+// Transitions 返回最近 limit 次状态变化，最新在前
+func (e *McpServerStatusEntry) Transitions(limit int) []McpStatusTransition {
+	out := []McpStatusTransition{}
+	for i := len(e.History) - 1; i > 0 && (limit <= 0 || len(out) < limit); i-- {
+		cur, prev := e.History[i], e.History[i-1]
+		if cur.Status != prev.Status {
+			out = append(out, McpStatusTransition{At: cur.At, From: prev.Status, To: cur.Status, Error: cur.Error})
+		}
+	}
+	return out
+}
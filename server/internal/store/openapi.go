@@ -0,0 +1,197 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrOpenAPINotFound = errors.New("openapi spec not found")
+
+const openAPISpecsFile = "openapi_specs.json"
+
+// OpenAPISpec 导入的 OpenAPI 文档：保存原文、选中的操作与该文档共用的鉴权
+type OpenAPISpec struct {
+	ID         string            `json:"id"`
+	Title      string            `json:"title"`
+	Version    string            `json:"version,omitempty"`
+	Prefix     string            `json:"prefix"`            // 工具名前缀
+	BaseURL    string            `json:"baseUrl,omitempty"` // 覆盖文档 servers[0].url
+	Source     string            `json:"source"`            // upload 或本地文件路径
+	Document   json.RawMessage   `json:"document"`
+	Operations []string          `json:"operations"`        // 选中的操作，形如 "GET /pets/{id}"
+	Headers    map[string]string `json:"headers,omitempty"` // 附加请求头（如 API Key），值加密落盘
+	Query      map[string]string `json:"query,omitempty"`   // 附加查询参数（如 api_key），值加密落盘
+	Auth       *McpAuth          `json:"auth,omitempty"`    // bearer / basic / oauth2，敏感字段加密落盘
+	CreatedAt  int64             `json:"createdAt"`
+	UpdatedAt  int64             `json:"updatedAt"`
+}
+
+func (s OpenAPISpec) clone() OpenAPISpec {
+	c := s
+	c.Document = append(json.RawMessage(nil), s.Document...)
+	c.Operations = append([]string(nil), s.Operations...)
+	c.Headers = cloneStringMap(s.Headers)
+	c.Query = cloneStringMap(s.Query)
+	if s.Auth != nil {
+		a := *s.Auth
+		a.Scopes = append([]string(nil), s.Auth.Scopes...)
+		c.Auth = &a
+	}
+	return c
+}
+
+type OpenAPIStore struct {
+	mu      sync.RWMutex
+	dir     string
+	specs   []OpenAPISpec
+	secrets *SecretBox
+}
+
+// NewOpenAPIStore 文档保存在 dir/openapi_specs.json，鉴权信息用 box 加密
+func NewOpenAPIStore(dir string, box *SecretBox) (*OpenAPIStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if box == nil {
+		var err error
+		if box, err = NewSecretBox(dir, ""); err != nil {
+			return nil, err
+		}
+	}
+	s := &OpenAPIStore{dir: dir, specs: []OpenAPISpec{}, secrets: box}
+	if err := loadSecretStore(s.filePath(), s.load); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *OpenAPIStore) filePath() string {
+	return filepath.Join(s.dir, openAPISpecsFile)
+}
+
+func (s *OpenAPIStore) load() error {
+	data, err := os.ReadFile(s.filePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var parsed []OpenAPISpec
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	for i := range parsed {
+		if err := s.transformSecrets(&parsed[i], s.secrets.Open); err != nil {
+			return err
+		}
+	}
+	s.specs = parsed
+	if s.specs == nil {
+		s.specs = []OpenAPISpec{}
+	}
+	return nil
+}
+
+func (s *OpenAPIStore) save() error {
+	persisted := make([]OpenAPISpec, len(s.specs))
+	for i, spec := range s.specs {
+		persisted[i] = spec.clone()
+		if err := s.transformSecrets(&persisted[i], s.secrets.Seal); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(persisted, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.filePath(), data, 0600)
+}
+
+func (s *OpenAPIStore) transformSecrets(spec *OpenAPISpec, fn func(string) (string, error)) error {
+	var err error
+	for _, m := range []map[string]string{spec.Headers, spec.Query} {
+		for k, v := range m {
+			if m[k], err = fn(v); err != nil {
+				return err
+			}
+		}
+	}
+	if a := spec.Auth; a != nil {
+		for _, f := range []*string{&a.Token, &a.Password, &a.ClientSecret} {
+			if *f, err = fn(*f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *OpenAPIStore) List() []OpenAPISpec {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]OpenAPISpec, len(s.specs))
+	for i, spec := range s.specs {
+		out[i] = spec.clone()
+	}
+	return out
+}
+
+func (s *OpenAPIStore) Get(id string) *OpenAPISpec {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, spec := range s.specs {
+		if spec.ID == id {
+			c := spec.clone()
+			return &c
+		}
+	}
+	return nil
+}
+
+// Add 保存新文档，ID 与时间戳由存储生成
+func (s *OpenAPIStore) Add(spec OpenAPISpec) (OpenAPISpec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	spec.ID = "oas_" + randomID()
+	spec.CreatedAt = nowMs()
+	spec.UpdatedAt = spec.CreatedAt
+	s.specs = append(s.specs, spec.clone())
+	if err := s.save(); err != nil {
+		return OpenAPISpec{}, err
+	}
+	return spec, nil
+}
+
+// Replace 整体替换指定 ID 的文档配置，保留创建时间
+func (s *OpenAPIStore) Replace(spec OpenAPISpec) (OpenAPISpec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.specs {
+		if s.specs[i].ID == spec.ID {
+			spec.CreatedAt = s.specs[i].CreatedAt
+			spec.UpdatedAt = nowMs()
+			s.specs[i] = spec.clone()
+			if err := s.save(); err != nil {
+				return OpenAPISpec{}, err
+			}
+			return spec, nil
+		}
+	}
+	return OpenAPISpec{}, ErrOpenAPINotFound
+}
+
+func (s *OpenAPIStore) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, spec := range s.specs {
+		if spec.ID == id {
+			s.specs = append(s.specs[:i], s.specs[i+1:]...)
+			return s.save()
+		}
+	}
+	return ErrOpenAPINotFound
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	secretKeyFile = "secret.key"
+	sealedPrefix  = "enc:v1:"
+)
+
+var ErrSecretCorrupt = errors.New("encrypted secret corrupt or key mismatch")
+
+// loadSecretStore 加载含加密字段的存储文件，失败时返回错误而不是以空列表启动：
+// 密钥变更（AGENT_SECRET_KEY 改变或 secret.key 丢失）后若照常启动，下一次保存会覆盖原文件
+func loadSecretStore(path string, load func() error) error {
+	if err := load(); err != nil {
+		if errors.Is(err, ErrSecretCorrupt) {
+			return fmt.Errorf("load %s: %w (check AGENT_SECRET_KEY or %s)", path, err, secretKeyFile)
+		}
+		return fmt.Errorf("load %s: %w", path, err)
+	}
+	return nil
+}
+
+// SecretBox 使用 AES-256-GCM 加密需落盘的敏感字段（token、密码、鉴权头等）
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+// NewSecretBox 由 passphrase 派生密钥；passphrase 为空时使用 dir 下的 secret.key，不存在则随机生成
+func NewSecretBox(dir, passphrase string) (*SecretBox, error) {
+	var key []byte
+	if passphrase != "" {
+		sum := sha256.Sum256([]byte(passphrase))
+		key = sum[:]
+	} else {
+		var err error
+		if key, err = loadOrCreateKey(dir); err != nil {
+			return nil, err
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+func loadOrCreateKey(dir string) ([]byte, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	p := filepath.Join(dir, secretKeyFile)
+	if data, err := os.ReadFile(p); err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) != 32 {
+			return nil, errors.New("invalid " + secretKeyFile)
+		}
+		return key, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(p, []byte(hex.EncodeToString(key)), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Seal 加密明文；空串原样返回
+func (b *SecretBox) Seal(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open 解密 Seal 的输出；无加密前缀的值视为历史明文，原样返回
+func (b *SecretBox) Open(s string) (string, error) {
+	if !strings.HasPrefix(s, sealedPrefix) {
+		return s, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, sealedPrefix))
+	if err != nil || len(raw) < b.aead.NonceSize() {
+		return "", ErrSecretCorrupt
+	}
+	nonce, ct := raw[:b.aead.NonceSize()], raw[b.aead.NonceSize():]
+	plain, err := b.aead.Open(nil, nonce, ct, nil)
+	if err != nil {
+		return "", ErrSecretCorrupt
+	}
+	return string(plain), nil
+}
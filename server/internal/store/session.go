@@ -9,21 +9,33 @@ import (
 	"sort"
 	"sync"
 	"time"
+
+	"agentic-demo/server/internal/bm25"
 )
 
 const activeSessionFile = "active.txt"
 
 type SessionStore struct {
-	mu     sync.RWMutex
-	dir    string
-	active string
+	mu            sync.RWMutex
+	dir           string
+	active        string
+	vfsLimits     VFSLimits
+	historyLimits VFSHistoryLimits
+	// writing 正在流式写入、尚未持久化的文件：sessionID -> path -> 文件
+	writing map[string]map[string]VfsFile
+	// indexes 知识库检索索引，见 knowledge_index.go
+	indexMu sync.Mutex
+	indexes map[string]*bm25.Index
 }
 
 func NewSessionStore(dir string) (*SessionStore, error) {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, err
 	}
-	s := &SessionStore{dir: dir}
+	s := &SessionStore{dir: dir, writing: map[string]map[string]VfsFile{}, indexes: map[string]*bm25.Index{}}
+	if err := s.migrateVFS(); err != nil {
+		return nil, err
+	}
 	s.active, _ = s.readActive()
 	return s, nil
 }
@@ -35,6 +47,8 @@ type AgentSessionState struct {
 	UIMessages     []any                  `json:"uiMessages"`
 	VFS            map[string]VfsFile     `json:"vfs"`
 	KnowledgeChunks []KnowledgeChunk       `json:"knowledgeChunks,omitempty"`
+	KnowledgeDocuments []KnowledgeDocument `json:"knowledgeDocuments,omitempty"`
+	Tools          *SessionTools          `json:"tools,omitempty"`
 	LastUpdated    int64                  `json:"lastUpdated"`
 }
 
@@ -43,12 +57,15 @@ type VfsFile struct {
 	Content  string `json:"content"`
 	Language string `json:"language"`
 	IsWriting bool  `json:"isWriting,omitempty"`
+	UpdatedAt int64 `json:"updatedAt,omitempty"`
 }
 
 type KnowledgeChunk struct {
 	Content        string `json:"content"`
 	Summary        string `json:"summary"`
 	BoundaryReason string `json:"boundaryReason"`
+	// Source 从文档导入的块记录来源
+	Source *ChunkSource `json:"source,omitempty"`
 }
 
 type SessionMeta struct {
@@ -83,6 +100,9 @@ func (s *SessionStore) CreateSession() (string, error) {
 	if err := s.writeSession(id, state); err != nil {
 		return "", err
 	}
+	if err := s.replaceVFS(id, state.VFS); err != nil {
+		return "", err
+	}
 	s.active = id
 	_ = os.WriteFile(filepath.Join(s.dir, activeSessionFile), []byte(id), 0644)
 	return id, nil
@@ -94,15 +114,29 @@ func (s *SessionStore) GetSession(sessionID string) (*AgentSessionState, error)
 	return s.readSession(sessionID)
 }
 
+// GetSessionDoc 只读取会话文档，返回值的 VFS 为 nil；不需要文件内容时使用，避免读取全部 VFS
+func (s *SessionStore) GetSessionDoc(sessionID string) (*AgentSessionState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.readSessionDoc(sessionID)
+}
+
+// SaveSession 保存会话文档；VFS 单独存储，只在会话还没有 VFS 时用 state.VFS 初始化
 func (s *SessionStore) SaveSession(sessionID string, state *AgentSessionState) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	state.LastUpdated = nowMs()
-	return s.writeSession(sessionID, *state)
+	if err := s.writeSession(sessionID, *state); err != nil {
+		return err
+	}
+	if state.VFS != nil && !s.hasVFS(sessionID) {
+		return s.replaceVFS(sessionID, state.VFS)
+	}
+	return nil
 }
 
 func (s *SessionStore) UpdateSession(sessionID string, updates map[string]any) error {
-	cur, err := s.GetSession(sessionID)
+	cur, err := s.GetSessionDoc(sessionID)
 	if err != nil || cur == nil {
 		return err
 	}
@@ -113,27 +147,53 @@ func (s *SessionStore) UpdateSession(sessionID string, updates map[string]any) e
 		cur.GeminiHistory = h
 	}
 	if vfs, ok := updates["vfs"].(map[string]VfsFile); ok {
-		cur.VFS = vfs
+		s.mu.Lock()
+		err := s.replaceVFS(sessionID, vfs)
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
 	}
 	if chunks, ok := updates["knowledgeChunks"].([]KnowledgeChunk); ok {
 		cur.KnowledgeChunks = chunks
+		defer s.dropIndex(sessionID)
 	}
 	if msgs, ok := updates["uiMessages"].([]any); ok {
 		cur.UIMessages = msgs
 	}
+	if tools, ok := updates["tools"].(*SessionTools); ok {
+		cur.Tools = tools
+	}
 	return s.SaveSession(sessionID, cur)
 }
 
+// UpdateVFS 写入文件：isWriting 为 true 时只更新内存中的写入状态，为 false 时持久化该文件
 func (s *SessionStore) UpdateVFS(sessionID, path, content, language string, isWriting bool) error {
-	cur, err := s.GetSession(sessionID)
-	if err != nil || cur == nil {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.sessionPath(sessionID)); err != nil {
 		return err
 	}
-	if cur.VFS == nil {
-		cur.VFS = make(map[string]VfsFile)
+	f := VfsFile{Path: path, Content: content, Language: language, IsWriting: isWriting, UpdatedAt: nowMs()}
+	if !isWriting {
+		return s.saveFile(sessionID, f)
 	}
-	cur.VFS[path] = VfsFile{Path: path, Content: content, Language: language, IsWriting: isWriting}
-	return s.SaveSession(sessionID, cur)
+	files := s.writing[sessionID]
+	if files == nil {
+		files = map[string]VfsFile{}
+		s.writing[sessionID] = files
+	}
+	_, started := files[path]
+	files[path] = f
+	if started {
+		return nil
+	}
+	// 开始流式写入前补记原内容，写入过程中的中间状态不记录版本
+	prev, existed, err := s.loadFile(sessionID, path)
+	if err != nil || !existed {
+		return err
+	}
+	return s.recordRevisions(sessionID, func(h *vfsHistory) { h.baseline(path, prev, true) })
 }
 
 func (s *SessionStore) ListSessions() ([]SessionMeta, error) {
@@ -149,7 +209,7 @@ func (s *SessionStore) ListSessions() ([]SessionMeta, error) {
 			continue
 		}
 		id := e.Name()[:len(e.Name())-5]
-		state, err := s.readSession(id)
+		state, err := s.readSessionDoc(id)
 		if err != nil || state == nil {
 			continue
 		}
@@ -187,6 +247,16 @@ func (s *SessionStore) DeleteSession(sessionID string) error {
 	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	if err := s.removeVFS(sessionID); err != nil {
+		return err
+	}
+	if err := s.removeHistory(sessionID); err != nil {
+		return err
+	}
+	if err := s.removeDocuments(sessionID); err != nil {
+		return err
+	}
+	s.dropIndex(sessionID)
 	if s.active == sessionID {
 		s.active = ""
 		_ = os.Remove(filepath.Join(s.dir, activeSessionFile))
@@ -204,11 +274,27 @@ func (s *SessionStore) ClearSessionContent(sessionID string) error {
 		KnowledgeChunks: []KnowledgeChunk{},
 		LastUpdated:    nowMs(),
 	}
-	return s.SaveSession(sessionID, &state)
+	// 清空内容但保留会话的工具设置
+	if cur, _ := s.GetSessionDoc(sessionID); cur != nil {
+		state.Tools = cur.Tools
+	}
+	if err := s.SaveSession(sessionID, &state); err != nil {
+		return err
+	}
+	s.dropIndex(sessionID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.replaceVFS(sessionID, state.VFS); err != nil {
+		return err
+	}
+	if err := s.removeDocuments(sessionID); err != nil {
+		return err
+	}
+	return s.removeHistory(sessionID)
 }
 
 func (s *SessionStore) GetKnowledgeChunks(sessionID string) ([]KnowledgeChunk, error) {
-	cur, err := s.GetSession(sessionID)
+	cur, err := s.GetSessionDoc(sessionID)
 	if err != nil || cur == nil {
 		return nil, err
 	}
@@ -216,17 +302,34 @@ func (s *SessionStore) GetKnowledgeChunks(sessionID string) ([]KnowledgeChunk, e
 }
 
 func (s *SessionStore) AppendKnowledgeChunks(sessionID string, chunks []KnowledgeChunk) error {
-	cur, err := s.GetSession(sessionID)
+	cur, err := s.GetSessionDoc(sessionID)
 	if err != nil || cur == nil {
 		return err
 	}
+	prev := len(cur.KnowledgeChunks)
 	cur.KnowledgeChunks = append(cur.KnowledgeChunks, chunks...)
-	return s.SaveSession(sessionID, cur)
+	if err := s.SaveSession(sessionID, cur); err != nil {
+		return err
+	}
+	s.indexAppended(sessionID, prev, chunks)
+	return nil
 }
 
+// readSession 读取会话文档并附上 VFS（含正在写入的文件）
 func (s *SessionStore) readSession(sessionID string) (*AgentSessionState, error) {
-	p := filepath.Join(s.dir, sessionID+".json")
-	data, err := os.ReadFile(p)
+	state, err := s.readSessionDoc(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if state.VFS, err = s.currentVFS(sessionID); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// readSessionDoc 只读取会话文档，不含 VFS
+func (s *SessionStore) readSessionDoc(sessionID string) (*AgentSessionState, error) {
+	data, err := os.ReadFile(s.sessionPath(sessionID))
 	if err != nil {
 		return nil, err
 	}
@@ -234,16 +337,20 @@ func (s *SessionStore) readSession(sessionID string) (*AgentSessionState, error)
 	if err := json.Unmarshal(data, &state); err != nil {
 		return nil, err
 	}
+	state.VFS = nil
 	return &state, nil
 }
 
+// writeSession 写入会话文档，VFS 不写入文档
 func (s *SessionStore) writeSession(sessionID string, state AgentSessionState) error {
-	p := filepath.Join(s.dir, sessionID+".json")
-	data, err := json.MarshalIndent(state, "", "  ")
+	data, err := json.MarshalIndent(struct {
+		*AgentSessionState
+		VFS map[string]VfsFile `json:"vfs,omitempty"`
+	}{AgentSessionState: &state}, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(p, data, 0644)
+	return os.WriteFile(s.sessionPath(sessionID), data, 0644)
 }
 
 func (s *SessionStore) readActive() (string, error) {
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const toolLimitsFile = "tool_limits.json"
+
+// ToolLimitUnlimited 单工具配置中表示「不限制」的取值，覆盖全局默认值
+const ToolLimitUnlimited = -1
+
+// ToolLimits 单个工具的执行限制；0 表示沿用全局默认值，ToolLimitUnlimited 表示不限制
+type ToolLimits struct {
+	TimeoutMs      int `json:"timeoutMs,omitempty"`
+	MaxResultBytes int `json:"maxResultBytes,omitempty"`
+}
+
+type ToolLimitStore struct {
+	mu   sync.RWMutex
+	dir  string
+	data map[string]ToolLimits
+}
+
+func NewToolLimitStore(dir string) (*ToolLimitStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &ToolLimitStore{dir: dir, data: make(map[string]ToolLimits)}
+	_ = s.load()
+	return s, nil
+}
+
+func (s *ToolLimitStore) filePath() string {
+	return filepath.Join(s.dir, toolLimitsFile)
+}
+
+func (s *ToolLimitStore) load() error {
+	data, err := os.ReadFile(s.filePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var parsed map[string]ToolLimits
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	if parsed != nil {
+		s.data = parsed
+	}
+	return nil
+}
+
+func (s *ToolLimitStore) save() error {
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.filePath(), data, 0644)
+}
+
+// Get 返回工具的单独配置，未配置时为零值
+func (s *ToolLimitStore) Get(id string) ToolLimits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data[id]
+}
+
+// Set 保存工具的单独配置；全为 0 时删除该项
+func (s *ToolLimitStore) Set(id string, l ToolLimits) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l == (ToolLimits{}) {
+		delete(s.data, id)
+	} else {
+		s.data[id] = l
+	}
+	return s.save()
+}
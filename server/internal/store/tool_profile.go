@@ -0,0 +1,234 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	ErrToolProfileExists   = errors.New("tool profile name already exists")
+	ErrToolProfileNotFound = errors.New("tool profile not found")
+	ErrToolProfileBound    = errors.New("mode or industry already bound to another tool profile")
+)
+
+const toolProfilesFile = "tool_profiles.json"
+
+// 工具审批策略
+const (
+	ApprovalAuto = "auto" // 直接执行（默认）
+	ApprovalPlan = "plan" // 仅在已批准的计划中执行
+)
+
+// NoToolProfile 会话显式不使用任何工具配置（不按模式/行业自动绑定）
+const NoToolProfile = "none"
+
+// ToolProfile 命名的工具配置：启用的工具集合与审批策略，可绑定到模式或行业
+type ToolProfile struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Tools       []string          `json:"tools,omitempty"`     // 启用的工具；为空表示不限制
+	Approvals   map[string]string `json:"approvals,omitempty"` // 工具 ID -> 审批策略
+	Modes       []string          `json:"modes,omitempty"`
+	Industries  []string          `json:"industries,omitempty"`
+	CreatedAt   int64             `json:"createdAt"`
+	UpdatedAt   int64             `json:"updatedAt"`
+}
+
+func (p ToolProfile) clone() ToolProfile {
+	c := p
+	c.Tools = append([]string(nil), p.Tools...)
+	c.Approvals = cloneStringMap(p.Approvals)
+	c.Modes = append([]string(nil), p.Modes...)
+	c.Industries = append([]string(nil), p.Industries...)
+	return c
+}
+
+// Includes 工具是否在配置的启用集合内
+func (p ToolProfile) Includes(id string) bool {
+	if len(p.Tools) == 0 {
+		return true
+	}
+	for _, t := range p.Tools {
+		if t == id {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionTools 会话级工具设置，叠加在工具配置之上
+type SessionTools struct {
+	Profile   string            `json:"profile,omitempty"`   // 工具配置 ID；空表示按模式/行业绑定，none 表示不使用
+	Enabled   map[string]bool   `json:"enabled,omitempty"`   // 工具 ID -> 是否启用
+	Approvals map[string]string `json:"approvals,omitempty"` // 工具 ID -> 审批策略
+}
+
+type ToolProfileStore struct {
+	mu       sync.RWMutex
+	dir      string
+	profiles []ToolProfile
+}
+
+func NewToolProfileStore(dir string) (*ToolProfileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &ToolProfileStore{dir: dir, profiles: []ToolProfile{}}
+	_ = s.load()
+	return s, nil
+}
+
+func (s *ToolProfileStore) filePath() string {
+	return filepath.Join(s.dir, toolProfilesFile)
+}
+
+func (s *ToolProfileStore) load() error {
+	data, err := os.ReadFile(s.filePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var parsed []ToolProfile
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	if parsed != nil {
+		s.profiles = parsed
+	}
+	return nil
+}
+
+func (s *ToolProfileStore) save() error {
+	data, err := json.MarshalIndent(s.profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.filePath(), data, 0644)
+}
+
+func (s *ToolProfileStore) List() []ToolProfile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]ToolProfile, len(s.profiles))
+	for i, p := range s.profiles {
+		out[i] = p.clone()
+	}
+	return out
+}
+
+func (s *ToolProfileStore) Get(id string) *ToolProfile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.profiles {
+		if p.ID == id {
+			c := p.clone()
+			return &c
+		}
+	}
+	return nil
+}
+
+// Bound 返回绑定到模式的配置，其次是绑定到行业的配置；via 为 mode 或 industry
+func (s *ToolProfileStore) Bound(mode, industry string) (*ToolProfile, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, via := range []string{"mode", "industry"} {
+		for _, p := range s.profiles {
+			keys, want := p.Modes, mode
+			if via == "industry" {
+				keys, want = p.Industries, industry
+			}
+			for _, k := range keys {
+				if want != "" && k == want {
+					c := p.clone()
+					return &c, via
+				}
+			}
+		}
+	}
+	return nil, ""
+}
+
+// Add 新增配置，ID 与时间戳由存储生成；名称不可重复，模式与行业只能绑定到一个配置
+func (s *ToolProfileStore) Add(p ToolProfile) (ToolProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.conflict("", p); err != nil {
+		return ToolProfile{}, err
+	}
+	p.ID = "profile_" + randomID()
+	p.CreatedAt = nowMs()
+	p.UpdatedAt = p.CreatedAt
+	s.profiles = append(s.profiles, p.clone())
+	if err := s.save(); err != nil {
+		return ToolProfile{}, err
+	}
+	return p, nil
+}
+
+// Replace 整体替换指定 ID 的配置，保留创建时间
+func (s *ToolProfileStore) Replace(p ToolProfile) (ToolProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.profiles {
+		if s.profiles[i].ID != p.ID {
+			continue
+		}
+		if err := s.conflict(p.ID, p); err != nil {
+			return ToolProfile{}, err
+		}
+		p.CreatedAt = s.profiles[i].CreatedAt
+		p.UpdatedAt = nowMs()
+		s.profiles[i] = p.clone()
+		if err := s.save(); err != nil {
+			return ToolProfile{}, err
+		}
+		return p, nil
+	}
+	return ToolProfile{}, ErrToolProfileNotFound
+}
+
+func (s *ToolProfileStore) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.profiles {
+		if p.ID == id {
+			s.profiles = append(s.profiles[:i], s.profiles[i+1:]...)
+			return s.save()
+		}
+	}
+	return ErrToolProfileNotFound
+}
+
+// conflict 检查除 skipID 外是否有同名配置或重复绑定，调用方需持有锁
+func (s *ToolProfileStore) conflict(skipID string, p ToolProfile) error {
+	for _, other := range s.profiles {
+		if other.ID == skipID {
+			continue
+		}
+		if other.Name == p.Name {
+			return ErrToolProfileExists
+		}
+		if overlaps(other.Modes, p.Modes) || overlaps(other.Industries, p.Industries) {
+			return ErrToolProfileBound
+		}
+	}
+	return nil
+}
+
+func overlaps(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
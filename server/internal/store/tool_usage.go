@@ -0,0 +1,242 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	toolUsageFile = "tool_usage.jsonl"
+	// maxToolCalls 保留的调用记录条数。内存与文件中的记录都允许增长到两倍后再一次性裁剪、压缩，
+	// 避免每次记录都复制整个切片
+	maxToolCalls = 20000
+	// recentToolCalls GetTool 返回的最近调用条数
+	recentToolCalls = 20
+)
+
+// ToolCall 一次工具执行记录
+type ToolCall struct {
+	Tool        string `json:"tool"`
+	SessionID   string `json:"sessionId,omitempty"`
+	Caller      string `json:"caller,omitempty"` // agent | invoke | mcp
+	StartedAt   int64  `json:"startedAt"`
+	DurationMs  int64  `json:"durationMs"`
+	OK          bool   `json:"ok"`
+	ErrorClass  string `json:"errorClass,omitempty"`
+	Error       string `json:"error,omitempty"`
+	ArgBytes    int    `json:"argBytes"`
+	ResultBytes int    `json:"resultBytes"`
+}
+
+// ToolStats 单个工具的聚合统计（基于保留的调用记录）
+type ToolStats struct {
+	Calls          int            `json:"calls"`
+	Errors         int            `json:"errors"`
+	ErrorRate      float64        `json:"errorRate"`
+	ErrorClasses   map[string]int `json:"errorClasses,omitempty"`
+	P50Ms          int64          `json:"p50Ms"`
+	P95Ms          int64          `json:"p95Ms"`
+	AvgArgBytes    int            `json:"avgArgBytes"`
+	AvgResultBytes int            `json:"avgResultBytes"`
+	LastUsed       int64          `json:"lastUsed,omitempty"`
+	LastError      string         `json:"lastError,omitempty"`
+}
+
+// ToolUsageStore 以 JSONL 追加保存工具调用记录，并在内存中保留最近 maxToolCalls 条用于聚合
+type ToolUsageStore struct {
+	mu    sync.RWMutex
+	dir   string
+	calls []ToolCall // 最多 2*maxToolCalls 条，聚合只取最后 maxToolCalls 条
+	lines int        // 文件中的记录行数
+}
+
+func NewToolUsageStore(dir string) (*ToolUsageStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &ToolUsageStore{dir: dir}
+	_ = s.load()
+	return s, nil
+}
+
+func (s *ToolUsageStore) filePath() string {
+	return filepath.Join(s.dir, toolUsageFile)
+}
+
+func (s *ToolUsageStore) load() error {
+	f, err := os.Open(s.filePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var c ToolCall
+		if json.Unmarshal(sc.Bytes(), &c) != nil || c.Tool == "" {
+			continue
+		}
+		s.lines++
+		s.append(c)
+	}
+	if s.lines > maxToolCalls {
+		return s.compact()
+	}
+	return nil
+}
+
+// append 追加到内存，超过 2*maxToolCalls 条时裁剪到 maxToolCalls 条
+func (s *ToolUsageStore) append(c ToolCall) {
+	s.calls = append(s.calls, c)
+	if len(s.calls) > 2*maxToolCalls {
+		s.calls = append([]ToolCall(nil), s.retained()...)
+	}
+}
+
+// retained 参与聚合的记录：最近 maxToolCalls 条
+func (s *ToolUsageStore) retained() []ToolCall {
+	if len(s.calls) > maxToolCalls {
+		return s.calls[len(s.calls)-maxToolCalls:]
+	}
+	return s.calls
+}
+
+// compact 只保留最近 maxToolCalls 条记录重写文件
+func (s *ToolUsageStore) compact() error {
+	calls := s.retained()
+	tmp := s.filePath() + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, c := range calls {
+		if err := enc.Encode(c); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.filePath()); err != nil {
+		return err
+	}
+	s.lines = len(calls)
+	return nil
+}
+
+// Record 追加一条调用记录；文件超过 2*maxToolCalls 行时压缩
+func (s *ToolUsageStore) Record(c ToolCall) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.append(c)
+	if s.lines >= 2*maxToolCalls {
+		if err := s.compact(); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.filePath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.lines++
+	return nil
+}
+
+// Stats 按工具聚合全部保留的记录
+func (s *ToolUsageStore) Stats() map[string]ToolStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	byTool := map[string][]ToolCall{}
+	for _, c := range s.retained() {
+		byTool[c.Tool] = append(byTool[c.Tool], c)
+	}
+	out := make(map[string]ToolStats, len(byTool))
+	for id, calls := range byTool {
+		out[id] = aggregateToolCalls(calls)
+	}
+	return out
+}
+
+// ToolStats 单个工具的聚合统计与最近的调用记录（新的在前）
+func (s *ToolUsageStore) ToolStats(id string) (ToolStats, []ToolCall) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var calls []ToolCall
+	for _, c := range s.retained() {
+		if c.Tool == id {
+			calls = append(calls, c)
+		}
+	}
+	recent := make([]ToolCall, 0, recentToolCalls)
+	for i := len(calls) - 1; i >= 0 && len(recent) < recentToolCalls; i-- {
+		recent = append(recent, calls[i])
+	}
+	return aggregateToolCalls(calls), recent
+}
+
+func aggregateToolCalls(calls []ToolCall) ToolStats {
+	st := ToolStats{Calls: len(calls)}
+	if len(calls) == 0 {
+		return st
+	}
+	durations := make([]int64, len(calls))
+	var argBytes, resultBytes int
+	for i, c := range calls {
+		durations[i] = c.DurationMs
+		argBytes += c.ArgBytes
+		resultBytes += c.ResultBytes
+		if !c.OK {
+			st.Errors++
+			if st.ErrorClasses == nil {
+				st.ErrorClasses = map[string]int{}
+			}
+			st.ErrorClasses[c.ErrorClass]++
+			st.LastError = c.Error
+		}
+		if c.StartedAt > st.LastUsed {
+			st.LastUsed = c.StartedAt
+		}
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	st.P50Ms = percentile(durations, 0.50)
+	st.P95Ms = percentile(durations, 0.95)
+	st.ErrorRate = float64(st.Errors) / float64(len(calls))
+	st.AvgArgBytes = argBytes / len(calls)
+	st.AvgResultBytes = resultBytes / len(calls)
+	return st
+}
+
+// percentile 最近秩法：sorted 已升序
+func percentile(sorted []int64, p float64) int64 {
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
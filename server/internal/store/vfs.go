@@ -0,0 +1,232 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrVFSInvalidPath   = errors.New("invalid vfs path")
+	ErrVFSNotFound      = errors.New("vfs file not found")
+	ErrVFSExists        = errors.New("vfs file already exists")
+	ErrVFSFileTooLarge  = errors.New("vfs file exceeds size limit")
+	ErrVFSQuotaExceeded = errors.New("vfs session size limit exceeded")
+)
+
+// VFSLimits 单文件与单会话 VFS 的大小上限（字节），0 表示不限制
+type VFSLimits struct {
+	MaxFileBytes  int `json:"maxFileBytes"`
+	MaxTotalBytes int `json:"maxTotalBytes"`
+}
+
+// NormalizeVFSPath 规范化 VFS 路径：统一为 / 分隔的相对路径，拒绝绝对路径、盘符、.. 与控制字符
+func NormalizeVFSPath(p string) (string, error) {
+	p = strings.ReplaceAll(strings.TrimSpace(p), "\\", "/")
+	if p == "" || strings.HasPrefix(p, "/") || (len(p) >= 2 && p[1] == ':') {
+		return "", ErrVFSInvalidPath
+	}
+	for _, r := range p {
+		if unicode.IsControl(r) {
+			return "", ErrVFSInvalidPath
+		}
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return "", ErrVFSInvalidPath
+		}
+	}
+	p = path.Clean(p)
+	if p == "." || strings.HasSuffix(p, "/") {
+		return "", ErrVFSInvalidPath
+	}
+	return p, nil
+}
+
+// VFSTotalBytes 会话 VFS 的内容总字节数
+func VFSTotalBytes(vfs map[string]VfsFile) int {
+	n := 0
+	for _, f := range vfs {
+		n += len(f.Content)
+	}
+	return n
+}
+
+// GetVFS 返回会话的 VFS 文件，包括正在写入的文件
+func (s *SessionStore) GetVFS(sessionID string) (map[string]VfsFile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, err := os.Stat(s.sessionPath(sessionID)); err != nil {
+		return nil, err
+	}
+	return s.currentVFS(sessionID)
+}
+
+// SetVFSLimits 设置经 PutFile、MoveFile 写入时校验的大小上限
+func (s *SessionStore) SetVFSLimits(l VFSLimits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vfsLimits = l
+}
+
+func (s *SessionStore) VFSLimits() VFSLimits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.vfsLimits
+}
+
+// checkVFSLimits 把 p 写为 size 字节后是否超出单文件或会话上限；vfs 为当前全部文件
+func (s *SessionStore) checkVFSLimits(vfs map[string]VfsFile, p string, size int) error {
+	if l := s.vfsLimits.MaxFileBytes; l > 0 && size > l {
+		return ErrVFSFileTooLarge
+	}
+	if l := s.vfsLimits.MaxTotalBytes; l > 0 && VFSTotalBytes(vfs)-len(vfs[p].Content)+size > l {
+		return ErrVFSQuotaExceeded
+	}
+	return nil
+}
+
+// PutFile 创建或覆盖文件并记录版本；路径须已规范化，超出单文件或会话上限时返回错误且不写入
+func (s *SessionStore) PutFile(sessionID, p, content, language string, src RevisionSource) (VfsFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.readSession(sessionID)
+	if err != nil {
+		return VfsFile{}, err
+	}
+	if err := s.checkVFSLimits(state.VFS, p, len(content)); err != nil {
+		return VfsFile{}, err
+	}
+	prev, existed := state.VFS[p]
+	f := VfsFile{Path: p, Content: content, Language: language, UpdatedAt: nowMs()}
+	if err := s.saveFile(sessionID, f); err != nil {
+		return VfsFile{}, err
+	}
+	return f, s.recordRevisions(sessionID, func(h *vfsHistory) {
+		h.baseline(p, prev, existed)
+		h.add(VFSRevision{Path: p, Op: RevisionWrite, Content: content, Language: language, RevisionSource: src})
+	})
+}
+
+// MoveFile 重命名文件；from 不是文件时按目录前缀移动其下所有文件，版本历史随文件迁移。返回移动后的路径（已排序）
+func (s *SessionStore) MoveFile(sessionID, from, to string, overwrite bool, src RevisionSource) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.readSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	moves := map[string]string{}
+	_, isFile := state.VFS[from]
+	if isFile {
+		moves[from] = to
+	} else {
+		for p := range state.VFS {
+			if strings.HasPrefix(p, from+"/") {
+				moves[p] = to + "/" + strings.TrimPrefix(p, from+"/")
+			}
+		}
+	}
+	if len(moves) == 0 {
+		return nil, ErrVFSNotFound
+	}
+	// 目标不能是与源类型不同的已有文件或目录
+	if _, toFile := state.VFS[to]; toFile && !isFile {
+		return nil, ErrVFSExists
+	}
+	if isFile {
+		for p := range state.VFS {
+			if strings.HasPrefix(p, to+"/") {
+				return nil, ErrVFSExists
+			}
+		}
+	}
+	for old, dst := range moves {
+		if _, exists := state.VFS[dst]; exists && !overwrite && moves[dst] == "" && dst != old {
+			return nil, ErrVFSExists
+		}
+	}
+	before := make(map[string]VfsFile, len(state.VFS))
+	for p, f := range state.VFS {
+		before[p] = f
+	}
+	moved := make(map[string]VfsFile, len(moves))
+	for old, dst := range moves {
+		f := state.VFS[old]
+		f.Path, f.UpdatedAt = dst, nowMs()
+		moved[dst] = f
+		delete(state.VFS, old)
+	}
+	out := make([]string, 0, len(moved))
+	for dst, f := range moved {
+		state.VFS[dst] = f
+		out = append(out, dst)
+	}
+	sort.Strings(out)
+	// 覆盖目标可能使总量超限
+	if l := s.vfsLimits.MaxTotalBytes; l > 0 && VFSTotalBytes(state.VFS) > l {
+		return nil, ErrVFSQuotaExceeded
+	}
+	// 先写入全部目标再删除源文件，写入失败时源文件仍在；目录移动到自身上级时某些源同时也是目标，不能删除
+	for _, f := range moved {
+		if err := s.saveFile(sessionID, f); err != nil {
+			return nil, err
+		}
+	}
+	for old := range moves {
+		if _, isDst := moved[old]; isDst {
+			continue
+		}
+		if err := s.removeFile(sessionID, old); err != nil {
+			return nil, err
+		}
+	}
+	return out, s.recordRevisions(sessionID, func(h *vfsHistory) {
+		for old, dst := range moves {
+			h.baseline(old, before[old], true)
+			prev, existed := before[dst]
+			h.baseline(dst, prev, existed)
+			h.rename(old, moved[dst], src)
+		}
+	})
+}
+
+// DeleteFile 删除文件并记录删除版本；p 不是文件时删除该目录下的所有文件。返回删除的路径（已排序）
+func (s *SessionStore) DeleteFile(sessionID, p string, src RevisionSource) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.readSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	if _, ok := state.VFS[p]; ok {
+		removed = []string{p}
+	} else {
+		for fp := range state.VFS {
+			if strings.HasPrefix(fp, p+"/") {
+				removed = append(removed, fp)
+			}
+		}
+	}
+	if len(removed) == 0 {
+		return nil, ErrVFSNotFound
+	}
+	deleted := make(map[string]VfsFile, len(removed))
+	for _, fp := range removed {
+		deleted[fp] = state.VFS[fp]
+		if err := s.removeFile(sessionID, fp); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(removed)
+	return removed, s.recordRevisions(sessionID, func(h *vfsHistory) {
+		for _, fp := range removed {
+			h.baseline(fp, deleted[fp], true)
+			h.add(VFSRevision{Path: fp, Op: RevisionDelete, RevisionSource: src})
+		}
+	})
+}
@@ -0,0 +1,431 @@
+package store
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const vfsHistoryDir = "history"
+
+// 文件版本的操作类型
+const (
+	RevisionWrite   = "write"
+	RevisionDelete  = "delete"
+	RevisionMove    = "move"
+	RevisionRestore = "restore"
+	// RevisionBaseline 开始记录前已存在的内容，在首次修改时补记
+	RevisionBaseline = "baseline"
+)
+
+var ErrVFSRevisionNotFound = errors.New("vfs revision not found")
+
+// RevisionSource 产生版本的来源：Source 为 tool、api、mcp_resource 等；
+// 由工具产生时记录工具名、调用方与所在轮次（助手消息 ID）及函数调用 ID
+type RevisionSource struct {
+	Source string `json:"source"`
+	Tool   string `json:"tool,omitempty"`
+	Caller string `json:"caller,omitempty"`
+	TurnID string `json:"turnId,omitempty"`
+	CallID string `json:"callId,omitempty"`
+}
+
+// VFSRevision 文件的一个版本；Rev 在会话内单调递增。删除记录的内容为空
+type VFSRevision struct {
+	Rev      int    `json:"rev"`
+	Path     string `json:"path"`
+	Op       string `json:"op"`
+	Content  string `json:"content,omitempty"`
+	Language string `json:"language,omitempty"`
+	Size     int    `json:"size"`
+	// From 移动前的路径；RestoredFrom 恢复所依据的版本
+	From         string `json:"from,omitempty"`
+	RestoredFrom int    `json:"restoredFrom,omitempty"`
+	RevisionSource
+	CreatedAt int64 `json:"createdAt"`
+}
+
+// VFSHistoryLimits 版本保留策略：每个文件最多保留的版本数与单会话历史内容总字节数，0 表示不限制。
+// 超出时先删最旧的版本，每个文件的最新版本始终保留
+type VFSHistoryLimits struct {
+	MaxRevisions int `json:"maxRevisions"`
+	MaxBytes     int `json:"maxBytes"`
+}
+
+// 历史与 VFS 一样按文件存储：history/{sessionID}/{sha1(path)}.json 保存该路径的全部版本，
+// index.json 只记录版本号计数与各版本的大小，用于裁剪；记录版本时只改写涉及的文件与索引
+const vfsHistoryIndex = "index.json"
+
+type revisionRef struct {
+	Rev  int `json:"rev"`
+	Size int `json:"size"`
+}
+
+type historyIndex struct {
+	NextRev int                      `json:"nextRev"`
+	Files   map[string][]revisionRef `json:"files"`
+}
+
+// vfsHistory 会话历史：索引常驻，各文件的版本按需读取，修改过的文件在 writeHistory 时写回
+type vfsHistory struct {
+	historyIndex
+	revs  map[string][]VFSRevision
+	dirty map[string]bool
+	read  func(p string) ([]VFSRevision, error)
+	err   error
+}
+
+// SetVFSHistoryLimits 设置版本保留策略，在下次记录版本时生效
+func (s *SessionStore) SetVFSHistoryLimits(l VFSHistoryLimits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.historyLimits = l
+}
+
+func (s *SessionStore) VFSHistoryLimits() VFSHistoryLimits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.historyLimits
+}
+
+// DiscardVFSWrite 丢弃流式写入的中间内容，文件保持写入前的状态（执行超时或取消时使用）
+func (s *SessionStore) DiscardVFSWrite(sessionID, p string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.writing[sessionID], p)
+}
+
+// CommitVFS 写入文件的最终内容并记录版本；流式写入过程中的中间状态仍用 UpdateVFS。
+// 与 PutFile 一样受 VFSLimits 约束，超出时丢弃流式写入的中间内容，文件保持原样
+func (s *SessionStore) CommitVFS(sessionID, p, content, language string, src RevisionSource) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.sessionPath(sessionID)); err != nil {
+		return err
+	}
+	var vfs map[string]VfsFile
+	if s.vfsLimits.MaxTotalBytes > 0 {
+		var err error
+		if vfs, err = s.currentVFS(sessionID); err != nil {
+			return err
+		}
+	}
+	if err := s.checkVFSLimits(vfs, p, len(content)); err != nil {
+		delete(s.writing[sessionID], p)
+		return err
+	}
+	// 流式写入开始时已补记原内容，这里取已持久化的版本即可
+	prev, existed, err := s.loadFile(sessionID, p)
+	if err != nil {
+		return err
+	}
+	if err := s.saveFile(sessionID, VfsFile{Path: p, Content: content, Language: language, UpdatedAt: nowMs()}); err != nil {
+		return err
+	}
+	return s.recordRevisions(sessionID, func(h *vfsHistory) {
+		h.baseline(p, prev, existed)
+		h.add(VFSRevision{Path: p, Op: RevisionWrite, Content: content, Language: language, RevisionSource: src})
+	})
+}
+
+// ListRevisions 返回文件的版本（不含内容），按版本号升序；文件已删除时仍可查询
+func (s *SessionStore) ListRevisions(sessionID, p string) ([]VFSRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, err := s.readHistory(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	all := h.get(p)
+	revs := make([]VFSRevision, len(all))
+	for i, r := range all {
+		r.Content = ""
+		revs[i] = r
+	}
+	return revs, h.err
+}
+
+// HistoryPaths 有版本记录的路径（已排序），包括已删除的文件
+func (s *SessionStore) HistoryPaths(sessionID string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, err := s.readHistory(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(h.Files))
+	for p := range h.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// GetRevision 返回文件的指定版本（含内容）
+func (s *SessionStore) GetRevision(sessionID, p string, rev int) (VFSRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, err := s.readHistory(sessionID)
+	if err != nil {
+		return VFSRevision{}, err
+	}
+	for _, r := range h.get(p) {
+		if r.Rev == rev {
+			return r, nil
+		}
+	}
+	if h.err != nil {
+		return VFSRevision{}, h.err
+	}
+	return VFSRevision{}, ErrVFSRevisionNotFound
+}
+
+// RestoreRevision 把文件恢复为指定版本的内容，并记录一个新的 restore 版本；
+// 恢复到删除记录时删除文件。受 VFSLimits 约束
+func (s *SessionStore) RestoreRevision(sessionID, p string, rev int, src RevisionSource) (VFSRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, err := s.readHistory(sessionID)
+	if err != nil {
+		return VFSRevision{}, err
+	}
+	var target *VFSRevision
+	revs := h.get(p)
+	for i := range revs {
+		if revs[i].Rev == rev {
+			target = &revs[i]
+		}
+	}
+	if h.err != nil {
+		return VFSRevision{}, h.err
+	}
+	if target == nil {
+		return VFSRevision{}, ErrVFSRevisionNotFound
+	}
+	state, err := s.readSession(sessionID)
+	if err != nil {
+		return VFSRevision{}, err
+	}
+	out := VFSRevision{Path: p, Op: RevisionRestore, RestoredFrom: rev, RevisionSource: src}
+	if target.Op == RevisionDelete {
+		out.Op = RevisionDelete
+		err = s.removeFile(sessionID, p)
+	} else {
+		if err := s.checkVFSLimits(state.VFS, p, len(target.Content)); err != nil {
+			return VFSRevision{}, err
+		}
+		out.Content, out.Language = target.Content, target.Language
+		err = s.saveFile(sessionID, VfsFile{Path: p, Content: target.Content, Language: target.Language, UpdatedAt: nowMs()})
+	}
+	if err != nil {
+		return VFSRevision{}, err
+	}
+	out = h.add(out)
+	h.prune(s.historyLimits)
+	if err := s.writeHistory(sessionID, h); err != nil {
+		return VFSRevision{}, err
+	}
+	out.Content = ""
+	return out, nil
+}
+
+// recordRevisions 在持有写锁时调用：读取历史、修改、按保留策略裁剪后写回
+func (s *SessionStore) recordRevisions(sessionID string, fn func(h *vfsHistory)) error {
+	h, err := s.readHistory(sessionID)
+	if err != nil {
+		return err
+	}
+	fn(h)
+	h.prune(s.historyLimits)
+	return s.writeHistory(sessionID, h)
+}
+
+// get 返回路径的版本，首次访问时从磁盘读取
+func (h *vfsHistory) get(p string) []VFSRevision {
+	if revs, ok := h.revs[p]; ok {
+		return revs
+	}
+	var revs []VFSRevision
+	if _, ok := h.Files[p]; ok {
+		var err error
+		if revs, err = h.read(p); err != nil && h.err == nil {
+			h.err = err
+		}
+	}
+	h.revs[p] = revs
+	return revs
+}
+
+// set 替换路径的版本并同步索引，写回时一并持久化
+func (h *vfsHistory) set(p string, revs []VFSRevision) {
+	h.revs[p], h.dirty[p] = revs, true
+	if len(revs) == 0 {
+		delete(h.Files, p)
+		return
+	}
+	refs := make([]revisionRef, len(revs))
+	for i, r := range revs {
+		refs[i] = revisionRef{Rev: r.Rev, Size: r.Size}
+	}
+	h.Files[p] = refs
+}
+
+// baseline 文件在开始记录前已存在时，先补记原内容，使第一次覆盖也可撤销
+func (h *vfsHistory) baseline(p string, prev VfsFile, existed bool) {
+	if existed && len(h.Files[p]) == 0 {
+		h.add(VFSRevision{Path: p, Op: RevisionBaseline, Content: prev.Content, Language: prev.Language})
+	}
+}
+
+// add 追加版本；内容与语言都与上一版本相同的写入不重复记录
+func (h *vfsHistory) add(r VFSRevision) VFSRevision {
+	revs := h.get(r.Path)
+	if n := len(revs); n > 0 && r.Op == RevisionWrite {
+		last := revs[n-1]
+		if last.Op != RevisionDelete && last.Content == r.Content && last.Language == r.Language {
+			return last
+		}
+	}
+	h.NextRev++
+	r.Rev, r.Size, r.CreatedAt = h.NextRev, len(r.Content), nowMs()
+	h.set(r.Path, append(revs, r))
+	return r
+}
+
+// rename 把 from 的历史并入 f.Path（覆盖时保留目标原有的版本），并追加一个 move 版本
+func (h *vfsHistory) rename(from string, f VfsFile, src RevisionSource) {
+	revs := append(append([]VFSRevision(nil), h.get(f.Path)...), h.get(from)...)
+	sort.Slice(revs, func(i, j int) bool { return revs[i].Rev < revs[j].Rev })
+	for i := range revs {
+		revs[i].Path = f.Path
+	}
+	h.set(from, nil)
+	h.set(f.Path, revs)
+	h.add(VFSRevision{Path: f.Path, Op: RevisionMove, From: from, Content: f.Content, Language: f.Language, RevisionSource: src})
+}
+
+// prune 按索引决定删除哪些版本，只读取并改写受影响的文件
+func (h *vfsHistory) prune(l VFSHistoryLimits) {
+	if l.MaxRevisions > 0 {
+		for p, refs := range h.Files {
+			if len(refs) > l.MaxRevisions {
+				revs := h.get(p)
+				h.set(p, append([]VFSRevision(nil), revs[len(revs)-l.MaxRevisions:]...))
+			}
+		}
+	}
+	if l.MaxBytes <= 0 {
+		return
+	}
+	total := 0
+	var candidates []revisionRef
+	owner := map[int]string{}
+	for p, refs := range h.Files {
+		for i, r := range refs {
+			total += r.Size
+			if i < len(refs)-1 {
+				candidates = append(candidates, r)
+				owner[r.Rev] = p
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Rev < candidates[j].Rev })
+	drop := map[int]bool{}
+	affected := map[string]bool{}
+	for _, r := range candidates {
+		if total <= l.MaxBytes {
+			break
+		}
+		drop[r.Rev] = true
+		affected[owner[r.Rev]] = true
+		total -= r.Size
+	}
+	for p := range affected {
+		var kept []VFSRevision
+		for _, r := range h.get(p) {
+			if !drop[r.Rev] {
+				kept = append(kept, r)
+			}
+		}
+		h.set(p, kept)
+	}
+}
+
+func (s *SessionStore) historyDir(sessionID string) string {
+	return filepath.Join(s.dir, vfsHistoryDir, sessionID)
+}
+
+func (s *SessionStore) historyBlobPath(sessionID, p string) string {
+	sum := sha1.Sum([]byte(p))
+	return filepath.Join(s.historyDir(sessionID), hex.EncodeToString(sum[:])+".json")
+}
+
+func (s *SessionStore) readHistory(sessionID string) (*vfsHistory, error) {
+	h := &vfsHistory{
+		historyIndex: historyIndex{Files: map[string][]revisionRef{}},
+		revs:         map[string][]VFSRevision{},
+		dirty:        map[string]bool{},
+		read: func(p string) ([]VFSRevision, error) {
+			var revs []VFSRevision
+			data, err := os.ReadFile(s.historyBlobPath(sessionID, p))
+			if err != nil {
+				return nil, err
+			}
+			return revs, json.Unmarshal(data, &revs)
+		},
+	}
+	data, err := os.ReadFile(filepath.Join(s.historyDir(sessionID), vfsHistoryIndex))
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &h.historyIndex); err != nil {
+		return nil, err
+	}
+	if h.Files == nil {
+		h.Files = map[string][]revisionRef{}
+	}
+	return h, nil
+}
+
+// writeHistory 写回修改过的文件历史与索引；读取文件历史时出错则不写，避免覆盖未能读出的版本
+func (s *SessionStore) writeHistory(sessionID string, h *vfsHistory) error {
+	if h.err != nil {
+		return h.err
+	}
+	if err := os.MkdirAll(s.historyDir(sessionID), 0755); err != nil {
+		return err
+	}
+	for p := range h.dirty {
+		blob := s.historyBlobPath(sessionID, p)
+		if len(h.revs[p]) == 0 {
+			if err := os.Remove(blob); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		data, err := json.Marshal(h.revs[p])
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(blob, data, 0644); err != nil {
+			return err
+		}
+	}
+	h.dirty = map[string]bool{}
+	data, err := json.Marshal(h.historyIndex)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.historyDir(sessionID), vfsHistoryIndex), data, 0644)
+}
+
+func (s *SessionStore) removeHistory(sessionID string) error {
+	return os.RemoveAll(s.historyDir(sessionID))
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// VFS 与会话文档分开存储：每个文件一个 blob（vfs/{sessionID}/{sha1(path)}.json），写入单个文件只改写对应的 blob。
+// write_file 流式写入的中间内容只保存在内存中（SessionStore.writing），写完后才持久化
+const vfsDirName = "vfs"
+
+func (s *SessionStore) sessionPath(sessionID string) string {
+	return filepath.Join(s.dir, sessionID+".json")
+}
+
+func (s *SessionStore) vfsDir(sessionID string) string {
+	return filepath.Join(s.dir, vfsDirName, sessionID)
+}
+
+func (s *SessionStore) blobPath(sessionID, p string) string {
+	sum := sha1.Sum([]byte(p))
+	return filepath.Join(s.vfsDir(sessionID), hex.EncodeToString(sum[:])+".json")
+}
+
+// hasVFS 会话是否已有独立的 VFS 存储（目录存在即可，可以为空）
+func (s *SessionStore) hasVFS(sessionID string) bool {
+	_, err := os.Stat(s.vfsDir(sessionID))
+	return err == nil
+}
+
+// loadVFS 读取已持久化的文件，不含正在写入的内容
+func (s *SessionStore) loadVFS(sessionID string) (map[string]VfsFile, error) {
+	vfs := map[string]VfsFile{}
+	entries, err := os.ReadDir(s.vfsDir(sessionID))
+	if os.IsNotExist(err) {
+		return vfs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.vfsDir(sessionID), e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var f VfsFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, err
+		}
+		vfs[f.Path] = f
+	}
+	return vfs, nil
+}
+
+// loadFile 读取单个已持久化的文件
+func (s *SessionStore) loadFile(sessionID, p string) (VfsFile, bool, error) {
+	data, err := os.ReadFile(s.blobPath(sessionID, p))
+	if os.IsNotExist(err) {
+		return VfsFile{}, false, nil
+	}
+	if err != nil {
+		return VfsFile{}, false, err
+	}
+	var f VfsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return VfsFile{}, false, err
+	}
+	return f, true, nil
+}
+
+// currentVFS 已持久化的文件叠加内存中正在写入的内容
+func (s *SessionStore) currentVFS(sessionID string) (map[string]VfsFile, error) {
+	vfs, err := s.loadVFS(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	for p, f := range s.writing[sessionID] {
+		vfs[p] = f
+	}
+	return vfs, nil
+}
+
+// saveFile 持久化文件并结束其写入状态；调用方须持有写锁
+func (s *SessionStore) saveFile(sessionID string, f VfsFile) error {
+	if err := os.MkdirAll(s.vfsDir(sessionID), 0755); err != nil {
+		return err
+	}
+	f.IsWriting = false
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.blobPath(sessionID, f.Path), data, 0644); err != nil {
+		return err
+	}
+	delete(s.writing[sessionID], f.Path)
+	return nil
+}
+
+// removeFile 删除文件的 blob 与写入状态；调用方须持有写锁
+func (s *SessionStore) removeFile(sessionID, p string) error {
+	delete(s.writing[sessionID], p)
+	if err := os.Remove(s.blobPath(sessionID, p)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// replaceVFS 整体替换会话的文件；调用方须持有写锁
+func (s *SessionStore) replaceVFS(sessionID string, vfs map[string]VfsFile) error {
+	if err := s.removeVFS(sessionID); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.vfsDir(sessionID), 0755); err != nil {
+		return err
+	}
+	for p, f := range vfs {
+		f.Path = p
+		if err := s.saveFile(sessionID, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SessionStore) removeVFS(sessionID string) error {
+	delete(s.writing, sessionID)
+	return os.RemoveAll(s.vfsDir(sessionID))
+}
+
+// migrateVFS 把旧版内嵌在会话 JSON 中的 vfs 拆分为独立存储，并重写不含 vfs 的会话文档
+func (s *SessionStore) migrateVFS() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		id := strings.TrimSuffix(e.Name(), ".json")
+		data, err := os.ReadFile(s.sessionPath(id))
+		if err != nil {
+			return err
+		}
+		var legacy struct {
+			VFS map[string]VfsFile `json:"vfs"`
+		}
+		if json.Unmarshal(data, &legacy) != nil || legacy.VFS == nil {
+			continue
+		}
+		state, err := s.readSessionDoc(id)
+		if err != nil {
+			return err
+		}
+		if !s.hasVFS(id) {
+			if err := s.replaceVFS(id, legacy.VFS); err != nil {
+				return err
+			}
+		}
+		if err := s.writeSession(id, *state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package textdiff
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Conflict 无法应用的 hunk：期望的旧内容与文件中对应位置的实际内容
+type Conflict struct {
+	Hunk     int      `json:"hunk"` // 从 1 开始
+	Header   string   `json:"header"`
+	Line     int      `json:"line"` // 期望的起始行（从 1 开始）
+	Reason   string   `json:"reason"`
+	Expected []string `json:"expected"`
+	Actual   []string `json:"actual"`
+}
+
+type hunk struct {
+	header   string
+	oldStart int // 从 1 开始；0 表示未给出行号
+	oldLines []string
+	newLines []string
+	// oldNoEOL、newNoEOL 旧/新内容的最后一行没有换行（"\ No newline at end of file"）
+	oldNoEOL bool
+	newNoEOL bool
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// ErrEmptyPatch 补丁中没有 hunk
+var ErrEmptyPatch = errors.New("patch has no hunks")
+
+func parsePatch(patch string) ([]hunk, error) {
+	var hunks []hunk
+	var cur *hunk
+	// 部分工具会去掉空上下文行的前导空格：空行在后面还有 hunk 内容时视为空上下文行，hunk 末尾的空行忽略
+	blank := 0
+	// last 上一行的前缀，"\ No newline at end of file" 作用于它
+	var last byte
+	for _, line := range strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n") {
+		if line == "" {
+			blank++
+			continue
+		}
+		if cur != nil && !strings.HasPrefix(line, "@@") {
+			for ; blank > 0; blank-- {
+				cur.oldLines = append(cur.oldLines, "")
+				cur.newLines = append(cur.newLines, "")
+			}
+		}
+		blank = 0
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			h := hunk{header: line}
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				h.oldStart, _ = strconv.Atoi(m[1])
+			}
+			hunks = append(hunks, h)
+			cur = &hunks[len(hunks)-1]
+		case cur == nil:
+			// 文件头（---/+++、diff --git 等）
+		case strings.HasPrefix(line, "\\"):
+			cur.oldNoEOL = cur.oldNoEOL || last == '-' || last == ' '
+			cur.newNoEOL = cur.newNoEOL || last == '+' || last == ' '
+		case strings.HasPrefix(line, "+"):
+			cur.newLines = append(cur.newLines, line[1:])
+		case strings.HasPrefix(line, "-"):
+			cur.oldLines = append(cur.oldLines, line[1:])
+		case strings.HasPrefix(line, " "):
+			cur.oldLines = append(cur.oldLines, line[1:])
+			cur.newLines = append(cur.newLines, line[1:])
+		default:
+			return nil, fmt.Errorf("unexpected patch line: %q", line)
+		}
+		if cur != nil && line[0] != '\\' {
+			last = line[0]
+		}
+	}
+	if len(hunks) == 0 {
+		return nil, ErrEmptyPatch
+	}
+	return hunks, nil
+}
+
+// Apply 把 unified diff 应用到 content。hunk 优先按行号（加上前面 hunk 实际位置与行号的偏差）定位，
+// 不匹配时在文件中就近搜索旧内容；任何 hunk 无法定位时不做修改并返回全部冲突。
+// 到达文件末尾的 hunk 带有 "\ No newline at end of file" 时按它决定结果末尾是否换行
+func Apply(content, patch string) (string, []Conflict, error) {
+	hunks, err := parsePatch(patch)
+	if err != nil {
+		return "", nil, err
+	}
+	lines := Lines(content)
+	trailing := content == "" || strings.HasSuffix(content, "\n")
+	type placed struct {
+		at int
+		h  hunk
+	}
+	var plan []placed
+	var conflicts []Conflict
+	delta, floor := 0, 0
+	for i, h := range hunks {
+		// 纯插入（旧行数为 0）时行号指插入位置之前的行
+		nominal := h.oldStart - 1
+		if len(h.oldLines) == 0 {
+			nominal = h.oldStart
+		}
+		want := nominal + delta
+		if h.oldStart == 0 {
+			want = floor
+		}
+		at := locate(lines, h.oldLines, want, floor)
+		if at < 0 {
+			c := Conflict{Hunk: i + 1, Header: h.header, Line: want + 1, Expected: h.oldLines, Reason: "上下文与文件内容不一致"}
+			if want >= 0 && want < len(lines) {
+				c.Actual = lines[want:min(len(lines), want+max(len(h.oldLines), 1))]
+			} else {
+				c.Reason = "行号超出文件范围"
+			}
+			conflicts = append(conflicts, c)
+			continue
+		}
+		plan = append(plan, placed{at, h})
+		// 行号都是旧文件中的行号，偏差只来自实际位置与行号不一致（文件在补丁生成后被改动）
+		if h.oldStart > 0 {
+			delta = at - nominal
+		}
+		floor = at + len(h.oldLines)
+		if floor == len(lines) && (h.oldNoEOL || h.newNoEOL) {
+			trailing = !h.newNoEOL
+		}
+	}
+	if len(conflicts) > 0 {
+		return "", conflicts, nil
+	}
+	var out []string
+	prev := 0
+	for _, p := range plan {
+		out = append(out, lines[prev:p.at]...)
+		out = append(out, p.h.newLines...)
+		prev = p.at + len(p.h.oldLines)
+	}
+	out = append(out, lines[prev:]...)
+	return Join(out, trailing), nil, nil
+}
+
+// locate 返回 old 在 lines 中不早于 floor 的位置：先试 want，再向两侧就近搜索
+func locate(lines, old []string, want, floor int) int {
+	if len(old) == 0 {
+		if want >= floor && want <= len(lines) {
+			return want
+		}
+		return -1
+	}
+	matches := func(at int) bool {
+		if at < floor || at+len(old) > len(lines) {
+			return false
+		}
+		for k, s := range old {
+			if lines[at+k] != s {
+				return false
+			}
+		}
+		return true
+	}
+	for d := 0; d <= len(lines); d++ {
+		if matches(want - d) {
+			return want - d
+		}
+		if d > 0 && matches(want+d) {
+			return want + d
+		}
+	}
+	return -1
+}
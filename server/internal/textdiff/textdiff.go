@@ -0,0 +1,217 @@
+// Package textdiff 按行比较文本、生成与应用 unified diff
+package textdiff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxLCSCells 逐行 LCS 的规模上限，超出时把去掉公共首尾后的中段整体视为替换
+const maxLCSCells = 4 << 20
+
+// Lines 按 \n 切分，末尾换行不产生空行
+func Lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Join 与 Lines 相反；trailingNewline 决定末尾是否带换行
+func Join(lines []string, trailingNewline bool) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	s := strings.Join(lines, "\n")
+	if trailingNewline {
+		s += "\n"
+	}
+	return s
+}
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+type op struct {
+	kind opKind
+	text string
+	a, b int // 该行在旧/新文本中的下标
+}
+
+// Stats 新增与删除的行数
+func Stats(a, b string) (added, removed int) {
+	for _, o := range diffLines(Lines(a), Lines(b)) {
+		switch o.kind {
+		case opInsert:
+			added++
+		case opDelete:
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// noEOL 标记末尾没有换行的最后一行，使它与带换行的同内容行不相等；正常行不含 \n
+const noEOL = "\n"
+
+// eolLines 与 Lines 相同，但末尾没有换行时最后一行带 noEOL 标记
+func eolLines(s string) []string {
+	lines := Lines(s)
+	if len(lines) > 0 && !strings.HasSuffix(s, "\n") {
+		lines[len(lines)-1] += noEOL
+	}
+	return lines
+}
+
+// Unified 生成 unified diff，context 为每个 hunk 前后的上下文行数；无差异时返回空串。
+// 最后一行没有换行时在其后输出 "\ No newline at end of file"
+func Unified(oldName, newName, a, b string, context int) string {
+	ops := diffLines(eolLines(a), eolLines(b))
+	var out strings.Builder
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+		// 从第一处改动向前取 context 行，向后合并间隔不超过 2*context 的改动
+		start := max(0, i-context)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == opEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end = min(len(ops), end+context)
+				break
+			}
+			end = run
+		}
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		writeHunk(&out, ops[start:end])
+		i = end
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []op) {
+	aStart, bStart, aLen, bLen := -1, -1, 0, 0
+	for _, o := range ops {
+		if o.kind != opInsert {
+			if aStart < 0 {
+				aStart = o.a
+			}
+			aLen++
+		}
+		if o.kind != opDelete {
+			if bStart < 0 {
+				bStart = o.b
+			}
+			bLen++
+		}
+	}
+	// 空范围按惯例记为插入/删除位置之前的行号
+	if aStart < 0 {
+		aStart = ops[0].a - 1
+	}
+	if bStart < 0 {
+		bStart = ops[0].b - 1
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+	for _, o := range ops {
+		out.WriteByte(byte(o.kind))
+		out.WriteString(strings.TrimSuffix(o.text, noEOL))
+		out.WriteByte('\n')
+		if strings.HasSuffix(o.text, noEOL) {
+			out.WriteString("\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(start, n int) string {
+	if n == 1 {
+		return strconv.Itoa(start + 1)
+	}
+	return strconv.Itoa(start+1) + "," + strconv.Itoa(n)
+}
+
+// diffLines 先去掉公共首尾，再对中段做 LCS；a、b 下标在插入/删除行上分别记录相邻位置
+func diffLines(a, b []string) []op {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	var ops []op
+	for i := 0; i < pre; i++ {
+		ops = append(ops, op{opEqual, a[i], i, i})
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if len(ma)*len(mb) > maxLCSCells {
+		for i, s := range ma {
+			ops = append(ops, op{opDelete, s, pre + i, pre})
+		}
+		for j, s := range mb {
+			ops = append(ops, op{opInsert, s, pre + len(ma), pre + j})
+		}
+	} else {
+		ops = append(ops, lcsOps(ma, mb, pre)...)
+	}
+	for k := 0; k < suf; k++ {
+		ops = append(ops, op{opEqual, a[len(a)-suf+k], len(a) - suf + k, len(b) - suf + k})
+	}
+	return ops
+}
+
+func lcsOps(a, b []string, offset int) []op {
+	n, m := len(a), len(b)
+	dp := make([][]int32, n+1)
+	for i := range dp {
+		dp[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			ops = append(ops, op{opEqual, a[i], offset + i, offset + j})
+			i++
+			j++
+		case i < n && (j == m || dp[i+1][j] >= dp[i][j+1]):
+			ops = append(ops, op{opDelete, a[i], offset + i, offset + j})
+			i++
+		default:
+			ops = append(ops, op{opInsert, b[j], offset + i, offset + j})
+			j++
+		}
+	}
+	return ops
+}
@@ -0,0 +1,124 @@
+// Package toolset 按「全局启用状态 → 工具配置 → 会话覆盖」三层计算会话实际可用的工具与审批策略
+package toolset
+
+import (
+	"sort"
+
+	"agentic-demo/server/internal/store"
+)
+
+// 决定工具可用性的层
+const (
+	LayerDefault = "default"
+	LayerGlobal  = "global"
+	LayerProfile = "profile"
+	LayerSession = "session"
+)
+
+// Input 计算所需的各层数据；Global、Profiles、Session 均可为空
+type Input struct {
+	IDs      []string
+	Global   func(id string) bool
+	Profiles *store.ToolProfileStore
+	Session  *store.SessionTools
+	Mode     string
+	Industry string
+}
+
+// Tool 单个工具的计算结果：是否可用、由哪一层决定及原因
+type Tool struct {
+	ID        string `json:"id"`
+	Available bool   `json:"available"`
+	Layer     string `json:"layer"`
+	Reason    string `json:"reason"`
+	Approval  string `json:"approval"`
+	// ApprovalLayer 审批策略来自哪一层（default、profile、session）
+	ApprovalLayer string `json:"approvalLayer"`
+}
+
+type Result struct {
+	Profile *store.ToolProfile `json:"profile,omitempty"`
+	// ProfileVia 配置的来源：session（会话指定）、mode、industry；为空表示未使用配置
+	ProfileVia string `json:"profileVia,omitempty"`
+	Tools      []Tool `json:"tools"`
+	byID       map[string]int
+}
+
+// Resolve 计算每个工具的可用性。全局禁用是硬开关，会话无法重新启用；
+// 配置列出工具时未列出的工具不可用，会话的 enabled 覆盖配置的结果
+func Resolve(in Input) *Result {
+	res := &Result{Tools: make([]Tool, 0, len(in.IDs)), byID: make(map[string]int, len(in.IDs))}
+	res.Profile, res.ProfileVia = selectProfile(in)
+
+	ids := append([]string(nil), in.IDs...)
+	sort.Strings(ids)
+	for _, id := range ids {
+		t := Tool{ID: id, Available: true, Layer: LayerDefault, Reason: "默认启用", Approval: store.ApprovalAuto, ApprovalLayer: LayerDefault}
+		if p := res.Profile; p != nil {
+			if a := p.Approvals[id]; a != "" {
+				t.Approval, t.ApprovalLayer = a, LayerProfile
+			}
+		}
+		if s := in.Session; s != nil {
+			if a := s.Approvals[id]; a != "" {
+				t.Approval, t.ApprovalLayer = a, LayerSession
+			}
+		}
+
+		switch {
+		case in.Global != nil && !in.Global(id):
+			t.Available, t.Layer, t.Reason = false, LayerGlobal, "已全局禁用"
+		case in.Session != nil && hasKey(in.Session.Enabled, id):
+			t.Available, t.Layer = in.Session.Enabled[id], LayerSession
+			t.Reason = "会话设置为禁用"
+			if t.Available {
+				t.Reason = "会话设置为启用"
+			}
+		case res.Profile != nil && len(res.Profile.Tools) > 0:
+			t.Available, t.Layer = res.Profile.Includes(id), LayerProfile
+			t.Reason = "不在工具配置「" + res.Profile.Name + "」中"
+			if t.Available {
+				t.Reason = "工具配置「" + res.Profile.Name + "」启用"
+			}
+		}
+		res.byID[id] = len(res.Tools)
+		res.Tools = append(res.Tools, t)
+	}
+	return res
+}
+
+// selectProfile 会话指定的配置优先，其次按模式、行业绑定
+func selectProfile(in Input) (*store.ToolProfile, string) {
+	if in.Profiles == nil {
+		return nil, ""
+	}
+	if in.Session != nil && in.Session.Profile != "" {
+		if in.Session.Profile == store.NoToolProfile {
+			return nil, ""
+		}
+		if p := in.Profiles.Get(in.Session.Profile); p != nil {
+			return p, "session"
+		}
+	}
+	return in.Profiles.Bound(in.Mode, in.Industry)
+}
+
+func hasKey(m map[string]bool, k string) bool {
+	_, ok := m[k]
+	return ok
+}
+
+// Lookup 返回工具的计算结果；不在输入 IDs 中的工具返回 false
+func (r *Result) Lookup(id string) (Tool, bool) {
+	i, ok := r.byID[id]
+	if !ok {
+		return Tool{}, false
+	}
+	return r.Tools[i], true
+}
+
+// Available 工具是否可用，供 registry.GetDefinitionsEnabled 过滤
+func (r *Result) Available(id string) bool {
+	t, ok := r.Lookup(id)
+	return ok && t.Available
+}
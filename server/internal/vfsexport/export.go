@@ -0,0 +1,297 @@
+// Package vfsexport 把会话 VFS 导出到磁盘目录，可选初始化 git 仓库并提交快照
+package vfsexport
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"agentic-demo/server/internal/store"
+)
+
+// 与磁盘上已有文件冲突时的处理方式
+const (
+	// ConflictFail 有冲突时不写入任何文件（默认）
+	ConflictFail      = "fail"
+	ConflictOverwrite = "overwrite"
+	// ConflictSkip 保留磁盘上的版本，其余文件照常导出
+	ConflictSkip = "skip"
+)
+
+// 冲突原因
+const (
+	ReasonModified  = "modified"  // 上次导出后在磁盘上被修改
+	ReasonUntracked = "untracked" // 已存在且不是导出写入的文件
+	ReasonNotFile   = "not_file"  // 目标位置是目录等非普通文件，任何策略下都不覆盖
+)
+
+// manifestDir 导出根目录下记录每个导出目录上次写入的文件哈希，不进入导出目录与 git
+const manifestDir = ".vfs-export"
+
+// DefaultGitignore gitignore 传 true 时写入的内容
+const DefaultGitignore = "node_modules/\ndist/\nbuild/\n__pycache__/\n*.pyc\n.env\n.DS_Store\n"
+
+var (
+	ErrConflict       = errors.New("export conflicts with files on disk")
+	ErrInvalidDir     = errors.New("invalid export directory")
+	ErrGitUnavailable = errors.New("git executable not found")
+)
+
+type Options struct {
+	// Root 导出根目录；Dir 为其下的目标目录，须为已规范化的相对路径
+	Root       string
+	Dir        string
+	Files      map[string]store.VfsFile
+	OnConflict string
+	// Gitignore 非空且 VFS 中没有 .gitignore 时写入
+	Gitignore string
+	// Git 为 true 时在目标目录初始化仓库（如不存在）并提交，Message 为提交说明
+	Git     bool
+	Message string
+}
+
+type Conflict struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+type Commit struct {
+	Hash    string `json:"hash"`
+	Message string `json:"message"`
+}
+
+type Result struct {
+	Dir       string     `json:"dir"`
+	Written   []string   `json:"written"`
+	Unchanged int        `json:"unchanged"`
+	Deleted   []string   `json:"deleted"`
+	Skipped   []string   `json:"skipped,omitempty"`
+	Conflicts []Conflict `json:"conflicts,omitempty"`
+	// Commit 为 nil 表示未启用 git 或与上次提交相比没有变化
+	Commit *Commit `json:"commit,omitempty"`
+}
+
+// inGitDir 路径中是否有 .git 段（不区分大小写）。写入 .git 可改动仓库配置（如 core.fsmonitor），
+// 之后对该目录执行 git 命令时会运行任意命令
+func inGitDir(p string) bool {
+	for _, seg := range strings.Split(p, "/") {
+		if strings.EqualFold(seg, ".git") {
+			return true
+		}
+	}
+	return false
+}
+
+// Export 把 Files 写入 Root/Dir。上次导出后未被改动的文件会被更新或删除（VFS 中已不存在时），
+// 因此重复导出得到与 VFS 一致的目录；有冲突且策略为 fail 时返回 ErrConflict 与冲突列表，不做任何修改
+func Export(ctx context.Context, opts Options) (*Result, error) {
+	if opts.Dir == "" || strings.SplitN(opts.Dir, "/", 2)[0] == manifestDir || inGitDir(opts.Dir) {
+		return nil, ErrInvalidDir
+	}
+	if opts.Git {
+		if _, err := lookGit(); err != nil {
+			return nil, err
+		}
+	}
+	target := filepath.Join(opts.Root, filepath.FromSlash(opts.Dir))
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return nil, err
+	}
+	if !within(opts.Root, target) {
+		return nil, ErrInvalidDir
+	}
+	manifestPath := filepath.Join(opts.Root, manifestDir, filepath.FromSlash(opts.Dir)+".json")
+	manifest := readManifest(manifestPath)
+
+	res := &Result{Dir: target, Written: []string{}, Deleted: []string{}}
+	files := map[string]string{}
+	for p, f := range opts.Files {
+		// 旧数据可能含未规范化的路径；任何层级 .git 下的内容都不导出
+		if np, err := store.NormalizeVFSPath(p); err != nil || np != p || inGitDir(p) {
+			res.Skipped = append(res.Skipped, p)
+			continue
+		}
+		files[p] = f.Content
+	}
+	if _, ok := files[".gitignore"]; !ok && opts.Gitignore != "" {
+		files[".gitignore"] = opts.Gitignore
+	}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	next := map[string]string{}
+	var writes []string
+	for _, p := range paths {
+		sum := hash(files[p])
+		st, err := os.Lstat(filepath.Join(target, filepath.FromSlash(p)))
+		switch {
+		case os.IsNotExist(err):
+			writes = append(writes, p)
+			next[p] = sum
+			continue
+		case err != nil:
+			return nil, err
+		case !st.Mode().IsRegular():
+			res.Conflicts = append(res.Conflicts, Conflict{p, ReasonNotFile})
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(p)))
+		if err != nil {
+			return nil, err
+		}
+		onDisk := hash(string(data))
+		switch {
+		case onDisk == sum:
+			res.Unchanged++
+			next[p] = sum
+		case manifest[p] == onDisk:
+			writes = append(writes, p)
+			next[p] = sum
+		default:
+			reason := ReasonUntracked
+			if manifest[p] != "" {
+				reason = ReasonModified
+			}
+			res.Conflicts = append(res.Conflicts, Conflict{p, reason})
+			if opts.OnConflict == ConflictOverwrite {
+				writes = append(writes, p)
+				next[p] = sum
+			} else if manifest[p] != "" {
+				next[p] = manifest[p]
+			}
+		}
+	}
+	// VFS 中已删除的文件：磁盘上未改动时一并删除，改动过的视为冲突
+	var deletes []string
+	for p, sum := range manifest {
+		if _, ok := files[p]; ok {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(p)))
+		if err != nil {
+			continue
+		}
+		modified := hash(string(data)) != sum
+		if modified {
+			res.Conflicts = append(res.Conflicts, Conflict{p, ReasonModified})
+		}
+		if !modified || opts.OnConflict == ConflictOverwrite {
+			deletes = append(deletes, p)
+		} else {
+			next[p] = sum
+		}
+	}
+	sort.Strings(deletes)
+	if len(res.Conflicts) > 0 && opts.OnConflict != ConflictOverwrite && opts.OnConflict != ConflictSkip {
+		return res, ErrConflict
+	}
+	for _, c := range res.Conflicts {
+		if c.Reason == ReasonNotFile || opts.OnConflict == ConflictSkip {
+			res.Skipped = append(res.Skipped, c.Path)
+		}
+	}
+
+	for _, p := range writes {
+		full := filepath.Join(target, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			return nil, err
+		}
+		// 目录中已有的符号链接不能把写入带出导出目录
+		if !within(target, filepath.Dir(full)) {
+			res.Skipped = append(res.Skipped, p)
+			delete(next, p)
+			continue
+		}
+		if err := os.WriteFile(full, []byte(files[p]), 0644); err != nil {
+			return nil, err
+		}
+		res.Written = append(res.Written, p)
+	}
+	for _, p := range deletes {
+		full := filepath.Join(target, filepath.FromSlash(p))
+		if !within(target, filepath.Dir(full)) {
+			continue
+		}
+		if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		removeEmptyParents(target, filepath.Dir(full))
+		res.Deleted = append(res.Deleted, p)
+	}
+	sort.Strings(res.Skipped)
+	if err := writeManifest(manifestPath, next); err != nil {
+		return nil, err
+	}
+
+	if opts.Git {
+		commit, err := commitSnapshot(ctx, target, opts.Message)
+		if err != nil {
+			return nil, err
+		}
+		res.Commit = commit
+	}
+	return res, nil
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func readManifest(p string) map[string]string {
+	m := map[string]string{}
+	if data, err := os.ReadFile(p); err == nil {
+		_ = json.Unmarshal(data, &m)
+	}
+	return m
+}
+
+func writeManifest(p string, m map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+// removeEmptyParents 删除文件后清理变空的上级目录，止于导出目录
+func removeEmptyParents(root, dir string) {
+	for dir != root && within(root, dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// within 判断 path 是否位于 root 内（解析符号链接后比较）
+func within(root, path string) bool {
+	r, err := filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+	p, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if real, err := filepath.EvalSymlinks(r); err == nil {
+		r = real
+	}
+	if real, err := filepath.EvalSymlinks(p); err == nil {
+		p = real
+	}
+	rel, err := filepath.Rel(r, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
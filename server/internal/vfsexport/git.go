@@ -0,0 +1,74 @@
+package vfsexport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// 仓库未配置提交者时使用的身份
+const (
+	gitUserName  = "Agentic Demo"
+	gitUserEmail = "agent@localhost"
+)
+
+func lookGit() (string, error) {
+	p, err := exec.LookPath("git")
+	if err != nil {
+		return "", ErrGitUnavailable
+	}
+	return p, nil
+}
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		sub := args[0]
+		for i := 0; i+2 < len(args) && args[i] == "-c"; i += 2 {
+			sub = args[i+2]
+		}
+		return "", fmt.Errorf("git %s: %w: %s", sub, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// commitSnapshot 在 dir 初始化仓库（如不存在）并提交全部改动；没有改动时返回 nil
+func commitSnapshot(ctx context.Context, dir, message string) (*Commit, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if _, err := runGit(ctx, dir, "init", "-q"); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := runGit(ctx, dir, "add", "-A"); err != nil {
+		return nil, err
+	}
+	status, err := runGit(ctx, dir, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	if status == "" {
+		return nil, nil
+	}
+	if message == "" {
+		message = "Export generated files"
+	}
+	args := []string{"commit", "-q", "-m", message}
+	// git config 在未设置时以非零状态退出
+	if email, _ := runGit(ctx, dir, "config", "user.email"); email == "" {
+		args = append([]string{"-c", "user.name=" + gitUserName, "-c", "user.email=" + gitUserEmail}, args...)
+	}
+	if _, err := runGit(ctx, dir, args...); err != nil {
+		return nil, err
+	}
+	hash, err := runGit(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return &Commit{Hash: hash, Message: message}, nil
+}
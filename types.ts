@@ -76,6 +76,8 @@ export enum AgentMode {
   DEEP_SEARCH = '深度检索'
 }
 
+export type ToolErrorClass = 'invalid_args' | 'timeout' | 'upstream_error' | 'permission_denied' | 'not_found' | 'internal_error';
+
 export interface ThinkingStep {
   id: string;
   agentId: string;
@@ -83,6 +85,7 @@ export interface ThinkingStep {
   content: string;
   details?: string;
   status: 'pending' | 'active' | 'completed' | 'failed';
+  errorClass?: ToolErrorClass; // 失败步骤的错误分类（由后端工具执行给出）
   timestamp: number;
   group?: string; // Used for grouping parallel tasks
   fileLink?: string; // Optional link to a VFS file (deprecated, use fileLinks)